@@ -0,0 +1,593 @@
+// archive.go - Implementation of our zip and tar primitives.
+//
+// Archives may be listed, extracted into a directory, and created from
+// a list of paths.  Directories are added recursively, and each path is
+// stored beneath its final element, so archiving "/var/log/app" creates
+// entries named "app/...".
+//
+// Tar archives are compressed with gzip when created with a name ending
+// in ".gz", or ".tgz", and compressed archives are detected when reading.
+//
+// Extraction refuses to write anything outside the target directory,
+// so a hostile archive cannot overwrite arbitrary files.
+
+package builtins
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/skx/yal/env"
+	"github.com/skx/yal/primitive"
+)
+
+// archiveFile is a file, on disk, which is to be added to an archive.
+type archiveFile struct {
+
+	// path is the location of the file on disk.
+	path string
+
+	// name is the slash-separated name within the archive.
+	name string
+
+	// info describes the file, which isn't followed if it is a
+	// symlink.
+	info fs.FileInfo
+
+	// link is the target of a symlink.
+	link string
+}
+
+// archiveEntry is an entry read from an archive.
+type archiveEntry struct {
+	name     string
+	mode     fs.FileMode
+	size     int64
+	modified time.Time
+
+	// link is the target of a symlink.
+	link string
+
+	// hardlink is the name of an earlier entry which this one
+	// is a hard link to.
+	hardlink string
+
+	// open returns the contents of a regular file.
+	open func() (io.ReadCloser, error)
+}
+
+// archiveReader iterates over the entries of an archive, invoking the
+// given function for each.
+type archiveReader func(archive string, fn func(e *archiveEntry) error) error
+
+// archiveWriter writes the given files to an archive.
+type archiveWriter func(w io.Writer, archive string, files []archiveFile) error
+
+// archiveFiles returns the files beneath the given paths, skipping
+// the archive which is being created.
+func archiveFiles(paths []string, skip fs.FileInfo) ([]archiveFile, error) {
+
+	var files []archiveFile
+
+	for _, root := range paths {
+
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+
+		base := filepath.Base(abs)
+		if base == string(filepath.Separator) || base == "." {
+			return nil, fmt.Errorf("cannot determine a name for %s", root)
+		}
+
+		err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if skip != nil && os.SameFile(info, skip) {
+				return nil
+			}
+
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+
+			f := archiveFile{
+				path: p,
+				name: path.Join(base, filepath.ToSlash(rel)),
+				info: info,
+			}
+
+			if info.Mode()&fs.ModeSymlink != 0 {
+				f.link, err = os.Readlink(p)
+				if err != nil {
+					return err
+				}
+			}
+
+			files = append(files, f)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// archiveEntryHash describes the given entry.
+func archiveEntryHash(e *archiveEntry) primitive.Hash {
+	h := primitive.NewHash()
+	h.Set(":name", primitive.String(e.name))
+	h.Set(":size", primitive.Number(e.size))
+	h.Set(":mode", primitive.String(e.mode.String()))
+	h.Set(":directory", primitive.Bool(e.mode.IsDir()))
+	h.Set(":modified", primitive.Time(e.modified))
+	return h
+}
+
+// archiveTarget returns the path to which the given entry should be
+// extracted, which must be within the directory.
+func archiveTarget(dir string, name string) (string, error) {
+
+	target := filepath.Join(dir, filepath.FromSlash(name))
+
+	rel, err := filepath.Rel(dir, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("entry %s would be extracted outside %s", name, dir)
+	}
+
+	// A symlink extracted earlier might point anywhere, so we don't
+	// write beneath one.
+	parent := dir
+	parts := strings.Split(rel, string(filepath.Separator))
+	for _, part := range parts[:len(parts)-1] {
+		parent = filepath.Join(parent, part)
+		info, err := os.Lstat(parent)
+		if err == nil && info.Mode()&fs.ModeSymlink != 0 {
+			return "", fmt.Errorf("entry %s would be extracted beneath the symlink %s", name, parent)
+		}
+	}
+	return target, nil
+}
+
+// archiveExtractEntry extracts a single entry into the given directory,
+// returning the path it was written to.
+func archiveExtractEntry(dir string, e *archiveEntry) (string, error) {
+
+	target, err := archiveTarget(dir, e.name)
+	if err != nil {
+		return "", err
+	}
+
+	// An existing symlink is replaced, rather than followed.
+	info, err := os.Lstat(target)
+	if err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		if err = os.Remove(target); err != nil {
+			return "", err
+		}
+	}
+
+	switch {
+	case e.mode.IsDir():
+		return target, os.MkdirAll(target, 0755)
+
+	case e.mode&fs.ModeSymlink != 0:
+		if filepath.IsAbs(e.link) {
+			return "", fmt.Errorf("symlink %s has an absolute target %s", e.name, e.link)
+		}
+		_, err = archiveTarget(dir, path.Join(path.Dir(e.name), filepath.ToSlash(e.link)))
+		if err != nil {
+			return "", fmt.Errorf("symlink %s points outside %s", e.name, dir)
+		}
+		if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return "", err
+		}
+		return target, os.Symlink(e.link, target)
+
+	case e.hardlink != "":
+		src, err := archiveTarget(dir, e.hardlink)
+		if err != nil {
+			return "", err
+		}
+		if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return "", err
+		}
+		return target, os.Link(src, target)
+
+	case e.mode.IsRegular():
+		if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return "", err
+		}
+
+		in, err := e.open()
+		if err != nil {
+			return "", err
+		}
+		defer in.Close()
+
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, e.mode.Perm()|0600)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(out, in)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return "", err
+		}
+		return target, os.Chtimes(target, e.modified, e.modified)
+	}
+
+	// Devices, and other special files, are ignored.
+	return "", nil
+}
+
+// archiveCreate implements the creation of an archive.
+func archiveCreate(args []primitive.Primitive, writer archiveWriter) primitive.Primitive {
+
+	// We need two arguments
+	if len(args) != 2 {
+		return primitive.ArityError()
+	}
+
+	archive, ok := args[0].(primitive.String)
+	if !ok {
+		return primitive.Error("argument not a string")
+	}
+
+	lst, ok := args[1].(primitive.List)
+	if !ok {
+		return primitive.Error("argument not a list")
+	}
+
+	var paths []string
+	for _, p := range lst {
+		str, ok := p.(primitive.String)
+		if !ok {
+			return primitive.Error("path not a string")
+		}
+		paths = append(paths, string(str))
+	}
+
+	// We don't want to archive the archive, if it already exists
+	self, _ := os.Stat(string(archive))
+
+	// Find all the files first, so that a bogus path doesn't
+	// affect any existing archive.
+	files, err := archiveFiles(paths, self)
+	if err != nil {
+		return primitive.Error(fmt.Sprintf("failed to create archive %s:%s", archive, err))
+	}
+
+	// The archive is written to a temporary file, which replaces
+	// the archive only once it is complete.
+	out, err := os.CreateTemp(filepath.Dir(string(archive)), "."+filepath.Base(string(archive))+".*")
+	if err != nil {
+		return primitive.Error(fmt.Sprintf("failed to create archive %s:%s", archive, err))
+	}
+
+	err = writer(out, string(archive), files)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	// A temporary file is only readable by us, so use the mode of
+	// the archive we're replacing, or that which os.Create would.
+	mode := fs.FileMode(0644)
+	if self != nil {
+		mode = self.Mode().Perm()
+	}
+	if err == nil {
+		err = os.Chmod(out.Name(), mode)
+	}
+	if err == nil {
+		err = os.Rename(out.Name(), string(archive))
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return primitive.Error(fmt.Sprintf("failed to create archive %s:%s", archive, err))
+	}
+
+	ret := primitive.List{}
+	for _, f := range files {
+		ret = append(ret, primitive.String(f.name))
+	}
+	return ret
+}
+
+// archiveExtract implements the extraction of an archive.
+func archiveExtract(args []primitive.Primitive, reader archiveReader) primitive.Primitive {
+
+	// We need two arguments
+	if len(args) != 2 {
+		return primitive.ArityError()
+	}
+
+	// Both strings
+	for _, arg := range args {
+		if _, ok := arg.(primitive.String); !ok {
+			return primitive.Error("argument not a string")
+		}
+	}
+
+	archive := args[0].ToString()
+	dir := args[1].ToString()
+
+	// Don't create the directory if there's nothing to extract
+	_, err := os.Stat(archive)
+	if err == nil {
+		err = os.MkdirAll(dir, 0755)
+	}
+
+	ret := primitive.List{}
+	if err == nil {
+		err = reader(archive, func(e *archiveEntry) error {
+			target, err := archiveExtractEntry(dir, e)
+			if err != nil {
+				return err
+			}
+			if target != "" {
+				ret = append(ret, primitive.String(target))
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		return primitive.Error(fmt.Sprintf("failed to extract archive %s:%s", archive, err))
+	}
+	return ret
+}
+
+// archiveList implements the listing of an archive.
+func archiveList(args []primitive.Primitive, reader archiveReader) primitive.Primitive {
+
+	// We only need a single argument
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	// Which is a string
+	archive, ok := args[0].(primitive.String)
+	if !ok {
+		return primitive.Error("argument not a string")
+	}
+
+	ret := primitive.List{}
+	err := reader(string(archive), func(e *archiveEntry) error {
+		ret = append(ret, archiveEntryHash(e))
+		return nil
+	})
+	if err != nil {
+		return primitive.Error(fmt.Sprintf("failed to read archive %s:%s", archive, err))
+	}
+	return ret
+}
+
+// readTar iterates over the entries of a tar archive, which might be
+// compressed.
+func readTar(archive string, fn func(e *archiveEntry) error) error {
+
+	file, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Look for the gzip magic number
+	var r io.Reader = bufio.NewReader(file)
+	magic, _ := r.(*bufio.Reader).Peek(2)
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		e := &archiveEntry{
+			name:     hdr.Name,
+			mode:     hdr.FileInfo().Mode(),
+			size:     hdr.Size,
+			modified: hdr.ModTime,
+			open:     func() (io.ReadCloser, error) { return io.NopCloser(tr), nil },
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeSymlink:
+			e.link = hdr.Linkname
+		case tar.TypeLink:
+			e.hardlink = hdr.Linkname
+		}
+
+		if err = fn(e); err != nil {
+			return err
+		}
+	}
+}
+
+// writeTar writes the given files to a tar archive, which is compressed
+// if the name of the archive suggests it should be.
+func writeTar(w io.Writer, archive string, files []archiveFile) error {
+
+	if strings.HasSuffix(archive, ".gz") || strings.HasSuffix(archive, ".tgz") {
+		gz := gzip.NewWriter(w)
+		err := writeTar(gz, "", files)
+		if cerr := gz.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	for _, f := range files {
+
+		hdr, err := tar.FileInfoHeader(f.info, f.link)
+		if err != nil {
+			return err
+		}
+
+		hdr.Name = f.name
+		if f.info.IsDir() {
+			hdr.Name += "/"
+		}
+
+		if err = tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if f.info.Mode().IsRegular() {
+			if err = archiveCopy(tw, f.path); err != nil {
+				return err
+			}
+		}
+	}
+	return tw.Close()
+}
+
+// readZip iterates over the entries of a zip archive.
+func readZip(archive string, fn func(e *archiveEntry) error) error {
+
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+
+		e := &archiveEntry{
+			name:     f.Name,
+			mode:     f.Mode(),
+			size:     int64(f.UncompressedSize64),
+			modified: f.Modified,
+			open:     f.Open,
+		}
+
+		// The target of a symlink is stored as its contents
+		if e.mode&fs.ModeSymlink != 0 {
+			in, err := f.Open()
+			if err != nil {
+				return err
+			}
+			link, err := io.ReadAll(in)
+			in.Close()
+			if err != nil {
+				return err
+			}
+			e.link = string(link)
+		}
+
+		if err = fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeZip writes the given files to a zip archive.
+func writeZip(w io.Writer, archive string, files []archiveFile) error {
+
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+
+		hdr, err := zip.FileInfoHeader(f.info)
+		if err != nil {
+			return err
+		}
+
+		hdr.Name = f.name
+		if f.info.IsDir() {
+			hdr.Name += "/"
+		} else {
+			hdr.Method = zip.Deflate
+		}
+
+		out, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case f.info.Mode()&fs.ModeSymlink != 0:
+			_, err = io.WriteString(out, f.link)
+		case f.info.Mode().IsRegular():
+			err = archiveCopy(out, f.path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// archiveCopy copies the contents of the given file to the writer.
+func archiveCopy(w io.Writer, path string) error {
+
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	_, err = io.Copy(w, in)
+	return err
+}
+
+// tarCreateFn implements (tar:create)
+func tarCreateFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+	return archiveCreate(args, writeTar)
+}
+
+// tarExtractFn implements (tar:extract)
+func tarExtractFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+	return archiveExtract(args, readTar)
+}
+
+// tarListFn implements (tar:list)
+func tarListFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+	return archiveList(args, readTar)
+}
+
+// zipCreateFn implements (zip:create)
+func zipCreateFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+	return archiveCreate(args, writeZip)
+}
+
+// zipExtractFn implements (zip:extract)
+func zipExtractFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+	return archiveExtract(args, readZip)
+}
+
+// zipListFn implements (zip:list)
+func zipListFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+	return archiveList(args, readZip)
+}
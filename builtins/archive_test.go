@@ -0,0 +1,325 @@
+//go:build !windows
+// +build !windows
+
+package builtins
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skx/yal/primitive"
+)
+
+// archiveTree creates a directory tree to archive, returning its path.
+func archiveTree(t *testing.T) string {
+
+	root := filepath.Join(t.TempDir(), "app")
+
+	files := map[string]string{
+		"one.txt":        "one",
+		"sub/two.txt":    "two\ntwo\n",
+		"sub/deep/three": strings.Repeat("three", 100),
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory:%s", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0640); err != nil {
+			t.Fatalf("failed to write file:%s", err)
+		}
+	}
+
+	if err := os.Symlink("sub/two.txt", filepath.Join(root, "link")); err != nil {
+		t.Fatalf("failed to create symlink:%s", err)
+	}
+	return root
+}
+
+// TestArchiveArguments ensures our archive-functions reject bogus
+// arguments.
+func TestArchiveArguments(t *testing.T) {
+
+	type TC struct {
+		fn   primitive.GolangPrimitiveFn
+		args []primitive.Primitive
+		err  string
+	}
+
+	str := primitive.String("steve")
+	missing := primitive.String("/fdsf/fdsf/-path-not/exists")
+	tmp := primitive.String(filepath.Join(t.TempDir(), "out"))
+
+	tests := []TC{
+		{tarCreateFn, []primitive.Primitive{str}, string(primitive.ArityError())},
+		{tarCreateFn, []primitive.Primitive{primitive.Number(3), primitive.List{}}, "not a string"},
+		{tarCreateFn, []primitive.Primitive{str, str}, "not a list"},
+		{tarCreateFn, []primitive.Primitive{str, primitive.List{primitive.Number(3)}}, "path not a string"},
+		{tarCreateFn, []primitive.Primitive{missing, primitive.List{}}, "failed to create archive"},
+		{tarCreateFn, []primitive.Primitive{tmp, primitive.List{missing}}, "failed to create archive"},
+		{tarCreateFn, []primitive.Primitive{tmp, primitive.List{primitive.String("/")}}, "cannot determine a name"},
+		{tarExtractFn, []primitive.Primitive{str}, string(primitive.ArityError())},
+		{tarExtractFn, []primitive.Primitive{str, primitive.Number(3)}, "not a string"},
+		{tarExtractFn, []primitive.Primitive{missing, tmp}, "failed to extract archive"},
+		{tarListFn, []primitive.Primitive{}, string(primitive.ArityError())},
+		{tarListFn, []primitive.Primitive{primitive.Number(3)}, "not a string"},
+		{tarListFn, []primitive.Primitive{missing}, "failed to read archive"},
+		{zipCreateFn, []primitive.Primitive{str, str, str}, string(primitive.ArityError())},
+		{zipCreateFn, []primitive.Primitive{tmp, primitive.List{missing}}, "failed to create archive"},
+		{zipExtractFn, []primitive.Primitive{missing, tmp}, "failed to extract archive"},
+		{zipListFn, []primitive.Primitive{str, str}, string(primitive.ArityError())},
+		{zipListFn, []primitive.Primitive{missing}, "failed to read archive"},
+	}
+
+	for _, test := range tests {
+		out := test.fn(ENV, test.args)
+
+		e, ok := out.(primitive.Error)
+		if !ok {
+			t.Fatalf("expected error for %v, got %v", test.args, out)
+		}
+		if !strings.Contains(string(e), test.err) {
+			t.Fatalf("got error for %v, but wrong one %v", test.args, out)
+		}
+	}
+
+	// A failed creation leaves nothing behind
+	if _, err := os.Stat(tmp.ToString()); err == nil {
+		t.Fatalf("partial archive was left behind")
+	}
+}
+
+// TestArchive tests creating, listing, and extracting archives.
+func TestArchive(t *testing.T) {
+
+	root := archiveTree(t)
+
+	type TC struct {
+		name    string
+		create  primitive.GolangPrimitiveFn
+		list    primitive.GolangPrimitiveFn
+		extract primitive.GolangPrimitiveFn
+		magic   string
+	}
+
+	tests := []TC{
+		{"test.tar", tarCreateFn, tarListFn, tarExtractFn, ""},
+		{"test.tar.gz", tarCreateFn, tarListFn, tarExtractFn, "\x1f\x8b"},
+		{"test.tgz", tarCreateFn, tarListFn, tarExtractFn, "\x1f\x8b"},
+		{"test.zip", zipCreateFn, zipListFn, zipExtractFn, "PK"},
+	}
+
+	expected := "app app/link app/one.txt app/sub app/sub/deep app/sub/deep/three app/sub/two.txt"
+
+	for _, test := range tests {
+
+		dir := t.TempDir()
+		archive := filepath.Join(dir, test.name)
+
+		// Create
+		out := test.create(ENV, []primitive.Primitive{primitive.String(archive), primitive.List{primitive.String(root)}})
+		lst, ok := out.(primitive.List)
+		if !ok {
+			t.Fatalf("%s: expected list, got %v", test.name, out)
+		}
+
+		var names []string
+		for _, x := range lst {
+			names = append(names, x.ToString())
+		}
+		if strings.Join(names, " ") != expected {
+			t.Fatalf("%s: wrong entries created %v", test.name, names)
+		}
+
+		data, _ := os.ReadFile(archive)
+		if !strings.HasPrefix(string(data), test.magic) {
+			t.Fatalf("%s: archive has the wrong format", test.name)
+		}
+
+		// List
+		out = test.list(ENV, []primitive.Primitive{primitive.String(archive)})
+		lst, ok = out.(primitive.List)
+		if !ok {
+			t.Fatalf("%s: expected list, got %v", test.name, out)
+		}
+		if len(lst) != len(names) {
+			t.Fatalf("%s: wrong number of entries listed %v", test.name, lst)
+		}
+
+		for _, x := range lst {
+			h := x.(primitive.Hash)
+			name := strings.TrimSuffix(h.Get(":name").ToString(), "/")
+
+			switch name {
+			case "app/sub":
+				if h.Get(":directory") != primitive.Bool(true) {
+					t.Fatalf("%s: expected a directory %v", test.name, h)
+				}
+			case "app/sub/two.txt":
+				if h.Get(":size") != primitive.Number(8) || h.Get(":mode").ToString() != "-rw-r-----" {
+					t.Fatalf("%s: wrong details %v", test.name, h)
+				}
+				if _, ok := h.Get(":modified").(primitive.Time); !ok {
+					t.Fatalf("%s: wrong modification time %v", test.name, h)
+				}
+			}
+		}
+
+		// Extract
+		restore := filepath.Join(dir, "restore")
+		out = test.extract(ENV, []primitive.Primitive{primitive.String(archive), primitive.String(restore)})
+		lst, ok = out.(primitive.List)
+		if !ok {
+			t.Fatalf("%s: expected list, got %v", test.name, out)
+		}
+		if len(lst) != len(names) {
+			t.Fatalf("%s: wrong number of entries extracted %v", test.name, lst)
+		}
+
+		content, err := os.ReadFile(filepath.Join(restore, "app", "sub", "deep", "three"))
+		if err != nil || string(content) != strings.Repeat("three", 100) {
+			t.Fatalf("%s: extracted file has the wrong contents:%s", test.name, err)
+		}
+
+		link, err := os.Readlink(filepath.Join(restore, "app", "link"))
+		if err != nil || link != "sub/two.txt" {
+			t.Fatalf("%s: symlink wasn't extracted:%s", test.name, err)
+		}
+
+		info, err := os.Stat(filepath.Join(restore, "app", "one.txt"))
+		if err != nil || info.Mode().Perm() != 0640 {
+			t.Fatalf("%s: wrong permissions extracted:%v", test.name, info)
+		}
+	}
+}
+
+// TestArchiveSelf tests that an archive created within the directory
+// being archived doesn't contain itself.
+func TestArchiveSelf(t *testing.T) {
+
+	root := archiveTree(t)
+	archive := filepath.Join(root, "self.zip")
+
+	out := zipCreateFn(ENV, []primitive.Primitive{primitive.String(archive), primitive.List{primitive.String(root)}})
+	if strings.Contains(out.ToString(), "self.zip") {
+		t.Fatalf("archive contains itself %v", out)
+	}
+}
+
+// TestArchiveFailure tests that failing to create an archive leaves any
+// existing file alone.
+func TestArchiveFailure(t *testing.T) {
+
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "existing.tar")
+	if err := os.WriteFile(archive, []byte("precious"), 0644); err != nil {
+		t.Fatalf("failed to write file:%s", err)
+	}
+
+	for _, fn := range []primitive.GolangPrimitiveFn{tarCreateFn, zipCreateFn} {
+		out := fn(ENV, []primitive.Primitive{
+			primitive.String(archive),
+			primitive.List{primitive.String(archiveTree(t)), primitive.String(filepath.Join(dir, "missing"))},
+		})
+		if !strings.Contains(out.ToString(), "failed to create archive") {
+			t.Fatalf("expected error, got %v", out)
+		}
+
+		content, err := os.ReadFile(archive)
+		if err != nil || string(content) != "precious" {
+			t.Fatalf("existing file was changed %s %v", content, err)
+		}
+
+		entries, _ := os.ReadDir(dir)
+		if len(entries) != 1 {
+			t.Fatalf("temporary files were left behind %v", entries)
+		}
+	}
+
+	// Success replaces it
+	out := tarCreateFn(ENV, []primitive.Primitive{primitive.String(archive), primitive.List{primitive.String(archiveTree(t))}})
+	if _, ok := out.(primitive.List); !ok {
+		t.Fatalf("expected list, got %v", out)
+	}
+	info, err := os.Stat(archive)
+	if err != nil || info.Size() <= int64(len("precious")) || info.Mode().Perm() != 0644 {
+		t.Fatalf("archive wasn't replaced %v %v", info, err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("temporary files were left behind %v", entries)
+	}
+}
+
+// TestArchiveHostile tests that extraction doesn't write outside the
+// target directory.
+func TestArchiveHostile(t *testing.T) {
+
+	type entry struct {
+		name string
+		link string
+	}
+
+	tests := [][]entry{
+		{{name: "../escape"}},
+		{{name: "a/../../escape"}},
+		{{name: "link", link: "../.."}},
+		{{name: "link", link: "/etc"}},
+		{{name: "a", link: "."}, {name: "a/b", link: ".."}, {name: "a/b/escape"}},
+		{{name: "ok", link: "."}, {name: "ok/escape"}},
+	}
+
+	for i, test := range tests {
+
+		dir := t.TempDir()
+		archive := filepath.Join(dir, "evil.tar")
+
+		f, _ := os.Create(archive)
+		tw := tar.NewWriter(f)
+		for _, e := range test {
+			hdr := &tar.Header{Name: e.name, Mode: 0644, Typeflag: tar.TypeReg}
+			if e.link != "" {
+				hdr.Typeflag = tar.TypeSymlink
+				hdr.Linkname = e.link
+			}
+			tw.WriteHeader(hdr)
+		}
+		tw.Close()
+		f.Close()
+
+		restore := filepath.Join(dir, "restore", "target")
+		out := tarExtractFn(ENV, []primitive.Primitive{primitive.String(archive), primitive.String(restore)})
+		if _, ok := out.(primitive.Error); !ok {
+			t.Fatalf("%d: expected error, got %v", i, out)
+		}
+
+		if _, err := os.Lstat(filepath.Join(dir, "restore", "escape")); err == nil {
+			t.Fatalf("%d: file written outside the directory", i)
+		}
+		if _, err := os.Lstat(filepath.Join(dir, "escape")); err == nil {
+			t.Fatalf("%d: file written outside the directory", i)
+		}
+	}
+
+	// The same for zip
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "evil.zip")
+
+	f, _ := os.Create(archive)
+	zw := zip.NewWriter(f)
+	zw.Create("../escape")
+	zw.Close()
+	f.Close()
+
+	out := zipExtractFn(ENV, []primitive.Primitive{primitive.String(archive), primitive.String(filepath.Join(dir, "restore"))})
+	if !strings.Contains(out.ToString(), "outside") {
+		t.Fatalf("expected error, got %v", out)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "escape")); err == nil {
+		t.Fatalf("file written outside the directory")
+	}
+}
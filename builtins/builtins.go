@@ -13,7 +13,6 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"math"
-	"math/rand"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -43,10 +42,6 @@ var helpMap map[string]string
 // is essentially constant.
 var regCache map[string]*regexp.Regexp
 
-// symCount is the count of symbols generated by the 'gensym' built-in
-// function.
-var symCount int
-
 // builtins contains all our built-in functions
 var builtins []string
 
@@ -101,6 +96,37 @@ func registerBuiltin(env *env.Environment, key string, value any) {
 	env.Set(key, value)
 }
 
+// applyProcedure invokes the given procedure, which might be implemented
+// in golang or in lisp, with the specified arguments.
+//
+// Calling lisp requires the interpreter which is executing code in the
+// given environment.
+func applyProcedure(env *env.Environment, proc *primitive.Procedure, args []primitive.Primitive) primitive.Primitive {
+
+	ev, ok := env.GetEvaluator().(primitive.Evaluator)
+	if ok {
+		return ev.Apply(env, proc, args)
+	}
+
+	// No interpreter?  We can still call golang procedures.
+	if proc.F != nil {
+		return proc.F(env, args)
+	}
+	return primitive.Error("no interpreter available to call lisp procedure")
+}
+
+// yieldInterpreter allows other goroutines to run lisp while the caller
+// blocks, returning the function to call before the caller uses the
+// environment again.
+func yieldInterpreter(env *env.Environment) func() {
+
+	sched, ok := env.GetEvaluator().(primitive.Scheduler)
+	if ok {
+		return sched.Yield()
+	}
+	return func() {}
+}
+
 // PopulateEnvironment registers our default primitives
 func PopulateEnvironment(env *env.Environment) {
 
@@ -132,44 +158,103 @@ func PopulateEnvironment(env *env.Environment) {
 	registerBuiltin(env, "contains?", &primitive.Procedure{F: containsFn, Help: helpMap["contains?"], Args: []primitive.Symbol{primitive.Symbol("hash"), primitive.Symbol("key")}})
 	registerBuiltin(env, "cos", &primitive.Procedure{F: cosFn, Help: helpMap["cos"], Args: []primitive.Symbol{primitive.Symbol("n")}})
 	registerBuiltin(env, "cosh", &primitive.Procedure{F: coshFn, Help: helpMap["cosh"], Args: []primitive.Symbol{primitive.Symbol("n")}})
+	registerBuiltin(env, "crc32", &primitive.Procedure{F: crc32Fn, Help: helpMap["crc32"], Args: []primitive.Symbol{primitive.Symbol("string")}})
+	registerBuiltin(env, "cron:next", &primitive.Procedure{F: cronNextFn, Help: helpMap["cron:next"], Args: []primitive.Symbol{primitive.Symbol("expression"), primitive.Symbol("[time]")}})
 	registerBuiltin(env, "date", &primitive.Procedure{F: dateFn, Help: helpMap["date"]})
+	registerBuiltin(env, "decode:base64", &primitive.Procedure{F: decodeBase64Fn, Help: helpMap["decode:base64"], Args: []primitive.Symbol{primitive.Symbol("string"), primitive.Symbol("[url-safe]")}})
+	registerBuiltin(env, "decode:hex", &primitive.Procedure{F: decodeHexFn, Help: helpMap["decode:hex"], Args: []primitive.Symbol{primitive.Symbol("string")}})
 	registerBuiltin(env, "directory:entries", &primitive.Procedure{F: directoryEntriesFn, Help: helpMap["directory:entries"]})
 	registerBuiltin(env, "directory?", &primitive.Procedure{F: directoryFn, Help: helpMap["directory?"], Args: []primitive.Symbol{primitive.Symbol("path")}})
+	registerBuiltin(env, "encode:base64", &primitive.Procedure{F: encodeBase64Fn, Help: helpMap["encode:base64"], Args: []primitive.Symbol{primitive.Symbol("string"), primitive.Symbol("[url-safe]")}})
+	registerBuiltin(env, "encode:hex", &primitive.Procedure{F: encodeHexFn, Help: helpMap["encode:hex"], Args: []primitive.Symbol{primitive.Symbol("string")}})
 	registerBuiltin(env, "env", &primitive.Procedure{F: envFn, Help: helpMap["env"], Args: []primitive.Symbol{}})
+	registerBuiltin(env, "environ", &primitive.Procedure{F: environFn, Help: helpMap["environ"], Args: []primitive.Symbol{}})
 	registerBuiltin(env, "eq", &primitive.Procedure{F: eqFn, Help: helpMap["eq"], Args: []primitive.Symbol{primitive.Symbol("a"), primitive.Symbol("b")}})
 	registerBuiltin(env, "error", &primitive.Procedure{F: errorFn, Help: helpMap["error"], Args: []primitive.Symbol{primitive.Symbol("message")}})
 	registerBuiltin(env, "exists?", &primitive.Procedure{F: existsFn, Help: helpMap["exists?"], Args: []primitive.Symbol{primitive.Symbol("path")}})
 	registerBuiltin(env, "explode", &primitive.Procedure{F: explodeFn, Help: helpMap["explode"], Args: []primitive.Symbol{primitive.Symbol("string")}})
+	registerBuiltin(env, "file:digest", &primitive.Procedure{F: fileDigestFn, Help: helpMap["file:digest"], Args: []primitive.Symbol{primitive.Symbol("path"), primitive.Symbol("[digest]")}})
 	registerBuiltin(env, "file:lines", &primitive.Procedure{F: fileLinesFn, Help: helpMap["file:lines"], Args: []primitive.Symbol{primitive.Symbol("path")}})
 	registerBuiltin(env, "file:read", &primitive.Procedure{F: fileReadFn, Help: helpMap["file:read"], Args: []primitive.Symbol{primitive.Symbol("path")}})
 	registerBuiltin(env, "file:stat", &primitive.Procedure{F: fileStatFn, Help: helpMap["file:stat"], Args: []primitive.Symbol{primitive.Symbol("path")}})
 	registerBuiltin(env, "file:write", &primitive.Procedure{F: fileWriteFn, Help: helpMap["file:write"], Args: []primitive.Symbol{primitive.Symbol("path"), primitive.Symbol("content")}})
 	registerBuiltin(env, "file?", &primitive.Procedure{F: fileFn, Help: helpMap["file?"], Args: []primitive.Symbol{primitive.Symbol("path")}})
-	registerBuiltin(env, "gensym", &primitive.Procedure{F: gensymFn, Help: helpMap["gensym"]})
+	registerBuiltin(env, "force", &primitive.Procedure{F: forceFn, Help: helpMap["force"], Args: []primitive.Symbol{primitive.Symbol("promise")}})
+	registerBuiltin(env, "gensym", &primitive.Procedure{F: gensymFn, Help: helpMap["gensym"], Args: []primitive.Symbol{primitive.Symbol("[name]")}})
 	registerBuiltin(env, "get", &primitive.Procedure{F: getFn, Help: helpMap["get"], Args: []primitive.Symbol{primitive.Symbol("hash"), primitive.Symbol("key")}})
 	registerBuiltin(env, "getenv", &primitive.Procedure{F: getenvFn, Help: helpMap["getenv"], Args: []primitive.Symbol{primitive.Symbol("key")}})
 	registerBuiltin(env, "glob", &primitive.Procedure{F: globFn, Help: helpMap["glob"], Args: []primitive.Symbol{primitive.Symbol("pattern")}})
+	registerBuiltin(env, "gzip:compress", &primitive.Procedure{F: gzipCompressFn, Help: helpMap["gzip:compress"], Args: []primitive.Symbol{primitive.Symbol("string")}})
+	registerBuiltin(env, "gzip:compress-file", &primitive.Procedure{F: gzipCompressFileFn, Help: helpMap["gzip:compress-file"], Args: []primitive.Symbol{primitive.Symbol("path"), primitive.Symbol("[destination]")}})
+	registerBuiltin(env, "gzip:decompress", &primitive.Procedure{F: gzipDecompressFn, Help: helpMap["gzip:decompress"], Args: []primitive.Symbol{primitive.Symbol("string")}})
+	registerBuiltin(env, "gzip:decompress-file", &primitive.Procedure{F: gzipDecompressFileFn, Help: helpMap["gzip:decompress-file"], Args: []primitive.Symbol{primitive.Symbol("path"), primitive.Symbol("[destination]")}})
 	registerBuiltin(env, "help", &primitive.Procedure{F: helpFn, Help: helpMap["help"], Args: []primitive.Symbol{primitive.Symbol("function")}})
+	registerBuiltin(env, "hmac", &primitive.Procedure{F: hmacFn, Help: helpMap["hmac"], Args: []primitive.Symbol{primitive.Symbol("digest"), primitive.Symbol("key"), primitive.Symbol("message")}})
+	registerBuiltin(env, "http:get", &primitive.Procedure{F: httpGetFn, Help: helpMap["http:get"], Args: []primitive.Symbol{primitive.Symbol("url"), primitive.Symbol("[headers]")}})
+	registerBuiltin(env, "http:post", &primitive.Procedure{F: httpPostFn, Help: helpMap["http:post"], Args: []primitive.Symbol{primitive.Symbol("url"), primitive.Symbol("body"), primitive.Symbol("[headers]")}})
+	registerBuiltin(env, "http:request", &primitive.Procedure{F: httpRequestFn, Help: helpMap["http:request"], Args: []primitive.Symbol{primitive.Symbol("request")}})
+	registerBuiltin(env, "http:serve", &primitive.Procedure{F: httpServeFn, Help: helpMap["http:serve"], Args: []primitive.Symbol{primitive.Symbol("address"), primitive.Symbol("handler")}})
 	registerBuiltin(env, "join", &primitive.Procedure{F: joinFn, Help: helpMap["join"], Args: []primitive.Symbol{primitive.Symbol("list")}})
+	registerBuiltin(env, "json:decode", &primitive.Procedure{F: jsonDecodeFn, Help: helpMap["json:decode"], Args: []primitive.Symbol{primitive.Symbol("string")}})
+	registerBuiltin(env, "json:encode", &primitive.Procedure{F: jsonEncodeFn, Help: helpMap["json:encode"], Args: []primitive.Symbol{primitive.Symbol("object")}})
 	registerBuiltin(env, "keys", &primitive.Procedure{F: keysFn, Help: helpMap["keys"], Args: []primitive.Symbol{primitive.Symbol("hash")}})
 	registerBuiltin(env, "list", &primitive.Procedure{F: listFn, Help: helpMap["list"], Args: []primitive.Symbol{primitive.Symbol("arg1"), primitive.Symbol("arg...")}})
 	registerBuiltin(env, "match", &primitive.Procedure{F: matchFn, Help: helpMap["match"], Args: []primitive.Symbol{primitive.Symbol("regexp"), primitive.Symbol("str")}})
 	registerBuiltin(env, "md5", &primitive.Procedure{F: md5Fn, Help: helpMap["md5"], Args: []primitive.Symbol{primitive.Symbol("string")}})
 	registerBuiltin(env, "ms", &primitive.Procedure{F: msFn, Help: helpMap["ms"]})
+	registerBuiltin(env, "net:accept", &primitive.Procedure{F: netAcceptFn, Help: helpMap["net:accept"], Args: []primitive.Symbol{primitive.Symbol("listener")}})
+	registerBuiltin(env, "net:address", &primitive.Procedure{F: netAddressFn, Help: helpMap["net:address"], Args: []primitive.Symbol{primitive.Symbol("handle")}})
+	registerBuiltin(env, "net:close", &primitive.Procedure{F: netCloseFn, Help: helpMap["net:close"], Args: []primitive.Symbol{primitive.Symbol("handle")}})
+	registerBuiltin(env, "net:deadline", &primitive.Procedure{F: netDeadlineFn, Help: helpMap["net:deadline"], Args: []primitive.Symbol{primitive.Symbol("connection"), primitive.Symbol("ms")}})
+	registerBuiltin(env, "net:dial", &primitive.Procedure{F: netDialFn, Help: helpMap["net:dial"], Args: []primitive.Symbol{primitive.Symbol("network"), primitive.Symbol("address"), primitive.Symbol("[timeout]")}})
+	registerBuiltin(env, "net:listen", &primitive.Procedure{F: netListenFn, Help: helpMap["net:listen"], Args: []primitive.Symbol{primitive.Symbol("network"), primitive.Symbol("address")}})
+	registerBuiltin(env, "net:read", &primitive.Procedure{F: netReadFn, Help: helpMap["net:read"], Args: []primitive.Symbol{primitive.Symbol("connection"), primitive.Symbol("[size]")}})
+	registerBuiltin(env, "net:read-line", &primitive.Procedure{F: netReadLineFn, Help: helpMap["net:read-line"], Args: []primitive.Symbol{primitive.Symbol("connection")}})
+	registerBuiltin(env, "net:serve", &primitive.Procedure{F: netServeFn, Help: helpMap["net:serve"], Args: []primitive.Symbol{primitive.Symbol("listener"), primitive.Symbol("handler"), primitive.Symbol("[timeout]")}})
+	registerBuiltin(env, "net:write", &primitive.Procedure{F: netWriteFn, Help: helpMap["net:write"], Args: []primitive.Symbol{primitive.Symbol("connection"), primitive.Symbol("string")}})
 	registerBuiltin(env, "nil?", &primitive.Procedure{F: nilFn, Help: helpMap["nil?"], Args: []primitive.Symbol{primitive.Symbol("object")}})
 	registerBuiltin(env, "now", &primitive.Procedure{F: nowFn, Help: helpMap["now"]})
 	registerBuiltin(env, "nth", &primitive.Procedure{F: nthFn, Help: helpMap["nth"], Args: []primitive.Symbol{primitive.Symbol("list"), primitive.Symbol("offset")}})
 	registerBuiltin(env, "number", &primitive.Procedure{F: numberFn, Help: helpMap["number"], Args: []primitive.Symbol{primitive.Symbol("str")}})
 	registerBuiltin(env, "ord", &primitive.Procedure{F: ordFn, Help: helpMap["ord"], Args: []primitive.Symbol{primitive.Symbol("char")}})
 	registerBuiltin(env, "os", &primitive.Procedure{F: osFn, Help: helpMap["os"]})
+	registerBuiltin(env, "path:abs", &primitive.Procedure{F: pathAbsFn, Help: helpMap["path:abs"], Args: []primitive.Symbol{primitive.Symbol("path")}})
+	registerBuiltin(env, "path:base", &primitive.Procedure{F: pathBaseFn, Help: helpMap["path:base"], Args: []primitive.Symbol{primitive.Symbol("path")}})
+	registerBuiltin(env, "path:clean", &primitive.Procedure{F: pathCleanFn, Help: helpMap["path:clean"], Args: []primitive.Symbol{primitive.Symbol("path")}})
+	registerBuiltin(env, "path:dir", &primitive.Procedure{F: pathDirFn, Help: helpMap["path:dir"], Args: []primitive.Symbol{primitive.Symbol("path")}})
+	registerBuiltin(env, "path:ext", &primitive.Procedure{F: pathExtFn, Help: helpMap["path:ext"], Args: []primitive.Symbol{primitive.Symbol("path")}})
+	registerBuiltin(env, "path:join", &primitive.Procedure{F: pathJoinFn, Help: helpMap["path:join"], Args: []primitive.Symbol{primitive.Symbol("path1"), primitive.Symbol("path2..pathN")}})
+	registerBuiltin(env, "path:match", &primitive.Procedure{F: pathMatchFn, Help: helpMap["path:match"], Args: []primitive.Symbol{primitive.Symbol("pattern"), primitive.Symbol("path")}})
+	registerBuiltin(env, "path:rel", &primitive.Procedure{F: pathRelFn, Help: helpMap["path:rel"], Args: []primitive.Symbol{primitive.Symbol("base"), primitive.Symbol("target")}})
+	registerBuiltin(env, "path:split", &primitive.Procedure{F: pathSplitFn, Help: helpMap["path:split"], Args: []primitive.Symbol{primitive.Symbol("path")}})
+	registerBuiltin(env, "path:split-list", &primitive.Procedure{F: pathSplitListFn, Help: helpMap["path:split-list"], Args: []primitive.Symbol{primitive.Symbol("list")}})
+	registerBuiltin(env, "pipeline", &primitive.Procedure{F: pipelineFn, Help: helpMap["pipeline"], Args: []primitive.Symbol{primitive.Symbol("stage1..stageN"), primitive.Symbol("[options]")}})
 	registerBuiltin(env, "print", &primitive.Procedure{F: printFn, Help: helpMap["print"], Args: []primitive.Symbol{primitive.Symbol("arg1..argN")}})
-	registerBuiltin(env, "random", &primitive.Procedure{F: randomFn, Help: helpMap["random"], Args: []primitive.Symbol{primitive.Symbol("max")}})
+	registerBuiltin(env, "process:kill", &primitive.Procedure{F: processKillFn, Help: helpMap["process:kill"], Args: []primitive.Symbol{primitive.Symbol("process")}})
+	registerBuiltin(env, "process:pid", &primitive.Procedure{F: processPidFn, Help: helpMap["process:pid"], Args: []primitive.Symbol{primitive.Symbol("process")}})
+	registerBuiltin(env, "process:read-line", &primitive.Procedure{F: processReadLineFn, Help: helpMap["process:read-line"], Args: []primitive.Symbol{primitive.Symbol("process"), primitive.Symbol("[stream]")}})
+	registerBuiltin(env, "process:run", &primitive.Procedure{F: processRunFn, Help: helpMap["process:run"], Args: []primitive.Symbol{primitive.Symbol("list"), primitive.Symbol("[options]")}})
+	registerBuiltin(env, "process:start", &primitive.Procedure{F: processStartFn, Help: helpMap["process:start"], Args: []primitive.Symbol{primitive.Symbol("list"), primitive.Symbol("[options]")}})
+	registerBuiltin(env, "process:wait", &primitive.Procedure{F: processWaitFn, Help: helpMap["process:wait"], Args: []primitive.Symbol{primitive.Symbol("process")}})
+	registerBuiltin(env, "random", &primitive.Procedure{F: randomFn, Help: helpMap["random"], Args: []primitive.Symbol{primitive.Symbol("max"), primitive.Symbol("[generator]")}})
+	registerBuiltin(env, "random:bytes", &primitive.Procedure{F: randomBytesFn, Help: helpMap["random:bytes"], Args: []primitive.Symbol{primitive.Symbol("n")}})
+	registerBuiltin(env, "random:float", &primitive.Procedure{F: randomFloatFn, Help: helpMap["random:float"], Args: []primitive.Symbol{primitive.Symbol("[generator]")}})
+	registerBuiltin(env, "random:new", &primitive.Procedure{F: randomNewFn, Help: helpMap["random:new"], Args: []primitive.Symbol{primitive.Symbol("[seed]")}})
+	registerBuiltin(env, "random:range", &primitive.Procedure{F: randomRangeFn, Help: helpMap["random:range"], Args: []primitive.Symbol{primitive.Symbol("min"), primitive.Symbol("max"), primitive.Symbol("[generator]")}})
+	registerBuiltin(env, "random:sample", &primitive.Procedure{F: randomSampleFn, Help: helpMap["random:sample"], Args: []primitive.Symbol{primitive.Symbol("list"), primitive.Symbol("n"), primitive.Symbol("[generator]")}})
+	registerBuiltin(env, "random:seed", &primitive.Procedure{F: randomSeedFn, Help: helpMap["random:seed"], Args: []primitive.Symbol{primitive.Symbol("seed")}})
+	registerBuiltin(env, "random:shuffle", &primitive.Procedure{F: randomShuffleFn, Help: helpMap["random:shuffle"], Args: []primitive.Symbol{primitive.Symbol("list"), primitive.Symbol("[generator]")}})
+	registerBuiltin(env, "random:token", &primitive.Procedure{F: randomTokenFn, Help: helpMap["random:token"], Args: []primitive.Symbol{primitive.Symbol("[n]")}})
+	registerBuiltin(env, "random:weighted", &primitive.Procedure{F: randomWeightedFn, Help: helpMap["random:weighted"], Args: []primitive.Symbol{primitive.Symbol("items"), primitive.Symbol("weights"), primitive.Symbol("[generator]")}})
 	registerBuiltin(env, "set", &primitive.Procedure{F: setFn, Help: helpMap["set"], Args: []primitive.Symbol{primitive.Symbol("hash"), primitive.Symbol("key"), primitive.Symbol("val")}})
+	registerBuiltin(env, "setenv", &primitive.Procedure{F: setenvFn, Help: helpMap["setenv"], Args: []primitive.Symbol{primitive.Symbol("key"), primitive.Symbol("value")}})
 	registerBuiltin(env, "sha1", &primitive.Procedure{F: sha1Fn, Help: helpMap["sha1"], Args: []primitive.Symbol{primitive.Symbol("string")}})
 	registerBuiltin(env, "sha256", &primitive.Procedure{F: sha256Fn, Help: helpMap["sha256"], Args: []primitive.Symbol{primitive.Symbol("string")}})
+	registerBuiltin(env, "sha512", &primitive.Procedure{F: sha512Fn, Help: helpMap["sha512"], Args: []primitive.Symbol{primitive.Symbol("string")}})
 	registerBuiltin(env, "shell", &primitive.Procedure{F: shellFn, Help: helpMap["shell"], Args: []primitive.Symbol{primitive.Symbol("list")}})
 	registerBuiltin(env, "sin", &primitive.Procedure{F: sinFn, Help: helpMap["sin"], Args: []primitive.Symbol{primitive.Symbol("n")}})
 	registerBuiltin(env, "sinh", &primitive.Procedure{F: sinhFn, Help: helpMap["sinh"], Args: []primitive.Symbol{primitive.Symbol("n")}})
+	registerBuiltin(env, "sleep", &primitive.Procedure{F: sleepFn, Help: helpMap["sleep"], Args: []primitive.Symbol{primitive.Symbol("ms")}})
 	registerBuiltin(env, "sort", &primitive.Procedure{F: sortFn, Help: helpMap["sort"], Args: []primitive.Symbol{primitive.Symbol("list")}})
 	registerBuiltin(env, "source", &primitive.Procedure{F: sourceFn, Help: helpMap["source"], Args: []primitive.Symbol{primitive.Symbol("symbol")}})
 	registerBuiltin(env, "specials", &primitive.Procedure{F: specialsFn, Help: helpMap["specials"], Args: []primitive.Symbol{}})
@@ -180,10 +265,52 @@ func PopulateEnvironment(env *env.Environment) {
 	registerBuiltin(env, "string=", &primitive.Procedure{F: stringEqualsFn, Help: helpMap["string="], Args: []primitive.Symbol{primitive.Symbol("a"), primitive.Symbol("b")}})
 	registerBuiltin(env, "tan", &primitive.Procedure{F: tanFn, Help: helpMap["tan"], Args: []primitive.Symbol{primitive.Symbol("n")}})
 	registerBuiltin(env, "tanh", &primitive.Procedure{F: tanhFn, Help: helpMap["tanh"], Args: []primitive.Symbol{primitive.Symbol("n")}})
+	registerBuiltin(env, "tar:create", &primitive.Procedure{F: tarCreateFn, Help: helpMap["tar:create"], Args: []primitive.Symbol{primitive.Symbol("archive"), primitive.Symbol("paths")}})
+	registerBuiltin(env, "tar:extract", &primitive.Procedure{F: tarExtractFn, Help: helpMap["tar:extract"], Args: []primitive.Symbol{primitive.Symbol("archive"), primitive.Symbol("directory")}})
+	registerBuiltin(env, "tar:list", &primitive.Procedure{F: tarListFn, Help: helpMap["tar:list"], Args: []primitive.Symbol{primitive.Symbol("archive")}})
+	registerBuiltin(env, "template:render", &primitive.Procedure{F: templateRenderFn, Help: helpMap["template:render"], Args: []primitive.Symbol{primitive.Symbol("template"), primitive.Symbol("data"), primitive.Symbol("[escape]")}})
 	registerBuiltin(env, "time", &primitive.Procedure{F: timeFn, Help: helpMap["time"]})
+	registerBuiltin(env, "time.day", &primitive.Procedure{F: timeDayFn, Help: helpMap["time.day"], Args: []primitive.Symbol{primitive.Symbol("time")}})
+	registerBuiltin(env, "time.hour", &primitive.Procedure{F: timeHourFn, Help: helpMap["time.hour"], Args: []primitive.Symbol{primitive.Symbol("time")}})
+	registerBuiltin(env, "time.minute", &primitive.Procedure{F: timeMinuteFn, Help: helpMap["time.minute"], Args: []primitive.Symbol{primitive.Symbol("time")}})
+	registerBuiltin(env, "time.month", &primitive.Procedure{F: timeMonthFn, Help: helpMap["time.month"], Args: []primitive.Symbol{primitive.Symbol("time")}})
+	registerBuiltin(env, "time.nanosecond", &primitive.Procedure{F: timeNanosecondFn, Help: helpMap["time.nanosecond"], Args: []primitive.Symbol{primitive.Symbol("time")}})
+	registerBuiltin(env, "time.second", &primitive.Procedure{F: timeSecondFn, Help: helpMap["time.second"], Args: []primitive.Symbol{primitive.Symbol("time")}})
+	registerBuiltin(env, "time.weekday", &primitive.Procedure{F: timeWeekdayFn, Help: helpMap["time.weekday"], Args: []primitive.Symbol{primitive.Symbol("time")}})
+	registerBuiltin(env, "time.year", &primitive.Procedure{F: timeYearFn, Help: helpMap["time.year"], Args: []primitive.Symbol{primitive.Symbol("time")}})
+	registerBuiltin(env, "time.yearday", &primitive.Procedure{F: timeYeardayFn, Help: helpMap["time.yearday"], Args: []primitive.Symbol{primitive.Symbol("time")}})
+	registerBuiltin(env, "time.zone", &primitive.Procedure{F: timeZoneFn, Help: helpMap["time.zone"], Args: []primitive.Symbol{primitive.Symbol("time")}})
+	registerBuiltin(env, "time:add", &primitive.Procedure{F: timeAddFn, Help: helpMap["time:add"], Args: []primitive.Symbol{primitive.Symbol("time"), primitive.Symbol("duration")}})
+	registerBuiltin(env, "time:diff", &primitive.Procedure{F: timeDiffFn, Help: helpMap["time:diff"], Args: []primitive.Symbol{primitive.Symbol("a"), primitive.Symbol("b")}})
+	registerBuiltin(env, "time:format", &primitive.Procedure{F: timeFormatFn, Help: helpMap["time:format"], Args: []primitive.Symbol{primitive.Symbol("time"), primitive.Symbol("[layout]")}})
+	registerBuiltin(env, "time:from-unix", &primitive.Procedure{F: timeFromUnixFn, Help: helpMap["time:from-unix"], Args: []primitive.Symbol{primitive.Symbol("seconds")}})
+	registerBuiltin(env, "time:now", &primitive.Procedure{F: timeNowFn, Help: helpMap["time:now"], Args: []primitive.Symbol{}})
+	registerBuiltin(env, "time:parse", &primitive.Procedure{F: timeParseFn, Help: helpMap["time:parse"], Args: []primitive.Symbol{primitive.Symbol("string"), primitive.Symbol("[layout]"), primitive.Symbol("[zone]")}})
+	registerBuiltin(env, "time:sub", &primitive.Procedure{F: timeSubFn, Help: helpMap["time:sub"], Args: []primitive.Symbol{primitive.Symbol("time"), primitive.Symbol("duration")}})
+	registerBuiltin(env, "time:tz", &primitive.Procedure{F: timeTzFn, Help: helpMap["time:tz"], Args: []primitive.Symbol{primitive.Symbol("time"), primitive.Symbol("zone")}})
+	registerBuiltin(env, "time:unix", &primitive.Procedure{F: timeUnixFn, Help: helpMap["time:unix"], Args: []primitive.Symbol{primitive.Symbol("time")}})
+	registerBuiltin(env, "timer:after", &primitive.Procedure{F: timerAfterFn, Help: helpMap["timer:after"], Args: []primitive.Symbol{primitive.Symbol("ms"), primitive.Symbol("function")}})
+	registerBuiltin(env, "timer:cancel", &primitive.Procedure{F: timerCancelFn, Help: helpMap["timer:cancel"], Args: []primitive.Symbol{primitive.Symbol("timer")}})
+	registerBuiltin(env, "timer:cron", &primitive.Procedure{F: timerCronFn, Help: helpMap["timer:cron"], Args: []primitive.Symbol{primitive.Symbol("expression"), primitive.Symbol("function")}})
+	registerBuiltin(env, "timer:every", &primitive.Procedure{F: timerEveryFn, Help: helpMap["timer:every"], Args: []primitive.Symbol{primitive.Symbol("ms"), primitive.Symbol("function")}})
 	registerBuiltin(env, "type", &primitive.Procedure{F: typeFn, Help: helpMap["type"], Args: []primitive.Symbol{primitive.Symbol("object")}})
+	registerBuiltin(env, "unsetenv", &primitive.Procedure{F: unsetenvFn, Help: helpMap["unsetenv"], Args: []primitive.Symbol{primitive.Symbol("key")}})
+	registerBuiltin(env, "url:build", &primitive.Procedure{F: urlBuildFn, Help: helpMap["url:build"], Args: []primitive.Symbol{primitive.Symbol("hash")}})
+	registerBuiltin(env, "url:decode", &primitive.Procedure{F: urlDecodeFn, Help: helpMap["url:decode"], Args: []primitive.Symbol{primitive.Symbol("string")}})
+	registerBuiltin(env, "url:encode", &primitive.Procedure{F: urlEncodeFn, Help: helpMap["url:encode"], Args: []primitive.Symbol{primitive.Symbol("string")}})
+	registerBuiltin(env, "url:parse", &primitive.Procedure{F: urlParseFn, Help: helpMap["url:parse"], Args: []primitive.Symbol{primitive.Symbol("string")}})
+	registerBuiltin(env, "uuid:v4", &primitive.Procedure{F: uuidV4Fn, Help: helpMap["uuid:v4"], Args: []primitive.Symbol{}})
+	registerBuiltin(env, "uuid:v7", &primitive.Procedure{F: uuidV7Fn, Help: helpMap["uuid:v7"], Args: []primitive.Symbol{}})
 	registerBuiltin(env, "vals", &primitive.Procedure{F: valsFn, Help: helpMap["vals"], Args: []primitive.Symbol{primitive.Symbol("hash")}})
+	registerBuiltin(env, "values", &primitive.Procedure{F: valuesFn, Help: helpMap["values"], Args: []primitive.Symbol{primitive.Symbol("&values")}})
+	registerBuiltin(env, "zip:create", &primitive.Procedure{F: zipCreateFn, Help: helpMap["zip:create"], Args: []primitive.Symbol{primitive.Symbol("archive"), primitive.Symbol("paths")}})
+	registerBuiltin(env, "zip:extract", &primitive.Procedure{F: zipExtractFn, Help: helpMap["zip:extract"], Args: []primitive.Symbol{primitive.Symbol("archive"), primitive.Symbol("directory")}})
+	registerBuiltin(env, "zip:list", &primitive.Procedure{F: zipListFn, Help: helpMap["zip:list"], Args: []primitive.Symbol{primitive.Symbol("archive")}})
+	registerBuiltin(env, "zlib:compress", &primitive.Procedure{F: zlibCompressFn, Help: helpMap["zlib:compress"], Args: []primitive.Symbol{primitive.Symbol("string")}})
+	registerBuiltin(env, "zlib:decompress", &primitive.Procedure{F: zlibDecompressFn, Help: helpMap["zlib:decompress"], Args: []primitive.Symbol{primitive.Symbol("string")}})
 
+	// Each interpreter has its own timers
+	newTimerQueue(env)
 }
 
 // Built in functions
@@ -307,6 +434,15 @@ func carFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive
 		return primitive.ArityError()
 	}
 
+	// A lazy sequence is computed as far as its first item
+	if seq, ok := args[0].(*primitive.LazySeq); ok {
+		first, _, _, err := seq.Next()
+		if err != nil {
+			return primitive.Error(err.Error())
+		}
+		return first
+	}
+
 	// ensure we received a list
 	if _, ok := args[0].(primitive.List); !ok {
 		return primitive.Error("argument not a list")
@@ -329,6 +465,15 @@ func cdrFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive
 		return primitive.ArityError()
 	}
 
+	// A lazy sequence is computed as far as its first item
+	if seq, ok := args[0].(*primitive.LazySeq); ok {
+		_, rest, _, err := seq.Next()
+		if err != nil {
+			return primitive.Error(err.Error())
+		}
+		return rest
+	}
+
 	// ensure we received a list
 	if _, ok := args[0].(primitive.List); !ok {
 		return primitive.Error("argument not a list")
@@ -434,6 +579,9 @@ func consFn(env *env.Environment, args []primitive.Primitive) primitive.Primitiv
 	if _, ok := args[1].(primitive.List); ok {
 		return append(primitive.List{args[0]}, args[1].(primitive.List)...)
 	}
+	if seq, ok := args[1].(*primitive.LazySeq); ok {
+		return primitive.LazyCons(args[0], seq)
+	}
 	return primitive.List{args[0], args[1]}
 }
 
@@ -643,6 +791,22 @@ func envFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive
 	return c
 }
 
+// environFn returns the environmental variables as a hash
+func environFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We take no arguments
+	if len(args) != 0 {
+		return primitive.ArityError()
+	}
+
+	ret := primitive.NewHash()
+	for _, ent := range os.Environ() {
+		name, val, _ := strings.Cut(ent, "=")
+		ret.Set(name, primitive.String(val))
+	}
+	return ret
+}
+
 // eqFn implements "eq"
 func eqFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
 	if len(args) != 2 {
@@ -669,6 +833,11 @@ func equalsFn(env *env.Environment, args []primitive.Primitive) primitive.Primit
 		return primitive.ArityError()
 	}
 
+	// Times are compared with other times
+	if _, ok := args[0].(primitive.Time); ok {
+		return timeEqualsFn(env, args)
+	}
+
 	// First argument must be a number.
 	nA, ok := args[0].(primitive.Number)
 	if !ok {
@@ -990,22 +1159,37 @@ func fileWriteFn(env *env.Environment, args []primitive.Primitive) primitive.Pri
 	return primitive.Nil{}
 }
 
+// forceFn is the implementation of (force ..)
+func forceFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	// Anything which isn't a promise is already a value
+	p, ok := args[0].(*primitive.Promise)
+	if !ok {
+		return args[0]
+	}
+	return p.Force()
+}
+
 // gensymFn is the implementation of (gensym ..)
 func gensymFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
-	// symbol characters
-	var letters = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
 
-	// generate prefix
-	b := make([]rune, 5)
-	for i := range b {
-		b[i] = letters[rand.Intn(len(letters))]
+	// The name may be given
+	name := "G"
+	if len(args) > 1 {
+		return primitive.ArityError()
 	}
-
-	// generate with count
-	symCount++
-	str := fmt.Sprintf("%s%06d", string(b), symCount)
-	sym := primitive.Symbol(str)
-	return sym
+	if len(args) == 1 {
+		switch args[0].(type) {
+		case primitive.String, primitive.Symbol:
+			name = args[0].ToString()
+		default:
+			return primitive.Error("argument not a string")
+		}
+	}
+	return primitive.Gensym(name)
 }
 
 // getFn is the implementation of `(get hash key)`
@@ -1119,23 +1303,8 @@ func helpFn(env *env.Environment, args []primitive.Primitive) primitive.Primitiv
 	// Return value
 	str := ""
 
-	for _, arg := range proc.Args {
-		if len(str) == 0 {
-			str = "Arguments"
-		}
-		str += " " + arg.ToString()
-
-		// Default value for this argument?
-		def, ok2 := proc.Defaults[arg]
-		if ok2 {
-			str += "[default:"
-			str += def.ToString()
-			str += "]"
-		}
-
-	}
-	if len(str) > 0 {
-		str += "\n"
+	if params := proc.Params(); params != "" {
+		str = "Arguments " + params + "\n"
 	}
 	str += proc.Help
 	return primitive.String(str)
@@ -1275,6 +1444,15 @@ func ltFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive
 		return primitive.ArityError()
 	}
 
+	// Times are compared with other times
+	if a, ok := args[0].(primitive.Time); ok {
+		b, ok := args[1].(primitive.Time)
+		if !ok {
+			return primitive.Error("argument not a time")
+		}
+		return primitive.Bool(time.Time(a).Before(time.Time(b)))
+	}
+
 	if _, ok := args[0].(primitive.Number); !ok {
 		return primitive.Error("argument not a number")
 	}
@@ -1448,6 +1626,15 @@ func nilFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive
 	if list, ok := args[0].(primitive.List); ok {
 		return primitive.Bool(len(list) == 0)
 	}
+
+	// as is an empty lazy sequence.
+	if seq, ok := args[0].(*primitive.LazySeq); ok {
+		_, _, found, err := seq.Next()
+		if err != nil {
+			return primitive.Error(err.Error())
+		}
+		return primitive.Bool(!found)
+	}
 	return primitive.Bool(false)
 
 }
@@ -1465,12 +1652,6 @@ func nthFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive
 		return primitive.ArityError()
 	}
 
-	// The argument must be a list
-	lst, ok := args[0].(primitive.List)
-	if !ok {
-		return primitive.Error("argument not a list")
-	}
-
 	// The second argument must be a number
 	num, ok2 := args[1].(primitive.Number)
 	if !ok2 {
@@ -1479,6 +1660,31 @@ func nthFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive
 
 	n := int(num)
 
+	// A lazy sequence is computed as far as the item we want
+	if seq, ok := args[0].(*primitive.LazySeq); ok {
+		var cur primitive.Primitive = seq
+		for i := 0; n >= 0; i++ {
+			first, rest, found, err := primitive.SeqNext(cur)
+			if err != nil {
+				return primitive.Error(err.Error())
+			}
+			if !found {
+				break
+			}
+			if i == n {
+				return first
+			}
+			cur = rest
+		}
+		return primitive.Error("out of bounds")
+	}
+
+	// The argument must be a list
+	lst, ok := args[0].(primitive.List)
+	if !ok {
+		return primitive.Error("argument not a list")
+	}
+
 	// Is it in bound?
 	if n >= 0 && n < len(lst) {
 		return lst[n]
@@ -1605,23 +1811,11 @@ func printFn(env *env.Environment, args []primitive.Primitive) primitive.Primiti
 	}
 
 	// OK format-string
-	frmt := expandStr(args[0].ToString())
-	parm := []any{}
-
-	for _, a := range args[1:] {
-
-		// If we can use ToNative then do that,
-		// otherwise fall back to outputting a string.
-		native, ok := a.(primitive.ToNative)
-		if ok {
-			parm = append(parm, native.ToInterface())
-		} else {
-			parm = append(parm, a.ToString())
-		}
+	out, err := formatString(expandStr(args[0].ToString()), args[1:])
+	if err != nil {
+		return primitive.Error(err.Error())
 	}
 
-	out := fmt.Sprintf(frmt, parm...)
-
 	// Write via our configuration object
 	// Linter complains about ignored return values here..
 	_, _ = ioHelper.STDOUT.Write([]byte(out))
@@ -1632,8 +1826,11 @@ func printFn(env *env.Environment, args []primitive.Primitive) primitive.Primiti
 
 // randomFn implements (random).
 func randomFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
-	if len(args) != 1 {
-		return primitive.ArityError()
+
+	// We need one argument, and an optional generator
+	gen, args, fail := generatorArgs(env, args, 1)
+	if fail != nil {
+		return fail
 	}
 
 	// ensure we received a number
@@ -1647,7 +1844,7 @@ func randomFn(env *env.Environment, args []primitive.Primitive) primitive.Primit
 		return primitive.Error("argument must be greater than zero")
 	}
 
-	return primitive.Number(rand.Intn(int(num)))
+	return primitive.Number(gen.Intn(int(num)))
 
 }
 
@@ -1669,6 +1866,30 @@ func setFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive
 	return args[2]
 }
 
+// setenvFn is the implementation of `(setenv "NAME" "value")`
+func setenvFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We need two arguments
+	if len(args) != 2 {
+		return primitive.ArityError()
+	}
+
+	// The name is a string
+	name, ok := args[0].(primitive.String)
+	if !ok {
+		return primitive.Error("argument not a string")
+	}
+	if name == "" {
+		return primitive.Error("environment variable name must not be empty")
+	}
+
+	err := os.Setenv(string(name), args[1].ToString())
+	if err != nil {
+		return primitive.Error(fmt.Sprintf("failed to set environment variable %s: %s", name, err))
+	}
+	return primitive.Nil{}
+}
+
 // sha1Fn runs a SHA1 hash
 func sha1Fn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
 	// We need one argument
@@ -1850,28 +2071,47 @@ func specialsFn(env *env.Environment, args []primitive.Primitive) primitive.Prim
 	specials := []string{
 		"$",
 		"alias",
+		"break",
+		"call/ec",
+		"continue",
 		"define",
+		"define-syntax",
 		"def!",
 		"defmacro!",
+		"delay",
 		"do",
+		"dolist",
+		"dotimes",
+		"dynamic-wind",
 		"eval",
 		"exit",
+		"for",
 		"forever",
+		"generator",
 		"if",
 		"lambda",
 		"fn*",
+		"lazy-seq",
+		"let",
 		"let*",
 		"macroexpand",
+		"macroexpand-1",
+		"macroexpand-all",
+		"match-case",
+		"multiple-value-bind",
 		"quasiquote",
 		"quote",
 		"read",
+		"receive",
 		"set!",
 		"struct",
 		"stdlib-start",
 		"stdlib-end",
 		"stdlib",
 		"symbol",
+		"syntax-rules",
 		"try",
+		"with-env",
 	}
 	var ret primitive.List
 	for _, entry := range specials {
@@ -1912,28 +2152,16 @@ func splitFn(env *env.Environment, args []primitive.Primitive) primitive.Primiti
 // (sprintf "fmt" "arg1" ... "argN")
 func sprintfFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
 
-	// we need 2+ arguments
-	if len(args) < 2 {
+	// we need a format-string
+	if len(args) < 1 {
 		return primitive.ArityError()
 	}
 
 	// OK format-string
-	frmt := expandStr(args[0].ToString())
-	parm := []any{}
-
-	for _, a := range args[1:] {
-
-		// If we can use ToNative then do that,
-		// otherwise fall back to outputting a string.
-		native, ok := a.(primitive.ToNative)
-		if ok {
-			parm = append(parm, native.ToInterface())
-		} else {
-			parm = append(parm, a.ToString())
-		}
+	out, err := formatString(expandStr(args[0].ToString()), args[1:])
+	if err != nil {
+		return primitive.Error(err.Error())
 	}
-
-	out := fmt.Sprintf(frmt, parm...)
 	return primitive.String(out)
 }
 
@@ -2040,6 +2268,30 @@ func typeFn(env *env.Environment, args []primitive.Primitive) primitive.Primitiv
 	return primitive.String(args[0].Type())
 }
 
+// unsetenvFn is the implementation of `(unsetenv "NAME")`
+func unsetenvFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We need a single argument
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	// Which is a string
+	name, ok := args[0].(primitive.String)
+	if !ok {
+		return primitive.Error("argument not a string")
+	}
+	if name == "" {
+		return primitive.Error("environment variable name must not be empty")
+	}
+
+	err := os.Unsetenv(string(name))
+	if err != nil {
+		return primitive.Error(fmt.Sprintf("failed to unset environment variable %s: %s", name, err))
+	}
+	return primitive.Nil{}
+}
+
 // valsFn is the implementation of `(vals hash)`
 func valsFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
 
@@ -2077,3 +2329,8 @@ func valsFn(env *env.Environment, args []primitive.Primitive) primitive.Primitiv
 
 	return c
 }
+
+// valuesFn implements "values"
+func valuesFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+	return primitive.Values(args)
+}
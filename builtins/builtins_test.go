@@ -1827,10 +1827,36 @@ func TestGenSym(t *testing.T) {
 	out := gensymFn(ENV, []primitive.Primitive{})
 
 	// Will lead to a symbol
-	_, ok := out.(primitive.Symbol)
+	sym, ok := out.(primitive.Symbol)
 	if !ok {
 		t.Fatalf("expected symbol, got %v", out)
 	}
+
+	// Which is unique
+	if gensymFn(ENV, []primitive.Primitive{}) == sym {
+		t.Fatalf("expected a unique symbol")
+	}
+
+	// And has a space, so it cannot be read
+	if !strings.Contains(string(sym), " ") {
+		t.Fatalf("expected an unreadable symbol, got %v", sym)
+	}
+
+	// Given a name
+	out = gensymFn(ENV, []primitive.Primitive{primitive.String("tmp")})
+	if !strings.HasPrefix(out.ToString(), "#<tmp ") {
+		t.Fatalf("expected a symbol based on the name, got %v", out)
+	}
+
+	// Which must be a string or symbol
+	out = gensymFn(ENV, []primitive.Primitive{primitive.Number(3)})
+	if _, ok := out.(primitive.Error); !ok {
+		t.Fatalf("expected error, got %v", out)
+	}
+	out = gensymFn(ENV, []primitive.Primitive{primitive.String("a"), primitive.String("b")})
+	if out != primitive.ArityError() {
+		t.Fatalf("expected arity error, got %v", out)
+	}
 }
 
 // TestGet tests get
@@ -1928,6 +1954,94 @@ func TestGetenv(t *testing.T) {
 
 }
 
+func TestSetenv(t *testing.T) {
+
+	// No arguments
+	out := setenvFn(ENV, []primitive.Primitive{})
+	if out != primitive.ArityError() {
+		t.Fatalf("expected arity error, got %v", out)
+	}
+
+	// Name that isn't a string
+	out = setenvFn(ENV, []primitive.Primitive{
+		primitive.Number(3),
+		primitive.String("foo"),
+	})
+	if !strings.Contains(out.ToString(), "not a string") {
+		t.Fatalf("got error, but wrong one %v", out)
+	}
+
+	// Bogus name
+	out = setenvFn(ENV, []primitive.Primitive{
+		primitive.String(""),
+		primitive.String("foo"),
+	})
+	if !strings.Contains(out.ToString(), "must not be empty") {
+		t.Fatalf("got error, but wrong one %v", out)
+	}
+
+	// Valid set
+	out = setenvFn(ENV, []primitive.Primitive{
+		primitive.String("YAL_TEST"),
+		primitive.Number(3),
+	})
+	if !primitive.IsNil(out) {
+		t.Fatalf("expected nil, got %v", out)
+	}
+	defer os.Unsetenv("YAL_TEST")
+
+	if os.Getenv("YAL_TEST") != "3" {
+		t.Fatalf("setenv didn't update the environment")
+	}
+
+	// It should now be visible via environ
+	out = environFn(ENV, []primitive.Primitive{})
+	hsh, ok := out.(primitive.Hash)
+	if !ok {
+		t.Fatalf("expected hash, got %v", out)
+	}
+	if hsh.Get("YAL_TEST").ToString() != "3" {
+		t.Fatalf("environ had the wrong value %v", hsh.Get("YAL_TEST"))
+	}
+
+	// environ takes no arguments
+	out = environFn(ENV, []primitive.Primitive{primitive.String("YAL_TEST")})
+	if out != primitive.ArityError() {
+		t.Fatalf("expected arity error, got %v", out)
+	}
+}
+
+func TestUnsetenv(t *testing.T) {
+
+	// No arguments
+	out := unsetenvFn(ENV, []primitive.Primitive{})
+	if out != primitive.ArityError() {
+		t.Fatalf("expected arity error, got %v", out)
+	}
+
+	// Name that isn't a string
+	out = unsetenvFn(ENV, []primitive.Primitive{primitive.Number(3)})
+	if !strings.Contains(out.ToString(), "not a string") {
+		t.Fatalf("got error, but wrong one %v", out)
+	}
+
+	// Empty name
+	out = unsetenvFn(ENV, []primitive.Primitive{primitive.String("")})
+	if !strings.Contains(out.ToString(), "must not be empty") {
+		t.Fatalf("got error, but wrong one %v", out)
+	}
+
+	os.Setenv("YAL_TEST", "set")
+	out = unsetenvFn(ENV, []primitive.Primitive{primitive.String("YAL_TEST")})
+	if !primitive.IsNil(out) {
+		t.Fatalf("expected nil, got %v", out)
+	}
+
+	if _, found := os.LookupEnv("YAL_TEST"); found {
+		t.Fatalf("unsetenv didn't remove the variable")
+	}
+}
+
 // TestGlob tests glob
 func TestGlob(t *testing.T) {
 
@@ -2010,6 +2124,7 @@ func TestHash(t *testing.T) {
 		md5Fn,
 		sha1Fn,
 		sha256Fn,
+		sha512Fn,
 	}
 
 	for _, fn := range funs {
@@ -3259,6 +3374,34 @@ func TestPrint(t *testing.T) {
 		t.Fatalf("got string, but wrong one %v", e2)
 	}
 
+	// A "~" which isn't a directive is output literally
+	out = printFn(ENV, []primitive.Primitive{
+		primitive.String("path ~/x %s"),
+		primitive.String("a"),
+	})
+
+	e2, ok2 = out.(primitive.String)
+	if !ok2 {
+		t.Fatalf("expected string, got %v", out)
+	}
+	if e2 != "path ~/x a" {
+		t.Fatalf("got string, but wrong one %v", e2)
+	}
+
+	// An argument which doesn't match the format
+	out = printFn(ENV, []primitive.Primitive{
+		primitive.String("Hello %d!"),
+		primitive.Number(3.5),
+	})
+
+	e, ok = out.(primitive.Error)
+	if !ok {
+		t.Fatalf("expected error, got %v", out)
+	}
+	if !strings.Contains(string(e), "%d expects an integer") {
+		t.Fatalf("got error, but wrong one %v", out)
+	}
+
 	// Preserve the current config
 	orig := ENV.GetIOConfig()
 
@@ -3683,6 +3826,48 @@ func TestSprintf(t *testing.T) {
 	if e2 != "Hello 3!" {
 		t.Fatalf("got string, but wrong one %v", e2)
 	}
+
+	// A format-string alone
+	out = sprintfFn(ENV, []primitive.Primitive{
+		primitive.String("100%%~%"),
+	})
+
+	e2, ok2 = out.(primitive.String)
+	if !ok2 {
+		t.Fatalf("expected string, got %v", out)
+	}
+	if e2 != "100%\n" {
+		t.Fatalf("got string, but wrong one %v", e2)
+	}
+
+	// A "~" which isn't a directive is output literally
+	out = sprintfFn(ENV, []primitive.Primitive{
+		primitive.String("path ~/x %s"),
+		primitive.String("a"),
+	})
+
+	e2, ok2 = out.(primitive.String)
+	if !ok2 {
+		t.Fatalf("expected string, got %v", out)
+	}
+	if e2 != "path ~/x a" {
+		t.Fatalf("got string, but wrong one %v", e2)
+	}
+
+	// Too many arguments
+	out = sprintfFn(ENV, []primitive.Primitive{
+		primitive.String("~a"),
+		primitive.Number(3),
+		primitive.Number(4),
+	})
+
+	e, ok = out.(primitive.Error)
+	if !ok {
+		t.Fatalf("expected error, got %v", out)
+	}
+	if !strings.Contains(string(e), "too many arguments") {
+		t.Fatalf("got error, but wrong one %v", out)
+	}
 }
 
 func TestStr(t *testing.T) {
@@ -3997,3 +4182,111 @@ func TestVals(t *testing.T) {
 		t.Fatalf("not a sorted list?")
 	}
 }
+
+func TestValues(t *testing.T) {
+
+	// no arguments
+	out := valuesFn(ENV, []primitive.Primitive{})
+
+	// Will lead to no values
+	v, ok := out.(primitive.Values)
+	if !ok {
+		t.Fatalf("expected values, got %v", out)
+	}
+	if len(v) != 0 {
+		t.Fatalf("expected no values, got %v", v)
+	}
+
+	// Two arguments
+	out = valuesFn(ENV, []primitive.Primitive{
+		primitive.Number(3),
+		primitive.String("x"),
+	})
+
+	v, ok = out.(primitive.Values)
+	if !ok {
+		t.Fatalf("expected values, got %v", out)
+	}
+	if len(v) != 2 || v.ToString() != "3 x" {
+		t.Fatalf("got wrong values %v", v)
+	}
+}
+
+func TestForce(t *testing.T) {
+
+	// No arguments
+	out := forceFn(ENV, []primitive.Primitive{})
+
+	// Will lead to an error
+	e, ok := out.(primitive.Error)
+	if !ok {
+		t.Fatalf("expected error, got %v", out)
+	}
+	if e != primitive.ArityError() {
+		t.Fatalf("got error, but wrong one %v", out)
+	}
+
+	// Anything which isn't a promise is returned
+	out = forceFn(ENV, []primitive.Primitive{primitive.Number(3)})
+	if out.ToString() != "3" {
+		t.Fatalf("expected 3, got %v", out)
+	}
+
+	// A promise is forced
+	p := primitive.NewPromise(func() primitive.Primitive {
+		return primitive.String("steve")
+	})
+	out = forceFn(ENV, []primitive.Primitive{p})
+	if out.ToString() != "steve" {
+		t.Fatalf("expected steve, got %v", out)
+	}
+}
+
+func TestLazySequences(t *testing.T) {
+
+	// a sequence of 1, 2
+	seq := func() *primitive.LazySeq {
+		return primitive.NewLazySeq(func() primitive.Primitive {
+			return primitive.List{primitive.Number(1), primitive.Number(2)}
+		})
+	}
+	empty := primitive.NewLazySeq(func() primitive.Primitive {
+		return primitive.Nil{}
+	})
+	failed := primitive.NewLazySeq(func() primitive.Primitive {
+		return primitive.Error("bogus")
+	})
+
+	tests := []struct {
+		name   string
+		out    primitive.Primitive
+		result string
+	}{
+		{"car", carFn(ENV, []primitive.Primitive{seq()}), "1"},
+		{"car empty", carFn(ENV, []primitive.Primitive{empty}), "nil"},
+		{"car error", carFn(ENV, []primitive.Primitive{failed}), "ERROR{bogus}"},
+		{"cdr", cdrFn(ENV, []primitive.Primitive{seq()}), "(2)"},
+		{"cdr empty", cdrFn(ENV, []primitive.Primitive{empty}), "nil"},
+		{"cdr error", cdrFn(ENV, []primitive.Primitive{failed}), "ERROR{bogus}"},
+		{"cons", consFn(ENV, []primitive.Primitive{primitive.Number(0), seq()}), "(0 1 2)"},
+		{"nil?", nilFn(ENV, []primitive.Primitive{seq()}), "#f"},
+		{"nil? empty", nilFn(ENV, []primitive.Primitive{empty}), "#t"},
+		{"nil? error", nilFn(ENV, []primitive.Primitive{failed}), "ERROR{bogus}"},
+		{"nth", nthFn(ENV, []primitive.Primitive{seq(), primitive.Number(1)}), "2"},
+		{"nth bounds", nthFn(ENV, []primitive.Primitive{seq(), primitive.Number(2)}), "ERROR{out of bounds}"},
+		{"nth negative", nthFn(ENV, []primitive.Primitive{seq(), primitive.Number(-1)}), "ERROR{out of bounds}"},
+		{"nth error", nthFn(ENV, []primitive.Primitive{failed, primitive.Number(0)}), "ERROR{bogus}"},
+	}
+
+	for _, test := range tests {
+		if test.out.ToString() != test.result {
+			t.Fatalf("%s: expected %s, got %s", test.name, test.result, test.out.ToString())
+		}
+	}
+
+	// cons keeps the sequence lazy
+	out := consFn(ENV, []primitive.Primitive{primitive.Number(0), seq()})
+	if _, ok := out.(*primitive.LazySeq); !ok {
+		t.Fatalf("expected a lazy sequence, got %v", out)
+	}
+}
@@ -0,0 +1,219 @@
+// compress.go - Implementation of our compression primitives.
+//
+// Strings may be compressed with gzip, or zlib, and files may be
+// compressed with gzip in the same way as the gzip/gunzip commands,
+// though the original file is left alone.
+//
+// Compressed data is binary, so it is returned as a string containing
+// arbitrary bytes, which may be written via (file:write) or encoded via
+// (encode:base64).
+
+package builtins
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/skx/yal/env"
+	"github.com/skx/yal/primitive"
+)
+
+// compressArg returns the single string argument of a compression
+// function.
+func compressArg(args []primitive.Primitive) (string, primitive.Primitive) {
+
+	// We only need a single argument
+	if len(args) != 1 {
+		return "", primitive.ArityError()
+	}
+
+	// Which is a string
+	str, ok := args[0].(primitive.String)
+	if !ok {
+		return "", primitive.Error("argument not a string")
+	}
+	return string(str), nil
+}
+
+// compressString compresses the given string with the writer returned
+// by the given function.
+func compressString(str string, writer func(w io.Writer) io.WriteCloser) primitive.Primitive {
+
+	var buf bytes.Buffer
+	w := writer(&buf)
+
+	_, err := io.WriteString(w, str)
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		return primitive.Error(fmt.Sprintf("failed to compress:%s", err))
+	}
+	return primitive.String(buf.String())
+}
+
+// decompressString decompresses the given string, with the reader
+// returned by the given function.
+func decompressString(str string, name string, reader func(r io.Reader) (io.ReadCloser, error)) primitive.Primitive {
+
+	r, err := reader(strings.NewReader(str))
+	if err != nil {
+		return primitive.Error(fmt.Sprintf("failed to decompress %s:%s", name, err))
+	}
+	defer r.Close()
+
+	out, err := io.ReadAll(r)
+	if err != nil {
+		return primitive.Error(fmt.Sprintf("failed to decompress %s:%s", name, err))
+	}
+	return primitive.String(out)
+}
+
+// gzipFileArgs returns the source, and destination, of a file which
+// is to be compressed or decompressed.
+//
+// If there is no destination the given function is used to derive it
+// from the source.
+func gzipFileArgs(args []primitive.Primitive, dest func(src string) (string, primitive.Primitive)) (string, string, primitive.Primitive) {
+
+	// We need one or two arguments
+	if len(args) != 1 && len(args) != 2 {
+		return "", "", primitive.ArityError()
+	}
+
+	// All of which are strings
+	for _, arg := range args {
+		if _, ok := arg.(primitive.String); !ok {
+			return "", "", primitive.Error("argument not a string")
+		}
+	}
+
+	src := args[0].ToString()
+	if len(args) == 2 {
+		return src, args[1].ToString(), nil
+	}
+
+	dst, fail := dest(src)
+	return src, dst, fail
+}
+
+// copyFile copies the source file to the destination, via the given
+// function which wraps the reader and writer.
+//
+// If anything fails the partial destination file is removed.
+func copyFile(src string, dst string, copyFn func(w io.Writer, r io.Reader) error) primitive.Primitive {
+
+	in, err := os.Open(src)
+	if err != nil {
+		return primitive.Error(fmt.Sprintf("failed to open %s:%s", src, err))
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return primitive.Error(fmt.Sprintf("failed to create %s:%s", dst, err))
+	}
+
+	err = copyFn(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return primitive.Error(fmt.Sprintf("failed to write %s:%s", dst, err))
+	}
+	return primitive.String(dst)
+}
+
+// gzipCompressFn implements (gzip:compress)
+func gzipCompressFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	str, fail := compressArg(args)
+	if fail != nil {
+		return fail
+	}
+
+	return compressString(str, func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })
+}
+
+// gzipCompressFileFn implements (gzip:compress-file)
+func gzipCompressFileFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	src, dst, fail := gzipFileArgs(args, func(src string) (string, primitive.Primitive) {
+		return src + ".gz", nil
+	})
+	if fail != nil {
+		return fail
+	}
+
+	return copyFile(src, dst, func(w io.Writer, r io.Reader) error {
+		gz := gzip.NewWriter(w)
+		if _, err := io.Copy(gz, r); err != nil {
+			return err
+		}
+		return gz.Close()
+	})
+}
+
+// gzipDecompressFn implements (gzip:decompress)
+func gzipDecompressFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	str, fail := compressArg(args)
+	if fail != nil {
+		return fail
+	}
+
+	return decompressString(str, "gzip", func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) })
+}
+
+// gzipDecompressFileFn implements (gzip:decompress-file)
+func gzipDecompressFileFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	src, dst, fail := gzipFileArgs(args, func(src string) (string, primitive.Primitive) {
+		if !strings.HasSuffix(src, ".gz") || src == ".gz" {
+			return "", primitive.Error(fmt.Sprintf("cannot derive an output name from %s, which lacks a .gz suffix", src))
+		}
+		return strings.TrimSuffix(src, ".gz"), nil
+	})
+	if fail != nil {
+		return fail
+	}
+
+	return copyFile(src, dst, func(w io.Writer, r io.Reader) error {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+
+		_, err = io.Copy(w, gz)
+		return err
+	})
+}
+
+// zlibCompressFn implements (zlib:compress)
+func zlibCompressFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	str, fail := compressArg(args)
+	if fail != nil {
+		return fail
+	}
+
+	return compressString(str, func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) })
+}
+
+// zlibDecompressFn implements (zlib:decompress)
+func zlibDecompressFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	str, fail := compressArg(args)
+	if fail != nil {
+		return fail
+	}
+
+	return decompressString(str, "zlib", zlib.NewReader)
+}
@@ -0,0 +1,148 @@
+package builtins
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skx/yal/primitive"
+)
+
+// TestCompressArguments ensures our compression-functions reject bogus
+// arguments.
+func TestCompressArguments(t *testing.T) {
+
+	type TC struct {
+		fn   primitive.GolangPrimitiveFn
+		args []primitive.Primitive
+		err  string
+	}
+
+	str := primitive.String("steve")
+
+	tests := []TC{
+		{gzipCompressFn, []primitive.Primitive{}, string(primitive.ArityError())},
+		{gzipCompressFn, []primitive.Primitive{primitive.Number(3)}, "not a string"},
+		{gzipDecompressFn, []primitive.Primitive{str, str}, string(primitive.ArityError())},
+		{gzipDecompressFn, []primitive.Primitive{str}, "failed to decompress gzip"},
+		{zlibCompressFn, []primitive.Primitive{primitive.Bool(true)}, "not a string"},
+		{zlibDecompressFn, []primitive.Primitive{}, string(primitive.ArityError())},
+		{zlibDecompressFn, []primitive.Primitive{str}, "failed to decompress zlib"},
+		{gzipCompressFileFn, []primitive.Primitive{}, string(primitive.ArityError())},
+		{gzipCompressFileFn, []primitive.Primitive{str, primitive.Number(3)}, "not a string"},
+		{gzipCompressFileFn, []primitive.Primitive{primitive.String("/fdsf/fdsf/-path-not/exists")}, "failed to open"},
+		{gzipCompressFileFn, []primitive.Primitive{primitive.String(os.Args[0]), primitive.String("/fdsf/fdsf/-path-not/exists.gz")}, "failed to create"},
+		{gzipDecompressFileFn, []primitive.Primitive{str, str, str}, string(primitive.ArityError())},
+		{gzipDecompressFileFn, []primitive.Primitive{str}, "lacks a .gz suffix"},
+		{gzipDecompressFileFn, []primitive.Primitive{primitive.String("/fdsf/fdsf/-path-not/exists.gz")}, "failed to open"},
+	}
+
+	for _, test := range tests {
+		out := test.fn(ENV, test.args)
+
+		e, ok := out.(primitive.Error)
+		if !ok {
+			t.Fatalf("expected error for %v, got %v", test.args, out)
+		}
+		if !strings.Contains(string(e), test.err) {
+			t.Fatalf("got error for %v, but wrong one %v", test.args, out)
+		}
+	}
+}
+
+// TestCompressString tests compressing, and decompressing, strings.
+func TestCompressString(t *testing.T) {
+
+	input := primitive.String(strings.Repeat("Hello, World!\n", 100))
+
+	type TC struct {
+		compress   primitive.GolangPrimitiveFn
+		decompress primitive.GolangPrimitiveFn
+		magic      string
+	}
+
+	tests := []TC{
+		{gzipCompressFn, gzipDecompressFn, "\x1f\x8b"},
+		{zlibCompressFn, zlibDecompressFn, "\x78"},
+	}
+
+	for _, test := range tests {
+		out := test.compress(ENV, []primitive.Primitive{input})
+		str, ok := out.(primitive.String)
+		if !ok {
+			t.Fatalf("expected string, got %v", out)
+		}
+		if !strings.HasPrefix(string(str), test.magic) {
+			t.Fatalf("output doesn't look compressed %q", str)
+		}
+		if len(str) >= len(input) {
+			t.Fatalf("output isn't smaller than the input")
+		}
+
+		out = test.decompress(ENV, []primitive.Primitive{str})
+		if out != input {
+			t.Fatalf("round-trip failed, got %v", out)
+		}
+	}
+}
+
+// TestCompressFile tests compressing, and decompressing, files.
+func TestCompressFile(t *testing.T) {
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	content := strings.Repeat("log line\n", 1000)
+
+	err := os.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("failed to write file:%s", err)
+	}
+
+	// Compress, with the default name
+	out := gzipCompressFileFn(ENV, []primitive.Primitive{primitive.String(path)})
+	if out.ToString() != path+".gz" {
+		t.Fatalf("unexpected result %v", out)
+	}
+
+	// The original is untouched, and the result is the same as
+	// compressing the string.
+	data, err := os.ReadFile(path + ".gz")
+	if err != nil {
+		t.Fatalf("failed to read compressed file:%s", err)
+	}
+	if gzipDecompressFn(ENV, []primitive.Primitive{primitive.String(data)}).ToString() != content {
+		t.Fatalf("compressed file has the wrong contents")
+	}
+
+	// Decompress, with the default name, after removing the original.
+	os.Remove(path)
+	out = gzipDecompressFileFn(ENV, []primitive.Primitive{primitive.String(path + ".gz")})
+	if out.ToString() != path {
+		t.Fatalf("unexpected result %v", out)
+	}
+	data, err = os.ReadFile(path)
+	if err != nil || string(data) != content {
+		t.Fatalf("decompressed file has the wrong contents:%s", err)
+	}
+
+	// Decompress, to a specific name
+	dst := filepath.Join(dir, "copy")
+	out = gzipDecompressFileFn(ENV, []primitive.Primitive{primitive.String(path + ".gz"), primitive.String(dst)})
+	if out.ToString() != dst {
+		t.Fatalf("unexpected result %v", out)
+	}
+
+	// Decompressing something which isn't compressed fails, and
+	// leaves nothing behind.
+	bogus := filepath.Join(dir, "bogus.gz")
+	os.WriteFile(bogus, []byte("not compressed"), 0644)
+
+	out = gzipDecompressFileFn(ENV, []primitive.Primitive{primitive.String(bogus)})
+	if !strings.Contains(out.ToString(), "failed to write") {
+		t.Fatalf("expected error, got %v", out)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "bogus")); err == nil {
+		t.Fatalf("partial output was left behind")
+	}
+}
@@ -0,0 +1,216 @@
+// cron.go - A parser for cron-expressions.
+//
+// We support the traditional five fields; minute, hour, day of month,
+// month, and day of week.  Each field may contain "*", a number, a range
+// "1-5", or a list "1,3,5", and any of those may be followed by a step
+// "*/15".  Months and days of the week may be given by name.
+//
+// The shortcuts "@yearly", "@monthly", "@weekly", "@daily", and "@hourly"
+// are also recognized.
+
+package builtins
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronShortcuts contains the expansions of the "@" forms.
+var cronShortcuts = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronField describes one of the fields of a cron-expression.
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names []string
+}
+
+// cronFields are the fields of a cron-expression, in order.
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"", "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// cronSchedule is a parsed cron-expression.
+//
+// Each field is stored as a bitmask of the values which match.
+type cronSchedule struct {
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+
+	// If both the day of the month, and the day of the week, are
+	// restricted then a time matching either will fire.
+	domStar bool
+	dowStar bool
+}
+
+// value parses a single value of the given field, which might be a name.
+func (f cronField) value(str string) (int, error) {
+
+	for i, name := range f.names {
+		if name != "" && strings.EqualFold(str, name) {
+			return i, nil
+		}
+	}
+
+	n, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s '%s'", f.name, str)
+	}
+	if n < f.min || n > f.max {
+		return 0, fmt.Errorf("%s '%s' out of range %d-%d", f.name, str, f.min, f.max)
+	}
+	return n, nil
+}
+
+// parse parses the given field, returning a bitmask of matching values.
+func (f cronField) parse(str string) (uint64, error) {
+
+	var mask uint64
+
+	for _, part := range strings.Split(str, ",") {
+
+		// Is there a step?
+		step := 1
+		rng, stp, found := strings.Cut(part, "/")
+		if found {
+			var err error
+			step, err = strconv.Atoi(stp)
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step '%s' for %s", stp, f.name)
+			}
+		}
+
+		// The range of values
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+
+			var err error
+			lo, err = f.value(a)
+			if err != nil {
+				return 0, err
+			}
+
+			hi = lo
+			if isRange {
+				hi, err = f.value(b)
+				if err != nil {
+					return 0, err
+				}
+			} else if found {
+				// "5/10" means from 5 onwards
+				hi = f.max
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("invalid range '%s' for %s", rng, f.name)
+			}
+		}
+
+		for i := lo; i <= hi; i += step {
+			mask |= 1 << uint(i)
+		}
+	}
+	return mask, nil
+}
+
+// parseCron parses the given cron-expression.
+func parseCron(expr string) (*cronSchedule, error) {
+
+	if short, ok := cronShortcuts[strings.ToLower(expr)]; ok {
+		expr = short
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("expected %d fields in cron-expression '%s', got %d", len(cronFields), expr, len(fields))
+	}
+
+	masks := make([]uint64, len(fields))
+	for i, field := range fields {
+		var err error
+		masks[i], err = cronFields[i].parse(field)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s := &cronSchedule{
+		minute:  masks[0],
+		hour:    masks[1],
+		dom:     masks[2],
+		month:   masks[3],
+		dow:     masks[4],
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}
+
+	// Sunday may be specified as either 0 or 7
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+// matchDay returns true if the given day matches the schedule.
+func (s *cronSchedule) matchDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// next returns the first time, after the given one, which matches the
+// schedule.
+//
+// If there is no such time within five years, the zero time is returned.
+func (s *cronSchedule) next(t time.Time) time.Time {
+
+	loc := t.Location()
+
+	// Start at the beginning of the next minute
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,145 @@
+// digest.go - Implementation of our digest primitives.
+//
+// (md5), (sha1), and (sha256) are implemented alongside the other
+// builtins, here we have the remaining digests, keyed hashing, and the
+// hashing of files.
+//
+// As with the originals all digests are returned as upper-case hex.
+
+package builtins
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/skx/yal/env"
+	"github.com/skx/yal/primitive"
+)
+
+// digests contains the digests we support, by name.
+var digests = map[string]func() hash.Hash{
+	"crc32":  func() hash.Hash { return crc32.NewIEEE() },
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// digestArg returns the constructor of the digest named by the given
+// argument.
+func digestArg(arg primitive.Primitive) (func() hash.Hash, primitive.Primitive) {
+
+	str, ok := arg.(primitive.String)
+	if !ok {
+		return nil, primitive.Error("argument not a string")
+	}
+
+	fn, ok := digests[strings.ToLower(string(str))]
+	if !ok {
+		return nil, primitive.Error(fmt.Sprintf("unknown digest %s", str))
+	}
+	return fn, nil
+}
+
+// crc32Fn implements (crc32)
+func crc32Fn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+	// We need one argument
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	// The argument must be a string
+	str := args[0].ToString()
+
+	// Get the output
+	return primitive.String(fmt.Sprintf("%08X", crc32.ChecksumIEEE([]byte(str))))
+}
+
+// fileDigestFn implements (file:digest)
+//
+// The file is streamed through the digest, so it need not fit in memory.
+func fileDigestFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We need one or two arguments
+	if len(args) != 1 && len(args) != 2 {
+		return primitive.ArityError()
+	}
+
+	path, ok := args[0].(primitive.String)
+	if !ok {
+		return primitive.Error("argument not a string")
+	}
+
+	// Default to SHA256
+	newHash := sha256.New
+	if len(args) == 2 {
+		var fail primitive.Primitive
+		newHash, fail = digestArg(args[1])
+		if fail != nil {
+			return fail
+		}
+	}
+
+	file, err := os.Open(string(path))
+	if err != nil {
+		return primitive.Error(fmt.Sprintf("failed to open %s:%s", path, err))
+	}
+	defer file.Close()
+
+	h := newHash()
+	_, err = io.Copy(h, file)
+	if err != nil {
+		return primitive.Error(fmt.Sprintf("failed to read %s:%s", path, err))
+	}
+
+	return primitive.String(fmt.Sprintf("%X", h.Sum(nil)))
+}
+
+// hmacFn implements (hmac)
+func hmacFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We need three arguments
+	if len(args) != 3 {
+		return primitive.ArityError()
+	}
+
+	newHash, fail := digestArg(args[0])
+	if fail != nil {
+		return fail
+	}
+
+	// A checksum isn't suitable
+	if strings.EqualFold(args[0].ToString(), "crc32") {
+		return primitive.Error("crc32 cannot be used for hmac")
+	}
+
+	key := args[1].ToString()
+	msg := args[2].ToString()
+
+	mac := hmac.New(newHash, []byte(key))
+	mac.Write([]byte(msg))
+	return primitive.String(fmt.Sprintf("%X", mac.Sum(nil)))
+}
+
+// sha512Fn runs a SHA512 hash
+func sha512Fn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+	// We need one argument
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	// The argument must be a string
+	str := args[0].ToString()
+
+	// Get the output
+	return primitive.String(fmt.Sprintf("%X", sha512.Sum512([]byte(str))))
+}
@@ -0,0 +1,163 @@
+package builtins
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/skx/yal/primitive"
+)
+
+// TestDigestArguments ensures our digest-functions reject bogus arguments.
+func TestDigestArguments(t *testing.T) {
+
+	type TC struct {
+		fn   primitive.GolangPrimitiveFn
+		args []primitive.Primitive
+		err  string
+	}
+
+	str := primitive.String("steve")
+
+	tests := []TC{
+		{crc32Fn, []primitive.Primitive{}, string(primitive.ArityError())},
+		{sha512Fn, []primitive.Primitive{str, str}, string(primitive.ArityError())},
+		{fileDigestFn, []primitive.Primitive{}, string(primitive.ArityError())},
+		{fileDigestFn, []primitive.Primitive{primitive.Number(3)}, "not a string"},
+		{fileDigestFn, []primitive.Primitive{str, primitive.Number(3)}, "not a string"},
+		{fileDigestFn, []primitive.Primitive{str, primitive.String("sha3")}, "unknown digest"},
+		{fileDigestFn, []primitive.Primitive{primitive.String("/fdsf/fdsf/-path-not/exists")}, "failed to open"},
+		{fileDigestFn, []primitive.Primitive{primitive.String(os.TempDir())}, "failed to read"},
+		{hmacFn, []primitive.Primitive{str, str}, string(primitive.ArityError())},
+		{hmacFn, []primitive.Primitive{primitive.Number(3), str, str}, "not a string"},
+		{hmacFn, []primitive.Primitive{str, str, str}, "unknown digest"},
+		{hmacFn, []primitive.Primitive{primitive.String("CRC32"), str, str}, "cannot be used"},
+		{randomBytesFn, []primitive.Primitive{}, string(primitive.ArityError())},
+		{randomBytesFn, []primitive.Primitive{str}, "not a number"},
+		{randomBytesFn, []primitive.Primitive{primitive.Number(0)}, "greater than zero"},
+		{randomTokenFn, []primitive.Primitive{primitive.Number(1), primitive.Number(1)}, string(primitive.ArityError())},
+		{randomTokenFn, []primitive.Primitive{primitive.Number(-1)}, "greater than zero"},
+		{uuidV4Fn, []primitive.Primitive{str}, string(primitive.ArityError())},
+		{uuidV7Fn, []primitive.Primitive{str}, string(primitive.ArityError())},
+	}
+
+	for _, test := range tests {
+		out := test.fn(ENV, test.args)
+
+		e, ok := out.(primitive.Error)
+		if !ok {
+			t.Fatalf("expected error for %v, got %v", test.args, out)
+		}
+		if !strings.Contains(string(e), test.err) {
+			t.Fatalf("got error for %v, but wrong one %v", test.args, out)
+		}
+	}
+}
+
+// TestDigest tests our digests against known values.
+func TestDigest(t *testing.T) {
+
+	type TC struct {
+		fn     primitive.GolangPrimitiveFn
+		args   []primitive.Primitive
+		output string
+	}
+
+	fox := primitive.String("The quick brown fox jumps over the lazy dog")
+
+	tests := []TC{
+		{crc32Fn, []primitive.Primitive{primitive.String("steve")}, "96AC18A5"},
+		{sha512Fn, []primitive.Primitive{primitive.String("steve")}, "3EA1FE205C3D228CE053D97C29A94476A18D683B70A347693D5EAC9AC985C6FDB556985FC8FC17BF1E9F8980CEF3340CE62760F21D14A5C9EED43424D6359E72"},
+		{hmacFn, []primitive.Primitive{primitive.String("sha256"), primitive.String("key"), fox}, "F7BC83F430538424B13298E6AA6FB143EF4D59A14946175997479DBC2D1A3CD8"},
+		{hmacFn, []primitive.Primitive{primitive.String("MD5"), primitive.String("key"), fox}, "80070713463E7749B90C2DC24911E275"},
+	}
+
+	for _, test := range tests {
+		out := test.fn(ENV, test.args)
+		if out.ToString() != test.output {
+			t.Fatalf("expected '%s' for %v, got '%s'", test.output, test.args, out)
+		}
+	}
+}
+
+// TestFileDigest tests hashing the contents of a file.
+func TestFileDigest(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "input")
+	err := os.WriteFile(path, []byte("line one\nline two\n"), 0644)
+	if err != nil {
+		t.Fatalf("failed to write file:%s", err)
+	}
+
+	type TC struct {
+		digest string
+		output string
+	}
+
+	tests := []TC{
+		{"", "E9024F1A07D29D52AD3AA5E1A18E94DB1F3A9FD32B89E39D47C472CD99071E13"},
+		{"sha1", "97059669371ED42A72435DC0266A432DB4348CCC"},
+		{"crc32", "75F4D78B"},
+	}
+
+	for _, test := range tests {
+		args := []primitive.Primitive{primitive.String(path)}
+		if test.digest != "" {
+			args = append(args, primitive.String(test.digest))
+		}
+
+		out := fileDigestFn(ENV, args)
+		if out.ToString() != test.output {
+			t.Fatalf("expected '%s' for %s, got '%s'", test.output, test.digest, out)
+		}
+	}
+
+	// Hashing a file gives the same result as hashing the string
+	out := fileDigestFn(ENV, []primitive.Primitive{primitive.String(path), primitive.String("md5")})
+	str := md5Fn(ENV, []primitive.Primitive{primitive.String("line one\nline two\n")})
+	if out.ToString() != str.ToString() {
+		t.Fatalf("file digest differs from string digest %s != %s", out, str)
+	}
+}
+
+// TestSecureRandom tests random bytes, tokens, and UUIDs.
+func TestSecureRandom(t *testing.T) {
+
+	out := randomBytesFn(ENV, []primitive.Primitive{primitive.Number(16)})
+	if len(out.ToString()) != 16 {
+		t.Fatalf("wrong length of random bytes %d", len(out.ToString()))
+	}
+
+	// 32 bytes by default, which is 43 characters of base64
+	out = randomTokenFn(ENV, []primitive.Primitive{})
+	if !regexp.MustCompile(`^[A-Za-z0-9_-]{43}$`).MatchString(out.ToString()) {
+		t.Fatalf("unexpected token %s", out)
+	}
+	if out.ToString() == randomTokenFn(ENV, []primitive.Primitive{}).ToString() {
+		t.Fatalf("tokens weren't random")
+	}
+
+	out = randomTokenFn(ENV, []primitive.Primitive{primitive.Number(3)})
+	if len(out.ToString()) != 4 {
+		t.Fatalf("unexpected token %s", out)
+	}
+
+	v4 := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	out = uuidV4Fn(ENV, []primitive.Primitive{})
+	if !v4.MatchString(out.ToString()) {
+		t.Fatalf("invalid v4 UUID %s", out)
+	}
+
+	// Version seven UUIDs are ordered
+	v7 := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	a := uuidV7Fn(ENV, []primitive.Primitive{})
+	if !v7.MatchString(a.ToString()) {
+		t.Fatalf("invalid v7 UUID %s", a)
+	}
+	b := uuidV7Fn(ENV, []primitive.Primitive{})
+	if a.ToString()[:8] > b.ToString()[:8] {
+		t.Fatalf("v7 UUIDs are not ordered %s %s", a, b)
+	}
+}
@@ -0,0 +1,267 @@
+// encoding.go - Implementation of our encoding primitives.
+//
+// Strings may be encoded, and decoded, as base64, hex, or with the
+// percent-encoding used in URLs.  URLs themselves may be parsed into a
+// hash, and built from one.
+
+package builtins
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/skx/yal/env"
+	"github.com/skx/yal/primitive"
+)
+
+// encodingArgs validates the arguments of an encoding function, which
+// take a string and an optional flag, returning both.
+func encodingArgs(args []primitive.Primitive, flag bool) (string, bool, primitive.Primitive) {
+
+	// We need one argument, or two if there is a flag
+	if len(args) != 1 && (!flag || len(args) != 2) {
+		return "", false, primitive.ArityError()
+	}
+
+	str, ok := args[0].(primitive.String)
+	if !ok {
+		return "", false, primitive.Error("argument not a string")
+	}
+
+	set := false
+	if len(args) == 2 {
+		b, ok := args[1].(primitive.Bool)
+		if !ok {
+			return "", false, primitive.Error("argument not a boolean")
+		}
+		set = bool(b)
+	}
+	return string(str), set, nil
+}
+
+// base64Encoding returns the URL-safe, or standard, base64 encoding
+// without padding.
+func base64Encoding(urlSafe bool) *base64.Encoding {
+	if urlSafe {
+		return base64.RawURLEncoding
+	}
+	return base64.RawStdEncoding
+}
+
+// decodeBase64Fn implements (decode:base64)
+func decodeBase64Fn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	str, urlSafe, fail := encodingArgs(args, true)
+	if fail != nil {
+		return fail
+	}
+
+	// Padding is optional
+	str = strings.TrimRight(strings.TrimSpace(str), "=")
+
+	out, err := base64Encoding(urlSafe).DecodeString(str)
+	if err != nil {
+		return primitive.Error(fmt.Sprintf("failed to decode base64:%s", err))
+	}
+	return primitive.String(out)
+}
+
+// decodeHexFn implements (decode:hex)
+func decodeHexFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	str, _, fail := encodingArgs(args, false)
+	if fail != nil {
+		return fail
+	}
+
+	out, err := hex.DecodeString(strings.TrimSpace(str))
+	if err != nil {
+		return primitive.Error(fmt.Sprintf("failed to decode hex:%s", err))
+	}
+	return primitive.String(out)
+}
+
+// encodeBase64Fn implements (encode:base64)
+func encodeBase64Fn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	str, urlSafe, fail := encodingArgs(args, true)
+	if fail != nil {
+		return fail
+	}
+
+	// The standard encoding is padded, the URL-safe one isn't.
+	if urlSafe {
+		return primitive.String(base64.RawURLEncoding.EncodeToString([]byte(str)))
+	}
+	return primitive.String(base64.StdEncoding.EncodeToString([]byte(str)))
+}
+
+// encodeHexFn implements (encode:hex)
+func encodeHexFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	str, _, fail := encodingArgs(args, false)
+	if fail != nil {
+		return fail
+	}
+
+	return primitive.String(hex.EncodeToString([]byte(str)))
+}
+
+// urlBuildFn implements (url:build)
+func urlBuildFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We only need a single argument
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	// Which is a hash
+	h, ok := args[0].(primitive.Hash)
+	if !ok {
+		return primitive.Error("argument not a hash")
+	}
+
+	// get returns the named field as a string, if present.
+	get := func(name string) string {
+		val := h.Get(name)
+		if _, ok := val.(primitive.Nil); ok {
+			return ""
+		}
+		return val.ToString()
+	}
+
+	u := url.URL{
+		Scheme:   get(":scheme"),
+		Host:     get(":host"),
+		Path:     get(":path"),
+		Fragment: get(":fragment"),
+	}
+
+	if port := get(":port"); port != "" {
+
+		// IPv6 addresses need to be bracketed
+		if strings.Contains(u.Host, ":") {
+			u.Host = "[" + u.Host + "]"
+		}
+		u.Host += ":" + port
+	}
+
+	if user := get(":user"); user != "" {
+		if pass := get(":password"); pass != "" {
+			u.User = url.UserPassword(user, pass)
+		} else {
+			u.User = url.User(user)
+		}
+	}
+
+	// The query may be a string, or a hash
+	switch query := h.Get(":query").(type) {
+	case primitive.Nil:
+	case primitive.Hash:
+		vals := url.Values{}
+		for key, val := range query.Entries {
+			key = strings.TrimPrefix(key, ":")
+
+			// Multiple values may be given as a list
+			if lst, ok := val.(primitive.List); ok {
+				for _, v := range lst {
+					vals.Add(key, v.ToString())
+				}
+				continue
+			}
+			vals.Add(key, val.ToString())
+		}
+		u.RawQuery = vals.Encode()
+	default:
+		u.RawQuery = query.ToString()
+	}
+
+	return primitive.String(u.String())
+}
+
+// urlDecodeFn implements (url:decode)
+func urlDecodeFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	str, _, fail := encodingArgs(args, false)
+	if fail != nil {
+		return fail
+	}
+
+	out, err := url.QueryUnescape(str)
+	if err != nil {
+		return primitive.Error(fmt.Sprintf("failed to decode %s:%s", str, err))
+	}
+	return primitive.String(out)
+}
+
+// urlEncodeFn implements (url:encode)
+func urlEncodeFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	str, _, fail := encodingArgs(args, false)
+	if fail != nil {
+		return fail
+	}
+
+	return primitive.String(url.QueryEscape(str))
+}
+
+// urlQueryHash converts the given query parameters to a hash, a
+// parameter which appears more than once will have a list of values.
+func urlQueryHash(vals url.Values) primitive.Hash {
+
+	query := primitive.NewHash()
+	for key, val := range vals {
+		if len(val) == 1 {
+			query.Set(key, primitive.String(val[0]))
+			continue
+		}
+
+		lst := primitive.List{}
+		for _, v := range val {
+			lst = append(lst, primitive.String(v))
+		}
+		query.Set(key, lst)
+	}
+	return query
+}
+
+// urlParseFn implements (url:parse)
+//
+// The query parameters are returned as a hash, and a parameter
+// which appears more than once will have a list of values.
+func urlParseFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	str, _, fail := encodingArgs(args, false)
+	if fail != nil {
+		return fail
+	}
+
+	u, err := url.Parse(str)
+	if err != nil {
+		return primitive.Error(fmt.Sprintf("failed to parse URL %s:%s", str, err))
+	}
+
+	vals, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return primitive.Error(fmt.Sprintf("failed to parse query %s:%s", u.RawQuery, err))
+	}
+
+	ret := primitive.NewHash()
+	ret.Set(":scheme", primitive.String(u.Scheme))
+	ret.Set(":host", primitive.String(u.Hostname()))
+	ret.Set(":port", primitive.String(u.Port()))
+	ret.Set(":path", primitive.String(u.Path))
+	ret.Set(":query", urlQueryHash(vals))
+	ret.Set(":fragment", primitive.String(u.Fragment))
+
+	if u.User != nil {
+		ret.Set(":user", primitive.String(u.User.Username()))
+		if pass, ok := u.User.Password(); ok {
+			ret.Set(":password", primitive.String(pass))
+		}
+	}
+	return ret
+}
@@ -0,0 +1,614 @@
+// format.go - Implementation of the format-strings used by (print) and
+// (sprintf).
+//
+// Two kinds of directive are supported.  The familiar "%" directives,
+// such as "%5.2f", are passed to golang's fmt package once the argument
+// has been converted to a suitable type, with the addition of the "'"
+// flag to separate thousands.
+//
+// The "~" directives are modelled upon those of Common Lisp's format:
+//
+//	~a    display an object, as print would.
+//	~s    display an object readably, so strings are quoted.
+//	~d    an integer, ~b, ~o, and ~x in binary, octal, and hex.
+//	~f    a floating-point number.
+//	~%    a newline, and ~~ a tilde.
+//	~{ }  iterate over the elements of a list.
+//	~^    stop, if there are no more arguments.
+//
+// Directives may have parameters and modifiers, such as "~10,'0d" or
+// "~:d".  Passing too few, or too many, arguments is an error.
+//
+// A "~" which doesn't begin one of these directives is output as it is,
+// so that format-strings such as "~/.yalrc" continue to work.
+
+package builtins
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/skx/yal/primitive"
+)
+
+// tildeVerbs contains the "~" directives which we support.
+const tildeVerbs = "%~asdbofx{}^"
+
+// formatState holds the arguments being consumed by a format-string.
+type formatState struct {
+	args []primitive.Primitive
+	pos  int
+}
+
+// remaining returns the number of arguments not yet consumed.
+func (s *formatState) remaining() int {
+	return len(s.args) - s.pos
+}
+
+// next consumes, and returns, the next argument.
+func (s *formatState) next(directive string) (primitive.Primitive, error) {
+	if s.pos >= len(s.args) {
+		return nil, fmt.Errorf("not enough arguments for the format-string, %s needs argument %d", directive, s.pos+1)
+	}
+	s.pos++
+	return s.args[s.pos-1], nil
+}
+
+// formatString formats the given arguments according to the format-string.
+func formatString(frmt string, args []primitive.Primitive) (string, error) {
+
+	state := &formatState{args: args}
+
+	out, _, err := formatRun(frmt, state)
+	if err != nil {
+		return "", err
+	}
+
+	if state.remaining() > 0 {
+		return "", fmt.Errorf("too many arguments for the format-string, %d given but only %d used", len(args), state.pos)
+	}
+	return out, nil
+}
+
+// formatRun processes the given format-string.
+//
+// The returned bool is true if processing was stopped by "~^".
+func formatRun(frmt string, state *formatState) (string, bool, error) {
+
+	var out strings.Builder
+
+	i := 0
+	for i < len(frmt) {
+
+		switch frmt[i] {
+		case '%':
+			str, n, err := formatPercent(frmt[i:], state)
+			if err != nil {
+				return "", false, err
+			}
+			out.WriteString(str)
+			i += n
+
+		case '~':
+			d, err := parseTilde(frmt, i)
+			if err != nil || strings.IndexByte(tildeVerbs, d.verb) < 0 {
+				out.WriteByte('~')
+				i++
+				continue
+			}
+
+			// Iteration needs the body, up to the matching "~}"
+			if d.verb == '{' {
+				end, after, err := formatClose(frmt, d.end)
+				if err != nil {
+					return "", false, err
+				}
+
+				str, err := formatIterate(frmt[d.end:end], d, state)
+				if err != nil {
+					return "", false, err
+				}
+				out.WriteString(str)
+				i = after
+				continue
+			}
+
+			if d.verb == '^' {
+				if state.remaining() == 0 {
+					return out.String(), true, nil
+				}
+				i = d.end
+				continue
+			}
+
+			str, err := formatTilde(d, state)
+			if err != nil {
+				return "", false, err
+			}
+			out.WriteString(str)
+			i = d.end
+
+		default:
+			out.WriteByte(frmt[i])
+			i++
+		}
+	}
+	return out.String(), false, nil
+}
+
+// formatReadable returns the representation of the given object which
+// may be read back, so strings are quoted.
+func formatReadable(p primitive.Primitive) string {
+
+	switch v := p.(type) {
+	case primitive.String:
+		return `"` + strings.ReplaceAll(string(v), `"`, `\"`) + `"`
+	case primitive.Character:
+		return `#\` + string(v)
+	case primitive.List:
+		items := make([]string, len(v))
+		for i, x := range v {
+			items[i] = formatReadable(x)
+		}
+		return "(" + strings.Join(items, " ") + ")"
+	case primitive.Hash:
+		keys := make([]string, 0, len(v.Entries))
+		for k := range v.Entries {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		items := make([]string, len(keys))
+		for i, k := range keys {
+			key := k
+			if !strings.HasPrefix(k, ":") {
+				key = formatReadable(primitive.String(k))
+			}
+			items[i] = key + " " + formatReadable(v.Entries[k])
+		}
+		return "{" + strings.Join(items, " ") + "}"
+	}
+	return p.ToString()
+}
+
+// formatGroup inserts the separator between each group of three digits
+// in the integer part of the given number.
+func formatGroup(num string, sep string) string {
+
+	// Skip any sign, or prefix, and find the run of digits
+	start := strings.IndexAny(num, "0123456789")
+	if start < 0 {
+		return num
+	}
+	end := start
+	for end < len(num) && num[end] >= '0' && num[end] <= '9' {
+		end++
+	}
+
+	digits := num[start:end]
+	var out strings.Builder
+	for i, c := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			out.WriteString(sep)
+		}
+		out.WriteRune(c)
+	}
+	return num[:start] + out.String() + num[end:]
+}
+
+// formatPad pads the given string to the given width, on the left unless
+// left is true.
+func formatPad(str string, width int, pad string, left bool) string {
+	n := width - utf8.RuneCountInString(str)
+	if n <= 0 {
+		return str
+	}
+	if left {
+		return str + strings.Repeat(pad, n)
+	}
+	return strings.Repeat(pad, n) + str
+}
+
+// formatInteger returns the given argument as an integer.
+func formatInteger(p primitive.Primitive, directive string) (int64, error) {
+	n, ok := p.(primitive.Number)
+	if !ok {
+		return 0, fmt.Errorf("%s expects an integer, got %s %s", directive, p.Type(), formatReadable(p))
+	}
+	if !n.IsInt() {
+		return 0, fmt.Errorf("%s expects an integer, got %s", directive, n.ToString())
+	}
+	return int64(n), nil
+}
+
+// formatFloat returns the given argument as a floating-point number.
+func formatFloat(p primitive.Primitive, directive string) (float64, error) {
+	n, ok := p.(primitive.Number)
+	if !ok {
+		return 0, fmt.Errorf("%s expects a number, got %s %s", directive, p.Type(), formatReadable(p))
+	}
+	return float64(n), nil
+}
+
+// formatPercent processes the "%" directive at the start of the given
+// string, returning the output and the length of the directive.
+func formatPercent(frmt string, state *formatState) (string, int, error) {
+
+	// Find the flags, width, and precision
+	i := 1
+	for i < len(frmt) && strings.IndexByte("+-# 0'", frmt[i]) >= 0 {
+		i++
+	}
+	for i < len(frmt) && frmt[i] >= '0' && frmt[i] <= '9' {
+		i++
+	}
+	if i < len(frmt) && frmt[i] == '.' {
+		i++
+		for i < len(frmt) && frmt[i] >= '0' && frmt[i] <= '9' {
+			i++
+		}
+	}
+	if i >= len(frmt) {
+		return "", 0, fmt.Errorf("incomplete format directive %s", frmt)
+	}
+
+	verb := frmt[i]
+	spec := frmt[:i]
+	directive := frmt[:i+1]
+
+	if verb == '%' {
+		return "%", i + 1, nil
+	}
+
+	// Separating thousands is our addition, so we handle it
+	// after formatting without the width.
+	group := strings.Contains(spec, "'")
+	width := 0
+	if group {
+		spec = strings.ReplaceAll(spec, "'", "")
+
+		w := strings.TrimLeft(spec[1:], "+-# 0")
+		if dot := strings.IndexByte(w, '.'); dot >= 0 {
+			spec = strings.Replace(spec, w[:dot], "", 1)
+			w = w[:dot]
+		} else {
+			spec = strings.Replace(spec, w, "", 1)
+		}
+		width, _ = strconv.Atoi(w)
+	}
+
+	arg, err := state.next(directive)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var val any
+	switch verb {
+	case 's', 'v':
+		val = arg.ToString()
+		verb = 's'
+	case 'q':
+		val = formatReadable(arg)
+		verb = 's'
+	case 'd', 'b', 'o', 'x', 'X':
+		if str, ok := arg.(primitive.String); ok && (verb == 'x' || verb == 'X') {
+			val = string(str)
+			break
+		}
+		val, err = formatInteger(arg, directive)
+	case 'e', 'E', 'f', 'F', 'g', 'G':
+		val, err = formatFloat(arg, directive)
+	case 'c':
+		switch v := arg.(type) {
+		case primitive.Character:
+			val = string(v)
+			verb = 's'
+		case primitive.Number:
+			val = rune(v)
+		default:
+			err = fmt.Errorf("%s expects a character, got %s %s", directive, arg.Type(), formatReadable(arg))
+		}
+	case 't':
+		b, ok := arg.(primitive.Bool)
+		if !ok {
+			err = fmt.Errorf("%s expects a boolean, got %s %s", directive, arg.Type(), formatReadable(arg))
+		}
+		val = bool(b)
+	default:
+		err = fmt.Errorf("unknown format directive %s", directive)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	out := fmt.Sprintf(spec+string(verb), val)
+	if group {
+		out = formatGroup(out, ",")
+		out = formatPad(out, width, " ", strings.Contains(spec, "-"))
+	}
+	return out, i + 1, nil
+}
+
+// tildeDirective is a parsed "~" directive.
+type tildeDirective struct {
+
+	// params contains the parameters, a nil entry is one which
+	// was omitted.
+	params []*string
+
+	// colon and at are true if the modifiers were present.
+	colon bool
+	at    bool
+
+	// verb is the directive, in lower-case.
+	verb byte
+
+	// text is the text of the directive, and end is the offset
+	// following it.
+	text string
+	end  int
+}
+
+// param returns the numbered parameter as a number, or the default.
+func (d tildeDirective) param(n int, def int) (int, error) {
+	if n >= len(d.params) || d.params[n] == nil {
+		return def, nil
+	}
+	v, err := strconv.Atoi(*d.params[n])
+	if err != nil {
+		return 0, fmt.Errorf("%s expects a number as parameter %d, got %s", d.text, n+1, *d.params[n])
+	}
+	return v, nil
+}
+
+// char returns the numbered parameter as a character, or the default.
+func (d tildeDirective) char(n int, def string) string {
+	if n >= len(d.params) || d.params[n] == nil {
+		return def
+	}
+	return strings.TrimPrefix(*d.params[n], "'")
+}
+
+// parseTilde parses the "~" directive which starts at the given offset.
+func parseTilde(frmt string, start int) (tildeDirective, error) {
+
+	d := tildeDirective{}
+
+	i := start + 1
+	for {
+		if i >= len(frmt) {
+			return d, fmt.Errorf("incomplete format directive %s", frmt[start:])
+		}
+
+		// A character parameter
+		if frmt[i] == '\'' && i+1 < len(frmt) {
+			_, size := utf8.DecodeRuneInString(frmt[i+1:])
+			p := frmt[i : i+1+size]
+			d.params = append(d.params, &p)
+			i += 1 + size
+		} else if (frmt[i] >= '0' && frmt[i] <= '9') || frmt[i] == '-' || frmt[i] == '+' {
+			j := i + 1
+			for j < len(frmt) && frmt[j] >= '0' && frmt[j] <= '9' {
+				j++
+			}
+			p := frmt[i:j]
+			d.params = append(d.params, &p)
+			i = j
+		} else if frmt[i] == ',' {
+			d.params = append(d.params, nil)
+		}
+
+		if i < len(frmt) && frmt[i] == ',' {
+			i++
+			// A trailing comma means an omitted parameter
+			if i < len(frmt) && frmt[i] != ',' && frmt[i] != '\'' && !(frmt[i] >= '0' && frmt[i] <= '9') && frmt[i] != '-' && frmt[i] != '+' {
+				d.params = append(d.params, nil)
+			}
+			continue
+		}
+		break
+	}
+
+	for i < len(frmt) && (frmt[i] == ':' || frmt[i] == '@') {
+		if frmt[i] == ':' {
+			d.colon = true
+		} else {
+			d.at = true
+		}
+		i++
+	}
+
+	if i >= len(frmt) {
+		return d, fmt.Errorf("incomplete format directive %s", frmt[start:])
+	}
+
+	d.verb = strings.ToLower(frmt[i : i+1])[0]
+	d.end = i + 1
+	d.text = frmt[start:d.end]
+	return d, nil
+}
+
+// formatClose finds the "~}" which closes the iteration whose body starts
+// at the given offset, returning the offsets of its start, and of the
+// text following it.
+func formatClose(frmt string, start int) (int, int, error) {
+
+	depth := 0
+	i := start
+	for i < len(frmt) {
+		if frmt[i] != '~' {
+			i++
+			continue
+		}
+
+		d, err := parseTilde(frmt, i)
+		if err != nil {
+			i++
+			continue
+		}
+		switch d.verb {
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return i, d.end, nil
+			}
+			depth--
+		}
+		i = d.end
+	}
+	return 0, 0, fmt.Errorf("unterminated ~{ in format-string")
+}
+
+// formatIterate processes the body of a "~{" directive.
+//
+// By default the next argument is a list whose elements are consumed by
+// the body, with "~@{" the remaining arguments are used instead, and
+// with "~:{" each element is itself a list of arguments for one pass.
+func formatIterate(body string, d tildeDirective, state *formatState) (string, error) {
+
+	limit, err := d.param(0, -1)
+	if err != nil {
+		return "", err
+	}
+
+	// The arguments we're iterating over
+	inner := state
+	if !d.at {
+		arg, err := state.next(d.text)
+		if err != nil {
+			return "", err
+		}
+
+		lst, ok := arg.(primitive.List)
+		if !ok {
+			if _, isNil := arg.(primitive.Nil); !isNil {
+				return "", fmt.Errorf("%s expects a list, got %s %s", d.text, arg.Type(), formatReadable(arg))
+			}
+		}
+		inner = &formatState{args: lst}
+	}
+
+	var out strings.Builder
+	for n := 0; inner.remaining() > 0 && n != limit; n++ {
+
+		args := inner
+		if d.colon {
+			arg, _ := inner.next(d.text)
+			lst, ok := arg.(primitive.List)
+			if !ok {
+				return "", fmt.Errorf("%s expects a list of lists, got %s %s", d.text, arg.Type(), formatReadable(arg))
+			}
+			args = &formatState{args: lst}
+		}
+
+		before := inner.pos
+		str, stop, err := formatRun(body, args)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(str)
+
+		if stop && !d.colon {
+			break
+		}
+
+		// A body which consumes nothing would loop forever
+		if !d.colon && inner.pos == before {
+			break
+		}
+	}
+	return out.String(), nil
+}
+
+// formatTilde processes a "~" directive, other than iteration.
+func formatTilde(d tildeDirective, state *formatState) (string, error) {
+
+	switch d.verb {
+	case '%':
+		n, err := d.param(0, 1)
+		if err != nil {
+			return "", err
+		}
+		return strings.Repeat("\n", max(n, 0)), nil
+
+	case '~':
+		n, err := d.param(0, 1)
+		if err != nil {
+			return "", err
+		}
+		return strings.Repeat("~", max(n, 0)), nil
+
+	case 'a', 's':
+		arg, err := state.next(d.text)
+		if err != nil {
+			return "", err
+		}
+		width, err := d.param(0, 0)
+		if err != nil {
+			return "", err
+		}
+
+		str := arg.ToString()
+		if d.verb == 's' {
+			str = formatReadable(arg)
+		}
+		return formatPad(str, width, d.char(1, " "), !d.at), nil
+
+	case 'd', 'b', 'o', 'x':
+		arg, err := state.next(d.text)
+		if err != nil {
+			return "", err
+		}
+		n, err := formatInteger(arg, d.text)
+		if err != nil {
+			return "", err
+		}
+		width, err := d.param(0, 0)
+		if err != nil {
+			return "", err
+		}
+
+		base := map[byte]int{'d': 10, 'b': 2, 'o': 8, 'x': 16}[d.verb]
+		str := strconv.FormatInt(n, base)
+		if d.colon {
+			str = formatGroup(str, d.char(2, ","))
+		}
+		if d.at && n >= 0 {
+			str = "+" + str
+		}
+		return formatPad(str, width, d.char(1, " "), false), nil
+
+	case 'f':
+		arg, err := state.next(d.text)
+		if err != nil {
+			return "", err
+		}
+		f, err := formatFloat(arg, d.text)
+		if err != nil {
+			return "", err
+		}
+		width, err := d.param(0, 0)
+		if err != nil {
+			return "", err
+		}
+		digits, err := d.param(1, -1)
+		if err != nil {
+			return "", err
+		}
+
+		str := strconv.FormatFloat(f, 'f', digits, 64)
+		if d.at && f >= 0 {
+			str = "+" + str
+		}
+		return formatPad(str, width, d.char(2, " "), false), nil
+
+	case '}':
+		return "", fmt.Errorf("~} without a matching ~{ in format-string")
+	}
+
+	return "", fmt.Errorf("unknown format directive %s", d.text)
+}
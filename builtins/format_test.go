@@ -0,0 +1,108 @@
+package builtins
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/skx/yal/primitive"
+)
+
+// TestFormat tests the output of format-strings.
+func TestFormat(t *testing.T) {
+
+	h := primitive.NewHash()
+	h.Set(":b", primitive.List{primitive.Number(1), primitive.String("x")})
+	h.Set(":a", primitive.String("y"))
+	h.Set("plain", primitive.Nil{})
+
+	pairs := primitive.List{
+		primitive.List{primitive.String("a"), primitive.Number(1)},
+		primitive.List{primitive.String("b"), primitive.Number(2)},
+	}
+	nums := primitive.List{primitive.Number(1), primitive.Number(2), primitive.Number(3)}
+
+	type TC struct {
+		format string
+		args   []primitive.Primitive
+		output string
+	}
+
+	tests := []TC{
+		{"plain", nil, "plain"},
+		{"100%%", nil, "100%"},
+		{"%s %v %d", []primitive.Primitive{primitive.Number(40), nums, primitive.Number(10)}, "40 (1 2 3) 10"},
+		{"%q %q %q", []primitive.Primitive{primitive.String(`a"b`), primitive.Character("c"), h}, `"a\"b" #\c {:a "y" :b (1 "x") "plain" nil}`},
+		{"%5.2f|%-6s|%06d", []primitive.Primitive{primitive.Number(3.14159), primitive.String("ab"), primitive.Number(-42)}, " 3.14|ab    |-00042"},
+		{"%'d %'d %'d", []primitive.Primitive{primitive.Number(123), primitive.Number(1234567), primitive.Number(-1234)}, "123 1,234,567 -1,234"},
+		{"[%'10d] [%'-10d] [%'.2f]", []primitive.Primitive{primitive.Number(1234), primitive.Number(1234), primitive.Number(1234567.891)}, "[     1,234] [1,234     ] [1,234,567.89]"},
+		{"%x %X %o %b", []primitive.Primitive{primitive.String("hi"), primitive.Number(255), primitive.Number(8), primitive.Number(5)}, "6869 FF 10 101"},
+		{"%c%c %t", []primitive.Primitive{primitive.Character("x"), primitive.Number(65), primitive.Bool(true)}, "xA true"},
+		{"~a ~s ~a ~s", []primitive.Primitive{primitive.String("x"), primitive.String("x"), primitive.Character("y"), primitive.Character("y")}, `x "x" y #\y`},
+		{"[~6a] [~6@a] [~6,'*a]", []primitive.Primitive{primitive.String("ab"), primitive.String("ab"), primitive.String("ab")}, "[ab    ] [    ab] [ab****]"},
+		{"~d ~:d ~@d ~,,'.:d", []primitive.Primitive{primitive.Number(1234), primitive.Number(1234567), primitive.Number(5), primitive.Number(1234567)}, "1234 1,234,567 +5 1.234.567"},
+		{"~5,'0d ~b ~o ~x ~X", []primitive.Primitive{primitive.Number(42), primitive.Number(5), primitive.Number(8), primitive.Number(255), primitive.Number(255)}, "00042 101 10 ff ff"},
+		{"[~f] [~,2f] [~8,2f] [~8,,'-f]", []primitive.Primitive{primitive.Number(1.5), primitive.Number(3.14159), primitive.Number(3.14159), primitive.Number(3.5)}, "[1.5] [3.14] [    3.14] [-----3.5]"},
+		{"a~%b~2%c~~", nil, "a\nb\n\nc~"},
+		{"~{~a~^, ~}", []primitive.Primitive{nums}, "1, 2, 3"},
+		{"~{~a~}|", []primitive.Primitive{primitive.Nil{}}, "|"},
+		{"~2{~a~}", []primitive.Primitive{nums}, "12"},
+		{"~@{<~a>~}", nums, "<1><2><3>"},
+		{"~:{~a=~a;~}", []primitive.Primitive{pairs}, "a=1;b=2;"},
+		{"~{~{~a~}.~}", []primitive.Primitive{pairs}, "a1.b2."},
+		{"~{~}", []primitive.Primitive{nums}, ""},
+		{"~/.yalrc ~z ~5, ~", nil, "~/.yalrc ~z ~5, ~"},
+		{"path ~/x %s", []primitive.Primitive{primitive.String("a")}, "path ~/x a"},
+		{"~{~a~z~}", []primitive.Primitive{primitive.List{primitive.Number(3)}}, "3~z"},
+	}
+
+	for _, test := range tests {
+		out, err := formatString(test.format, test.args)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %s", test.format, err)
+		}
+		if out != test.output {
+			t.Fatalf("%s: wrong output %q", test.format, out)
+		}
+	}
+}
+
+// TestFormatErrors tests that bogus format-strings, or arguments, are
+// rejected.
+func TestFormatErrors(t *testing.T) {
+
+	type TC struct {
+		format string
+		args   []primitive.Primitive
+		err    string
+	}
+
+	tests := []TC{
+		{"%d %d", []primitive.Primitive{primitive.Number(1)}, "not enough arguments for the format-string, %d needs argument 2"},
+		{"~a", nil, "not enough arguments"},
+		{"%d", []primitive.Primitive{primitive.Number(1), primitive.Number(2)}, "too many arguments for the format-string, 2 given but only 1 used"},
+		{"%d", []primitive.Primitive{primitive.Number(1.5)}, "%d expects an integer, got 1.5"},
+		{"%x", []primitive.Primitive{primitive.NewHash()}, "%x expects an integer, got hash"},
+		{"~d", []primitive.Primitive{primitive.String("x")}, `~d expects an integer, got string "x"`},
+		{"%f", []primitive.Primitive{primitive.String("x")}, "%f expects a number"},
+		{"~f", []primitive.Primitive{primitive.Nil{}}, "~f expects a number"},
+		{"%c", []primitive.Primitive{primitive.String("x")}, "%c expects a character"},
+		{"%t", []primitive.Primitive{primitive.Number(1)}, "%t expects a boolean"},
+		{"%z", []primitive.Primitive{primitive.Number(1)}, "unknown format directive %z"},
+		{"%5", nil, "incomplete format directive"},
+		{"~'xa", []primitive.Primitive{primitive.Number(1)}, "expects a number as parameter 1"},
+		{"~{~a", []primitive.Primitive{primitive.List{}}, "unterminated ~{"},
+		{"~}", nil, "~} without a matching ~{"},
+		{"~{~a~}", []primitive.Primitive{primitive.Number(3)}, "~{ expects a list, got number 3"},
+		{"~:{~a~}", []primitive.Primitive{primitive.List{primitive.Number(3)}}, "~:{ expects a list of lists"},
+	}
+
+	for _, test := range tests {
+		_, err := formatString(test.format, test.args)
+		if err == nil {
+			t.Fatalf("%s: expected error", test.format)
+		}
+		if !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("%s: got error, but wrong one %s", test.format, err)
+		}
+	}
+}
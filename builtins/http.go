@@ -0,0 +1,300 @@
+// http.go - Implementation of our HTTP client primitives.
+//
+// (http:request) accepts a hash describing the request, and returns a
+// hash describing the response, and (http:get) and (http:post) are
+// conveniences built upon it.
+//
+// A response with an error status, such as 404, is not an error; only
+// a failure to make the request at all is reported as one.
+//
+// Requests are cancelled if the interpreter's context is, so they will
+// not exceed the interpreter's timeout.
+
+package builtins
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/skx/yal/env"
+	"github.com/skx/yal/primitive"
+)
+
+// httpClient is used for all requests, timeouts are applied via the
+// context of each request.
+var httpClient = &http.Client{}
+
+// httpMaxBody is the largest response body we'll read.
+const httpMaxBody = 10 << 20
+
+// httpOptions holds the options which may be supplied, via a hash,
+// when making a request.
+type httpOptions struct {
+
+	// method is the HTTP method, which defaults to GET.
+	method string
+
+	// url is the URL to request.
+	url string
+
+	// headers contains the headers to send.
+	headers http.Header
+
+	// body contains the body to send, if set.
+	body *string
+
+	// json is true if the body was encoded as JSON.
+	json bool
+
+	// timeout is the maximum duration of the request, if non-zero.
+	timeout time.Duration
+}
+
+// parseHTTPOptions converts the given hash into a set of options.
+func parseHTTPOptions(arg primitive.Primitive) (httpOptions, primitive.Primitive) {
+
+	opts := httpOptions{method: http.MethodGet, headers: http.Header{}}
+
+	hsh, ok := arg.(primitive.Hash)
+	if !ok {
+		return opts, primitive.Error("argument not a hash")
+	}
+
+	for key, val := range hsh.Entries {
+
+		switch key {
+		case ":method":
+			str, ok := val.(primitive.String)
+			if !ok {
+				return opts, primitive.Error(fmt.Sprintf(":method must be a string, got %v", val.Type()))
+			}
+			opts.method = strings.ToUpper(string(str))
+
+		case ":url":
+			str, ok := val.(primitive.String)
+			if !ok {
+				return opts, primitive.Error(fmt.Sprintf(":url must be a string, got %v", val.Type()))
+			}
+			opts.url = string(str)
+
+		case ":headers":
+			hdrs, ok := val.(primitive.Hash)
+			if !ok {
+				return opts, primitive.Error(fmt.Sprintf(":headers must be a hash, got %v", val.Type()))
+			}
+
+			// Headers may be named as ":Name" or "Name".
+			for name, value := range hdrs.Entries {
+				opts.headers.Set(strings.TrimPrefix(name, ":"), value.ToString())
+			}
+
+		case ":body":
+			if opts.body != nil {
+				return opts, primitive.Error("only one of :body and :json may be given")
+			}
+			str := val.ToString()
+			opts.body = &str
+
+		case ":json":
+			if opts.body != nil {
+				return opts, primitive.Error("only one of :body and :json may be given")
+			}
+			str, err := jsonEncode(val)
+			if err != nil {
+				return opts, primitive.Error(fmt.Sprintf("failed to encode JSON:%s", err))
+			}
+			opts.body = &str
+			opts.json = true
+
+		case ":timeout":
+			ms, ok := val.(primitive.Number)
+			if !ok {
+				return opts, primitive.Error(fmt.Sprintf(":timeout must be a number, got %v", val.Type()))
+			}
+			opts.timeout = time.Duration(ms) * time.Millisecond
+
+		default:
+			return opts, primitive.Error(fmt.Sprintf("unknown request option %s", key))
+		}
+	}
+
+	if opts.url == "" {
+		return opts, primitive.Error("the request has no :url")
+	}
+
+	// JSON is labelled as such, unless told otherwise
+	if opts.json && opts.headers.Get("Content-Type") == "" {
+		opts.headers.Set("Content-Type", "application/json")
+	}
+
+	return opts, nil
+}
+
+// httpResponse converts the given response into a hash.
+//
+// If the response is JSON it is decoded, and returned as :json.
+func httpResponse(resp *http.Response, body []byte) primitive.Hash {
+
+	headers := primitive.NewHash()
+	for name, vals := range resp.Header {
+		headers.Set(name, primitive.String(strings.Join(vals, ", ")))
+	}
+
+	ret := primitive.NewHash()
+	ret.Set(":status", primitive.Number(resp.StatusCode))
+	ret.Set(":headers", headers)
+	ret.Set(":body", primitive.String(body))
+
+	media, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if media == "application/json" || strings.HasSuffix(media, "+json") {
+		val, err := jsonDecode(string(body))
+		if err == nil {
+			ret.Set(":json", val)
+		}
+	}
+	return ret
+}
+
+// httpDo makes the request described by the given options.
+func httpDo(env *env.Environment, opts httpOptions) primitive.Primitive {
+
+	// If we're running a test-case we'll stop here, because
+	// fuzzing might make requests.
+	if os.Getenv("FUZZ") != "" {
+		return primitive.NewHash()
+	}
+
+	ctx := evaluatorContext(env)
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+
+	var body io.Reader
+	if opts.body != nil {
+		body = strings.NewReader(*opts.body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, opts.method, opts.url, body)
+	if err != nil {
+		return primitive.Error(fmt.Sprintf("failed to create request to %s:%s", opts.url, err))
+	}
+	req.Header = opts.headers
+
+	// The Host header is sent from the request, not its headers
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+		req.Header.Del("Host")
+	}
+
+	// Other goroutines may run lisp while we wait
+	resume := yieldInterpreter(env)
+	resp, out, err := httpFetch(req)
+	resume()
+
+	if err != nil {
+		return primitive.Error(err.Error())
+	}
+	return httpResponse(resp, out)
+}
+
+// httpFetch makes the given request, returning the response and its body.
+func httpFetch(req *http.Request) (*http.Response, []byte, error) {
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("request to %s failed:%s", req.URL, err)
+	}
+	defer resp.Body.Close()
+
+	out, err := io.ReadAll(io.LimitReader(resp.Body, httpMaxBody+1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read response from %s:%s", req.URL, err)
+	}
+	if len(out) > httpMaxBody {
+		return nil, nil, fmt.Errorf("the response from %s is larger than %d bytes", req.URL, httpMaxBody)
+	}
+	return resp, out, nil
+}
+
+// httpHeadersArg adds the headers in the given hash to the request
+// options.
+func httpHeadersArg(opts primitive.Hash, arg primitive.Primitive) primitive.Primitive {
+	if _, ok := arg.(primitive.Hash); !ok {
+		return primitive.Error("argument not a hash")
+	}
+	opts.Set(":headers", arg)
+	return nil
+}
+
+// httpGetFn implements (http:get)
+func httpGetFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We need one or two arguments
+	if len(args) != 1 && len(args) != 2 {
+		return primitive.ArityError()
+	}
+
+	opts := primitive.NewHash()
+	opts.Set(":url", args[0])
+
+	if len(args) == 2 {
+		if fail := httpHeadersArg(opts, args[1]); fail != nil {
+			return fail
+		}
+	}
+
+	return httpRequestFn(env, []primitive.Primitive{opts})
+}
+
+// httpPostFn implements (http:post)
+//
+// A body which isn't a string is sent as JSON.
+func httpPostFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We need two or three arguments
+	if len(args) != 2 && len(args) != 3 {
+		return primitive.ArityError()
+	}
+
+	opts := primitive.NewHash()
+	opts.Set(":method", primitive.String(http.MethodPost))
+	opts.Set(":url", args[0])
+
+	if _, ok := args[1].(primitive.String); ok {
+		opts.Set(":body", args[1])
+	} else {
+		opts.Set(":json", args[1])
+	}
+
+	if len(args) == 3 {
+		if fail := httpHeadersArg(opts, args[2]); fail != nil {
+			return fail
+		}
+	}
+
+	return httpRequestFn(env, []primitive.Primitive{opts})
+}
+
+// httpRequestFn implements (http:request)
+func httpRequestFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We only need a single argument
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	opts, fail := parseHTTPOptions(args[0])
+	if fail != nil {
+		return fail
+	}
+
+	return httpDo(env, opts)
+}
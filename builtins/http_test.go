@@ -0,0 +1,282 @@
+package builtins
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skx/yal/env"
+	"github.com/skx/yal/primitive"
+)
+
+// testServer returns a server which echoes details of the requests it
+// receives.
+func testServer(t *testing.T) *httptest.Server {
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Method", r.Method)
+		w.Header().Set("X-Content-Type", r.Header.Get("Content-Type"))
+		w.Header().Set("X-Token", r.Header.Get("X-Token"))
+		w.Header().Set("X-Host", r.Host)
+		w.Write(body)
+	})
+
+	mux.HandleFunc("/big", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", httpMaxBody+1)))
+	})
+
+	mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(`{"name": "steve", "langs": ["lisp", "go"], "age": 42, "admin": false, "pet": null}`))
+	})
+
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not here", http.StatusNotFound)
+	})
+
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// TestHTTPArguments ensures our HTTP-functions reject bogus arguments.
+func TestHTTPArguments(t *testing.T) {
+
+	type TC struct {
+		fn   primitive.GolangPrimitiveFn
+		args []primitive.Primitive
+		err  string
+	}
+
+	// opts returns a hash of request options
+	opts := func(kv ...primitive.Primitive) primitive.Hash {
+		h := primitive.NewHash()
+		for i := 0; i < len(kv); i += 2 {
+			h.Set(kv[i].ToString(), kv[i+1])
+		}
+		return h
+	}
+
+	url := primitive.String("http://localhost/")
+	str := primitive.String("x")
+	num := primitive.Number(3)
+
+	tests := []TC{
+		{httpRequestFn, []primitive.Primitive{}, string(primitive.ArityError())},
+		{httpRequestFn, []primitive.Primitive{str}, "not a hash"},
+		{httpRequestFn, []primitive.Primitive{opts()}, "has no :url"},
+		{httpRequestFn, []primitive.Primitive{opts(primitive.String(":url"), num)}, ":url must be a string"},
+		{httpRequestFn, []primitive.Primitive{opts(primitive.String(":url"), url, primitive.String(":method"), num)}, ":method must be a string"},
+		{httpRequestFn, []primitive.Primitive{opts(primitive.String(":url"), url, primitive.String(":headers"), str)}, ":headers must be a hash"},
+		{httpRequestFn, []primitive.Primitive{opts(primitive.String(":url"), url, primitive.String(":timeout"), str)}, ":timeout must be a number"},
+		{httpRequestFn, []primitive.Primitive{opts(primitive.String(":url"), url, primitive.String(":cheese"), str)}, "unknown request option :cheese"},
+		{httpRequestFn, []primitive.Primitive{opts(primitive.String(":url"), url, primitive.String(":body"), str, primitive.String(":json"), str)}, "only one of :body and :json"},
+		{httpRequestFn, []primitive.Primitive{opts(primitive.String(":url"), url, primitive.String(":json"), primitive.Error("x"))}, "failed to encode JSON"},
+		{httpRequestFn, []primitive.Primitive{opts(primitive.String(":url"), url, primitive.String(":method"), primitive.String("BAD METHOD"))}, "failed to create request"},
+		{httpRequestFn, []primitive.Primitive{opts(primitive.String(":url"), primitive.String("http://127.0.0.1:0/"))}, "failed"},
+		{httpGetFn, []primitive.Primitive{}, string(primitive.ArityError())},
+		{httpGetFn, []primitive.Primitive{url, str}, "not a hash"},
+		{httpGetFn, []primitive.Primitive{num}, ":url must be a string"},
+		{httpPostFn, []primitive.Primitive{url}, string(primitive.ArityError())},
+		{httpPostFn, []primitive.Primitive{url, str, str}, "not a hash"},
+	}
+
+	for _, test := range tests {
+		out := test.fn(ENV, test.args)
+
+		e, ok := out.(primitive.Error)
+		if !ok {
+			t.Fatalf("expected error for %v, got %v", test.args, out)
+		}
+		if !strings.Contains(string(e), test.err) {
+			t.Fatalf("got error for %v, but wrong one %v", test.args, out)
+		}
+	}
+}
+
+// TestHTTP tests making requests.
+func TestHTTP(t *testing.T) {
+
+	srv := testServer(t)
+
+	// A simple GET, with a header
+	hdrs := primitive.NewHash()
+	hdrs.Set(":X-Token", primitive.String("secret"))
+
+	out := httpGetFn(ENV, []primitive.Primitive{primitive.String(srv.URL + "/echo"), hdrs})
+	res, ok := out.(primitive.Hash)
+	if !ok {
+		t.Fatalf("expected hash, got %v", out)
+	}
+	if res.Get(":status") != primitive.Number(200) {
+		t.Fatalf("wrong status %v", res.Get(":status"))
+	}
+	h := res.Get(":headers").(primitive.Hash)
+	if h.Get("X-Method").ToString() != "GET" || h.Get("X-Token").ToString() != "secret" {
+		t.Fatalf("wrong headers %v", h)
+	}
+	if _, ok := res.Get(":json").(primitive.Nil); !ok {
+		t.Fatalf("unexpected JSON %v", res.Get(":json"))
+	}
+
+	// POST a string
+	out = httpPostFn(ENV, []primitive.Primitive{primitive.String(srv.URL + "/echo"), primitive.String("hello")})
+	res = out.(primitive.Hash)
+	h = res.Get(":headers").(primitive.Hash)
+	if res.Get(":body").ToString() != "hello" || h.Get("X-Method").ToString() != "POST" || h.Get("X-Content-Type").ToString() != "" {
+		t.Fatalf("wrong response %v", res)
+	}
+
+	// POST JSON
+	data := primitive.NewHash()
+	data.Set(":name", primitive.String("steve"))
+	out = httpPostFn(ENV, []primitive.Primitive{primitive.String(srv.URL + "/echo"), data})
+	res = out.(primitive.Hash)
+	h = res.Get(":headers").(primitive.Hash)
+	if res.Get(":body").ToString() != `{"name":"steve"}` || h.Get("X-Content-Type").ToString() != "application/json" {
+		t.Fatalf("wrong response %v", res)
+	}
+
+	// A general request, where the content-type is overridden
+	hdrs = primitive.NewHash()
+	hdrs.Set("content-type", primitive.String("application/vnd.test+json"))
+
+	req := primitive.NewHash()
+	req.Set(":method", primitive.String("put"))
+	req.Set(":url", primitive.String(srv.URL+"/echo"))
+	req.Set(":json", primitive.List{primitive.Number(1), primitive.Number(2)})
+	req.Set(":headers", hdrs)
+	req.Set(":timeout", primitive.Number(5000))
+
+	out = httpRequestFn(ENV, []primitive.Primitive{req})
+	res = out.(primitive.Hash)
+	h = res.Get(":headers").(primitive.Hash)
+	if res.Get(":body").ToString() != "[1,2]" || h.Get("X-Method").ToString() != "PUT" || h.Get("X-Content-Type").ToString() != "application/vnd.test+json" {
+		t.Fatalf("wrong response %v", res)
+	}
+
+	// A JSON response is decoded
+	out = httpGetFn(ENV, []primitive.Primitive{primitive.String(srv.URL + "/json")})
+	res = out.(primitive.Hash)
+	js, ok := res.Get(":json").(primitive.Hash)
+	if !ok {
+		t.Fatalf("expected decoded JSON, got %v", res)
+	}
+	if js.Get(":name").ToString() != "steve" || js.Get(":langs").ToString() != "(lisp go)" || js.Get(":age") != primitive.Number(42) {
+		t.Fatalf("wrong JSON %v", js)
+	}
+
+	// The Host header replaces the host of the URL
+	hdrs = primitive.NewHash()
+	hdrs.Set("Host", primitive.String("example.test"))
+	out = httpGetFn(ENV, []primitive.Primitive{primitive.String(srv.URL + "/echo"), hdrs})
+	res = out.(primitive.Hash)
+	if res.Get(":headers").(primitive.Hash).Get("X-Host").ToString() != "example.test" {
+		t.Fatalf("wrong host %v", res)
+	}
+
+	// A response which is too large is an error
+	out = httpGetFn(ENV, []primitive.Primitive{primitive.String(srv.URL + "/big")})
+	if !strings.Contains(out.ToString(), "larger than") {
+		t.Fatalf("expected error, got %v", out)
+	}
+
+	// An error status isn't an error
+	out = httpGetFn(ENV, []primitive.Primitive{primitive.String(srv.URL + "/missing")})
+	res = out.(primitive.Hash)
+	if res.Get(":status") != primitive.Number(404) || res.Get(":body").ToString() != "not here\n" {
+		t.Fatalf("wrong response %v", res)
+	}
+
+	// Pretend we're running under a fuzzer
+	old := os.Getenv("FUZZ")
+	os.Setenv("FUZZ", "FUZZ")
+	out = httpGetFn(ENV, []primitive.Primitive{primitive.String(srv.URL + "/echo")})
+	os.Setenv("FUZZ", old)
+
+	if res, ok = out.(primitive.Hash); !ok || len(res.Entries) != 0 {
+		t.Fatalf("expected empty hash, got %v", out)
+	}
+}
+
+// TestHTTPTimeout tests that requests are cancelled by their timeout,
+// or by the interpreter's context.
+func TestHTTPTimeout(t *testing.T) {
+
+	srv := testServer(t)
+
+	req := primitive.NewHash()
+	req.Set(":url", primitive.String(srv.URL+"/slow"))
+	req.Set(":timeout", primitive.Number(50))
+
+	start := time.Now()
+	out := httpRequestFn(ENV, []primitive.Primitive{req})
+	if !strings.Contains(out.ToString(), "deadline exceeded") {
+		t.Fatalf("expected timeout, got %v", out)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatalf("request didn't timeout promptly")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	e := env.New()
+	e.SetEvaluator(&fakeEvaluator{ctx: ctx})
+
+	start = time.Now()
+	out = httpGetFn(e, []primitive.Primitive{primitive.String(srv.URL + "/slow")})
+	if !strings.Contains(out.ToString(), "deadline exceeded") {
+		t.Fatalf("expected timeout, got %v", out)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatalf("request didn't timeout promptly")
+	}
+}
+
+// TestHTTPYield tests that other goroutines may run lisp while a request
+// is waiting for its response.
+func TestHTTPYield(t *testing.T) {
+
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+			w.Write([]byte("released"))
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	sched := &fakeScheduler{fakeEvaluator: fakeEvaluator{ctx: context.Background()}}
+	e := env.New()
+	e.SetEvaluator(sched)
+
+	// This only runs once the request yields
+	sched.Go(func() { close(release) })
+
+	req := primitive.NewHash()
+	req.Set(":url", primitive.String(srv.URL))
+	req.Set(":timeout", primitive.Number(5000))
+
+	out := httpRequestFn(e, []primitive.Primitive{req})
+	res, ok := out.(primitive.Hash)
+	if !ok || res.Get(":body").ToString() != "released" {
+		t.Fatalf("expected the request to yield, got %v", out)
+	}
+}
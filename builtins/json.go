@@ -0,0 +1,160 @@
+// json.go - Implementation of our JSON primitives.
+//
+// JSON values are converted to, and from, our own types in the obvious
+// way; objects are hashes, arrays are lists, and null is nil.
+//
+// The keys of objects become keywords, so a decoded object can be used
+// like a hash literal, (get obj :name), and when encoding the leading
+// ":" of a keyword is removed.
+
+package builtins
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/skx/yal/env"
+	"github.com/skx/yal/primitive"
+)
+
+// jsonToNative converts the given object to a value which may be
+// encoded as JSON.
+func jsonToNative(p primitive.Primitive) (any, error) {
+
+	switch v := p.(type) {
+	case primitive.Nil:
+		return nil, nil
+	case primitive.Bool:
+		return bool(v), nil
+	case primitive.Number:
+		// Avoid exponents in whole numbers
+		f := float64(v)
+		if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			return int64(f), nil
+		}
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, fmt.Errorf("cannot encode %s as JSON", v.ToString())
+		}
+		return f, nil
+	case primitive.String:
+		return string(v), nil
+	case primitive.Character:
+		return string(v), nil
+	case primitive.Symbol:
+		return string(v), nil
+	case primitive.Time:
+		return time.Time(v).Format(time.RFC3339Nano), nil
+	case primitive.List:
+		ret := make([]any, len(v))
+		for i, x := range v {
+			var err error
+			ret[i], err = jsonToNative(x)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return ret, nil
+	case primitive.Hash:
+		ret := make(map[string]any, len(v.Entries))
+		for key, x := range v.Entries {
+			val, err := jsonToNative(x)
+			if err != nil {
+				return nil, err
+			}
+			ret[strings.TrimPrefix(key, ":")] = val
+		}
+		return ret, nil
+	}
+	return nil, fmt.Errorf("cannot encode %s as JSON", p.Type())
+}
+
+// jsonFromNative converts the given decoded JSON value to our types.
+func jsonFromNative(v any) primitive.Primitive {
+
+	switch v := v.(type) {
+	case bool:
+		return primitive.Bool(v)
+	case float64:
+		return primitive.Number(v)
+	case string:
+		return primitive.String(v)
+	case []any:
+		ret := make(primitive.List, len(v))
+		for i, x := range v {
+			ret[i] = jsonFromNative(x)
+		}
+		return ret
+	case map[string]any:
+		ret := primitive.NewHash()
+		for key, x := range v {
+			ret.Set(":"+key, jsonFromNative(x))
+		}
+		return ret
+	}
+	return primitive.Nil{}
+}
+
+// jsonEncode returns the JSON encoding of the given object.
+func jsonEncode(p primitive.Primitive) (string, error) {
+
+	native, err := jsonToNative(p)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := json.Marshal(native)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// jsonDecode decodes the given JSON.
+func jsonDecode(str string) (primitive.Primitive, error) {
+
+	var native any
+	err := json.Unmarshal([]byte(str), &native)
+	if err != nil {
+		return nil, err
+	}
+	return jsonFromNative(native), nil
+}
+
+// jsonDecodeFn implements (json:decode)
+func jsonDecodeFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We only need a single argument
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	// Which is a string
+	str, ok := args[0].(primitive.String)
+	if !ok {
+		return primitive.Error("argument not a string")
+	}
+
+	ret, err := jsonDecode(string(str))
+	if err != nil {
+		return primitive.Error(fmt.Sprintf("failed to decode JSON:%s", err))
+	}
+	return ret
+}
+
+// jsonEncodeFn implements (json:encode)
+func jsonEncodeFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We only need a single argument
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	ret, err := jsonEncode(args[0])
+	if err != nil {
+		return primitive.Error(fmt.Sprintf("failed to encode JSON:%s", err))
+	}
+	return primitive.String(ret)
+}
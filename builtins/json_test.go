@@ -0,0 +1,101 @@
+package builtins
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skx/yal/primitive"
+)
+
+// TestJSONArguments ensures our JSON-functions reject bogus arguments.
+func TestJSONArguments(t *testing.T) {
+
+	type TC struct {
+		fn   primitive.GolangPrimitiveFn
+		args []primitive.Primitive
+		err  string
+	}
+
+	tests := []TC{
+		{jsonDecodeFn, []primitive.Primitive{}, string(primitive.ArityError())},
+		{jsonDecodeFn, []primitive.Primitive{primitive.Number(3)}, "not a string"},
+		{jsonDecodeFn, []primitive.Primitive{primitive.String("{")}, "failed to decode JSON"},
+		{jsonEncodeFn, []primitive.Primitive{}, string(primitive.ArityError())},
+		{jsonEncodeFn, []primitive.Primitive{primitive.Error("x")}, "failed to encode JSON"},
+		{jsonEncodeFn, []primitive.Primitive{primitive.List{primitive.Number(math.Inf(1))}}, "failed to encode JSON"},
+		{jsonEncodeFn, []primitive.Primitive{primitive.List{primitive.List{&primitive.Procedure{}}}}, "failed to encode JSON"},
+	}
+
+	for _, test := range tests {
+		out := test.fn(ENV, test.args)
+
+		e, ok := out.(primitive.Error)
+		if !ok {
+			t.Fatalf("expected error for %v, got %v", test.args, out)
+		}
+		if !strings.Contains(string(e), test.err) {
+			t.Fatalf("got error for %v, but wrong one %v", test.args, out)
+		}
+	}
+}
+
+// TestJSON tests encoding and decoding JSON.
+func TestJSON(t *testing.T) {
+
+	type TC struct {
+		input  primitive.Primitive
+		output string
+	}
+
+	hsh := primitive.NewHash()
+	hsh.Set(":name", primitive.String("steve"))
+	hsh.Set("plain", primitive.List{primitive.Bool(true), primitive.Nil{}})
+
+	tests := []TC{
+		{primitive.Nil{}, "null"},
+		{primitive.Bool(false), "false"},
+		{primitive.Number(1000000), "1000000"},
+		{primitive.Number(-2.5), "-2.5"},
+		{primitive.String("a\"b"), `"a\"b"`},
+		{primitive.Character("c"), `"c"`},
+		{primitive.Symbol("sym"), `"sym"`},
+		{primitive.Time(time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)), `"2022-10-01T12:00:00Z"`},
+		{primitive.List{}, "[]"},
+		{primitive.NewHash(), "{}"},
+		{hsh, `{"name":"steve","plain":[true,null]}`},
+	}
+
+	for _, test := range tests {
+		out := jsonEncodeFn(ENV, []primitive.Primitive{test.input})
+		if out.ToString() != test.output {
+			t.Fatalf("wrong encoding of %v, got %v", test.input, out)
+		}
+	}
+
+	// Decoding
+	out := jsonDecodeFn(ENV, []primitive.Primitive{primitive.String(`{"name": "steve", "age": 42, "langs": ["go", "lisp"], "ok": true, "pet": null, "nested": {"x": 1.5}}`)})
+	res, ok := out.(primitive.Hash)
+	if !ok {
+		t.Fatalf("expected hash, got %v", out)
+	}
+	if res.Get(":name") != primitive.String("steve") || res.Get(":age") != primitive.Number(42) || res.Get(":ok") != primitive.Bool(true) {
+		t.Fatalf("wrong decoding %v", res)
+	}
+	if res.Get(":langs").ToString() != "(go lisp)" {
+		t.Fatalf("wrong list decoded %v", res.Get(":langs"))
+	}
+	if _, ok := res.Get(":pet").(primitive.Nil); !ok {
+		t.Fatalf("expected nil, got %v", res.Get(":pet"))
+	}
+	if res.Get(":nested").(primitive.Hash).Get(":x") != primitive.Number(1.5) {
+		t.Fatalf("wrong nested hash %v", res.Get(":nested"))
+	}
+
+	// Round-trip
+	out = jsonEncodeFn(ENV, []primitive.Primitive{out})
+	if out.ToString() != `{"age":42,"langs":["go","lisp"],"name":"steve","nested":{"x":1.5},"ok":true,"pet":null}` {
+		t.Fatalf("round-trip failed, got %v", out)
+	}
+}
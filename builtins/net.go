@@ -0,0 +1,578 @@
+// net.go - Implementation of our socket primitives.
+//
+// Connections, and listeners, are TCP or Unix domain sockets, and are
+// represented by handles.
+//
+// Blocking operations are interrupted if the interpreter's context is
+// cancelled, and connections may also be given a deadline.
+//
+// (net:serve) accepts connections and passes each of them to a lisp
+// function, on a goroutine of its own.  Lisp code is not safe to run
+// concurrently, so the goroutines take turns: one runs lisp until it
+// blocks in (net:read), (net:write), (sleep), or similar, and then
+// another may run.  Timers continue to fire while the server waits.
+
+package builtins
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skx/yal/env"
+	"github.com/skx/yal/primitive"
+)
+
+// netReadSize is the default maximum number of bytes returned by a
+// single call to (net:read).
+const netReadSize = 4096
+
+// netConn holds the state of a connection.
+type netConn struct {
+	conn net.Conn
+
+	// reader buffers reads, so that lines may be read.
+	reader *bufio.Reader
+
+	// deadline is the deadline set via (net:deadline), if any.
+	deadline time.Time
+
+	// partial holds the start of a line, if reading the rest of it
+	// failed.
+	partial string
+}
+
+// deadliner is implemented by connections and listeners which may be
+// given a deadline.
+type deadliner interface {
+	SetDeadline(t time.Time) error
+}
+
+// newNetConn wraps the given connection in a handle.
+func newNetConn(conn net.Conn) *primitive.Handle {
+	return primitive.NewHandle("connection", &netConn{conn: conn, reader: bufio.NewReader(conn)})
+}
+
+// getNetConn returns the connection from the given handle, or an error.
+func getNetConn(arg primitive.Primitive) (*netConn, primitive.Primitive) {
+	h, ok := arg.(*primitive.Handle)
+	if ok {
+		c, ok2 := h.Value.(*netConn)
+		if ok2 {
+			return c, nil
+		}
+	}
+	return nil, primitive.Error("argument not a connection")
+}
+
+// getNetListener returns the listener from the given handle, or an error.
+func getNetListener(arg primitive.Primitive) (net.Listener, primitive.Primitive) {
+	h, ok := arg.(*primitive.Handle)
+	if ok {
+		l, ok2 := h.Value.(net.Listener)
+		if ok2 {
+			return l, nil
+		}
+	}
+	return nil, primitive.Error("argument not a listener")
+}
+
+// netNetwork validates the given network name.
+func netNetwork(arg primitive.Primitive) (string, primitive.Primitive) {
+	str, ok := arg.(primitive.String)
+	if !ok {
+		return "", primitive.Error("argument not a string")
+	}
+
+	switch string(str) {
+	case "tcp", "tcp4", "tcp6", "unix":
+		return string(str), nil
+	}
+	return "", primitive.Error(fmt.Sprintf("unsupported network %s, expected tcp, tcp4, tcp6, or unix", str))
+}
+
+// netWatch interrupts any blocking operation on the given connection,
+// or listener, if the interpreter's context is cancelled.
+//
+// Other goroutines may run lisp while the operation blocks, so the
+// returned function must be called once it completes, before the
+// environment is used again.  If the operation was interrupted it also
+// restores the given deadline.
+func netWatch(env *env.Environment, d deadliner, deadline time.Time) func() {
+	stop := context.AfterFunc(evaluatorContext(env), func() {
+		d.SetDeadline(time.Now())
+	})
+	resume := yieldInterpreter(env)
+
+	return func() {
+		resume()
+		if !stop() {
+			d.SetDeadline(deadline)
+		}
+	}
+}
+
+// netError describes the failure of the given operation.
+func netError(env *env.Environment, op string, err error) primitive.Primitive {
+	if ctx := evaluatorContext(env); ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return primitive.Error(fmt.Sprintf("%s failed:%s", op, err))
+}
+
+// netAcceptFn implements (net:accept)
+func netAcceptFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We only need a single argument
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	ln, fail := getNetListener(args[0])
+	if fail != nil {
+		return fail
+	}
+
+	var stop func()
+	if d, ok := ln.(deadliner); ok {
+		stop = netWatch(env, d, time.Time{})
+	} else {
+		stop = yieldInterpreter(env)
+	}
+
+	conn, err := ln.Accept()
+	stop()
+	if err != nil {
+		return netError(env, "accept", err)
+	}
+	return newNetConn(conn)
+}
+
+// netAddressFn implements (net:address)
+//
+// The return value is a hash containing :local, and for connections
+// :remote too.
+func netAddressFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We only need a single argument
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	ret := primitive.NewHash()
+
+	if c, fail := getNetConn(args[0]); fail == nil {
+		ret.Set(":local", primitive.String(c.conn.LocalAddr().String()))
+		ret.Set(":remote", primitive.String(c.conn.RemoteAddr().String()))
+		return ret
+	}
+
+	ln, fail := getNetListener(args[0])
+	if fail != nil {
+		return primitive.Error("argument not a connection or listener")
+	}
+	ret.Set(":local", primitive.String(ln.Addr().String()))
+	return ret
+}
+
+// netCloseFn implements (net:close)
+func netCloseFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We only need a single argument
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	var c io.Closer
+	if conn, fail := getNetConn(args[0]); fail == nil {
+		c = conn.conn
+	} else if ln, fail := getNetListener(args[0]); fail == nil {
+		c = ln
+	} else {
+		return primitive.Error("argument not a connection or listener")
+	}
+
+	// Closing twice is harmless
+	err := c.Close()
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		return primitive.Error(fmt.Sprintf("close failed:%s", err))
+	}
+	return primitive.Nil{}
+}
+
+// netDeadlineFn implements (net:deadline)
+//
+// Reads and writes which don't complete within the given number of
+// milliseconds will fail, and a deadline of nil removes the limit.
+func netDeadlineFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We need two arguments
+	if len(args) != 2 {
+		return primitive.ArityError()
+	}
+
+	c, fail := getNetConn(args[0])
+	if fail != nil {
+		return fail
+	}
+
+	deadline := time.Time{}
+	if _, ok := args[1].(primitive.Nil); !ok {
+		delay, fail := msArg(args[1])
+		if fail != nil {
+			return fail
+		}
+		deadline = time.Now().Add(delay)
+	}
+
+	err := c.conn.SetDeadline(deadline)
+	if err != nil {
+		return primitive.Error(fmt.Sprintf("failed to set deadline:%s", err))
+	}
+	c.deadline = deadline
+	return primitive.Nil{}
+}
+
+// netDialFn implements (net:dial)
+func netDialFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We need two or three arguments
+	if len(args) != 2 && len(args) != 3 {
+		return primitive.ArityError()
+	}
+
+	network, fail := netNetwork(args[0])
+	if fail != nil {
+		return fail
+	}
+
+	addr, ok := args[1].(primitive.String)
+	if !ok {
+		return primitive.Error("argument not a string")
+	}
+
+	ctx := evaluatorContext(env)
+	if len(args) == 3 {
+		timeout, fail := msArg(args[2])
+		if fail != nil {
+			return fail
+		}
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// If we're running a test-case we'll stop here, because
+	// fuzzing might make connections.
+	if os.Getenv("FUZZ") != "" {
+		return primitive.Nil{}
+	}
+
+	var d net.Dialer
+	resume := yieldInterpreter(env)
+	conn, err := d.DialContext(ctx, network, string(addr))
+	resume()
+
+	if err != nil {
+		return primitive.Error(fmt.Sprintf("failed to connect to %s:%s", addr, err))
+	}
+	return newNetConn(conn)
+}
+
+// netListenFn implements (net:listen)
+func netListenFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We need two arguments
+	if len(args) != 2 {
+		return primitive.ArityError()
+	}
+
+	network, fail := netNetwork(args[0])
+	if fail != nil {
+		return fail
+	}
+
+	addr, ok := args[1].(primitive.String)
+	if !ok {
+		return primitive.Error("argument not a string")
+	}
+
+	// If we're running a test-case we'll stop here, because
+	// fuzzing might listen for connections.
+	if os.Getenv("FUZZ") != "" {
+		return primitive.Nil{}
+	}
+
+	ln, err := net.Listen(network, string(addr))
+	if err != nil {
+		return primitive.Error(fmt.Sprintf("failed to listen on %s:%s", addr, err))
+	}
+	return primitive.NewHandle("listener", ln)
+}
+
+// netReadFn implements (net:read)
+//
+// At most the given number of bytes are returned, and nil is returned
+// once the connection has been closed by the peer.
+func netReadFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We need one or two arguments
+	if len(args) != 1 && len(args) != 2 {
+		return primitive.ArityError()
+	}
+
+	c, fail := getNetConn(args[0])
+	if fail != nil {
+		return fail
+	}
+
+	size := netReadSize
+	if len(args) == 2 {
+		n, ok := args[1].(primitive.Number)
+		if !ok || int(n) < 1 {
+			return primitive.Error("size must be a positive number")
+		}
+		size = int(n)
+	}
+
+	buf := make([]byte, size)
+
+	stop := netWatch(env, c.conn, c.deadline)
+	n, err := c.reader.Read(buf)
+	stop()
+
+	if n > 0 {
+		return primitive.String(buf[:n])
+	}
+	if err == io.EOF {
+		return primitive.Nil{}
+	}
+	return netError(env, "read", err)
+}
+
+// netReadLineFn implements (net:read-line)
+//
+// The line is returned without its trailing newline, and nil is returned
+// once the connection has been closed by the peer.
+func netReadLineFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We only need a single argument
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	c, fail := getNetConn(args[0])
+	if fail != nil {
+		return fail
+	}
+
+	stop := netWatch(env, c.conn, c.deadline)
+	line, err := c.reader.ReadString('\n')
+	stop()
+
+	line = c.partial + line
+	c.partial = ""
+
+	if err == io.EOF && line == "" {
+		return primitive.Nil{}
+	}
+	if err != nil && err != io.EOF {
+		// Keep what we have, in case the caller retries
+		c.partial = line
+		return netError(env, "read", err)
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return primitive.String(line)
+}
+
+// netServeFn implements (net:serve)
+//
+// The listener is closed when the interpreter's context is cancelled, at
+// which point we return.
+func netServeFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We need two or three arguments
+	if len(args) != 2 && len(args) != 3 {
+		return primitive.ArityError()
+	}
+
+	ln, fail := getNetListener(args[0])
+	if fail != nil {
+		return fail
+	}
+
+	proc, ok := args[1].(*primitive.Procedure)
+	if !ok {
+		return primitive.Error("argument not a function")
+	}
+
+	var timeout time.Duration
+	if len(args) == 3 {
+		timeout, fail = msArg(args[2])
+		if fail != nil {
+			return fail
+		}
+	}
+
+	// Accept connections in the background
+	conns := make(chan net.Conn)
+	failed := make(chan error, 1)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				failed <- err
+				return
+			}
+
+			select {
+			case conns <- conn:
+			case <-done:
+				conn.Close()
+				return
+			}
+		}
+	}()
+
+	// handle calls the handler with the given connection, and closes
+	// it once the handler returns.
+	handle := func(conn net.Conn) {
+		defer conn.Close()
+
+		h := newNetConn(conn)
+		if timeout > 0 {
+			c := h.Value.(*netConn)
+			c.deadline = time.Now().Add(timeout)
+			conn.SetDeadline(c.deadline)
+		}
+
+		// An error affects only this connection
+		applyProcedure(env, proc, []primitive.Primitive{h})
+	}
+
+	// If the interpreter allows it each connection is handled on
+	// its own goroutine, taking turns to run lisp, otherwise they
+	// are handled one at a time.
+	sched, concurrent := env.GetEvaluator().(primitive.Scheduler)
+
+	var handlers sync.WaitGroup
+	var mu sync.Mutex
+	open := make(map[net.Conn]bool)
+
+	// Once we're stopped, and the listener is closed, we close any
+	// connections which are still open, and wait for their handlers
+	// to return.
+	defer func() {
+		mu.Lock()
+		for conn := range open {
+			conn.Close()
+		}
+		mu.Unlock()
+
+		resume := yieldInterpreter(env)
+		handlers.Wait()
+		resume()
+	}()
+
+	defer ln.Close()
+	defer close(done)
+
+	ctx := evaluatorContext(env)
+	timers := interpreterTimers(env)
+
+	for {
+		// Invoke any timers which are due
+		out := timers.run(env)
+		if out != nil {
+			return out
+		}
+
+		// Other goroutines may run lisp while we wait
+		resume := yieldInterpreter(env)
+
+		select {
+		case conn := <-conns:
+			resume()
+
+			if !concurrent {
+				handle(conn)
+				break
+			}
+
+			mu.Lock()
+			open[conn] = true
+			mu.Unlock()
+
+			handlers.Add(1)
+			sched.Go(func() {
+				defer handlers.Done()
+				defer func() {
+					mu.Lock()
+					delete(open, conn)
+					mu.Unlock()
+				}()
+
+				handle(conn)
+			})
+
+		case <-timers.notify:
+			// a timer fired
+			resume()
+
+		case err := <-failed:
+			resume()
+
+			// Closing the listener is how we're stopped
+			if errors.Is(err, net.ErrClosed) {
+				return primitive.Nil{}
+			}
+			return primitive.Error(fmt.Sprintf("accept failed:%s", err))
+
+		case <-ctx.Done():
+			resume()
+			return primitive.Nil{}
+		}
+	}
+}
+
+// netWriteFn implements (net:write)
+//
+// The return value is the number of bytes written.
+func netWriteFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We need two arguments
+	if len(args) != 2 {
+		return primitive.ArityError()
+	}
+
+	c, fail := getNetConn(args[0])
+	if fail != nil {
+		return fail
+	}
+
+	str, ok := args[1].(primitive.String)
+	if !ok {
+		return primitive.Error("argument not a string")
+	}
+
+	stop := netWatch(env, c.conn, c.deadline)
+	n, err := io.WriteString(c.conn, string(str))
+	stop()
+
+	if err != nil {
+		return netError(env, "write", err)
+	}
+	return primitive.Number(n)
+}
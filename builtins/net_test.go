@@ -0,0 +1,503 @@
+package builtins
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/skx/yal/env"
+	"github.com/skx/yal/primitive"
+)
+
+// TestNetArguments ensures our socket-functions reject bogus arguments.
+func TestNetArguments(t *testing.T) {
+
+	type TC struct {
+		fn   primitive.GolangPrimitiveFn
+		args []primitive.Primitive
+		err  string
+	}
+
+	tcp := primitive.String("tcp")
+	str := primitive.String("steve")
+	num := primitive.Number(3)
+	other := primitive.NewHandle("timer", nil)
+
+	// A listener, which has been closed, to find a port nobody is
+	// listening upon
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	closed := primitive.String(ln.Addr().String())
+	ln.Close()
+
+	tests := []TC{
+		{netDialFn, []primitive.Primitive{tcp}, string(primitive.ArityError())},
+		{netDialFn, []primitive.Primitive{num, str}, "not a string"},
+		{netDialFn, []primitive.Primitive{str, str}, "unsupported network steve"},
+		{netDialFn, []primitive.Primitive{tcp, num}, "not a string"},
+		{netDialFn, []primitive.Primitive{tcp, closed, str}, "not a number"},
+		{netDialFn, []primitive.Primitive{tcp, closed}, "failed to connect"},
+		{netListenFn, []primitive.Primitive{tcp}, string(primitive.ArityError())},
+		{netListenFn, []primitive.Primitive{primitive.String("udp"), str}, "unsupported network"},
+		{netListenFn, []primitive.Primitive{tcp, num}, "not a string"},
+		{netListenFn, []primitive.Primitive{tcp, primitive.String("bogus:address:here")}, "failed to listen"},
+		{netAcceptFn, []primitive.Primitive{}, string(primitive.ArityError())},
+		{netAcceptFn, []primitive.Primitive{other}, "not a listener"},
+		{netAddressFn, []primitive.Primitive{}, string(primitive.ArityError())},
+		{netAddressFn, []primitive.Primitive{str}, "not a connection or listener"},
+		{netCloseFn, []primitive.Primitive{}, string(primitive.ArityError())},
+		{netCloseFn, []primitive.Primitive{other}, "not a connection or listener"},
+		{netDeadlineFn, []primitive.Primitive{other}, string(primitive.ArityError())},
+		{netDeadlineFn, []primitive.Primitive{other, num}, "not a connection"},
+		{netReadFn, []primitive.Primitive{}, string(primitive.ArityError())},
+		{netReadFn, []primitive.Primitive{num}, "not a connection"},
+		{netReadLineFn, []primitive.Primitive{}, string(primitive.ArityError())},
+		{netReadLineFn, []primitive.Primitive{str}, "not a connection"},
+		{netWriteFn, []primitive.Primitive{str}, string(primitive.ArityError())},
+		{netWriteFn, []primitive.Primitive{other, str}, "not a connection"},
+		{netServeFn, []primitive.Primitive{str}, string(primitive.ArityError())},
+		{netServeFn, []primitive.Primitive{other, str}, "not a listener"},
+	}
+
+	for _, test := range tests {
+		out := test.fn(ENV, test.args)
+
+		e, ok := out.(primitive.Error)
+		if !ok {
+			t.Fatalf("expected error for %v, got %v", test.args, out)
+		}
+		if !strings.Contains(string(e), test.err) {
+			t.Fatalf("got error for %v, but wrong one %v", test.args, out)
+		}
+	}
+
+	// Now with a real connection, and listener
+	l := netListenFn(ENV, []primitive.Primitive{tcp, primitive.String("127.0.0.1:0")})
+	defer netCloseFn(ENV, []primitive.Primitive{l})
+
+	addr := netAddressFn(ENV, []primitive.Primitive{l}).(primitive.Hash).Get(":local")
+	c := netDialFn(ENV, []primitive.Primitive{tcp, addr})
+	defer netCloseFn(ENV, []primitive.Primitive{c})
+
+	tests = []TC{
+		{netDeadlineFn, []primitive.Primitive{c, str}, "not a number"},
+		{netReadFn, []primitive.Primitive{c, str}, "size must be a positive number"},
+		{netReadFn, []primitive.Primitive{c, primitive.Number(0)}, "size must be a positive number"},
+		{netWriteFn, []primitive.Primitive{c, num}, "not a string"},
+		{netServeFn, []primitive.Primitive{l, str}, "not a function"},
+		{netServeFn, []primitive.Primitive{l, &primitive.Procedure{}, str}, "not a number"},
+	}
+
+	for _, test := range tests {
+		out := test.fn(ENV, test.args)
+
+		e, ok := out.(primitive.Error)
+		if !ok {
+			t.Fatalf("expected error for %v, got %v", test.args, out)
+		}
+		if !strings.Contains(string(e), test.err) {
+			t.Fatalf("got error for %v, but wrong one %v", test.args, out)
+		}
+	}
+
+	// Pretend we're running under a fuzzer
+	old := os.Getenv("FUZZ")
+	os.Setenv("FUZZ", "FUZZ")
+	dial := netDialFn(ENV, []primitive.Primitive{tcp, addr})
+	listen := netListenFn(ENV, []primitive.Primitive{tcp, primitive.String("127.0.0.1:0")})
+	os.Setenv("FUZZ", old)
+
+	if _, ok := dial.(primitive.Nil); !ok {
+		t.Fatalf("expected nil, got %v", dial)
+	}
+	if _, ok := listen.(primitive.Nil); !ok {
+		t.Fatalf("expected nil, got %v", listen)
+	}
+}
+
+// TestNet tests connecting, reading, and writing.
+func TestNet(t *testing.T) {
+
+	addrs := map[string]string{
+		"tcp": "127.0.0.1:0",
+	}
+	if runtime.GOOS != "windows" {
+		addrs["unix"] = filepath.Join(t.TempDir(), "test.sock")
+	}
+
+	for network, addr := range addrs {
+
+		l := netListenFn(ENV, []primitive.Primitive{primitive.String(network), primitive.String(addr)})
+		if _, ok := l.(*primitive.Handle); !ok {
+			t.Fatalf("%s: expected listener, got %v", network, l)
+		}
+		if l.Type() != "listener" {
+			t.Fatalf("%s: wrong type %s", network, l.Type())
+		}
+
+		local := netAddressFn(ENV, []primitive.Primitive{l}).(primitive.Hash).Get(":local")
+
+		client := netDialFn(ENV, []primitive.Primitive{primitive.String(network), local, primitive.Number(5000)})
+		if client.Type() != "connection" {
+			t.Fatalf("%s: expected connection, got %v", network, client)
+		}
+
+		server := netAcceptFn(ENV, []primitive.Primitive{l})
+		if server.Type() != "connection" {
+			t.Fatalf("%s: expected connection, got %v", network, server)
+		}
+
+		// The addresses of each end match
+		ca := netAddressFn(ENV, []primitive.Primitive{client}).(primitive.Hash)
+		sa := netAddressFn(ENV, []primitive.Primitive{server}).(primitive.Hash)
+		if ca.Get(":remote").ToString() != local.ToString() || ca.Get(":local").ToString() != sa.Get(":remote").ToString() {
+			t.Fatalf("%s: wrong addresses %v %v", network, ca, sa)
+		}
+
+		// Write some lines, and read them back
+		out := netWriteFn(ENV, []primitive.Primitive{client, primitive.String("PING\r\nHELLO\nabcdef")})
+		if out != primitive.Number(18) {
+			t.Fatalf("%s: wrong write result %v", network, out)
+		}
+
+		for _, expected := range []string{"PING", "HELLO"} {
+			out = netReadLineFn(ENV, []primitive.Primitive{server})
+			if out.ToString() != expected {
+				t.Fatalf("%s: wrong line %v", network, out)
+			}
+		}
+
+		out = netReadFn(ENV, []primitive.Primitive{server, primitive.Number(4)})
+		if out.ToString() != "abcd" {
+			t.Fatalf("%s: wrong read %v", network, out)
+		}
+
+		// Nothing more is coming, so we'll timeout
+		netDeadlineFn(ENV, []primitive.Primitive{server, primitive.Number(50)})
+		out = netReadLineFn(ENV, []primitive.Primitive{server})
+		if !strings.Contains(out.ToString(), "i/o timeout") {
+			t.Fatalf("%s: expected timeout, got %v", network, out)
+		}
+
+		// Clear the deadline, and close the client
+		netDeadlineFn(ENV, []primitive.Primitive{server, primitive.Nil{}})
+		netCloseFn(ENV, []primitive.Primitive{client})
+
+		// The remaining partial line is returned, then nil
+		out = netReadLineFn(ENV, []primitive.Primitive{server})
+		if out.ToString() != "ef" {
+			t.Fatalf("%s: wrong line %v", network, out)
+		}
+		out = netReadLineFn(ENV, []primitive.Primitive{server})
+		if _, ok := out.(primitive.Nil); !ok {
+			t.Fatalf("%s: expected nil, got %v", network, out)
+		}
+		out = netReadFn(ENV, []primitive.Primitive{server})
+		if _, ok := out.(primitive.Nil); !ok {
+			t.Fatalf("%s: expected nil, got %v", network, out)
+		}
+
+		// Closing twice is fine, but writing to a closed
+		// connection isn't
+		for i := 0; i < 2; i++ {
+			out = netCloseFn(ENV, []primitive.Primitive{server})
+			if _, ok := out.(primitive.Nil); !ok {
+				t.Fatalf("%s: expected nil, got %v", network, out)
+			}
+		}
+		out = netWriteFn(ENV, []primitive.Primitive{server, primitive.String("x")})
+		if !strings.Contains(out.ToString(), "write failed") {
+			t.Fatalf("%s: expected error, got %v", network, out)
+		}
+
+		netCloseFn(ENV, []primitive.Primitive{l})
+		out = netAcceptFn(ENV, []primitive.Primitive{l})
+		if !strings.Contains(out.ToString(), "accept failed") {
+			t.Fatalf("%s: expected error, got %v", network, out)
+		}
+	}
+}
+
+// TestNetCancel tests that blocking operations are interrupted by the
+// interpreter's context.
+func TestNetCancel(t *testing.T) {
+
+	l := netListenFn(ENV, []primitive.Primitive{primitive.String("tcp"), primitive.String("127.0.0.1:0")})
+	defer netCloseFn(ENV, []primitive.Primitive{l})
+
+	local := netAddressFn(ENV, []primitive.Primitive{l}).(primitive.Hash).Get(":local")
+	client := netDialFn(ENV, []primitive.Primitive{primitive.String("tcp"), local})
+	defer netCloseFn(ENV, []primitive.Primitive{client})
+
+	// Accept the client, so that nothing else is waiting
+	server := netAcceptFn(ENV, []primitive.Primitive{l})
+	defer netCloseFn(ENV, []primitive.Primitive{server})
+
+	type TC struct {
+		fn   primitive.GolangPrimitiveFn
+		args []primitive.Primitive
+	}
+
+	tests := []TC{
+		{netReadLineFn, []primitive.Primitive{client}},
+		{netReadFn, []primitive.Primitive{client}},
+		{netAcceptFn, []primitive.Primitive{l}},
+	}
+
+	for _, test := range tests {
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+
+		e := env.New()
+		e.SetEvaluator(&fakeEvaluator{ctx: ctx})
+
+		start := time.Now()
+		out := test.fn(e, test.args)
+		cancel()
+
+		if !strings.Contains(out.ToString(), "context deadline exceeded") {
+			t.Fatalf("expected timeout, got %v", out)
+		}
+		if time.Since(start) > 2*time.Second {
+			t.Fatalf("operation wasn't interrupted promptly")
+		}
+	}
+}
+
+// TestNetServe tests serving connections.
+func TestNetServe(t *testing.T) {
+
+	l := netListenFn(ENV, []primitive.Primitive{primitive.String("tcp"), primitive.String("127.0.0.1:0")})
+	addr := netAddressFn(ENV, []primitive.Primitive{l}).(primitive.Hash).Get(":local").ToString()
+
+	// A handler which echoes lines, in upper-case, until told to quit
+	handled := 0
+	proc := &primitive.Procedure{F: func(e *env.Environment, args []primitive.Primitive) primitive.Primitive {
+		handled++
+		for {
+			line := netReadLineFn(e, args)
+			if _, ok := line.(primitive.String); !ok {
+				return line
+			}
+			if line.ToString() == "QUIT" {
+				return netCloseFn(e, []primitive.Primitive{l})
+			}
+			netWriteFn(e, []primitive.Primitive{args[0], primitive.String(strings.ToUpper(line.ToString()) + "\n")})
+		}
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	e := env.New()
+	e.SetEvaluator(&fakeEvaluator{ctx: ctx})
+
+	result := make(chan primitive.Primitive, 1)
+	go func() {
+		result <- netServeFn(e, []primitive.Primitive{l, proc, primitive.Number(200)})
+	}()
+
+	// Without a scheduler connections are handled one at a time, and
+	// a client which sends nothing will be dropped after the timeout
+	idle, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to connect:%s", err)
+	}
+	defer idle.Close()
+
+	// A well-behaved client is served after that
+	for _, msg := range []string{"hello", "world"} {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("failed to connect:%s", err)
+		}
+
+		conn.Write([]byte(msg + "\n"))
+		reply, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil || reply != strings.ToUpper(msg)+"\n" {
+			t.Fatalf("wrong reply %q:%s", reply, err)
+		}
+		conn.Close()
+	}
+
+	// Finally tell the server to stop
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to connect:%s", err)
+	}
+	conn.Write([]byte("QUIT\n"))
+	conn.Close()
+
+	select {
+	case out := <-result:
+		if _, ok := out.(primitive.Nil); !ok {
+			t.Fatalf("expected nil, got %v", out)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("server didn't stop")
+	}
+
+	if handled != 4 {
+		t.Fatalf("wrong number of connections handled %d", handled)
+	}
+
+	// Cancelling the context stops the server, and closes the listener
+	l = netListenFn(ENV, []primitive.Primitive{primitive.String("tcp"), primitive.String("127.0.0.1:0")})
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	e = env.New()
+	e.SetEvaluator(&fakeEvaluator{ctx: ctx})
+
+	out := netServeFn(e, []primitive.Primitive{l, proc})
+	if _, ok := out.(primitive.Nil); !ok {
+		t.Fatalf("expected nil, got %v", out)
+	}
+
+	out = netAcceptFn(ENV, []primitive.Primitive{l})
+	if !strings.Contains(out.ToString(), "accept failed") {
+		t.Fatalf("expected error, got %v", out)
+	}
+}
+
+// fakeScheduler is an evaluator which allows procedures to run on more
+// than one goroutine, one at a time.
+type fakeScheduler struct {
+	fakeEvaluator
+
+	running sync.Mutex
+	shared  bool
+}
+
+func (f *fakeScheduler) Go(fn func()) {
+	if !f.shared {
+		f.shared = true
+		f.running.Lock()
+	}
+
+	go func() {
+		f.running.Lock()
+		defer f.running.Unlock()
+		fn()
+	}()
+}
+
+func (f *fakeScheduler) Yield() func() {
+	if !f.shared {
+		return func() {}
+	}
+	f.running.Unlock()
+	return f.running.Lock
+}
+
+// TestNetServeConcurrent tests that a connection is served while another
+// is idle.
+func TestNetServeConcurrent(t *testing.T) {
+
+	l := netListenFn(ENV, []primitive.Primitive{primitive.String("tcp"), primitive.String("127.0.0.1:0")})
+	addr := netAddressFn(ENV, []primitive.Primitive{l}).(primitive.Hash).Get(":local").ToString()
+
+	// A handler which replies to a single line, or stops the server.
+	//
+	// The counts are updated without locking, as the handlers take
+	// turns to run, which the race detector will confirm.
+	started, finished := 0, 0
+	begun := make(chan struct{}, 8)
+	proc := &primitive.Procedure{F: func(e *env.Environment, args []primitive.Primitive) primitive.Primitive {
+		started++
+		defer func() { finished++ }()
+		begun <- struct{}{}
+
+		line := netReadLineFn(e, args)
+		if line.ToString() == "QUIT" {
+			return netCloseFn(e, []primitive.Primitive{l})
+		}
+		return netWriteFn(e, []primitive.Primitive{args[0], primitive.String(strings.ToUpper(line.ToString()) + "\n")})
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	e := env.New()
+	e.SetEvaluator(&fakeScheduler{fakeEvaluator: fakeEvaluator{ctx: ctx}})
+
+	result := make(chan primitive.Primitive, 1)
+	go func() {
+		result <- netServeFn(e, []primitive.Primitive{l, proc})
+	}()
+
+	// A client which sends nothing, and has no timeout
+	idle, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to connect:%s", err)
+	}
+	defer idle.Close()
+
+	// Doesn't stop the others from being served
+	for _, msg := range []string{"hello", "world"} {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("failed to connect:%s", err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		conn.Write([]byte(msg + "\n"))
+		reply, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil || reply != strings.ToUpper(msg)+"\n" {
+			t.Fatalf("wrong reply %q:%s", reply, err)
+		}
+		conn.Close()
+	}
+
+	// The idle client may then stop the server
+	idle.Write([]byte("QUIT\n"))
+
+	select {
+	case out := <-result:
+		if _, ok := out.(primitive.Nil); !ok {
+			t.Fatalf("expected nil, got %v", out)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("server didn't stop")
+	}
+
+	// Stopping the server closes connections whose handlers are
+	// still running, and waits for them to return.
+	for len(begun) > 0 {
+		<-begun
+	}
+
+	l = netListenFn(ENV, []primitive.Primitive{primitive.String("tcp"), primitive.String("127.0.0.1:0")})
+	addr = netAddressFn(ENV, []primitive.Primitive{l}).(primitive.Hash).Get(":local").ToString()
+
+	go func() {
+		result <- netServeFn(e, []primitive.Primitive{l, proc})
+	}()
+
+	idle, err = net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to connect:%s", err)
+	}
+	defer idle.Close()
+
+	// Wait for the handler to start
+	<-begun
+	cancel()
+
+	select {
+	case <-result:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("server didn't stop")
+	}
+
+	if started != 4 || finished != started {
+		t.Fatalf("%d handlers started, %d finished", started, finished)
+	}
+}
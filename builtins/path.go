@@ -0,0 +1,230 @@
+// path.go - Implementation of our path-manipulation primitives.
+//
+// These are all thin wrappers around the golang "path/filepath" package,
+// which means they use the separator appropriate to the host operating
+// system.
+
+package builtins
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/skx/yal/env"
+	"github.com/skx/yal/primitive"
+)
+
+// pathStringArg returns the given argument as a string, or an error
+// if it was some other type.
+func pathStringArg(arg primitive.Primitive) (string, primitive.Primitive) {
+	str, ok := arg.(primitive.String)
+	if !ok {
+		return "", primitive.Error("argument not a string")
+	}
+	return str.ToString(), nil
+}
+
+// pathAbsFn implements (path:abs)
+func pathAbsFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We only need a single argument
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	// Which is a string
+	pth, err := pathStringArg(args[0])
+	if err != nil {
+		return err
+	}
+
+	abs, er := filepath.Abs(pth)
+	if er != nil {
+		return primitive.Error(fmt.Sprintf("failed to make %s absolute:%s", pth, er))
+	}
+	return primitive.String(abs)
+}
+
+// pathBaseFn implements (path:base)
+func pathBaseFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We only need a single argument
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	// Which is a string
+	pth, err := pathStringArg(args[0])
+	if err != nil {
+		return err
+	}
+
+	return primitive.String(filepath.Base(pth))
+}
+
+// pathCleanFn implements (path:clean)
+func pathCleanFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We only need a single argument
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	// Which is a string
+	pth, err := pathStringArg(args[0])
+	if err != nil {
+		return err
+	}
+
+	return primitive.String(filepath.Clean(pth))
+}
+
+// pathDirFn implements (path:dir)
+func pathDirFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We only need a single argument
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	// Which is a string
+	pth, err := pathStringArg(args[0])
+	if err != nil {
+		return err
+	}
+
+	return primitive.String(filepath.Dir(pth))
+}
+
+// pathExtFn implements (path:ext)
+func pathExtFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We only need a single argument
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	// Which is a string
+	pth, err := pathStringArg(args[0])
+	if err != nil {
+		return err
+	}
+
+	return primitive.String(filepath.Ext(pth))
+}
+
+// pathJoinFn implements (path:join)
+func pathJoinFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We need at least one argument
+	if len(args) < 1 {
+		return primitive.ArityError()
+	}
+
+	// All of which must be strings
+	parts := []string{}
+	for _, arg := range args {
+		pth, err := pathStringArg(arg)
+		if err != nil {
+			return err
+		}
+		parts = append(parts, pth)
+	}
+
+	return primitive.String(filepath.Join(parts...))
+}
+
+// pathMatchFn implements (path:match)
+func pathMatchFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We need two arguments
+	if len(args) != 2 {
+		return primitive.ArityError()
+	}
+
+	// The pattern
+	pat, err := pathStringArg(args[0])
+	if err != nil {
+		return err
+	}
+
+	// The path to test
+	pth, err := pathStringArg(args[1])
+	if err != nil {
+		return err
+	}
+
+	match, er := filepath.Match(pat, pth)
+	if er != nil {
+		return primitive.Error(fmt.Sprintf("error matching pattern %s:%s", pat, er))
+	}
+	return primitive.Bool(match)
+}
+
+// pathRelFn implements (path:rel)
+func pathRelFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We need two arguments
+	if len(args) != 2 {
+		return primitive.ArityError()
+	}
+
+	// The base directory
+	base, err := pathStringArg(args[0])
+	if err != nil {
+		return err
+	}
+
+	// The target path
+	target, err := pathStringArg(args[1])
+	if err != nil {
+		return err
+	}
+
+	rel, er := filepath.Rel(base, target)
+	if er != nil {
+		return primitive.Error(fmt.Sprintf("failed to make %s relative to %s:%s", target, base, er))
+	}
+	return primitive.String(rel)
+}
+
+// pathSplitFn implements (path:split)
+//
+// Return value is (DIRECTORY FILE)
+func pathSplitFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We only need a single argument
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	// Which is a string
+	pth, err := pathStringArg(args[0])
+	if err != nil {
+		return err
+	}
+
+	dir, file := filepath.Split(pth)
+	return primitive.List{primitive.String(dir), primitive.String(file)}
+}
+
+// pathSplitListFn implements (path:split-list)
+func pathSplitListFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We only need a single argument
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	// Which is a string
+	pth, err := pathStringArg(args[0])
+	if err != nil {
+		return err
+	}
+
+	var ret primitive.List
+	for _, ent := range filepath.SplitList(pth) {
+		ret = append(ret, primitive.String(ent))
+	}
+	return ret
+}
@@ -0,0 +1,258 @@
+package builtins
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skx/yal/primitive"
+)
+
+// TestPathArguments ensures all our path-functions reject bogus
+// argument counts and types.
+func TestPathArguments(t *testing.T) {
+
+	// Functions which take a single argument
+	single := []primitive.GolangPrimitiveFn{
+		pathAbsFn,
+		pathBaseFn,
+		pathCleanFn,
+		pathDirFn,
+		pathExtFn,
+		pathSplitFn,
+		pathSplitListFn,
+	}
+
+	for _, fn := range single {
+
+		// No arguments
+		out := fn(ENV, []primitive.Primitive{})
+
+		// Will lead to an error
+		e, ok := out.(primitive.Error)
+		if !ok {
+			t.Fatalf("expected error, got %v", out)
+		}
+		if e != primitive.ArityError() {
+			t.Fatalf("got error, but wrong one %v", out)
+		}
+
+		// Argument of the wrong type
+		out = fn(ENV, []primitive.Primitive{primitive.Number(3)})
+
+		e, ok = out.(primitive.Error)
+		if !ok {
+			t.Fatalf("expected error, got %v", out)
+		}
+		if !strings.Contains(string(e), "not a string") {
+			t.Fatalf("got error, but wrong one %v", out)
+		}
+	}
+
+	// Functions which take two arguments
+	double := []primitive.GolangPrimitiveFn{
+		pathMatchFn,
+		pathRelFn,
+	}
+
+	for _, fn := range double {
+
+		// One argument
+		out := fn(ENV, []primitive.Primitive{primitive.String("/tmp")})
+
+		e, ok := out.(primitive.Error)
+		if !ok {
+			t.Fatalf("expected error, got %v", out)
+		}
+		if e != primitive.ArityError() {
+			t.Fatalf("got error, but wrong one %v", out)
+		}
+
+		// Second argument of the wrong type
+		out = fn(ENV, []primitive.Primitive{primitive.String("/tmp"), primitive.Number(3)})
+
+		e, ok = out.(primitive.Error)
+		if !ok {
+			t.Fatalf("expected error, got %v", out)
+		}
+		if !strings.Contains(string(e), "not a string") {
+			t.Fatalf("got error, but wrong one %v", out)
+		}
+	}
+
+	// Join needs at least one argument
+	out := pathJoinFn(ENV, []primitive.Primitive{})
+	if out != primitive.ArityError() {
+		t.Fatalf("expected arity error, got %v", out)
+	}
+
+	// And they must all be strings
+	out = pathJoinFn(ENV, []primitive.Primitive{primitive.String("/tmp"), primitive.Bool(true)})
+	if !strings.Contains(out.ToString(), "not a string") {
+		t.Fatalf("expected type error, got %v", out)
+	}
+}
+
+// TestPathSimple tests the functions which return a single string.
+func TestPathSimple(t *testing.T) {
+
+	type TC struct {
+		fn     primitive.GolangPrimitiveFn
+		args   []string
+		output string
+	}
+
+	sep := string(filepath.Separator)
+
+	tests := []TC{
+		{pathBaseFn, []string{"/etc/passwd"}, "passwd"},
+		{pathBaseFn, []string{""}, "."},
+		{pathCleanFn, []string{"/etc/../etc/./passwd"}, filepath.FromSlash("/etc/passwd")},
+		{pathDirFn, []string{"/etc/passwd"}, filepath.FromSlash("/etc")},
+		{pathExtFn, []string{"archive.tar.gz"}, ".gz"},
+		{pathExtFn, []string{"README"}, ""},
+		{pathJoinFn, []string{"etc", "ssh", "sshd_config"}, "etc" + sep + "ssh" + sep + "sshd_config"},
+		{pathJoinFn, []string{"etc", "", "passwd"}, "etc" + sep + "passwd"},
+		{pathRelFn, []string{"/etc", "/etc/ssh/sshd_config"}, filepath.FromSlash("ssh/sshd_config")},
+	}
+
+	for _, test := range tests {
+
+		args := []primitive.Primitive{}
+		for _, arg := range test.args {
+			args = append(args, primitive.String(filepath.FromSlash(arg)))
+		}
+
+		out := test.fn(ENV, args)
+
+		str, ok := out.(primitive.String)
+		if !ok {
+			t.Fatalf("expected string for %v, got %v", test.args, out)
+		}
+		if str.ToString() != test.output {
+			t.Fatalf("expected '%s' for %v, got '%s'", test.output, test.args, str)
+		}
+	}
+}
+
+// TestPathAbs tests (path:abs)
+func TestPathAbs(t *testing.T) {
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("failed to get cwd:%s", err)
+	}
+
+	out := pathAbsFn(ENV, []primitive.Primitive{primitive.String("foo")})
+
+	str, ok := out.(primitive.String)
+	if !ok {
+		t.Fatalf("expected string, got %v", out)
+	}
+	if str.ToString() != filepath.Join(cwd, "foo") {
+		t.Fatalf("got wrong absolute path %s", str)
+	}
+}
+
+// TestPathMatch tests (path:match)
+func TestPathMatch(t *testing.T) {
+
+	out := pathMatchFn(ENV, []primitive.Primitive{
+		primitive.String("*.lisp"),
+		primitive.String("test.lisp"),
+	})
+	if out != primitive.Bool(true) {
+		t.Fatalf("expected match, got %v", out)
+	}
+
+	out = pathMatchFn(ENV, []primitive.Primitive{
+		primitive.String("*.lisp"),
+		primitive.String("test.go"),
+	})
+	if out != primitive.Bool(false) {
+		t.Fatalf("expected no match, got %v", out)
+	}
+
+	// A malformed pattern
+	out = pathMatchFn(ENV, []primitive.Primitive{
+		primitive.String("[-"),
+		primitive.String("test.go"),
+	})
+	e, ok := out.(primitive.Error)
+	if !ok {
+		t.Fatalf("expected error, got %v", out)
+	}
+	if !strings.Contains(string(e), "error matching pattern") {
+		t.Fatalf("got error, but wrong one %v", out)
+	}
+}
+
+// TestPathRel tests (path:rel) failing
+func TestPathRel(t *testing.T) {
+
+	// A relative target cannot be made relative to an absolute base
+	out := pathRelFn(ENV, []primitive.Primitive{
+		primitive.String(filepath.FromSlash("/etc")),
+		primitive.String("passwd"),
+	})
+
+	e, ok := out.(primitive.Error)
+	if !ok {
+		t.Fatalf("expected error, got %v", out)
+	}
+	if !strings.Contains(string(e), "failed to make") {
+		t.Fatalf("got error, but wrong one %v", out)
+	}
+}
+
+// TestPathSplit tests (path:split) and (path:split-list)
+func TestPathSplit(t *testing.T) {
+
+	out := pathSplitFn(ENV, []primitive.Primitive{
+		primitive.String(filepath.FromSlash("/etc/passwd")),
+	})
+
+	lst, ok := out.(primitive.List)
+	if !ok {
+		t.Fatalf("expected list, got %v", out)
+	}
+	if len(lst) != 2 {
+		t.Fatalf("expected two entries, got %v", lst)
+	}
+	if lst[0].ToString() != filepath.FromSlash("/etc/") {
+		t.Fatalf("wrong directory %v", lst[0])
+	}
+	if lst[1].ToString() != "passwd" {
+		t.Fatalf("wrong file %v", lst[1])
+	}
+
+	// Now a list of paths
+	input := strings.Join([]string{"/bin", "/usr/bin"}, string(filepath.ListSeparator))
+	out = pathSplitListFn(ENV, []primitive.Primitive{
+		primitive.String(input),
+	})
+
+	lst, ok = out.(primitive.List)
+	if !ok {
+		t.Fatalf("expected list, got %v", out)
+	}
+	if len(lst) != 2 {
+		t.Fatalf("expected two entries, got %v", lst)
+	}
+	if lst[0].ToString() != "/bin" || lst[1].ToString() != "/usr/bin" {
+		t.Fatalf("wrong result %v", lst)
+	}
+
+	// empty string is an empty list
+	out = pathSplitListFn(ENV, []primitive.Primitive{
+		primitive.String(""),
+	})
+	lst, ok = out.(primitive.List)
+	if !ok {
+		t.Fatalf("expected list, got %v", out)
+	}
+	if len(lst) != 0 {
+		t.Fatalf("expected empty list, got %v", lst)
+	}
+}
@@ -0,0 +1,299 @@
+// pipeline.go - Implementation of (pipeline ..)
+//
+// A pipeline connects a series of stages together, such that the output
+// of each is fed to the input of the next, without the need to invoke a
+// shell.
+//
+// Each stage is either a command to execute, or a lisp function which
+// is invoked for each line of its input.  Lisp code is not safe to run
+// concurrently, so while the commands run in the background all the
+// calls to lisp functions are made upon the caller's goroutine.
+
+package builtins
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skx/yal/env"
+	"github.com/skx/yal/primitive"
+)
+
+// pipelineStage holds the state of a single stage of a pipeline.
+type pipelineStage struct {
+
+	// cmd is the command to execute, if this stage runs a command.
+	cmd *exec.Cmd
+
+	// proc is the function to invoke, if this stage is a filter.
+	proc *primitive.Procedure
+
+	// in and out are connected to the adjacent stages.
+	in  io.Reader
+	out io.Writer
+
+	// stderr holds the error output of a command.
+	stderr bytes.Buffer
+
+	// code holds the exit code of the stage, once complete.
+	code int
+
+	// err holds any error which aborted the stage.
+	err primitive.Primitive
+}
+
+// close closes any pipes which connect this stage to its neighbours.
+func (s *pipelineStage) close() {
+	if f, ok := s.in.(*os.File); ok {
+		f.Close()
+	}
+	if f, ok := s.out.(*os.File); ok {
+		f.Close()
+	}
+}
+
+// pipelineCall is sent from a filter-stage to the caller's goroutine,
+// when a lisp function must be invoked.
+type pipelineCall struct {
+	proc  *primitive.Procedure
+	line  string
+	reply chan primitive.Primitive
+}
+
+// filter runs a lisp function over each line of input, writing the
+// results to our output.
+//
+// A function which returns nil causes the line to be dropped.
+func (s *pipelineStage) filter(calls chan<- pipelineCall, cancel context.CancelFunc) {
+
+	// Closing our pipes lets the stages either side of us see
+	// that we're done.
+	defer s.close()
+
+	// We might be the first stage, with no input.
+	if s.in == nil {
+		return
+	}
+
+	reply := make(chan primitive.Primitive)
+	rdr := bufio.NewReader(s.in)
+	for {
+		line, err := rdr.ReadString('\n')
+		if line != "" {
+			calls <- pipelineCall{proc: s.proc, line: strings.TrimSuffix(line, "\n"), reply: reply}
+			out := <-reply
+
+			// An error aborts the whole pipeline.
+			if _, ok := out.(primitive.Error); ok {
+				s.err = out
+				s.code = -1
+				cancel()
+				return
+			}
+
+			if !primitive.IsNil(out) {
+				_, err = io.WriteString(s.out, out.ToString()+"\n")
+
+				// The next stage stopped reading.
+				if err != nil {
+					return
+				}
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// wait waits for the command of this stage to complete, and records the
+// exit code.
+//
+// A command which was still running when the pipeline was cancelled is
+// reported as killed, even if it managed to exit by itself because the
+// stage before it was killed and closed its input.
+func (s *pipelineStage) wait(ctx context.Context) {
+	err := s.cmd.Wait()
+	if ctx.Err() != nil {
+		s.code = -1
+		return
+	}
+	if err == nil {
+		return
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		s.code = exitErr.ExitCode()
+		return
+	}
+	s.code = -1
+	s.err = primitive.Error(fmt.Sprintf("error running command %s:%s", s.cmd.Args, err))
+}
+
+// pipelineFn implements (pipeline)
+func pipelineFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// A trailing hash contains options for the pipeline as a whole
+	var opts processOptions
+	if len(args) > 0 {
+		if _, ok := args[len(args)-1].(primitive.Hash); ok {
+			var fail primitive.Primitive
+			opts, fail = parseProcessOptions(args[len(args)-1])
+			if fail != nil {
+				return fail
+			}
+			args = args[:len(args)-1]
+		}
+	}
+
+	// We need at least one stage
+	if len(args) < 1 {
+		return primitive.ArityError()
+	}
+
+	ctx, cancel := processContext(opts)
+	defer cancel()
+
+	// Create each stage, in turn
+	stages := make([]*pipelineStage, len(args))
+	for i, arg := range args {
+
+		stages[i] = &pipelineStage{}
+
+		switch arg := arg.(type) {
+		case *primitive.Procedure:
+			stages[i].proc = arg
+		case primitive.List:
+			cArgs, fail := processArgs(arg)
+			if fail != nil {
+				return fail
+			}
+			stages[i].cmd = newProcessCmd(ctx, cArgs, opts)
+		default:
+			return primitive.Error(fmt.Sprintf("pipeline stage %d must be a list or a function, got %v", i+1, arg.Type()))
+		}
+	}
+
+	// If we're running a test-case we'll stop here, because
+	// fuzzing might run commands.
+	if os.Getenv("FUZZ") != "" {
+		return primitive.NewHash()
+	}
+
+	// The first stage reads any input we were given, and the
+	// last stage writes to a buffer we'll return.
+	var stdout bytes.Buffer
+	if opts.stdin != nil {
+		stages[0].in = strings.NewReader(*opts.stdin)
+	}
+	stages[len(stages)-1].out = &stdout
+
+	// Connect each stage to the next.
+	for i := 0; i < len(stages)-1; i++ {
+		r, w, err := os.Pipe()
+		if err != nil {
+			for _, s := range stages {
+				s.close()
+			}
+			return primitive.Error(fmt.Sprintf("failed to create pipe:%s", err))
+		}
+		stages[i].out = w
+		stages[i+1].in = r
+	}
+
+	// Now launch each stage
+	calls := make(chan pipelineCall)
+	var wg sync.WaitGroup
+	var fail primitive.Primitive
+
+	start := time.Now()
+	for _, s := range stages {
+
+		// Once something has failed we don't launch anything else,
+		// but we still need to close the pipes of the remainder.
+		if fail != nil {
+			s.close()
+			continue
+		}
+
+		if s.proc != nil {
+			wg.Add(1)
+			go func(s *pipelineStage) {
+				defer wg.Done()
+				s.filter(calls, cancel)
+			}(s)
+			continue
+		}
+
+		s.cmd.Stdin = s.in
+		s.cmd.Stdout = s.out
+		s.cmd.Stderr = &s.stderr
+		err := s.cmd.Start()
+
+		// The child has its own copies of the pipes now.
+		s.close()
+
+		if err != nil {
+			fail = primitive.Error(fmt.Sprintf("error starting command %s:%s", s.cmd.Args, err))
+			cancel()
+			continue
+		}
+
+		wg.Add(1)
+		go func(s *pipelineStage) {
+			defer wg.Done()
+			s.wait(ctx)
+		}(s)
+	}
+
+	// Wait for everything to complete, servicing any calls to lisp
+	// functions as they are made.
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	for running := true; running; {
+		select {
+		case c := <-calls:
+			c.reply <- applyProcedure(env, c.proc, []primitive.Primitive{primitive.String(c.line)})
+		case <-done:
+			running = false
+		}
+	}
+
+	if fail != nil {
+		return fail
+	}
+
+	// Collect the results from each stage
+	var stderr strings.Builder
+	var codes primitive.List
+	for _, s := range stages {
+		if s.err != nil {
+			return s.err
+		}
+		stderr.WriteString(s.stderr.String())
+		codes = append(codes, primitive.Number(s.code))
+	}
+
+	res := primitive.NewHash()
+	res.Set(":stdout", primitive.String(stdout.String()))
+	res.Set(":stderr", primitive.String(stderr.String()))
+	res.Set(":exit-code", codes[len(codes)-1])
+	res.Set(":exit-codes", codes)
+	res.Set(":duration", primitive.Number(time.Since(start).Milliseconds()))
+	res.Set(":timed-out", primitive.Bool(errors.Is(ctx.Err(), context.DeadlineExceeded)))
+	return res
+}
@@ -0,0 +1,180 @@
+//go:build !windows
+// +build !windows
+
+package builtins
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/skx/yal/env"
+	"github.com/skx/yal/primitive"
+)
+
+// TestPipelineArguments tests (pipeline) with bogus arguments
+func TestPipelineArguments(t *testing.T) {
+
+	// No stages
+	out := pipelineFn(ENV, []primitive.Primitive{})
+	if out != primitive.ArityError() {
+		t.Fatalf("expected arity error, got %v", out)
+	}
+
+	// Only options
+	out = pipelineFn(ENV, []primitive.Primitive{primitive.NewHash()})
+	if out != primitive.ArityError() {
+		t.Fatalf("expected arity error, got %v", out)
+	}
+
+	bogusKey := primitive.NewHash()
+	bogusKey.Set(":cheese", primitive.String("cake"))
+
+	type TC struct {
+		args []primitive.Primitive
+		err  string
+	}
+
+	tests := []TC{
+		{[]primitive.Primitive{primitive.Number(3)}, "stage 1 must be a list or a function"},
+		{[]primitive.Primitive{cmd("true"), primitive.String("foo")}, "stage 2 must be a list or a function"},
+		{[]primitive.Primitive{primitive.List{}}, "must be non-empty"},
+		{[]primitive.Primitive{cmd("true"), bogusKey}, "unknown process option :cheese"},
+		{[]primitive.Primitive{cmd("true"), cmd("/fdsf/fdsf/-path-not/exists")}, "error starting command"},
+	}
+
+	for _, test := range tests {
+		out = pipelineFn(ENV, test.args)
+
+		e, ok := out.(primitive.Error)
+		if !ok {
+			t.Fatalf("expected error, got %v", out)
+		}
+		if !strings.Contains(string(e), test.err) {
+			t.Fatalf("got error, but wrong one %v", out)
+		}
+	}
+}
+
+// TestPipeline tests (pipeline) with commands, and golang filters.
+func TestPipeline(t *testing.T) {
+
+	// A filter which upper-cases lines, and drops those that
+	// are "skip"
+	upper := &primitive.Procedure{F: func(e *env.Environment, args []primitive.Primitive) primitive.Primitive {
+		if args[0].ToString() == "skip" {
+			return primitive.Nil{}
+		}
+		return primitive.String(strings.ToUpper(args[0].ToString()))
+	}}
+
+	opts := primitive.NewHash()
+	opts.Set(":stdin", primitive.String("one\nskip\ntwo\nthree"))
+
+	out := pipelineFn(ENV, []primitive.Primitive{
+		cmd("cat"),
+		upper,
+		cmd("sh", "-c", "sort; echo oops >&2; exit 2"),
+		opts,
+	})
+
+	res, ok := out.(primitive.Hash)
+	if !ok {
+		t.Fatalf("expected hash, got %v", out)
+	}
+	if res.Get(":stdout").ToString() != "ONE\nTHREE\nTWO\n" {
+		t.Fatalf("wrong stdout: %v", res.Get(":stdout"))
+	}
+	if res.Get(":stderr").ToString() != "oops\n" {
+		t.Fatalf("wrong stderr: %v", res.Get(":stderr"))
+	}
+	if res.Get(":exit-code") != primitive.Number(2) {
+		t.Fatalf("wrong exit-code: %v", res.Get(":exit-code"))
+	}
+	if res.Get(":exit-codes").ToString() != "(0 0 2)" {
+		t.Fatalf("wrong exit-codes: %v", res.Get(":exit-codes"))
+	}
+
+	// A filter may be the first and last stage
+	out = pipelineFn(ENV, []primitive.Primitive{upper, opts})
+	res, ok = out.(primitive.Hash)
+	if !ok {
+		t.Fatalf("expected hash, got %v", out)
+	}
+	if res.Get(":stdout").ToString() != "ONE\nTWO\nTHREE\n" {
+		t.Fatalf("wrong stdout: %v", res.Get(":stdout"))
+	}
+
+	// Without input a filter has nothing to do
+	out = pipelineFn(ENV, []primitive.Primitive{upper})
+	res, ok = out.(primitive.Hash)
+	if !ok {
+		t.Fatalf("expected hash, got %v", out)
+	}
+	if res.Get(":stdout").ToString() != "" {
+		t.Fatalf("wrong stdout: %v", res.Get(":stdout"))
+	}
+
+	// A stage which stops reading early doesn't hang us
+	out = pipelineFn(ENV, []primitive.Primitive{cmd("yes"), upper, cmd("head", "-n", "2")})
+	res, ok = out.(primitive.Hash)
+	if !ok {
+		t.Fatalf("expected hash, got %v", out)
+	}
+	if res.Get(":stdout").ToString() != "Y\nY\n" {
+		t.Fatalf("wrong stdout: %v", res.Get(":stdout"))
+	}
+
+	// Pretend we're running under a fuzzer
+	old := os.Getenv("FUZZ")
+	os.Setenv("FUZZ", "FUZZ")
+	out = pipelineFn(ENV, []primitive.Primitive{cmd("true")})
+	os.Setenv("FUZZ", old)
+
+	res, ok = out.(primitive.Hash)
+	if !ok {
+		t.Fatalf("expected hash, got %v", out)
+	}
+	if len(res.Entries) != 0 {
+		t.Fatalf("expected empty hash, got %v", res)
+	}
+}
+
+// TestPipelineFailure tests a filter which fails, and a timeout.
+func TestPipelineFailure(t *testing.T) {
+
+	fail := &primitive.Procedure{F: func(e *env.Environment, args []primitive.Primitive) primitive.Primitive {
+		return primitive.Error("bang")
+	}}
+
+	out := pipelineFn(ENV, []primitive.Primitive{cmd("yes"), fail, cmd("cat")})
+	if out != primitive.Error("bang") {
+		t.Fatalf("expected error, got %v", out)
+	}
+
+	// A lisp filter can't be called without an interpreter
+	lisp := &primitive.Procedure{Body: primitive.String("x")}
+	opts := primitive.NewHash()
+	opts.Set(":stdin", primitive.String("input"))
+
+	out = pipelineFn(ENV, []primitive.Primitive{lisp, opts})
+	if !strings.Contains(out.ToString(), "no interpreter available") {
+		t.Fatalf("expected error, got %v", out)
+	}
+
+	// Timeout
+	opts = primitive.NewHash()
+	opts.Set(":timeout", primitive.Number(50))
+
+	out = pipelineFn(ENV, []primitive.Primitive{cmd("sleep", "10"), cmd("cat"), opts})
+	res, ok := out.(primitive.Hash)
+	if !ok {
+		t.Fatalf("expected hash, got %v", out)
+	}
+	if res.Get(":timed-out") != primitive.Bool(true) {
+		t.Fatalf("expected timeout: %v", res)
+	}
+	if res.Get(":exit-codes").ToString() != "(-1 -1)" {
+		t.Fatalf("wrong exit-codes: %v", res.Get(":exit-codes"))
+	}
+}
@@ -0,0 +1,474 @@
+// process.go - Implementation of our process-spawning primitives.
+//
+// (shell) is a simple way to run a command, but it discards output on
+// failure and offers no control over the environment the child runs in.
+//
+// Here we allow a command to be run with specific input, environment,
+// working directory, and timeout, either to completion or in the
+// background.
+
+package builtins
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skx/yal/env"
+	"github.com/skx/yal/primitive"
+)
+
+// processOptions holds the options which may be supplied, via a hash,
+// when launching a child process.
+type processOptions struct {
+
+	// stdin contains input to send to the child, if set.
+	stdin *string
+
+	// env contains the extra environmental variables to set.
+	env []string
+
+	// dir contains the working directory of the child.
+	dir string
+
+	// timeout is the maximum runtime of the child, if non-zero.
+	timeout time.Duration
+}
+
+// parseProcessOptions converts the given hash into a set of options.
+func parseProcessOptions(arg primitive.Primitive) (processOptions, primitive.Primitive) {
+
+	var opts processOptions
+
+	hsh, ok := arg.(primitive.Hash)
+	if !ok {
+		return opts, primitive.Error("argument not a hash")
+	}
+
+	for key, val := range hsh.Entries {
+
+		switch key {
+		case ":stdin":
+			str := val.ToString()
+			opts.stdin = &str
+
+		case ":env":
+			vars, ok := val.(primitive.Hash)
+			if !ok {
+				return opts, primitive.Error(fmt.Sprintf(":env must be a hash, got %v", val.Type()))
+			}
+
+			// Variables may be named as ":NAME" or "NAME".
+			for name, value := range vars.Entries {
+				opts.env = append(opts.env, strings.TrimPrefix(name, ":")+"="+value.ToString())
+			}
+
+		case ":dir":
+			dir, ok := val.(primitive.String)
+			if !ok {
+				return opts, primitive.Error(fmt.Sprintf(":dir must be a string, got %v", val.Type()))
+			}
+			opts.dir = dir.ToString()
+
+		case ":timeout":
+			ms, ok := val.(primitive.Number)
+			if !ok {
+				return opts, primitive.Error(fmt.Sprintf(":timeout must be a number, got %v", val.Type()))
+			}
+			opts.timeout = time.Duration(ms) * time.Millisecond
+
+		default:
+			return opts, primitive.Error(fmt.Sprintf("unknown process option %s", key))
+		}
+	}
+
+	return opts, nil
+}
+
+// processArgs converts the given list into the command to execute, and
+// its arguments.
+func processArgs(arg primitive.Primitive) ([]string, primitive.Primitive) {
+
+	// The command must be a list
+	lst, ok := arg.(primitive.List)
+	if !ok {
+		return nil, primitive.Error("argument not a list")
+	}
+
+	// An empty list is no good
+	if len(lst) < 1 {
+		return nil, primitive.Error("the list must be non-empty")
+	}
+
+	// Command to run, and arguments
+	cArgs := []string{}
+	for _, arg := range lst {
+		cArgs = append(cArgs, arg.ToString())
+	}
+	return cArgs, nil
+}
+
+// processContext returns the context which limits the runtime of a
+// child, according to the given options.
+func processContext(opts processOptions) (context.Context, context.CancelFunc) {
+	if opts.timeout > 0 {
+		return context.WithTimeout(context.Background(), opts.timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// newProcessCmd creates the command to execute, with the environment and
+// working directory setup from the given options.
+//
+// Any input specified in the options is not applied here.
+func newProcessCmd(ctx context.Context, cArgs []string, opts processOptions) *exec.Cmd {
+
+	cmd := exec.CommandContext(ctx, cArgs[0], cArgs[1:]...)
+	cmd.Dir = opts.dir
+	if len(opts.env) > 0 {
+		cmd.Env = append(os.Environ(), opts.env...)
+	}
+
+	// If the child exits, or is killed, but left something running
+	// which holds its output open we don't want to wait forever.
+	cmd.WaitDelay = time.Second
+
+	return cmd
+}
+
+// processCommand builds the command to execute, from the given list and
+// optional hash of options.
+//
+// The returned cancel function must be invoked when the child has
+// terminated, to release any timeout resources.
+func processCommand(args []primitive.Primitive) (*exec.Cmd, context.Context, context.CancelFunc, primitive.Primitive) {
+
+	// We need one or two arguments
+	if len(args) != 1 && len(args) != 2 {
+		return nil, nil, nil, primitive.ArityError()
+	}
+
+	cArgs, fail := processArgs(args[0])
+	if fail != nil {
+		return nil, nil, nil, fail
+	}
+
+	// Options are optional
+	var opts processOptions
+	if len(args) == 2 {
+		opts, fail = parseProcessOptions(args[1])
+		if fail != nil {
+			return nil, nil, nil, fail
+		}
+	}
+
+	// Setup a timeout, if we've been given one.
+	ctx, cancel := processContext(opts)
+
+	cmd := newProcessCmd(ctx, cArgs, opts)
+	if opts.stdin != nil {
+		cmd.Stdin = strings.NewReader(*opts.stdin)
+	}
+
+	return cmd, ctx, cancel, nil
+}
+
+// processResult builds the hash we return to describe a child which
+// has terminated.
+func processResult(ctx context.Context, stdout string, stderr string, err error, duration time.Duration) primitive.Primitive {
+
+	code := 0
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return primitive.Error(fmt.Sprintf("error running command:%s", err))
+		}
+		code = exitErr.ExitCode()
+	}
+
+	res := primitive.NewHash()
+	res.Set(":stdout", primitive.String(stdout))
+	res.Set(":stderr", primitive.String(stderr))
+	res.Set(":exit-code", primitive.Number(code))
+	res.Set(":duration", primitive.Number(duration.Milliseconds()))
+	res.Set(":timed-out", primitive.Bool(errors.Is(ctx.Err(), context.DeadlineExceeded)))
+	return res
+}
+
+// processRunFn implements (process:run)
+func processRunFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	cmd, ctx, cancel, fail := processCommand(args)
+	if fail != nil {
+		return fail
+	}
+	defer cancel()
+
+	// If we're running a test-case we'll stop here, because
+	// fuzzing might run commands.
+	if os.Getenv("FUZZ") != "" {
+		return primitive.NewHash()
+	}
+
+	var outb, errb bytes.Buffer
+	cmd.Stdout = &outb
+	cmd.Stderr = &errb
+
+	start := time.Now()
+	err := cmd.Run()
+
+	return processResult(ctx, outb.String(), errb.String(), err, time.Since(start))
+}
+
+// lineQueue holds the output of a background process, which is
+// collected as it is produced, and may be consumed a line at a time.
+type lineQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	lines   []string
+	partial string
+	done    bool
+}
+
+// newLineQueue creates a new, empty, queue.
+func newLineQueue() *lineQueue {
+	q := &lineQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// Write is called with output from the child, which we split into lines.
+func (q *lineQueue) Write(p []byte) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.partial += string(p)
+	for {
+		i := strings.IndexByte(q.partial, '\n')
+		if i < 0 {
+			break
+		}
+		q.lines = append(q.lines, q.partial[:i+1])
+		q.partial = q.partial[i+1:]
+	}
+	q.cond.Broadcast()
+	return len(p), nil
+}
+
+// close marks the queue as complete, once the child has terminated.
+func (q *lineQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.partial != "" {
+		q.lines = append(q.lines, q.partial)
+		q.partial = ""
+	}
+	q.done = true
+	q.cond.Broadcast()
+}
+
+// next returns the next line of output, blocking until it is available.
+//
+// When the output has been exhausted false is returned.
+func (q *lineQueue) next() (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.lines) == 0 && !q.done {
+		q.cond.Wait()
+	}
+	if len(q.lines) == 0 {
+		return "", false
+	}
+	line := q.lines[0]
+	q.lines = q.lines[1:]
+	return line, true
+}
+
+// rest returns everything which has not yet been consumed.
+func (q *lineQueue) rest() string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	out := strings.Join(q.lines, "")
+	q.lines = nil
+	return out
+}
+
+// process holds the state of a child launched via (process:start)
+type process struct {
+	cmd    *exec.Cmd
+	ctx    context.Context
+	cancel context.CancelFunc
+	start  time.Time
+	stdout *lineQueue
+	stderr *lineQueue
+
+	// exited is closed when the child has terminated, at which
+	// point err holds the result of waiting for it, and end the
+	// time it terminated.
+	exited chan struct{}
+	err    error
+	end    time.Time
+
+	// result is cached once the process has been waited upon, which
+	// may happen from more than one goroutine at once.
+	result primitive.Primitive
+	waited sync.Once
+}
+
+// getProcess returns the process from the given handle, or an error.
+func getProcess(arg primitive.Primitive) (*process, primitive.Primitive) {
+	h, ok := arg.(*primitive.Handle)
+	if ok {
+		p, ok2 := h.Value.(*process)
+		if ok2 {
+			return p, nil
+		}
+	}
+	return nil, primitive.Error("argument not a process")
+}
+
+// processKillFn implements (process:kill)
+func processKillFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	p, fail := getProcess(args[0])
+	if fail != nil {
+		return fail
+	}
+
+	// Already terminated?  Then there's nothing to do
+	select {
+	case <-p.exited:
+		return primitive.Nil{}
+	default:
+	}
+
+	err := p.cmd.Process.Kill()
+	if err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return primitive.Error(fmt.Sprintf("failed to kill process %d:%s", p.cmd.Process.Pid, err))
+	}
+	return primitive.Nil{}
+}
+
+// processPidFn implements (process:pid)
+func processPidFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	p, fail := getProcess(args[0])
+	if fail != nil {
+		return fail
+	}
+	return primitive.Number(p.cmd.Process.Pid)
+}
+
+// processReadLineFn implements (process:read-line)
+func processReadLineFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We need one or two arguments
+	if len(args) != 1 && len(args) != 2 {
+		return primitive.ArityError()
+	}
+
+	p, fail := getProcess(args[0])
+	if fail != nil {
+		return fail
+	}
+
+	// Reading from STDOUT by default
+	q := p.stdout
+	if len(args) == 2 {
+		switch args[1].ToString() {
+		case ":stdout":
+			// nop
+		case ":stderr":
+			q = p.stderr
+		default:
+			return primitive.Error(fmt.Sprintf("(process:read-line ..) can read from :stdout, or :stderr, got %v", args[1]))
+		}
+	}
+
+	line, ok := q.next()
+	if !ok {
+		return primitive.Nil{}
+	}
+	return primitive.String(strings.TrimSuffix(line, "\n"))
+}
+
+// processStartFn implements (process:start)
+func processStartFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	cmd, ctx, cancel, fail := processCommand(args)
+	if fail != nil {
+		return fail
+	}
+
+	// If we're running a test-case we'll stop here, because
+	// fuzzing might run commands.
+	if os.Getenv("FUZZ") != "" {
+		cancel()
+		return primitive.Nil{}
+	}
+
+	p := &process{
+		cmd:    cmd,
+		ctx:    ctx,
+		cancel: cancel,
+		stdout: newLineQueue(),
+		stderr: newLineQueue(),
+		exited: make(chan struct{}),
+	}
+	cmd.Stdout = p.stdout
+	cmd.Stderr = p.stderr
+
+	p.start = time.Now()
+	err := cmd.Start()
+	if err != nil {
+		cancel()
+		return primitive.Error(fmt.Sprintf("error starting command:%s", err))
+	}
+
+	// Reap the child in the background, so that our output
+	// queues are marked as complete when it terminates.
+	go func() {
+		p.err = cmd.Wait()
+		p.end = time.Now()
+		p.stdout.close()
+		p.stderr.close()
+		p.cancel()
+		close(p.exited)
+	}()
+
+	return primitive.NewHandle("process", p)
+}
+
+// processWaitFn implements (process:wait)
+func processWaitFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	p, fail := getProcess(args[0])
+	if fail != nil {
+		return fail
+	}
+
+	// Waiting twice returns the same result
+	p.waited.Do(func() {
+		<-p.exited
+		p.result = processResult(p.ctx, p.stdout.rest(), p.stderr.rest(), p.err, p.end.Sub(p.start))
+	})
+	return p.result
+}
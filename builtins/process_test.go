@@ -0,0 +1,258 @@
+//go:build !windows
+// +build !windows
+
+package builtins
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skx/yal/primitive"
+)
+
+// cmd is a helper to create a command-list from the given strings
+func cmd(args ...string) primitive.List {
+	lst := primitive.List{}
+	for _, arg := range args {
+		lst = append(lst, primitive.String(arg))
+	}
+	return lst
+}
+
+// TestProcessRun tests (process:run)
+func TestProcessRun(t *testing.T) {
+
+	// calling with no argument
+	out := processRunFn(ENV, []primitive.Primitive{})
+	if out != primitive.ArityError() {
+		t.Fatalf("expected arity error, got %v", out)
+	}
+
+	// bogus types, and options
+	type TC struct {
+		args []primitive.Primitive
+		err  string
+	}
+
+	bogusEnv := primitive.NewHash()
+	bogusEnv.Set(":env", primitive.Number(3))
+	bogusDir := primitive.NewHash()
+	bogusDir.Set(":dir", primitive.Number(3))
+	bogusTimeout := primitive.NewHash()
+	bogusTimeout.Set(":timeout", primitive.String("soon"))
+	bogusKey := primitive.NewHash()
+	bogusKey.Set(":cheese", primitive.String("cake"))
+
+	tests := []TC{
+		{[]primitive.Primitive{primitive.Number(3)}, "not a list"},
+		{[]primitive.Primitive{primitive.List{}}, "must be non-empty"},
+		{[]primitive.Primitive{cmd("true"), primitive.Number(3)}, "not a hash"},
+		{[]primitive.Primitive{cmd("true"), bogusEnv}, ":env must be a hash"},
+		{[]primitive.Primitive{cmd("true"), bogusDir}, ":dir must be a string"},
+		{[]primitive.Primitive{cmd("true"), bogusTimeout}, ":timeout must be a number"},
+		{[]primitive.Primitive{cmd("true"), bogusKey}, "unknown process option :cheese"},
+		{[]primitive.Primitive{cmd("/fdsf/fdsf/-path-not/exists")}, "error running command"},
+	}
+
+	for _, test := range tests {
+		out = processRunFn(ENV, test.args)
+
+		e, ok := out.(primitive.Error)
+		if !ok {
+			t.Fatalf("expected error, got %v", out)
+		}
+		if !strings.Contains(string(e), test.err) {
+			t.Fatalf("got error, but wrong one %v", out)
+		}
+	}
+
+	// Now run something with all the options
+	vars := primitive.NewHash()
+	vars.Set(":YAL_TEST", primitive.String("cake"))
+	opts := primitive.NewHash()
+	opts.Set(":stdin", primitive.String("input"))
+	opts.Set(":env", vars)
+	opts.Set(":dir", primitive.String("/"))
+
+	out = processRunFn(ENV, []primitive.Primitive{
+		cmd("sh", "-c", "cat; echo \" $YAL_TEST $(pwd)\"; echo oops >&2; exit 3"),
+		opts,
+	})
+
+	res, ok := out.(primitive.Hash)
+	if !ok {
+		t.Fatalf("expected hash, got %v", out)
+	}
+	if res.Get(":stdout").ToString() != "input cake /\n" {
+		t.Fatalf("wrong stdout: %v", res.Get(":stdout"))
+	}
+	if res.Get(":stderr").ToString() != "oops\n" {
+		t.Fatalf("wrong stderr: %v", res.Get(":stderr"))
+	}
+	if res.Get(":exit-code") != primitive.Number(3) {
+		t.Fatalf("wrong exit-code: %v", res.Get(":exit-code"))
+	}
+	if res.Get(":timed-out") != primitive.Bool(false) {
+		t.Fatalf("wrong timeout: %v", res.Get(":timed-out"))
+	}
+	if _, ok := res.Get(":duration").(primitive.Number); !ok {
+		t.Fatalf("wrong duration: %v", res.Get(":duration"))
+	}
+
+	// Now run something which times out
+	opts = primitive.NewHash()
+	opts.Set(":timeout", primitive.Number(50))
+
+	out = processRunFn(ENV, []primitive.Primitive{cmd("sleep", "10"), opts})
+
+	res, ok = out.(primitive.Hash)
+	if !ok {
+		t.Fatalf("expected hash, got %v", out)
+	}
+	if res.Get(":timed-out") != primitive.Bool(true) {
+		t.Fatalf("expected timeout: %v", res)
+	}
+	if res.Get(":exit-code") != primitive.Number(-1) {
+		t.Fatalf("wrong exit-code: %v", res.Get(":exit-code"))
+	}
+
+	// Pretend we're running under a fuzzer
+	old := os.Getenv("FUZZ")
+	os.Setenv("FUZZ", "FUZZ")
+	out = processRunFn(ENV, []primitive.Primitive{cmd("true")})
+	os.Setenv("FUZZ", old)
+
+	res, ok = out.(primitive.Hash)
+	if !ok {
+		t.Fatalf("expected hash, got %v", out)
+	}
+	if len(res.Entries) != 0 {
+		t.Fatalf("expected empty hash, got %v", res)
+	}
+}
+
+// TestProcessStart tests running a process in the background
+func TestProcessStart(t *testing.T) {
+
+	// Functions which take a process-handle
+	for _, fn := range []primitive.GolangPrimitiveFn{processKillFn, processPidFn, processReadLineFn, processWaitFn} {
+
+		out := fn(ENV, []primitive.Primitive{})
+		if out != primitive.ArityError() {
+			t.Fatalf("expected arity error, got %v", out)
+		}
+
+		out = fn(ENV, []primitive.Primitive{primitive.NewHandle("foo", 3)})
+		if !strings.Contains(out.ToString(), "argument not a process") {
+			t.Fatalf("expected type error, got %v", out)
+		}
+	}
+
+	// Failing to start
+	out := processStartFn(ENV, []primitive.Primitive{cmd("/fdsf/fdsf/-path-not/exists")})
+	if !strings.Contains(out.ToString(), "error starting command") {
+		t.Fatalf("expected error, got %v", out)
+	}
+
+	// Launch something which produces output
+	proc := processStartFn(ENV, []primitive.Primitive{
+		cmd("sh", "-c", "echo one; echo two; echo err >&2; printf three"),
+	})
+	if proc.Type() != "process" {
+		t.Fatalf("expected process, got %v", proc)
+	}
+
+	pid := processPidFn(ENV, []primitive.Primitive{proc})
+	if n, ok := pid.(primitive.Number); !ok || n <= 0 {
+		t.Fatalf("bogus pid %v", pid)
+	}
+
+	// Read a line, from each stream
+	out = processReadLineFn(ENV, []primitive.Primitive{proc})
+	if out.ToString() != "one" {
+		t.Fatalf("wrong line %v", out)
+	}
+	out = processReadLineFn(ENV, []primitive.Primitive{proc, primitive.Symbol(":stderr")})
+	if out.ToString() != "err" {
+		t.Fatalf("wrong line %v", out)
+	}
+	out = processReadLineFn(ENV, []primitive.Primitive{proc, primitive.Symbol(":bogus")})
+	if !strings.Contains(out.ToString(), "can read from :stdout, or :stderr") {
+		t.Fatalf("expected error, got %v", out)
+	}
+
+	// Wait will give us the rest
+	out = processWaitFn(ENV, []primitive.Primitive{proc})
+	res, ok := out.(primitive.Hash)
+	if !ok {
+		t.Fatalf("expected hash, got %v", out)
+	}
+	if res.Get(":stdout").ToString() != "two\nthree" {
+		t.Fatalf("wrong stdout: %v", res.Get(":stdout"))
+	}
+	if res.Get(":exit-code") != primitive.Number(0) {
+		t.Fatalf("wrong exit-code: %v", res.Get(":exit-code"))
+	}
+
+	// Waiting again is fine
+	again := processWaitFn(ENV, []primitive.Primitive{proc})
+	if again.ToString() != out.ToString() {
+		t.Fatalf("waiting twice gave a different result")
+	}
+
+	// Reading once complete gives nil
+	out = processReadLineFn(ENV, []primitive.Primitive{proc})
+	if !primitive.IsNil(out) {
+		t.Fatalf("expected nil, got %v", out)
+	}
+
+	// Killing a completed process is a nop
+	out = processKillFn(ENV, []primitive.Primitive{proc})
+	if !primitive.IsNil(out) {
+		t.Fatalf("expected nil, got %v", out)
+	}
+
+	// Now start something long-running, and kill it
+	proc = processStartFn(ENV, []primitive.Primitive{cmd("sleep", "60")})
+	out = processKillFn(ENV, []primitive.Primitive{proc})
+	if !primitive.IsNil(out) {
+		t.Fatalf("expected nil, got %v", out)
+	}
+	out = processWaitFn(ENV, []primitive.Primitive{proc})
+	res, ok = out.(primitive.Hash)
+	if !ok {
+		t.Fatalf("expected hash, got %v", out)
+	}
+	if res.Get(":exit-code") != primitive.Number(-1) {
+		t.Fatalf("wrong exit-code: %v", res.Get(":exit-code"))
+	}
+
+	// Waiting from several goroutines at once gives each the same result
+	proc = processStartFn(ENV, []primitive.Primitive{cmd("sh", "-c", "sleep 0.1; echo done")})
+	results := make(chan primitive.Primitive, 4)
+	for i := 0; i < 4; i++ {
+		go func() {
+			results <- processWaitFn(ENV, []primitive.Primitive{proc})
+		}()
+	}
+	first := <-results
+	for i := 1; i < 4; i++ {
+		if out := <-results; out.ToString() != first.ToString() {
+			t.Fatalf("concurrent waits gave different results: %v %v", first, out)
+		}
+	}
+	if first.(primitive.Hash).Get(":stdout").ToString() != "done\n" {
+		t.Fatalf("wrong stdout: %v", first)
+	}
+
+	// The duration is how long the child ran, not how long it was
+	// before we waited for it
+	proc = processStartFn(ENV, []primitive.Primitive{cmd("true")})
+	time.Sleep(500 * time.Millisecond)
+	out = processWaitFn(ENV, []primitive.Primitive{proc})
+	if n, ok := out.(primitive.Hash).Get(":duration").(primitive.Number); !ok || n >= 400 {
+		t.Fatalf("wrong duration: %v", out)
+	}
+}
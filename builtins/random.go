@@ -0,0 +1,372 @@
+// random.go - Implementation of our random primitives.
+//
+// (random), and the other functions here which accept a generator, use
+// "math/rand", which is fine for games and simulations.  By default they
+// use the interpreter's generator, which may be seeded to make a script
+// reproducible, but a generator created via (random:new) may be given as
+// the final argument instead.
+//
+// (random:bytes), (random:token), and our UUIDs use "crypto/rand" to
+// generate values which are suitable for use as secrets.
+
+package builtins
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	mrand "math/rand"
+	"time"
+
+	"github.com/skx/yal/env"
+	"github.com/skx/yal/primitive"
+)
+
+// newGenerator returns a generator using the given seed.
+func newGenerator(seed int64) *mrand.Rand {
+	return mrand.New(mrand.NewSource(seed))
+}
+
+// interpreterGenerator returns the generator of the interpreter which is
+// executing code in the given environment, creating it if necessary.
+//
+// The generator is kept in the interpreter's configuration, which is
+// always present, so that seeding it affects every later call.
+func interpreterGenerator(env *env.Environment) *mrand.Rand {
+
+	cfg := env.GetIOConfig()
+	if cfg.Random == nil {
+		cfg.Random = newGenerator(time.Now().UnixNano())
+	}
+	return cfg.Random
+}
+
+// generatorArgs returns the generator to use, and the remaining
+// arguments, when a function takes n arguments and an optional
+// generator.
+func generatorArgs(env *env.Environment, args []primitive.Primitive, n int) (*mrand.Rand, []primitive.Primitive, primitive.Primitive) {
+
+	if len(args) == n {
+		return interpreterGenerator(env), args, nil
+	}
+	if len(args) != n+1 {
+		return nil, nil, primitive.ArityError()
+	}
+
+	h, ok := args[n].(*primitive.Handle)
+	if ok {
+		gen, ok2 := h.Value.(*mrand.Rand)
+		if ok2 {
+			return gen, args[:n], nil
+		}
+	}
+	return nil, nil, primitive.Error("argument not a random generator")
+}
+
+// seedArg returns the given argument as a seed.
+func seedArg(arg primitive.Primitive) (int64, primitive.Primitive) {
+	n, ok := arg.(primitive.Number)
+	if !ok {
+		return 0, primitive.Error("argument not a number")
+	}
+	return int64(n), nil
+}
+
+// randomBytes returns the given number of random bytes.
+func randomBytes(n int) ([]byte, primitive.Primitive) {
+	buf := make([]byte, n)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return nil, primitive.Error(fmt.Sprintf("failed to read random bytes:%s", err))
+	}
+	return buf, nil
+}
+
+// randomCountArg returns the given argument as a count of bytes.
+func randomCountArg(arg primitive.Primitive) (int, primitive.Primitive) {
+	n, ok := arg.(primitive.Number)
+	if !ok {
+		return 0, primitive.Error("argument not a number")
+	}
+	if int(n) <= 0 {
+		return 0, primitive.Error("argument must be greater than zero")
+	}
+	return int(n), nil
+}
+
+// formatUUID formats the given bytes as a UUID, after setting the
+// version and variant.
+func formatUUID(b []byte, version byte) primitive.Primitive {
+	b[6] = (b[6] & 0x0f) | version<<4
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return primitive.String(fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]))
+}
+
+// randomBytesFn implements (random:bytes)
+func randomBytesFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We only need a single argument
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	n, fail := randomCountArg(args[0])
+	if fail != nil {
+		return fail
+	}
+
+	buf, fail := randomBytes(n)
+	if fail != nil {
+		return fail
+	}
+	return primitive.String(buf)
+}
+
+// randomTokenFn implements (random:token)
+//
+// The token is URL-safe base64, without padding.
+func randomTokenFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We need zero or one arguments
+	if len(args) > 1 {
+		return primitive.ArityError()
+	}
+
+	// 32 bytes by default
+	n := 32
+	if len(args) == 1 {
+		var fail primitive.Primitive
+		n, fail = randomCountArg(args[0])
+		if fail != nil {
+			return fail
+		}
+	}
+
+	buf, fail := randomBytes(n)
+	if fail != nil {
+		return fail
+	}
+	return primitive.String(base64.RawURLEncoding.EncodeToString(buf))
+}
+
+// uuidV4Fn implements (uuid:v4)
+func uuidV4Fn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We take no arguments
+	if len(args) != 0 {
+		return primitive.ArityError()
+	}
+
+	buf, fail := randomBytes(16)
+	if fail != nil {
+		return fail
+	}
+	return formatUUID(buf, 4)
+}
+
+// uuidV7Fn implements (uuid:v7)
+//
+// These begin with the current time, in milliseconds, so they sort
+// in the order in which they were created.
+func uuidV7Fn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We take no arguments
+	if len(args) != 0 {
+		return primitive.ArityError()
+	}
+
+	buf, fail := randomBytes(16)
+	if fail != nil {
+		return fail
+	}
+
+	ms := uint64(time.Now().UnixMilli())
+	for i := 0; i < 6; i++ {
+		buf[i] = byte(ms >> (8 * (5 - i)))
+	}
+	return formatUUID(buf, 7)
+}
+
+// randomFloatFn implements (random:float)
+func randomFloatFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	gen, _, fail := generatorArgs(env, args, 0)
+	if fail != nil {
+		return fail
+	}
+
+	return primitive.Number(gen.Float64())
+}
+
+// randomNewFn implements (random:new)
+func randomNewFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We need zero or one arguments
+	if len(args) > 1 {
+		return primitive.ArityError()
+	}
+
+	// Default to the current time
+	seed := time.Now().UnixNano()
+	if len(args) == 1 {
+		var fail primitive.Primitive
+		seed, fail = seedArg(args[0])
+		if fail != nil {
+			return fail
+		}
+	}
+
+	return primitive.NewHandle("random", newGenerator(seed))
+}
+
+// randomRangeFn implements (random:range)
+//
+// The result is at least min, and less than max.
+func randomRangeFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	gen, args, fail := generatorArgs(env, args, 2)
+	if fail != nil {
+		return fail
+	}
+
+	lo, ok := args[0].(primitive.Number)
+	if !ok {
+		return primitive.Error("argument not a number")
+	}
+	hi, ok := args[1].(primitive.Number)
+	if !ok {
+		return primitive.Error("argument not a number")
+	}
+
+	if int(hi) <= int(lo) {
+		return primitive.Error("the maximum must be greater than the minimum")
+	}
+
+	return primitive.Number(int(lo) + gen.Intn(int(hi)-int(lo)))
+}
+
+// randomSampleFn implements (random:sample)
+//
+// The result is the given number of distinct elements of the list,
+// in a random order.
+func randomSampleFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	gen, args, fail := generatorArgs(env, args, 2)
+	if fail != nil {
+		return fail
+	}
+
+	lst, ok := args[0].(primitive.List)
+	if !ok {
+		return primitive.Error("argument not a list")
+	}
+	n, ok := args[1].(primitive.Number)
+	if !ok {
+		return primitive.Error("argument not a number")
+	}
+	if int(n) < 0 || int(n) > len(lst) {
+		return primitive.Error(fmt.Sprintf("cannot sample %d items from a list of %d", int(n), len(lst)))
+	}
+
+	ret := primitive.List{}
+	for _, i := range gen.Perm(len(lst))[:int(n)] {
+		ret = append(ret, lst[i])
+	}
+	return ret
+}
+
+// randomSeedFn implements (random:seed)
+func randomSeedFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We only need a single argument
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	seed, fail := seedArg(args[0])
+	if fail != nil {
+		return fail
+	}
+
+	interpreterGenerator(env).Seed(seed)
+	return primitive.Nil{}
+}
+
+// randomShuffleFn implements (random:shuffle)
+//
+// The result is a new list, the original is unchanged.
+func randomShuffleFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	gen, args, fail := generatorArgs(env, args, 1)
+	if fail != nil {
+		return fail
+	}
+
+	lst, ok := args[0].(primitive.List)
+	if !ok {
+		return primitive.Error("argument not a list")
+	}
+
+	ret := make(primitive.List, len(lst))
+	copy(ret, lst)
+	gen.Shuffle(len(ret), func(i, j int) { ret[i], ret[j] = ret[j], ret[i] })
+	return ret
+}
+
+// randomWeightedFn implements (random:weighted)
+//
+// The argument is a list of items, and a list of their weights, and
+// each item is chosen in proportion to its weight.
+func randomWeightedFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	gen, args, fail := generatorArgs(env, args, 2)
+	if fail != nil {
+		return fail
+	}
+
+	items, ok := args[0].(primitive.List)
+	if !ok {
+		return primitive.Error("argument not a list")
+	}
+	weights, ok := args[1].(primitive.List)
+	if !ok {
+		return primitive.Error("argument not a list")
+	}
+	if len(items) != len(weights) {
+		return primitive.Error(fmt.Sprintf("expected %d weights, got %d", len(items), len(weights)))
+	}
+
+	total := 0.0
+	for _, w := range weights {
+		n, ok := w.(primitive.Number)
+		if !ok {
+			return primitive.Error("weight not a number")
+		}
+		if n < 0 {
+			return primitive.Error("weights must not be negative")
+		}
+		total += float64(n)
+	}
+	if total <= 0 {
+		return primitive.Error("weights must not all be zero")
+	}
+
+	// Choose a point, and find the item it falls within
+	r := gen.Float64() * total
+	for i, w := range weights {
+		r -= float64(w.(primitive.Number))
+		if r < 0 {
+			return items[i]
+		}
+	}
+
+	// Rounding might leave us here, so return the last item
+	// which has any weight.
+	for i := len(weights) - 1; i >= 0; i-- {
+		if weights[i].(primitive.Number) > 0 {
+			return items[i]
+		}
+	}
+	return primitive.Nil{}
+}
@@ -0,0 +1,208 @@
+package builtins
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/skx/yal/config"
+	"github.com/skx/yal/env"
+	"github.com/skx/yal/primitive"
+)
+
+// seededEnv returns an environment whose generator has the given seed.
+func seededEnv(seed int64) *env.Environment {
+	e := env.New()
+	cfg := config.New()
+	cfg.Random = rand.New(rand.NewSource(seed))
+	e.SetIOConfig(cfg)
+	return e
+}
+
+// TestRandomArguments ensures our random-functions reject bogus arguments.
+func TestRandomArguments(t *testing.T) {
+
+	type TC struct {
+		fn   primitive.GolangPrimitiveFn
+		args []primitive.Primitive
+		err  string
+	}
+
+	lst := primitive.List{primitive.Number(1), primitive.Number(2)}
+	gen := randomNewFn(ENV, []primitive.Primitive{})
+
+	tests := []TC{
+		{randomFn, []primitive.Primitive{primitive.Number(3), primitive.Number(3)}, "not a random generator"},
+		{randomFn, []primitive.Primitive{primitive.Number(3), primitive.NewHandle("timer", nil)}, "not a random generator"},
+		{randomFn, []primitive.Primitive{primitive.Number(3), gen, gen}, string(primitive.ArityError())},
+		{randomFloatFn, []primitive.Primitive{gen, gen}, string(primitive.ArityError())},
+		{randomNewFn, []primitive.Primitive{primitive.Number(1), primitive.Number(1)}, string(primitive.ArityError())},
+		{randomNewFn, []primitive.Primitive{primitive.String("1")}, "not a number"},
+		{randomRangeFn, []primitive.Primitive{primitive.Number(1)}, string(primitive.ArityError())},
+		{randomRangeFn, []primitive.Primitive{primitive.String("1"), primitive.Number(1)}, "not a number"},
+		{randomRangeFn, []primitive.Primitive{primitive.Number(1), primitive.String("1")}, "not a number"},
+		{randomRangeFn, []primitive.Primitive{primitive.Number(3), primitive.Number(3)}, "must be greater"},
+		{randomSampleFn, []primitive.Primitive{lst}, string(primitive.ArityError())},
+		{randomSampleFn, []primitive.Primitive{primitive.Number(1), primitive.Number(1)}, "not a list"},
+		{randomSampleFn, []primitive.Primitive{lst, lst}, "not a number"},
+		{randomSampleFn, []primitive.Primitive{lst, primitive.Number(3)}, "cannot sample 3 items"},
+		{randomSeedFn, []primitive.Primitive{}, string(primitive.ArityError())},
+		{randomSeedFn, []primitive.Primitive{lst}, "not a number"},
+		{randomShuffleFn, []primitive.Primitive{}, string(primitive.ArityError())},
+		{randomShuffleFn, []primitive.Primitive{primitive.Number(1)}, "not a list"},
+		{randomWeightedFn, []primitive.Primitive{lst}, string(primitive.ArityError())},
+		{randomWeightedFn, []primitive.Primitive{primitive.Number(1), lst}, "not a list"},
+		{randomWeightedFn, []primitive.Primitive{lst, primitive.Number(1)}, "not a list"},
+		{randomWeightedFn, []primitive.Primitive{lst, primitive.List{primitive.Number(1)}}, "expected 2 weights"},
+		{randomWeightedFn, []primitive.Primitive{lst, primitive.List{primitive.Number(1), primitive.String("x")}}, "weight not a number"},
+		{randomWeightedFn, []primitive.Primitive{lst, primitive.List{primitive.Number(1), primitive.Number(-1)}}, "must not be negative"},
+		{randomWeightedFn, []primitive.Primitive{lst, primitive.List{primitive.Number(0), primitive.Number(0)}}, "must not all be zero"},
+	}
+
+	for _, test := range tests {
+		out := test.fn(ENV, test.args)
+
+		e, ok := out.(primitive.Error)
+		if !ok {
+			t.Fatalf("expected error for %v, got %v", test.args, out)
+		}
+		if !strings.Contains(string(e), test.err) {
+			t.Fatalf("got error for %v, but wrong one %v", test.args, out)
+		}
+	}
+}
+
+// TestRandomSeed tests that seeded generators are reproducible.
+func TestRandomSeed(t *testing.T) {
+
+	lst := primitive.List{}
+	for i := 0; i < 20; i++ {
+		lst = append(lst, primitive.Number(i))
+	}
+
+	// run calls a selection of our functions, returning their output.
+	run := func(e *env.Environment, gen ...primitive.Primitive) string {
+		out := []string{
+			randomFn(e, append([]primitive.Primitive{primitive.Number(1000)}, gen...)).ToString(),
+			randomFloatFn(e, gen).ToString(),
+			randomRangeFn(e, append([]primitive.Primitive{primitive.Number(-10), primitive.Number(10)}, gen...)).ToString(),
+			randomSampleFn(e, append([]primitive.Primitive{lst, primitive.Number(5)}, gen...)).ToString(),
+			randomShuffleFn(e, append([]primitive.Primitive{lst}, gen...)).ToString(),
+			randomWeightedFn(e, append([]primitive.Primitive{lst, lst}, gen...)).ToString(),
+		}
+		return strings.Join(out, " ")
+	}
+
+	// Two interpreters with the same seed give the same results
+	a := run(seededEnv(42))
+	b := run(seededEnv(42))
+	if a != b {
+		t.Fatalf("seeded results differ:\n%s\n%s", a, b)
+	}
+	if strings.Contains(a, "ERROR") {
+		t.Fatalf("unexpected error %s", a)
+	}
+
+	// Different seeds differ
+	c := run(seededEnv(43))
+	if a == c {
+		t.Fatalf("results with different seeds were the same %s", a)
+	}
+
+	// Reseeding restarts the sequence
+	e := seededEnv(1)
+	out := randomSeedFn(e, []primitive.Primitive{primitive.Number(42)})
+	if _, ok := out.(primitive.Nil); !ok {
+		t.Fatalf("expected nil, got %v", out)
+	}
+	if run(e) != a {
+		t.Fatalf("reseeded results differ")
+	}
+
+	// A generator with the same seed also gives the same results,
+	// and doesn't affect the interpreter's generator.
+	e = seededEnv(42)
+	gen := randomNewFn(e, []primitive.Primitive{primitive.Number(42)})
+	if run(e, gen) != a {
+		t.Fatalf("generator results differ")
+	}
+	if run(e) != a {
+		t.Fatalf("interpreter's generator was affected by another")
+	}
+
+	// An interpreter without a generator gets one
+	e = env.New()
+	randomFn(e, []primitive.Primitive{primitive.Number(10)})
+	if e.GetIOConfig().Random == nil {
+		t.Fatalf("expected a generator to be created")
+	}
+
+	// Even one which has no configuration, and where the calls are
+	// made in different scopes.
+	e = env.New()
+	e.SetIOConfig(nil)
+	randomSeedFn(env.NewEnvironment(e), []primitive.Primitive{primitive.Number(42)})
+	if run(env.NewEnvironment(e)) != a {
+		t.Fatalf("seeding without a configuration had no effect")
+	}
+	randomSeedFn(e, []primitive.Primitive{primitive.Number(42)})
+	if run(e) != a {
+		t.Fatalf("reseeding without a configuration had no effect")
+	}
+}
+
+// TestRandomResults tests the results of our random-functions are sane.
+func TestRandomResults(t *testing.T) {
+
+	e := seededEnv(7)
+	lst := primitive.List{primitive.String("a"), primitive.String("b"), primitive.String("c")}
+
+	for i := 0; i < 100; i++ {
+
+		f := randomFloatFn(e, []primitive.Primitive{}).(primitive.Number)
+		if f < 0 || f >= 1 {
+			t.Fatalf("float out of range %f", f)
+		}
+
+		n := randomRangeFn(e, []primitive.Primitive{primitive.Number(5), primitive.Number(8)}).(primitive.Number)
+		if n < 5 || n >= 8 || n != primitive.Number(int(n)) {
+			t.Fatalf("range out of range %f", n)
+		}
+
+		// A shuffle, and a full sample, contain everything once.
+		for _, out := range []primitive.Primitive{
+			randomShuffleFn(e, []primitive.Primitive{lst}),
+			randomSampleFn(e, []primitive.Primitive{lst, primitive.Number(3)}),
+		} {
+			res := out.(primitive.List)
+			seen := map[string]bool{}
+			for _, x := range res {
+				seen[x.ToString()] = true
+			}
+			if len(res) != 3 || len(seen) != 3 {
+				t.Fatalf("wrong result %v", res)
+			}
+		}
+
+		// Items with no weight are never chosen
+		w := randomWeightedFn(e, []primitive.Primitive{lst, primitive.List{primitive.Number(0), primitive.Number(1), primitive.Number(0)}})
+		if w.ToString() != "b" {
+			t.Fatalf("wrong weighted choice %v", w)
+		}
+	}
+
+	// The original list is unchanged by a shuffle
+	if lst.ToString() != "(a b c)" {
+		t.Fatalf("list was modified %v", lst)
+	}
+
+	// Weights are respected
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		w := randomWeightedFn(e, []primitive.Primitive{lst, primitive.List{primitive.Number(1), primitive.Number(8), primitive.Number(1)}})
+		counts[w.ToString()]++
+	}
+	if counts["b"] < 700 || counts["a"] == 0 || counts["c"] == 0 {
+		t.Fatalf("weights weren't respected %v", counts)
+	}
+}
@@ -0,0 +1,377 @@
+// serve.go - Implementation of our HTTP server.
+//
+// (http:serve) listens for HTTP requests, and passes each of them to a
+// lisp function as a hash.  The hash the function returns describes the
+// response.
+//
+// Lisp code is not safe to run concurrently, so requests are received on
+// background goroutines, but their handlers are invoked one at a time on
+// the goroutine which called (http:serve).  Timers continue to fire while
+// the server is running.
+//
+// The server runs until the interpreter's context is cancelled, at which
+// point it shuts down gracefully and (http:serve) returns.
+
+package builtins
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skx/yal/env"
+	"github.com/skx/yal/primitive"
+)
+
+// serveMaxBody is the largest request body we'll accept.
+const serveMaxBody = 10 << 20
+
+// serveShutdownTimeout is how long we wait for open connections to
+// finish, once we've been told to stop.
+const serveShutdownTimeout = 5 * time.Second
+
+// serveRequest is a request which is waiting for its handler to be
+// invoked.
+type serveRequest struct {
+
+	// proc is the handler to invoke.
+	proc *primitive.Procedure
+
+	// req is the hash describing the request.
+	req primitive.Hash
+
+	// reply receives the response.
+	reply chan serveResponse
+}
+
+// serveResponse is the response to send to a client.
+type serveResponse struct {
+	status  int
+	headers http.Header
+	body    string
+}
+
+// serveError returns a plain-text response with the given status.
+func serveError(status int, msg string) serveResponse {
+	hdrs := http.Header{}
+	hdrs.Set("Content-Type", "text/plain; charset=utf-8")
+	return serveResponse{status: status, headers: hdrs, body: msg + "\n"}
+}
+
+// servePatternNames returns the names of the wildcards in the given
+// routing pattern, such as "id" in "GET /users/{id}".
+func servePatternNames(pattern string) []string {
+
+	var names []string
+	for {
+		start := strings.Index(pattern, "{")
+		if start < 0 {
+			return names
+		}
+		end := strings.Index(pattern[start:], "}")
+		if end < 0 {
+			return names
+		}
+
+		name := strings.TrimSuffix(pattern[start+1:start+end], "...")
+		if name != "$" {
+			names = append(names, name)
+		}
+		pattern = pattern[start+end+1:]
+	}
+}
+
+// serveRequestHash converts the given request into a hash.
+func serveRequestHash(r *http.Request, body []byte) primitive.Hash {
+
+	headers := primitive.NewHash()
+	for name, vals := range r.Header {
+		headers.Set(name, primitive.String(strings.Join(vals, ", ")))
+	}
+
+	params := primitive.NewHash()
+	for _, name := range servePatternNames(r.Pattern) {
+		params.Set(name, primitive.String(r.PathValue(name)))
+	}
+
+	ret := primitive.NewHash()
+	ret.Set(":method", primitive.String(r.Method))
+	ret.Set(":path", primitive.String(r.URL.Path))
+	ret.Set(":query", urlQueryHash(r.URL.Query()))
+	ret.Set(":params", params)
+	ret.Set(":headers", headers)
+	ret.Set(":body", primitive.String(body))
+	ret.Set(":remote", primitive.String(r.RemoteAddr))
+
+	media, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if media == "application/json" || strings.HasSuffix(media, "+json") {
+		val, err := jsonDecode(string(body))
+		if err == nil {
+			ret.Set(":json", val)
+		}
+	}
+	return ret
+}
+
+// serveResult converts the value returned by a handler into a response.
+//
+// A string is sent as plain text, a hash may contain :status, :headers,
+// and either :body or :json.
+func serveResult(out primitive.Primitive) (serveResponse, error) {
+
+	resp := serveResponse{status: http.StatusOK, headers: http.Header{}}
+
+	switch v := out.(type) {
+	case primitive.Error:
+		return resp, fmt.Errorf("%s", string(v))
+
+	case primitive.String:
+		resp.headers.Set("Content-Type", "text/plain; charset=utf-8")
+		resp.body = string(v)
+		return resp, nil
+
+	case primitive.Hash:
+		// handled below
+
+	default:
+		return resp, fmt.Errorf("handler returned %s, not a hash or string", out.Type())
+	}
+
+	hsh := out.(primitive.Hash)
+	json := false
+
+	for key, val := range hsh.Entries {
+
+		switch key {
+		case ":status":
+			n, ok := val.(primitive.Number)
+			if !ok || int(n) < 100 || int(n) > 999 {
+				return resp, fmt.Errorf(":status must be a valid status code, got %s", val.ToString())
+			}
+			resp.status = int(n)
+
+		case ":headers":
+			hdrs, ok := val.(primitive.Hash)
+			if !ok {
+				return resp, fmt.Errorf(":headers must be a hash, got %v", val.Type())
+			}
+			for name, value := range hdrs.Entries {
+				resp.headers.Set(strings.TrimPrefix(name, ":"), value.ToString())
+			}
+
+		case ":body":
+			resp.body = val.ToString()
+
+		case ":json":
+			str, err := jsonEncode(val)
+			if err != nil {
+				return resp, fmt.Errorf("failed to encode JSON:%s", err)
+			}
+			resp.body = str
+			json = true
+
+		default:
+			return resp, fmt.Errorf("unknown response option %s", key)
+		}
+	}
+
+	if json {
+		if _, ok := hsh.Entries[":body"]; ok {
+			return resp, fmt.Errorf("only one of :body and :json may be given")
+		}
+		if resp.headers.Get("Content-Type") == "" {
+			resp.headers.Set("Content-Type", "application/json")
+		}
+	}
+	return resp, nil
+}
+
+// serveRoutes returns a handler which routes requests to the given lisp
+// function, or functions, by queueing them upon the given channel.
+//
+// The routes are either a single function, which handles everything, or
+// a hash of patterns, such as "GET /users/{id}", and their functions.
+func serveRoutes(routes primitive.Primitive, queue chan<- serveRequest, done <-chan struct{}) (mux *http.ServeMux, err error) {
+
+	mux = http.NewServeMux()
+
+	// Registering a bogus, or duplicate, pattern panics
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	switch v := routes.(type) {
+	case *primitive.Procedure:
+		mux.Handle("/", serveHandler(v, queue, done))
+
+	case primitive.Hash:
+		for pattern, val := range v.Entries {
+			proc, ok := val.(*primitive.Procedure)
+			if !ok {
+				return nil, fmt.Errorf("the handler for %s is not a function", pattern)
+			}
+			mux.Handle(pattern, serveHandler(proc, queue, done))
+		}
+
+	default:
+		return nil, fmt.Errorf("argument not a function or hash")
+	}
+	return mux, nil
+}
+
+// serveHandler returns a handler which passes requests to the given lisp
+// function, via the queue, and waits for the result.
+func serveHandler(proc *primitive.Procedure, queue chan<- serveRequest, done <-chan struct{}) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, serveMaxBody))
+		if err != nil {
+			resp := serveError(http.StatusBadRequest, "failed to read request body")
+			serveWrite(w, resp)
+			return
+		}
+
+		req := serveRequest{
+			proc:  proc,
+			req:   serveRequestHash(r, body),
+			reply: make(chan serveResponse, 1),
+		}
+
+		select {
+		case queue <- req:
+		case <-done:
+			serveWrite(w, serveError(http.StatusServiceUnavailable, "server shutting down"))
+			return
+		case <-r.Context().Done():
+			return
+		}
+
+		select {
+		case resp := <-req.reply:
+			serveWrite(w, resp)
+		case <-r.Context().Done():
+		}
+	})
+}
+
+// serveWrite sends the given response to the client.
+func serveWrite(w http.ResponseWriter, resp serveResponse) {
+	for name, vals := range resp.headers {
+		w.Header()[name] = vals
+	}
+	w.WriteHeader(resp.status)
+	io.WriteString(w, resp.body)
+}
+
+// serve handles the requests received by the given listener, until the
+// interpreter's context is cancelled.
+func serve(env *env.Environment, ln net.Listener, routes primitive.Primitive) primitive.Primitive {
+
+	queue := make(chan serveRequest)
+	done := make(chan struct{})
+
+	mux, err := serveRoutes(routes, queue, done)
+	if err != nil {
+		ln.Close()
+		return primitive.Error(fmt.Sprintf("failed to create routes:%s", err))
+	}
+
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 30 * time.Second}
+
+	// However we return, even if a handler unwinds past us, waiting
+	// requests are refused and the server is stopped.
+	refuse := sync.OnceFunc(func() { close(done) })
+	defer srv.Close()
+	defer refuse()
+
+	failed := make(chan error, 1)
+	go func() {
+		failed <- srv.Serve(ln)
+	}()
+
+	ctx := evaluatorContext(env)
+	timers := interpreterTimers(env)
+
+	for {
+		// Invoke any timers which are due
+		out := timers.run(env)
+		if out != nil {
+			return out
+		}
+
+		// Other goroutines may run lisp while we wait
+		resume := yieldInterpreter(env)
+
+		select {
+		case req := <-queue:
+			resume()
+			out := applyProcedure(env, req.proc, []primitive.Primitive{req.req})
+			resp, err := serveResult(out)
+			if err != nil {
+				// The details are for us, not the client
+				msg := fmt.Sprintf("http:serve: %s %s: %s\n", req.req.Get(":method").ToString(), req.req.Get(":path").ToString(), err)
+				_, _ = env.GetIOConfig().STDERR.Write([]byte(msg))
+				resp = serveError(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			}
+			req.reply <- resp
+
+		case <-timers.notify:
+			// a timer fired
+			resume()
+
+		case err := <-failed:
+			resume()
+			return primitive.Error(fmt.Sprintf("server failed:%s", err))
+
+		case <-ctx.Done():
+			resume()
+
+			// Stop accepting requests, and refuse any which are
+			// waiting, while open connections are closed.
+			refuse()
+
+			stop, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+			defer cancel()
+
+			srv.Shutdown(stop)
+			return primitive.Nil{}
+		}
+	}
+}
+
+// httpServeFn implements (http:serve)
+func httpServeFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We need two arguments
+	if len(args) != 2 {
+		return primitive.ArityError()
+	}
+
+	addr, ok := args[0].(primitive.String)
+	if !ok {
+		return primitive.Error("argument not a string")
+	}
+
+	// If we're running a test-case we'll stop here, because
+	// fuzzing might listen for connections.
+	if os.Getenv("FUZZ") != "" {
+		return primitive.Nil{}
+	}
+
+	ln, err := net.Listen("tcp", string(addr))
+	if err != nil {
+		return primitive.Error(fmt.Sprintf("failed to listen on %s:%s", addr, err))
+	}
+
+	return serve(env, ln, args[1])
+}
@@ -0,0 +1,394 @@
+package builtins
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/skx/yal/env"
+	"github.com/skx/yal/primitive"
+)
+
+// handlerFn returns a procedure implemented in golang, which may be used
+// as a handler without an interpreter.
+func handlerFn(fn func(req primitive.Hash) primitive.Primitive) *primitive.Procedure {
+	return &primitive.Procedure{F: func(e *env.Environment, args []primitive.Primitive) primitive.Primitive {
+		return fn(args[0].(primitive.Hash))
+	}}
+}
+
+// startServer launches a server with the given routes, returning its URL,
+// a function to stop it, and a channel which receives the result of
+// (http:serve).
+func startServer(t *testing.T, routes primitive.Primitive) (string, context.CancelFunc, chan primitive.Primitive) {
+	return startServerIn(t, env.New(), routes)
+}
+
+// startServerIn is like startServer, but runs the server in the given
+// environment.
+func startServerIn(t *testing.T, e *env.Environment, routes primitive.Primitive) (string, context.CancelFunc, chan primitive.Primitive) {
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen:%s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	e.SetEvaluator(&fakeEvaluator{ctx: ctx})
+
+	result := make(chan primitive.Primitive, 1)
+	go func() {
+		result <- serve(e, ln, routes)
+	}()
+
+	return "http://" + ln.Addr().String(), cancel, result
+}
+
+// fetch makes a request, returning the status and body of the response.
+func fetch(t *testing.T, method string, url string, body string) (int, http.Header, string) {
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to create request:%s", err)
+	}
+	if strings.HasPrefix(body, "{") {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed:%s", err)
+	}
+	defer resp.Body.Close()
+
+	out, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, resp.Header, string(out)
+}
+
+// TestServeArguments ensures (http:serve) rejects bogus arguments.
+func TestServeArguments(t *testing.T) {
+
+	addr := primitive.String("127.0.0.1:0")
+	proc := handlerFn(func(req primitive.Hash) primitive.Primitive { return primitive.Nil{} })
+
+	bogus := primitive.NewHash()
+	bogus.Set("GET /", primitive.Number(3))
+
+	invalid := primitive.NewHash()
+	invalid.Set("GET /{", proc)
+
+	tests := []struct {
+		args []primitive.Primitive
+		err  string
+	}{
+		{[]primitive.Primitive{}, string(primitive.ArityError())},
+		{[]primitive.Primitive{addr}, string(primitive.ArityError())},
+		{[]primitive.Primitive{primitive.Number(3), proc}, "not a string"},
+		{[]primitive.Primitive{primitive.String("bogus:address:here"), proc}, "failed to listen"},
+		{[]primitive.Primitive{addr, primitive.Number(3)}, "not a function or hash"},
+		{[]primitive.Primitive{addr, bogus}, "is not a function"},
+		{[]primitive.Primitive{addr, invalid}, "failed to create routes"},
+	}
+
+	for _, test := range tests {
+		out := httpServeFn(ENV, test.args)
+
+		e, ok := out.(primitive.Error)
+		if !ok {
+			t.Fatalf("expected error for %v, got %v", test.args, out)
+		}
+		if !strings.Contains(string(e), test.err) {
+			t.Fatalf("got error for %v, but wrong one %v", test.args, out)
+		}
+	}
+
+	// Pretend we're running under a fuzzer
+	old := os.Getenv("FUZZ")
+	os.Setenv("FUZZ", "FUZZ")
+	out := httpServeFn(ENV, []primitive.Primitive{addr, proc})
+	os.Setenv("FUZZ", old)
+
+	if _, ok := out.(primitive.Nil); !ok {
+		t.Fatalf("expected nil, got %v", out)
+	}
+}
+
+// TestServePatterns tests finding the names of wildcards in patterns.
+func TestServePatterns(t *testing.T) {
+
+	tests := map[string]string{
+		"/":                         "",
+		"GET /users/{id}":           "id",
+		"GET /{a}/x/{b...}":         "a b",
+		"/exact/{$}":                "",
+		"example.com/{name}/{$}":    "name",
+		"/broken/{name":             "",
+		"POST /{first}/{second}/ok": "first second",
+	}
+
+	for pattern, expected := range tests {
+		out := strings.Join(servePatternNames(pattern), " ")
+		if out != expected {
+			t.Fatalf("wrong names for %s, got %q", pattern, out)
+		}
+	}
+}
+
+// TestServe tests routing requests, and the responses sent.
+func TestServe(t *testing.T) {
+
+	routes := primitive.NewHash()
+
+	routes.Set("GET /users/{id}", handlerFn(func(req primitive.Hash) primitive.Primitive {
+		data := primitive.NewHash()
+		data.Set(":id", req.Get(":params").(primitive.Hash).Get("id"))
+		data.Set(":q", req.Get(":query").(primitive.Hash).Get("q"))
+		data.Set(":path", req.Get(":path"))
+
+		ret := primitive.NewHash()
+		ret.Set(":json", data)
+		return ret
+	}))
+
+	routes.Set("POST /echo", handlerFn(func(req primitive.Hash) primitive.Primitive {
+		hdrs := primitive.NewHash()
+		hdrs.Set(":X-Method", req.Get(":method"))
+		hdrs.Set("X-Name", req.Get(":json").(primitive.Hash).Get(":name"))
+
+		ret := primitive.NewHash()
+		ret.Set(":status", primitive.Number(201))
+		ret.Set(":headers", hdrs)
+		ret.Set(":body", req.Get(":body"))
+		return ret
+	}))
+
+	routes.Set("/", handlerFn(func(req primitive.Hash) primitive.Primitive {
+		return primitive.String("fallback " + req.Get(":path").ToString())
+	}))
+
+	routes.Set("GET /error", handlerFn(func(req primitive.Hash) primitive.Primitive {
+		return primitive.Error("oops")
+	}))
+
+	routes.Set("GET /number", handlerFn(func(req primitive.Hash) primitive.Primitive {
+		return primitive.Number(3)
+	}))
+
+	routes.Set("GET /status", handlerFn(func(req primitive.Hash) primitive.Primitive {
+		ret := primitive.NewHash()
+		ret.Set(":status", primitive.Number(42))
+		return ret
+	}))
+
+	routes.Set("GET /both", handlerFn(func(req primitive.Hash) primitive.Primitive {
+		ret := primitive.NewHash()
+		ret.Set(":body", primitive.String("x"))
+		ret.Set(":json", primitive.String("x"))
+		return ret
+	}))
+
+	routes.Set("GET /unknown", handlerFn(func(req primitive.Hash) primitive.Primitive {
+		ret := primitive.NewHash()
+		ret.Set(":cheese", primitive.String("x"))
+		return ret
+	}))
+
+	e := env.New()
+	var log bytes.Buffer
+	e.GetIOConfig().STDERR = &log
+
+	url, cancel, result := startServerIn(t, e, routes)
+
+	type TC struct {
+		method string
+		path   string
+		body   string
+		status int
+		output string
+	}
+
+	tests := []TC{
+		{"GET", "/users/steve?q=lisp", "", 200, `{"id":"steve","path":"/users/steve","q":"lisp"}`},
+		{"POST", "/echo", `{"name": "bob"}`, 201, `{"name": "bob"}`},
+		{"GET", "/some/where", "", 200, "fallback /some/where"},
+		{"DELETE", "/users/steve", "", 200, "fallback /users/steve"},
+		{"GET", "/error", "", 500, "Internal Server Error\n"},
+		{"GET", "/number", "", 500, "Internal Server Error\n"},
+		{"GET", "/status", "", 500, "Internal Server Error\n"},
+		{"GET", "/both", "", 500, "Internal Server Error\n"},
+		{"GET", "/unknown", "", 500, "Internal Server Error\n"},
+	}
+
+	for _, test := range tests {
+		status, hdrs, body := fetch(t, test.method, url+test.path, test.body)
+		if status != test.status {
+			t.Fatalf("%s %s: wrong status %d", test.method, test.path, status)
+		}
+		if test.output != "" && body != test.output {
+			t.Fatalf("%s %s: wrong body %q", test.method, test.path, body)
+		}
+
+		switch test.path {
+		case "/users/steve?q=lisp":
+			if hdrs.Get("Content-Type") != "application/json" {
+				t.Fatalf("wrong content-type %v", hdrs)
+			}
+		case "/echo":
+			if hdrs.Get("X-Method") != "POST" || hdrs.Get("X-Name") != "bob" {
+				t.Fatalf("wrong headers %v", hdrs)
+			}
+		}
+	}
+
+	// Stop the server
+	cancel()
+
+	select {
+	case out := <-result:
+		if _, ok := out.(primitive.Nil); !ok {
+			t.Fatalf("expected nil, got %v", out)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("server didn't stop")
+	}
+
+	// The details of the errors were logged, not sent to the client
+	for _, msg := range []string{
+		"http:serve: GET /error: oops\n",
+		"http:serve: GET /number: handler returned number, not a hash or string\n",
+		"http:serve: GET /unknown: unknown response option :cheese\n",
+	} {
+		if !strings.Contains(log.String(), msg) {
+			t.Fatalf("%q was not logged, got %q", msg, log.String())
+		}
+	}
+}
+
+// TestServePanic tests that the server stops if a handler unwinds past
+// (http:serve), as an escape continuation would.
+func TestServePanic(t *testing.T) {
+
+	proc := handlerFn(func(req primitive.Hash) primitive.Primitive {
+		panic("escaping")
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen:%s", err)
+	}
+	url := "http://" + ln.Addr().String()
+
+	e := env.New()
+	e.SetEvaluator(&fakeEvaluator{ctx: context.Background()})
+
+	result := make(chan any, 1)
+	go func() {
+		defer func() { result <- recover() }()
+		serve(e, ln, proc)
+	}()
+
+	// The request fails, as its connection is closed
+	resp, err := http.Get(url)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatalf("expected the request to fail")
+	}
+
+	select {
+	case r := <-result:
+		if r != "escaping" {
+			t.Fatalf("expected the panic to propagate, got %v", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("server didn't stop")
+	}
+
+	// Nothing is listening any more
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err == nil {
+		conn.Close()
+		t.Fatalf("expected the listener to be closed")
+	}
+}
+
+// TestServeSerial tests that handlers are never invoked concurrently.
+func TestServeSerial(t *testing.T) {
+
+	var running int32
+	count := 0
+
+	proc := handlerFn(func(req primitive.Hash) primitive.Primitive {
+		if !atomic.CompareAndSwapInt32(&running, 0, 1) {
+			return primitive.Error("handlers running concurrently")
+		}
+		defer atomic.StoreInt32(&running, 0)
+
+		// Without serialization this would race
+		count++
+		time.Sleep(time.Millisecond)
+		return primitive.String(fmt.Sprintf("%d", count))
+	})
+
+	url, cancel, result := startServer(t, proc)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Get(url)
+			if err != nil {
+				t.Errorf("request failed:%s", err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != 200 {
+				t.Errorf("wrong status %d", resp.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+
+	cancel()
+	<-result
+
+	if count != 20 {
+		t.Fatalf("wrong number of requests handled %d", count)
+	}
+}
+
+// TestServeTimers tests that timers fire while the server is running.
+func TestServeTimers(t *testing.T) {
+
+	fired := make(chan bool, 1)
+	proc := &primitive.Procedure{F: func(e *env.Environment, args []primitive.Primitive) primitive.Primitive {
+		fired <- true
+		return primitive.Nil{}
+	}}
+
+	// The timer belongs to the server's interpreter
+	e := env.New()
+	timerAfterFn(e, []primitive.Primitive{primitive.Number(10), proc})
+
+	_, cancel, result := startServerIn(t, e, proc)
+
+	select {
+	case <-fired:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timer didn't fire")
+	}
+
+	cancel()
+	<-result
+}
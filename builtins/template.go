@@ -0,0 +1,277 @@
+// template.go - Implementation of our templating primitive.
+//
+// (template:render) uses the golang text/template package, or
+// html/template when escaping for HTML, so templates may use the usual
+// interpolation, conditionals, and loops.
+//
+// Our values are converted to golang values in the obvious way, with the
+// leading ":" removed from the keys of hashes so that they may be used
+// as {{.name}}.  Functions become golang functions, which may be invoked
+// via {{call .fn arg}}, and any function may be called by name via
+// {{lisp "name" arg}}.
+//
+// The output of every action is escaped according to the mode, which is
+// done by adding a final command to each pipeline in the parsed template.
+
+package builtins
+
+import (
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"regexp"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/skx/yal/env"
+	"github.com/skx/yal/primitive"
+)
+
+// shellSafe matches strings which don't need to be quoted for the shell.
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellQuote quotes the given string for use as a single argument to a
+// shell command.
+func shellQuote(str string) string {
+	if shellSafe.MatchString(str) {
+		return str
+	}
+	return "'" + strings.ReplaceAll(str, "'", `'\''`) + "'"
+}
+
+// templateString converts the given value to the string which will be
+// inserted into the output.
+func templateString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
+
+// templateValue converts the given object to a golang value, for use
+// by a template.
+func templateValue(env *env.Environment, p primitive.Primitive) any {
+
+	switch v := p.(type) {
+	case primitive.String:
+		return string(v)
+	case primitive.Character:
+		return string(v)
+	case primitive.List:
+		ret := make([]any, len(v))
+		for i, x := range v {
+			ret[i] = templateValue(env, x)
+		}
+		return ret
+	case primitive.Hash:
+		ret := make(map[string]any, len(v.Entries))
+		for key, x := range v.Entries {
+			ret[strings.TrimPrefix(key, ":")] = templateValue(env, x)
+		}
+		return ret
+	case *primitive.Procedure:
+		return templateFunc(env, v)
+	case primitive.ToNative:
+		return v.ToInterface()
+	}
+	return p
+}
+
+// templatePrimitive converts the given golang value, received from a
+// template, to one of our objects.
+func templatePrimitive(v any) primitive.Primitive {
+
+	switch v := v.(type) {
+	case nil:
+		return primitive.Nil{}
+	case primitive.Primitive:
+		return v
+	case bool:
+		return primitive.Bool(v)
+	case int:
+		return primitive.Number(v)
+	case int64:
+		return primitive.Number(v)
+	case float64:
+		return primitive.Number(v)
+	case string:
+		return primitive.String(v)
+	case time.Time:
+		return primitive.Time(v)
+	case []any:
+		ret := make(primitive.List, len(v))
+		for i, x := range v {
+			ret[i] = templatePrimitive(x)
+		}
+		return ret
+	case map[string]any:
+		ret := primitive.NewHash()
+		for key, x := range v {
+			ret.Set(":"+key, templatePrimitive(x))
+		}
+		return ret
+	}
+	return primitive.String(fmt.Sprint(v))
+}
+
+// templateFunc returns a golang function which invokes the given lisp
+// function, an error aborts the rendering of the template.
+func templateFunc(env *env.Environment, proc *primitive.Procedure) func(args ...any) (any, error) {
+
+	return func(args ...any) (any, error) {
+
+		vals := make([]primitive.Primitive, len(args))
+		for i, x := range args {
+			vals[i] = templatePrimitive(x)
+		}
+
+		out := applyProcedure(env, proc, vals)
+		if e, ok := out.(primitive.Error); ok {
+			return nil, errors.New(string(e))
+		}
+		return templateValue(env, out), nil
+	}
+}
+
+// templateFuncs returns the functions available to templates.
+func templateFuncs(env *env.Environment) map[string]any {
+
+	return map[string]any{
+		"lisp": func(name string, args ...any) (any, error) {
+			val, ok := env.Get(name)
+			if !ok {
+				return nil, fmt.Errorf("function %s not found", name)
+			}
+			proc, ok := val.(*primitive.Procedure)
+			if !ok {
+				return nil, fmt.Errorf("%s is not a function", name)
+			}
+			return templateFunc(env, proc)(args...)
+		},
+		"shell": func(v any) string {
+			return shellQuote(templateString(v))
+		},
+		"str": templateString,
+	}
+}
+
+// templateEscape adds a call to the named function to the end of every
+// pipeline which produces output, beneath the given node.
+func templateEscape(tree *parse.Tree, node parse.Node, fn string) {
+
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, x := range n.Nodes {
+			templateEscape(tree, x, fn)
+		}
+	case *parse.ActionNode:
+		// Declarations produce no output
+		if len(n.Pipe.Decl) == 0 {
+			id := parse.NewIdentifier(fn).SetTree(tree).SetPos(n.Pos)
+			n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{NodeType: parse.NodeCommand, Pos: n.Pos, Args: []parse.Node{id}})
+		}
+	case *parse.IfNode:
+		templateEscape(tree, n.List, fn)
+		templateEscape(tree, n.ElseList, fn)
+	case *parse.RangeNode:
+		templateEscape(tree, n.List, fn)
+		templateEscape(tree, n.ElseList, fn)
+	case *parse.WithNode:
+		templateEscape(tree, n.List, fn)
+		templateEscape(tree, n.ElseList, fn)
+	}
+}
+
+// templateExecutor is implemented by both text and HTML templates.
+type templateExecutor interface {
+	Execute(w io.Writer, data any) error
+}
+
+// templateRender renders the given template with the given data.
+//
+// The mode is one of "none", "html", or "shell".
+func templateRender(env *env.Environment, text string, data any, mode string) (string, error) {
+
+	var t templateExecutor
+	var trees []*parse.Tree
+
+	if mode == "html" {
+		h, err := htmltemplate.New("template").Funcs(templateFuncs(env)).Parse(text)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse template:%s", err)
+		}
+		for _, x := range h.Templates() {
+			trees = append(trees, x.Tree)
+		}
+		t = h
+	} else {
+		p, err := template.New("template").Funcs(templateFuncs(env)).Parse(text)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse template:%s", err)
+		}
+		for _, x := range p.Templates() {
+			trees = append(trees, x.Tree)
+		}
+		t = p
+	}
+
+	// The function applied to the output of every action
+	escape := "str"
+	if mode == "shell" {
+		escape = "shell"
+	}
+	for _, tree := range trees {
+		if tree != nil {
+			templateEscape(tree, tree.Root, escape)
+		}
+	}
+
+	var out strings.Builder
+	err := t.Execute(&out, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to render template:%s", err)
+	}
+	return out.String(), nil
+}
+
+// templateRenderFn implements (template:render)
+func templateRenderFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We need two or three arguments
+	if len(args) != 2 && len(args) != 3 {
+		return primitive.ArityError()
+	}
+
+	text, ok := args[0].(primitive.String)
+	if !ok {
+		return primitive.Error("argument not a string")
+	}
+
+	// No escaping by default
+	mode := "none"
+	if len(args) == 3 {
+		switch args[2].ToString() {
+		case ":none", ":html", ":shell":
+			mode = strings.TrimPrefix(args[2].ToString(), ":")
+		default:
+			return primitive.Error(fmt.Sprintf("(template:render ..) can escape for :none, :html, or :shell, got %v", args[2]))
+		}
+	}
+
+	out, err := templateRender(env, string(text), templateValue(env, args[1]), mode)
+	if err != nil {
+		return primitive.Error(err.Error())
+	}
+	return primitive.String(out)
+}
@@ -0,0 +1,152 @@
+package builtins
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skx/yal/env"
+	"github.com/skx/yal/primitive"
+)
+
+// TestTemplateArguments ensures (template:render) rejects bogus arguments.
+func TestTemplateArguments(t *testing.T) {
+
+	data := primitive.NewHash()
+	tmpl := primitive.String("{{.x}}")
+
+	tests := []struct {
+		args []primitive.Primitive
+		err  string
+	}{
+		{[]primitive.Primitive{}, string(primitive.ArityError())},
+		{[]primitive.Primitive{tmpl}, string(primitive.ArityError())},
+		{[]primitive.Primitive{primitive.Number(3), data}, "not a string"},
+		{[]primitive.Primitive{tmpl, data, primitive.String(":xml")}, "can escape for :none, :html, or :shell"},
+		{[]primitive.Primitive{primitive.String("{{.x"), data}, "failed to parse template"},
+		{[]primitive.Primitive{primitive.String("{{.x"), data, primitive.String(":html")}, "failed to parse template"},
+		{[]primitive.Primitive{primitive.String("{{index .x 1}}"), data}, "failed to render template"},
+		{[]primitive.Primitive{primitive.String(`{{lisp "missing-function"}}`), data}, "function missing-function not found"},
+		{[]primitive.Primitive{primitive.String(`{{lisp "pi"}}`), data}, "pi is not a function"},
+		{[]primitive.Primitive{primitive.String(`{{lisp "error" "boom"}}`), data}, "boom"},
+	}
+
+	// An environment with a value which isn't a function
+	e := env.NewEnvironment(ENV)
+	e.Set("pi", primitive.Number(3.14))
+
+	for _, test := range tests {
+		out := templateRenderFn(e, test.args)
+
+		e, ok := out.(primitive.Error)
+		if !ok {
+			t.Fatalf("expected error for %v, got %v", test.args, out)
+		}
+		if !strings.Contains(string(e), test.err) {
+			t.Fatalf("got error for %v, but wrong one %v", test.args, out)
+		}
+	}
+}
+
+// TestTemplate tests rendering templates.
+func TestTemplate(t *testing.T) {
+
+	// A function to invoke from templates
+	double := &primitive.Procedure{F: func(e *env.Environment, args []primitive.Primitive) primitive.Primitive {
+		return primitive.Number(args[0].(primitive.Number) * 2)
+	}}
+
+	// A function which returns a hash
+	person := &primitive.Procedure{F: func(e *env.Environment, args []primitive.Primitive) primitive.Primitive {
+		h := primitive.NewHash()
+		h.Set(":name", args[0])
+		h.Set(":admin", args[1])
+		return h
+	}}
+
+	inner := primitive.NewHash()
+	inner.Set(":port", primitive.Number(8080))
+
+	data := primitive.NewHash()
+	data.Set(":host", primitive.String("example.com"))
+	data.Set(":server-name", primitive.String("www"))
+	data.Set("plain", primitive.String("yes"))
+	data.Set(":ssl", primitive.Bool(true))
+	data.Set(":debug", primitive.Bool(false))
+	data.Set(":nothing", primitive.Nil{})
+	data.Set(":ratio", primitive.Number(1.5))
+	data.Set(":chr", primitive.Character("x"))
+	data.Set(":sym", primitive.Symbol("sym"))
+	data.Set(":when", primitive.Time(time.Date(2023, 7, 8, 10, 0, 0, 0, time.UTC)))
+	data.Set(":paths", primitive.List{primitive.String("/a"), primitive.String("/b c")})
+	data.Set(":inner", inner)
+	data.Set(":double", double)
+	data.Set(":person", person)
+	data.Set(":html", primitive.String(`<a href="x">&</a>`))
+	data.Set(":shell", primitive.String("it's $HOME"))
+
+	type TC struct {
+		template string
+		mode     string
+		output   string
+	}
+
+	tests := []TC{
+		{"server_name {{.host}};", "", "server_name example.com;"},
+		{`{{index . "server-name"}} {{.plain}}`, "", "www yes"},
+		{"{{if .ssl}}listen 443;{{else}}listen 80;{{end}}", "", "listen 443;"},
+		{"{{if .debug}}debug{{end}}{{if .missing}}missing{{end}}", "", ""},
+		{"[{{.nothing}}] {{.ratio}} {{.chr}} {{.sym}}", "", "[] 1.5 x sym"},
+		{"{{.when}} {{.when.Year}}", "", "2023-07-08T10:00:00Z 2023"},
+		{"{{range $i, $p := .paths}}{{$i}}={{$p}};{{end}}", "", "0=/a;1=/b c;"},
+		{"{{range .none}}x{{else}}empty{{end}}", "", "empty"},
+		{"{{with .inner}}port {{.port}}{{end}}", "", "port 8080"},
+		{"{{call .double 21}} {{21 | call .double}}", "", "42 42"},
+		{"{{$p := call .person .host true}}{{$p.name}} {{$p.admin}}", "", "example.com true"},
+		{`{{lisp "sprintf" "%s:%d" .host 80}} {{lisp "join" .paths ","}}`, "", "example.com:80 /a,/b c"},
+		{`{{lisp "str" .ratio}} {{len .paths}}`, "", "1.500000 2"},
+		{"{{.html}}", ":none", `<a href="x">&</a>`},
+		{"{{.html}}", ":html", "&lt;a href=&#34;x&#34;&gt;&amp;&lt;/a&gt;"},
+		{`<a href="/{{.shell}}">{{.nothing}}</a>`, ":html", `<a href="/it%27s%20$HOME"></a>`},
+		{"echo {{.shell}} {{.host}} {{range .paths}}{{.}} {{end}}", ":shell", `echo 'it'\''s $HOME' example.com /a '/b c' `},
+		{"echo {{.shell | shell}}", "", `echo 'it'\''s $HOME'`},
+		{`{{define "x"}}[{{.}}]{{end}}{{template "x" .shell}}`, ":shell", `['it'\''s $HOME']`},
+		{`{{$x := .shell}}{{if $x}}{{$x}}{{end}}`, ":shell", `'it'\''s $HOME'`},
+	}
+
+	for _, test := range tests {
+		args := []primitive.Primitive{primitive.String(test.template), data}
+		if test.mode != "" {
+			args = append(args, primitive.String(test.mode))
+		}
+
+		out := templateRenderFn(ENV, args)
+		if _, ok := out.(primitive.String); !ok {
+			t.Fatalf("%s: expected string, got %v", test.template, out)
+		}
+		if out.ToString() != test.output {
+			t.Fatalf("%s: wrong output %q", test.template, out.ToString())
+		}
+	}
+}
+
+// TestShellQuote tests quoting strings for the shell.
+func TestShellQuote(t *testing.T) {
+
+	tests := map[string]string{
+		"":              "''",
+		"simple":        "simple",
+		"/path/to-file": "/path/to-file",
+		"a b":           "'a b'",
+		"it's":          `'it'\''s'`,
+		"$(rm -rf /)":   "'$(rm -rf /)'",
+		"a;b":           "'a;b'",
+		"new\nline":     "'new\nline'",
+	}
+
+	for in, expected := range tests {
+		if out := shellQuote(in); out != expected {
+			t.Fatalf("wrong quoting of %q, got %q", in, out)
+		}
+	}
+}
@@ -0,0 +1,473 @@
+// time.go - Implementation of our date and time primitives.
+//
+// (date), (time), (now), and (ms) return simple values describing the
+// current time.  Here we work with time objects instead, which can
+// represent any point in time, in any time zone.
+//
+// Durations may be given as a number of seconds, or as a string such
+// as "1h30m", which is parsed by golang's time.ParseDuration.
+//
+// Layouts may be given in golang's format, "2006-01-02 15:04:05", or
+// strftime-style, "%Y-%m-%d %H:%M:%S".
+
+package builtins
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	_ "time/tzdata" // embedded time zone database
+
+	"github.com/skx/yal/env"
+	"github.com/skx/yal/primitive"
+)
+
+// strftime maps the strftime directives we support to the
+// golang layout equivalent.
+var strftime = map[byte]string{
+	'a': "Mon",
+	'A': "Monday",
+	'b': "Jan",
+	'B': "January",
+	'd': "02",
+	'D': "01/02/06",
+	'e': "_2",
+	'F': "2006-01-02",
+	'h': "Jan",
+	'H': "15",
+	'I': "03",
+	'j': "002",
+	'm': "01",
+	'M': "04",
+	'n': "\n",
+	'p': "PM",
+	'R': "15:04",
+	'S': "05",
+	't': "\t",
+	'T': "15:04:05",
+	'y': "06",
+	'Y': "2006",
+	'z': "-0700",
+	'Z': "MST",
+	'%': "%",
+}
+
+// strptime maps the strftime directives we support to a regular
+// expression matching the text they produce, and the golang layout
+// which parses that text.
+var strptime = map[byte][2]string{
+	'a': {`[A-Za-z]{3}`, "Mon"},
+	'A': {`[A-Za-z]+`, "Monday"},
+	'b': {`[A-Za-z]{3}`, "Jan"},
+	'B': {`[A-Za-z]+`, "January"},
+	'd': {`\d{2}`, "02"},
+	'D': {`\d{2}/\d{2}/\d{2}`, "01/02/06"},
+	'e': {` ?\d{1,2}`, "2"},
+	'F': {`\d{4}-\d{2}-\d{2}`, "2006-01-02"},
+	'h': {`[A-Za-z]{3}`, "Jan"},
+	'H': {`\d{2}`, "15"},
+	'I': {`\d{2}`, "03"},
+	'j': {`\d{3}`, "002"},
+	'm': {`\d{2}`, "01"},
+	'M': {`\d{2}`, "04"},
+	'p': {`[AP]M`, "PM"},
+	'R': {`\d{2}:\d{2}`, "15:04"},
+	'S': {`\d{2}`, "05"},
+	'T': {`\d{2}:\d{2}:\d{2}`, "15:04:05"},
+	'y': {`\d{2}`, "06"},
+	'Y': {`\d{4}`, "2006"},
+	'z': {`[+-]\d{4}|Z`, "Z0700"},
+	'Z': {`[A-Z][A-Za-z]*(?:[+-]\d+)?`, "MST"},
+}
+
+// timeLayout converts the given layout, and the string which is to be
+// parsed with it, to a golang layout and the string golang should parse,
+// if the layout contains strftime-style directives.
+//
+// Golang has no way to escape literal text in a layout, so that "2" or
+// "Jan" would be taken as part of the date.  Instead we match the literal
+// text here, and give golang only the text matched by each directive.
+func timeLayout(layout string, str string) (string, string, primitive.Primitive) {
+
+	if !strings.Contains(layout, "%") {
+		return layout, str, nil
+	}
+
+	var re strings.Builder
+	var directives []string
+
+	re.WriteString("^")
+	for i := 0; i < len(layout); i++ {
+		if layout[i] != '%' {
+			re.WriteString(regexp.QuoteMeta(layout[i : i+1]))
+			continue
+		}
+
+		i++
+		if i >= len(layout) {
+			return "", "", primitive.Error(fmt.Sprintf("unterminated directive in layout %s", layout))
+		}
+
+		val, ok := strftime[layout[i]]
+		if !ok {
+			return "", "", primitive.Error(fmt.Sprintf("unknown directive %%%c in layout %s", layout[i], layout))
+		}
+
+		// "%%", "%n", and "%t" are literals
+		parse, ok := strptime[layout[i]]
+		if !ok {
+			re.WriteString(regexp.QuoteMeta(val))
+			continue
+		}
+		re.WriteString("(" + parse[0] + ")")
+		directives = append(directives, parse[1])
+	}
+	re.WriteString("$")
+
+	match := regexp.MustCompile(re.String()).FindStringSubmatch(str)
+	if match == nil {
+		return "", "", primitive.Error(fmt.Sprintf("time %s does not match the layout %s", str, layout))
+	}
+
+	// The text matched by each directive is separated by a space,
+	// as are the golang layouts which parse it.
+	values := []string{}
+	for _, m := range match[1:] {
+		values = append(values, strings.TrimSpace(m))
+	}
+	return strings.Join(directives, " "), strings.Join(values, " "), nil
+}
+
+// timeStrftime processes a strftime-style layout, passing the golang
+// equivalent of each directive to the given function and replacing the
+// directive with the result.
+func timeStrftime(layout string, directive func(s string) string) (string, primitive.Primitive) {
+
+	var out strings.Builder
+	for i := 0; i < len(layout); i++ {
+		if layout[i] != '%' {
+			out.WriteByte(layout[i])
+			continue
+		}
+
+		i++
+		if i >= len(layout) {
+			return "", primitive.Error(fmt.Sprintf("unterminated directive in layout %s", layout))
+		}
+
+		val, ok := strftime[layout[i]]
+		if !ok {
+			return "", primitive.Error(fmt.Sprintf("unknown directive %%%c in layout %s", layout[i], layout))
+		}
+
+		// "%%" is a literal
+		if layout[i] == '%' {
+			out.WriteString(val)
+			continue
+		}
+		out.WriteString(directive(val))
+	}
+	return out.String(), nil
+}
+
+// timeArg returns the given argument as a time, or an error
+// if it was some other type.
+func timeArg(arg primitive.Primitive) (time.Time, primitive.Primitive) {
+	t, ok := arg.(primitive.Time)
+	if !ok {
+		return time.Time{}, primitive.Error("argument not a time")
+	}
+	return time.Time(t), nil
+}
+
+// durationArg returns the given argument as a duration, which is either
+// a number of seconds, or a string such as "1h30m".
+func durationArg(arg primitive.Primitive) (time.Duration, primitive.Primitive) {
+
+	switch arg := arg.(type) {
+	case primitive.Number:
+		return time.Duration(float64(arg) * float64(time.Second)), nil
+	case primitive.String:
+		d, err := time.ParseDuration(string(arg))
+		if err != nil {
+			return 0, primitive.Error(fmt.Sprintf("failed to parse duration %s:%s", arg, err))
+		}
+		return d, nil
+	}
+	return 0, primitive.Error("argument not a duration")
+}
+
+// timeAddFn implements (time:add)
+func timeAddFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We need two arguments
+	if len(args) != 2 {
+		return primitive.ArityError()
+	}
+
+	t, err := timeArg(args[0])
+	if err != nil {
+		return err
+	}
+
+	d, err := durationArg(args[1])
+	if err != nil {
+		return err
+	}
+
+	return primitive.Time(t.Add(d))
+}
+
+// timeDiffFn implements (time:diff)
+//
+// Return value is the number of seconds between the two times.
+func timeDiffFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We need two arguments
+	if len(args) != 2 {
+		return primitive.ArityError()
+	}
+
+	a, err := timeArg(args[0])
+	if err != nil {
+		return err
+	}
+
+	b, err := timeArg(args[1])
+	if err != nil {
+		return err
+	}
+
+	return primitive.Number(a.Sub(b).Seconds())
+}
+
+// timeEqualsFn implements "=" when applied to times.
+//
+// Times are equal if they represent the same instant, even if
+// they are in different time zones.
+func timeEqualsFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	a, err := timeArg(args[0])
+	if err != nil {
+		return err
+	}
+
+	// As with numbers we test all arguments, to report on
+	// any type violations.
+	ret := primitive.Bool(true)
+	for _, arg := range args[1:] {
+		b, err := timeArg(arg)
+		if err != nil {
+			return err
+		}
+		if !a.Equal(b) {
+			ret = primitive.Bool(false)
+		}
+	}
+	return ret
+}
+
+// timeFormatFn implements (time:format)
+func timeFormatFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We need one or two arguments
+	if len(args) != 1 && len(args) != 2 {
+		return primitive.ArityError()
+	}
+
+	t, err := timeArg(args[0])
+	if err != nil {
+		return err
+	}
+
+	// Default to the same format we use for display
+	if len(args) == 1 {
+		return primitive.String(t.Format(time.RFC3339Nano))
+	}
+
+	str, ok := args[1].(primitive.String)
+	if !ok {
+		return primitive.Error("argument not a string")
+	}
+
+	// Golang layout
+	if !strings.Contains(string(str), "%") {
+		return primitive.String(t.Format(string(str)))
+	}
+
+	// strftime-style layout, where we format each directive alone
+	// so that literal text is preserved.
+	out, err := timeStrftime(string(str), t.Format)
+	if err != nil {
+		return err
+	}
+	return primitive.String(out)
+}
+
+// timeFromUnixFn implements (time:from-unix)
+func timeFromUnixFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We only need a single argument
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	// Which is a number
+	n, ok := args[0].(primitive.Number)
+	if !ok {
+		return primitive.Error("argument not a number")
+	}
+
+	secs := int64(n)
+	nsecs := int64((float64(n) - float64(secs)) * float64(time.Second))
+	return primitive.Time(time.Unix(secs, nsecs))
+}
+
+// timeNowFn implements (time:now)
+func timeNowFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+	if len(args) != 0 {
+		return primitive.ArityError()
+	}
+	return primitive.Time(time.Now())
+}
+
+// timeParseFn implements (time:parse)
+func timeParseFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We need between one and three arguments
+	if len(args) < 1 || len(args) > 3 {
+		return primitive.ArityError()
+	}
+
+	// All of which are strings
+	for _, arg := range args {
+		if _, ok := arg.(primitive.String); !ok {
+			return primitive.Error("argument not a string")
+		}
+	}
+
+	str := args[0].ToString()
+
+	// RFC3339 is our default layout
+	layout := time.RFC3339Nano
+	if len(args) >= 2 {
+		var err primitive.Primitive
+		layout, str, err = timeLayout(args[1].ToString(), str)
+		if err != nil {
+			return err
+		}
+	}
+
+	// If the input has no time zone it is assumed to be UTC,
+	// unless we're told otherwise.
+	loc := time.UTC
+	if len(args) == 3 {
+		var err error
+		loc, err = time.LoadLocation(args[2].ToString())
+		if err != nil {
+			return primitive.Error(fmt.Sprintf("unknown time zone %s:%s", args[2], err))
+		}
+	}
+
+	t, err := time.ParseInLocation(layout, str, loc)
+	if err != nil {
+		return primitive.Error(fmt.Sprintf("failed to parse time %s:%s", args[0], err))
+	}
+	return primitive.Time(t)
+}
+
+// timeSubFn implements (time:sub)
+func timeSubFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We need two arguments
+	if len(args) != 2 {
+		return primitive.ArityError()
+	}
+
+	t, err := timeArg(args[0])
+	if err != nil {
+		return err
+	}
+
+	d, err := durationArg(args[1])
+	if err != nil {
+		return err
+	}
+
+	return primitive.Time(t.Add(-d))
+}
+
+// timeTzFn implements (time:tz)
+func timeTzFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We need two arguments
+	if len(args) != 2 {
+		return primitive.ArityError()
+	}
+
+	t, err := timeArg(args[0])
+	if err != nil {
+		return err
+	}
+
+	name, ok := args[1].(primitive.String)
+	if !ok {
+		return primitive.Error("argument not a string")
+	}
+
+	loc, er := time.LoadLocation(string(name))
+	if er != nil {
+		return primitive.Error(fmt.Sprintf("unknown time zone %s:%s", name, er))
+	}
+	return primitive.Time(t.In(loc))
+}
+
+// timeUnixFn implements (time:unix)
+func timeUnixFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We only need a single argument
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	t, err := timeArg(args[0])
+	if err != nil {
+		return err
+	}
+
+	return primitive.Number(float64(t.UnixNano()) / float64(time.Second))
+}
+
+// timeAccessor returns a primitive which returns a single field of
+// a time, in the same way as the accessors for a structure.
+func timeAccessor(field func(t time.Time) primitive.Primitive) primitive.GolangPrimitiveFn {
+	return func(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+		// We only need a single argument
+		if len(args) != 1 {
+			return primitive.ArityError()
+		}
+
+		t, err := timeArg(args[0])
+		if err != nil {
+			return err
+		}
+
+		return field(t)
+	}
+}
+
+// The accessors for the fields of a time.
+var (
+	timeDayFn        = timeAccessor(func(t time.Time) primitive.Primitive { return primitive.Number(t.Day()) })
+	timeHourFn       = timeAccessor(func(t time.Time) primitive.Primitive { return primitive.Number(t.Hour()) })
+	timeMinuteFn     = timeAccessor(func(t time.Time) primitive.Primitive { return primitive.Number(t.Minute()) })
+	timeMonthFn      = timeAccessor(func(t time.Time) primitive.Primitive { return primitive.Number(t.Month()) })
+	timeNanosecondFn = timeAccessor(func(t time.Time) primitive.Primitive { return primitive.Number(t.Nanosecond()) })
+	timeSecondFn     = timeAccessor(func(t time.Time) primitive.Primitive { return primitive.Number(t.Second()) })
+	timeWeekdayFn    = timeAccessor(func(t time.Time) primitive.Primitive { return primitive.String(t.Weekday().String()) })
+	timeYearFn       = timeAccessor(func(t time.Time) primitive.Primitive { return primitive.Number(t.Year()) })
+	timeYeardayFn    = timeAccessor(func(t time.Time) primitive.Primitive { return primitive.Number(t.YearDay()) })
+	timeZoneFn       = timeAccessor(func(t time.Time) primitive.Primitive { return primitive.String(t.Location().String()) })
+)
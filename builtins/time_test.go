@@ -0,0 +1,241 @@
+package builtins
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skx/yal/primitive"
+)
+
+// testTime returns a fixed time for testing purposes
+func testTime() primitive.Time {
+	loc, _ := time.LoadLocation("Europe/London")
+	return primitive.Time(time.Date(2023, time.July, 4, 13, 5, 9, 0, loc))
+}
+
+// TestTimeArguments ensures our time-functions reject bogus arguments.
+func TestTimeArguments(t *testing.T) {
+
+	type TC struct {
+		fn   primitive.GolangPrimitiveFn
+		args []primitive.Primitive
+		err  string
+	}
+
+	tm := testTime()
+
+	tests := []TC{
+		{timeAddFn, []primitive.Primitive{tm}, string(primitive.ArityError())},
+		{timeAddFn, []primitive.Primitive{primitive.Number(3), primitive.Number(3)}, "not a time"},
+		{timeAddFn, []primitive.Primitive{tm, tm}, "not a duration"},
+		{timeAddFn, []primitive.Primitive{tm, primitive.String("3 days")}, "failed to parse duration"},
+		{timeDiffFn, []primitive.Primitive{tm}, string(primitive.ArityError())},
+		{timeDiffFn, []primitive.Primitive{primitive.Number(3), tm}, "not a time"},
+		{timeDiffFn, []primitive.Primitive{tm, primitive.Number(3)}, "not a time"},
+		{timeFormatFn, []primitive.Primitive{}, string(primitive.ArityError())},
+		{timeFormatFn, []primitive.Primitive{primitive.String("now")}, "not a time"},
+		{timeFormatFn, []primitive.Primitive{tm, primitive.Number(3)}, "not a string"},
+		{timeFormatFn, []primitive.Primitive{tm, primitive.String("%Q")}, "unknown directive %Q"},
+		{timeFormatFn, []primitive.Primitive{tm, primitive.String("%Y%")}, "unterminated directive"},
+		{timeFromUnixFn, []primitive.Primitive{}, string(primitive.ArityError())},
+		{timeFromUnixFn, []primitive.Primitive{primitive.String("0")}, "not a number"},
+		{timeNowFn, []primitive.Primitive{tm}, string(primitive.ArityError())},
+		{timeParseFn, []primitive.Primitive{}, string(primitive.ArityError())},
+		{timeParseFn, []primitive.Primitive{primitive.Number(3)}, "not a string"},
+		{timeParseFn, []primitive.Primitive{primitive.String("2023"), primitive.String("%Q")}, "unknown directive"},
+		{timeParseFn, []primitive.Primitive{primitive.String("2023"), primitive.String("%Y"), primitive.String("Moon/Base")}, "unknown time zone"},
+		{timeParseFn, []primitive.Primitive{primitive.String("yesterday")}, "failed to parse time"},
+		{timeParseFn, []primitive.Primitive{primitive.String("2023"), primitive.String("%Y%")}, "unterminated directive"},
+		{timeParseFn, []primitive.Primitive{primitive.String("Q1 2023"), primitive.String("Q2 %Y")}, "does not match the layout"},
+		{timeParseFn, []primitive.Primitive{primitive.String("2023-13-01"), primitive.String("%F")}, "failed to parse time"},
+		{timeSubFn, []primitive.Primitive{tm}, string(primitive.ArityError())},
+		{timeSubFn, []primitive.Primitive{primitive.Number(3), primitive.Number(3)}, "not a time"},
+		{timeSubFn, []primitive.Primitive{tm, primitive.Bool(true)}, "not a duration"},
+		{timeTzFn, []primitive.Primitive{tm}, string(primitive.ArityError())},
+		{timeTzFn, []primitive.Primitive{primitive.Number(3), primitive.String("UTC")}, "not a time"},
+		{timeTzFn, []primitive.Primitive{tm, primitive.Number(3)}, "not a string"},
+		{timeTzFn, []primitive.Primitive{tm, primitive.String("Moon/Base")}, "unknown time zone"},
+		{timeUnixFn, []primitive.Primitive{}, string(primitive.ArityError())},
+		{timeUnixFn, []primitive.Primitive{primitive.Number(3)}, "not a time"},
+		{timeYearFn, []primitive.Primitive{}, string(primitive.ArityError())},
+		{timeYearFn, []primitive.Primitive{primitive.Number(3)}, "not a time"},
+		{ltFn, []primitive.Primitive{tm, primitive.Number(3)}, "not a time"},
+		{equalsFn, []primitive.Primitive{tm, primitive.Number(3)}, "not a time"},
+	}
+
+	for _, test := range tests {
+		out := test.fn(ENV, test.args)
+
+		e, ok := out.(primitive.Error)
+		if !ok {
+			t.Fatalf("expected error for %v, got %v", test.args, out)
+		}
+		if !strings.Contains(string(e), test.err) {
+			t.Fatalf("got error for %v, but wrong one %v", test.args, out)
+		}
+	}
+}
+
+// TestTimeFormat tests formatting, and parsing, times.
+func TestTimeFormat(t *testing.T) {
+
+	tm := testTime()
+
+	type TC struct {
+		layout string
+		output string
+	}
+
+	tests := []TC{
+		{"", "2023-07-04T13:05:09+01:00"},
+		{"2006-01-02 15:04", "2023-07-04 13:05"},
+		{"%Y-%m-%d %H:%M:%S", "2023-07-04 13:05:09"},
+		{"%a %A %b %B %h", "Tue Tuesday Jul July Jul"},
+		{"%e|%j|%I%p|%y", " 4|185|01PM|23"},
+		{"%F %T %R %D", "2023-07-04 13:05:09 13:05 07/04/23"},
+		{"%z %Z 100%%", "+0100 BST 100%"},
+	}
+
+	for _, test := range tests {
+
+		args := []primitive.Primitive{tm}
+		if test.layout != "" {
+			args = append(args, primitive.String(test.layout))
+		}
+
+		out := timeFormatFn(ENV, args)
+		if out.ToString() != test.output {
+			t.Fatalf("expected '%s' for '%s', got '%s'", test.output, test.layout, out)
+		}
+	}
+
+	// Parse the default format
+	out := timeParseFn(ENV, []primitive.Primitive{primitive.String("2023-07-04T13:05:09+01:00")})
+	p, ok := out.(primitive.Time)
+	if !ok {
+		t.Fatalf("expected time, got %v", out)
+	}
+	if !time.Time(p).Equal(time.Time(tm)) {
+		t.Fatalf("parsed time was wrong %v", p)
+	}
+
+	// Parse with a layout, which will be UTC
+	out = timeParseFn(ENV, []primitive.Primitive{primitive.String("04/07/2023 12:05:09"), primitive.String("%d/%m/%Y %T")})
+	p, ok = out.(primitive.Time)
+	if !ok {
+		t.Fatalf("expected time, got %v", out)
+	}
+	if !time.Time(p).Equal(time.Time(tm)) {
+		t.Fatalf("parsed time was wrong %v", p)
+	}
+
+	// Literal text in a strftime-style layout is not taken as part of
+	// the date, even if golang would treat it as such.
+	out = timeParseFn(ENV, []primitive.Primitive{primitive.String("Q2 Jan: 4 Jul 2023, 12:05:09PM +0000"), primitive.String("Q2 Jan: %e %b %Y, %I:%M:%S%p %z")})
+	p, ok = out.(primitive.Time)
+	if !ok {
+		t.Fatalf("expected time, got %v", out)
+	}
+	if !time.Time(p).Equal(time.Time(tm)) {
+		t.Fatalf("parsed time was wrong %v", p)
+	}
+
+	// Parse with a layout, and a time zone
+	out = timeParseFn(ENV, []primitive.Primitive{primitive.String("04/07/2023 13:05:09"), primitive.String("02/01/2006 15:04:05"), primitive.String("Europe/London")})
+	p, ok = out.(primitive.Time)
+	if !ok {
+		t.Fatalf("expected time, got %v", out)
+	}
+	if p.ToString() != tm.ToString() {
+		t.Fatalf("parsed time was wrong %v", p)
+	}
+}
+
+// TestTimeArithmetic tests adding, subtracting, and comparing times.
+func TestTimeArithmetic(t *testing.T) {
+
+	tm := testTime()
+
+	later := timeAddFn(ENV, []primitive.Primitive{tm, primitive.String("1h30m")})
+	if later.ToString() != "2023-07-04T14:35:09+01:00" {
+		t.Fatalf("wrong result from add %v", later)
+	}
+
+	earlier := timeSubFn(ENV, []primitive.Primitive{tm, primitive.Number(1.5)})
+	if earlier.ToString() != "2023-07-04T13:05:07.5+01:00" {
+		t.Fatalf("wrong result from sub %v", earlier)
+	}
+
+	diff := timeDiffFn(ENV, []primitive.Primitive{later, earlier})
+	if diff != primitive.Number(5401.5) {
+		t.Fatalf("wrong result from diff %v", diff)
+	}
+
+	// Comparisons
+	if ltFn(ENV, []primitive.Primitive{earlier, later}) != primitive.Bool(true) {
+		t.Fatalf("expected earlier < later")
+	}
+	if ltFn(ENV, []primitive.Primitive{later, earlier}) != primitive.Bool(false) {
+		t.Fatalf("expected !(later < earlier)")
+	}
+
+	// Equality ignores the time zone
+	utc := timeTzFn(ENV, []primitive.Primitive{tm, primitive.String("UTC")})
+	if utc.ToString() != "2023-07-04T12:05:09Z" {
+		t.Fatalf("wrong result from tz %v", utc)
+	}
+	if equalsFn(ENV, []primitive.Primitive{tm, utc, tm}) != primitive.Bool(true) {
+		t.Fatalf("expected times to be equal")
+	}
+	if equalsFn(ENV, []primitive.Primitive{tm, utc, later}) != primitive.Bool(false) {
+		t.Fatalf("expected times to differ")
+	}
+
+	// Unix time, and back
+	unix := timeUnixFn(ENV, []primitive.Primitive{earlier})
+	if unix != primitive.Number(1688472307.5) {
+		t.Fatalf("wrong result from unix %v", unix)
+	}
+	back := timeFromUnixFn(ENV, []primitive.Primitive{unix})
+	if equalsFn(ENV, []primitive.Primitive{back, earlier}) != primitive.Bool(true) {
+		t.Fatalf("wrong result from from-unix %v", back)
+	}
+
+	// now is now
+	now := timeNowFn(ENV, []primitive.Primitive{})
+	if _, ok := now.(primitive.Time); !ok {
+		t.Fatalf("expected time, got %v", now)
+	}
+}
+
+// TestTimeAccessors tests retrieving the fields of a time.
+func TestTimeAccessors(t *testing.T) {
+
+	tm := testTime()
+
+	type TC struct {
+		fn     primitive.GolangPrimitiveFn
+		output string
+	}
+
+	tests := []TC{
+		{timeDayFn, "4"},
+		{timeHourFn, "13"},
+		{timeMinuteFn, "5"},
+		{timeMonthFn, "7"},
+		{timeNanosecondFn, "0"},
+		{timeSecondFn, "9"},
+		{timeWeekdayFn, "Tuesday"},
+		{timeYearFn, "2023"},
+		{timeYeardayFn, "185"},
+		{timeZoneFn, "Europe/London"},
+	}
+
+	for _, test := range tests {
+		out := test.fn(ENV, []primitive.Primitive{tm})
+		if out.ToString() != test.output {
+			t.Fatalf("expected '%s', got '%s'", test.output, out)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+// timer.go - Implementation of sleep, and of timers.
+//
+// Timers invoke a function after a delay, at a regular interval, or
+// according to a cron-expression.
+//
+// Lisp code is not safe to run concurrently, so when a timer fires its
+// function is queued, and it is executed by the next call to (sleep), on
+// the caller's goroutine, or by a server while it waits for requests.
+// A script which uses timers will typically finish with something like
+// (forever (sleep 1000)).
+//
+// Each interpreter has its own queue of timers, held in its environment,
+// so a timer is only ever run by the interpreter which created it.
+
+package builtins
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/skx/yal/env"
+	"github.com/skx/yal/primitive"
+)
+
+// timer holds the state of a single timer.
+type timer struct {
+
+	// proc is the function to invoke when the timer fires.
+	proc *primitive.Procedure
+
+	// next returns the time at which a repeating timer should next
+	// fire, and is nil for a timer which fires only once.
+	next func(now time.Time) time.Time
+
+	// t is the underlying golang timer.
+	t *time.Timer
+
+	// queue is the queue of the interpreter which created the timer.
+	queue *timerQueue
+
+	// queued is true if the timer has fired, but its function has
+	// not yet been invoked.
+	queued bool
+
+	// cancelled is true if the timer has been cancelled.
+	cancelled bool
+}
+
+// timerQueue holds the timers which have fired, and are waiting for
+// their functions to be invoked.
+type timerQueue struct {
+	mu  sync.Mutex
+	due []*timer
+
+	// notify receives a value when a timer fires, to wake (sleep).
+	notify chan struct{}
+}
+
+// timerQueueName is the name the queue of timers is stored under in
+// the environment, which the reader cannot produce, so that lisp code
+// cannot refer to it.
+const timerQueueName = "timer queue"
+
+// newTimerQueue stores a new queue of timers in the given environment.
+func newTimerQueue(env *env.Environment) *timerQueue {
+	q := &timerQueue{notify: make(chan struct{}, 1)}
+	env.Set(timerQueueName, primitive.NewHandle("timers", q))
+	return q
+}
+
+// interpreterTimers returns the timers of the interpreter which is
+// executing code in the given environment.
+//
+// These are created by PopulateEnvironment, but if they are missing
+// they're created in the given environment.
+func interpreterTimers(env *env.Environment) *timerQueue {
+
+	if val, ok := env.Get(timerQueueName); ok {
+		if h, ok := val.(*primitive.Handle); ok {
+			if q, ok := h.Value.(*timerQueue); ok {
+				return q
+			}
+		}
+	}
+	return newTimerQueue(env)
+}
+
+// schedule launches the given timer, to fire after the given delay.
+func (q *timerQueue) schedule(t *timer, delay time.Duration) {
+
+	// Holding the lock ensures t.t is set before fire can run.
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	t.queue = q
+	t.t = time.AfterFunc(delay, func() { q.fire(t) })
+}
+
+// fire is invoked, on a background goroutine, when a timer fires.
+func (q *timerQueue) fire(t *timer) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if t.cancelled {
+		return
+	}
+
+	// If the function still hasn't been invoked since the last
+	// time the timer fired we don't queue it twice.
+	if !t.queued {
+		t.queued = true
+		q.due = append(q.due, t)
+	}
+
+	// Repeating timers are rescheduled, unless there is no time
+	// at which they would fire again
+	if t.next != nil {
+		if next := t.next(time.Now()); !next.IsZero() {
+			t.t.Reset(time.Until(next))
+		}
+	}
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// cancel stops the given timer.
+func (q *timerQueue) cancel(t *timer) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	t.cancelled = true
+	t.t.Stop()
+}
+
+// take removes and returns the timers which have fired.
+func (q *timerQueue) take() []*timer {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	due := q.due
+	q.due = nil
+	for _, t := range due {
+		t.queued = false
+	}
+	return due
+}
+
+// run invokes the functions of any timers which have fired.
+//
+// If a function returns an error it is returned, and the remaining
+// timers are left for the next call.
+func (q *timerQueue) run(env *env.Environment) primitive.Primitive {
+
+	due := q.take()
+	for i, t := range due {
+
+		q.mu.Lock()
+		cancelled := t.cancelled
+		q.mu.Unlock()
+
+		if cancelled {
+			continue
+		}
+
+		out := applyProcedure(env, t.proc, []primitive.Primitive{})
+		if _, ok := out.(primitive.Error); ok {
+			q.requeue(due[i+1:])
+			return out
+		}
+	}
+	return nil
+}
+
+// requeue places the given timers back on the queue.
+func (q *timerQueue) requeue(due []*timer) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, t := range due {
+		if !t.queued {
+			t.queued = true
+			q.due = append(q.due, t)
+		}
+	}
+}
+
+// evaluatorContext returns the context of the interpreter executing code
+// in the given environment.
+func evaluatorContext(env *env.Environment) context.Context {
+	ev, ok := env.GetEvaluator().(primitive.Evaluator)
+	if ok {
+		return ev.Context()
+	}
+	return context.Background()
+}
+
+// timerArgs validates the arguments used to create a timer, returning
+// the function to invoke.
+func timerArgs(args []primitive.Primitive) (*primitive.Procedure, primitive.Primitive) {
+
+	// We need two arguments
+	if len(args) != 2 {
+		return nil, primitive.ArityError()
+	}
+
+	proc, ok := args[1].(*primitive.Procedure)
+	if !ok {
+		return nil, primitive.Error("argument not a function")
+	}
+	return proc, nil
+}
+
+// msArg returns the given argument as a duration, specified in
+// milliseconds.
+func msArg(arg primitive.Primitive) (time.Duration, primitive.Primitive) {
+	n, ok := arg.(primitive.Number)
+	if !ok {
+		return 0, primitive.Error("argument not a number")
+	}
+	return time.Duration(float64(n) * float64(time.Millisecond)), nil
+}
+
+// cronNextFn implements (cron:next)
+func cronNextFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We need one or two arguments
+	if len(args) != 1 && len(args) != 2 {
+		return primitive.ArityError()
+	}
+
+	str, ok := args[0].(primitive.String)
+	if !ok {
+		return primitive.Error("argument not a string")
+	}
+
+	// Default to the current time
+	from := time.Now()
+	if len(args) == 2 {
+		var fail primitive.Primitive
+		from, fail = timeArg(args[1])
+		if fail != nil {
+			return fail
+		}
+	}
+
+	sched, err := parseCron(string(str))
+	if err != nil {
+		return primitive.Error(fmt.Sprintf("failed to parse cron-expression:%s", err))
+	}
+
+	next := sched.next(from)
+	if next.IsZero() {
+		return primitive.Nil{}
+	}
+	return primitive.Time(next)
+}
+
+// sleepFn implements (sleep)
+func sleepFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We only need a single argument
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	delay, fail := msArg(args[0])
+	if fail != nil {
+		return fail
+	}
+
+	ctx := evaluatorContext(env)
+	timers := interpreterTimers(env)
+
+	done := time.NewTimer(delay)
+	defer done.Stop()
+
+	for {
+		// Invoke anything which is due
+		out := timers.run(env)
+		if out != nil {
+			return out
+		}
+
+		// Other goroutines may run lisp while we wait
+		resume := yieldInterpreter(env)
+
+		select {
+		case <-ctx.Done():
+			resume()
+			return primitive.Error(fmt.Sprintf("sleep interrupted:%s", ctx.Err()))
+		case <-done.C:
+			resume()
+			return primitive.Nil{}
+		case <-timers.notify:
+			// a timer fired
+			resume()
+		}
+	}
+}
+
+// timerAfterFn implements (timer:after)
+func timerAfterFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	proc, fail := timerArgs(args)
+	if fail != nil {
+		return fail
+	}
+
+	delay, fail := msArg(args[0])
+	if fail != nil {
+		return fail
+	}
+
+	t := &timer{proc: proc}
+	interpreterTimers(env).schedule(t, delay)
+	return primitive.NewHandle("timer", t)
+}
+
+// timerCancelFn implements (timer:cancel)
+func timerCancelFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	// We only need a single argument
+	if len(args) != 1 {
+		return primitive.ArityError()
+	}
+
+	h, ok := args[0].(*primitive.Handle)
+	if ok {
+		t, ok2 := h.Value.(*timer)
+		if ok2 {
+			t.queue.cancel(t)
+			return primitive.Nil{}
+		}
+	}
+	return primitive.Error("argument not a timer")
+}
+
+// timerCronFn implements (timer:cron)
+func timerCronFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	proc, fail := timerArgs(args)
+	if fail != nil {
+		return fail
+	}
+
+	str, ok := args[0].(primitive.String)
+	if !ok {
+		return primitive.Error("argument not a string")
+	}
+
+	sched, err := parseCron(string(str))
+	if err != nil {
+		return primitive.Error(fmt.Sprintf("failed to parse cron-expression:%s", err))
+	}
+
+	now := time.Now()
+	first := sched.next(now)
+	if first.IsZero() {
+		return primitive.Error(fmt.Sprintf("cron-expression '%s' never fires", str))
+	}
+
+	t := &timer{proc: proc, next: sched.next}
+	interpreterTimers(env).schedule(t, first.Sub(now))
+	return primitive.NewHandle("timer", t)
+}
+
+// timerEveryFn implements (timer:every)
+func timerEveryFn(env *env.Environment, args []primitive.Primitive) primitive.Primitive {
+
+	proc, fail := timerArgs(args)
+	if fail != nil {
+		return fail
+	}
+
+	interval, fail := msArg(args[0])
+	if fail != nil {
+		return fail
+	}
+	if interval <= 0 {
+		return primitive.Error("the interval must be positive")
+	}
+
+	t := &timer{
+		proc: proc,
+		next: func(now time.Time) time.Time { return now.Add(interval) },
+	}
+	interpreterTimers(env).schedule(t, interval)
+	return primitive.NewHandle("timer", t)
+}
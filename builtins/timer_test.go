@@ -0,0 +1,333 @@
+package builtins
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/skx/yal/env"
+	"github.com/skx/yal/primitive"
+)
+
+// fakeEvaluator is an evaluator which has a context, but cannot
+// evaluate lisp.
+type fakeEvaluator struct {
+	ctx context.Context
+}
+
+func (f *fakeEvaluator) Apply(e *env.Environment, proc *primitive.Procedure, args []primitive.Primitive) primitive.Primitive {
+	return proc.F(e, args)
+}
+
+func (f *fakeEvaluator) Context() context.Context {
+	return f.ctx
+}
+
+// TestParseCron tests parsing cron-expressions, and finding the
+// next time they fire.
+func TestParseCron(t *testing.T) {
+
+	// Saturday 8th July 2023
+	from := time.Date(2023, time.July, 8, 10, 17, 30, 0, time.UTC)
+
+	type TC struct {
+		expr string
+		next string
+	}
+
+	tests := []TC{
+		{"* * * * *", "2023-07-08T10:18:00Z"},
+		{"*/15 * * * *", "2023-07-08T10:30:00Z"},
+		{"5/20 * * * *", "2023-07-08T10:25:00Z"},
+		{"0 9-17 * * *", "2023-07-08T11:00:00Z"},
+		{"0,10 3 * * *", "2023-07-09T03:00:00Z"},
+		{"30 9 * * mon-fri", "2023-07-10T09:30:00Z"},
+		{"0 0 * * 7", "2023-07-09T00:00:00Z"},
+		{"0 0 1 jan *", "2024-01-01T00:00:00Z"},
+		{"0 0 29 2 *", "2024-02-29T00:00:00Z"},
+		{"0 0 13 * fri", "2023-07-13T00:00:00Z"},
+		{"0 0 20 * 2", "2023-07-11T00:00:00Z"},
+		{"@daily", "2023-07-09T00:00:00Z"},
+		{"@HOURLY", "2023-07-08T11:00:00Z"},
+		{"@weekly", "2023-07-09T00:00:00Z"},
+		{"@yearly", "2024-01-01T00:00:00Z"},
+		{"0 0 31 2 *", ""},
+	}
+
+	for _, test := range tests {
+		s, err := parseCron(test.expr)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %s", test.expr, err)
+		}
+
+		next := s.next(from)
+		out := ""
+		if !next.IsZero() {
+			out = next.Format(time.RFC3339)
+		}
+		if out != test.next {
+			t.Fatalf("wrong next time for '%s', got '%s' expected '%s'", test.expr, out, test.next)
+		}
+	}
+
+	// Bogus expressions
+	bogus := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * foo *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"1-x * * * *",
+	}
+
+	for _, expr := range bogus {
+		_, err := parseCron(expr)
+		if err == nil {
+			t.Fatalf("expected error parsing '%s'", expr)
+		}
+	}
+}
+
+// TestTimerArguments ensures our timer-functions reject bogus arguments.
+func TestTimerArguments(t *testing.T) {
+
+	type TC struct {
+		fn   primitive.GolangPrimitiveFn
+		args []primitive.Primitive
+		err  string
+	}
+
+	proc := &primitive.Procedure{F: func(e *env.Environment, args []primitive.Primitive) primitive.Primitive {
+		return primitive.Nil{}
+	}}
+
+	tests := []TC{
+		{cronNextFn, []primitive.Primitive{}, string(primitive.ArityError())},
+		{cronNextFn, []primitive.Primitive{primitive.Number(3)}, "not a string"},
+		{cronNextFn, []primitive.Primitive{primitive.String("@daily"), primitive.Number(3)}, "not a time"},
+		{cronNextFn, []primitive.Primitive{primitive.String("@sometimes")}, "failed to parse cron-expression"},
+		{sleepFn, []primitive.Primitive{}, string(primitive.ArityError())},
+		{sleepFn, []primitive.Primitive{primitive.String("1")}, "not a number"},
+		{timerAfterFn, []primitive.Primitive{primitive.Number(1)}, string(primitive.ArityError())},
+		{timerAfterFn, []primitive.Primitive{primitive.Number(1), primitive.Number(1)}, "not a function"},
+		{timerAfterFn, []primitive.Primitive{primitive.String("1"), proc}, "not a number"},
+		{timerCancelFn, []primitive.Primitive{}, string(primitive.ArityError())},
+		{timerCancelFn, []primitive.Primitive{primitive.Number(1)}, "not a timer"},
+		{timerCancelFn, []primitive.Primitive{primitive.NewHandle("process", nil)}, "not a timer"},
+		{timerCronFn, []primitive.Primitive{primitive.String("@daily")}, string(primitive.ArityError())},
+		{timerCronFn, []primitive.Primitive{primitive.Number(1), proc}, "not a string"},
+		{timerCronFn, []primitive.Primitive{primitive.String("* *"), proc}, "failed to parse cron-expression"},
+		{timerCronFn, []primitive.Primitive{primitive.String("0 0 31 2 *"), proc}, "never fires"},
+		{timerEveryFn, []primitive.Primitive{primitive.Number(1)}, string(primitive.ArityError())},
+		{timerEveryFn, []primitive.Primitive{primitive.Number(1), primitive.String("x")}, "not a function"},
+		{timerEveryFn, []primitive.Primitive{primitive.String("1"), proc}, "not a number"},
+		{timerEveryFn, []primitive.Primitive{primitive.Number(0), proc}, "must be positive"},
+	}
+
+	for _, test := range tests {
+		out := test.fn(ENV, test.args)
+
+		e, ok := out.(primitive.Error)
+		if !ok {
+			t.Fatalf("expected error for %v, got %v", test.args, out)
+		}
+		if !strings.Contains(string(e), test.err) {
+			t.Fatalf("got error for %v, but wrong one %v", test.args, out)
+		}
+	}
+}
+
+// TestCronNext tests (cron:next)
+func TestCronNext(t *testing.T) {
+
+	out := cronNextFn(ENV, []primitive.Primitive{primitive.String("0 12 * * *"), testTime()})
+	if out.ToString() != "2023-07-05T12:00:00+01:00" {
+		t.Fatalf("wrong result %v", out)
+	}
+
+	out = cronNextFn(ENV, []primitive.Primitive{primitive.String("0 0 30 2 *")})
+	if _, ok := out.(primitive.Nil); !ok {
+		t.Fatalf("expected nil, got %v", out)
+	}
+
+	out = cronNextFn(ENV, []primitive.Primitive{primitive.String("@hourly")})
+	tm, ok := out.(primitive.Time)
+	if !ok {
+		t.Fatalf("expected time, got %v", out)
+	}
+	if !time.Time(tm).After(time.Now()) {
+		t.Fatalf("next time is in the past %v", tm)
+	}
+}
+
+// TestTimers tests timers firing while we sleep.
+func TestTimers(t *testing.T) {
+
+	count := 0
+	every := &primitive.Procedure{F: func(e *env.Environment, args []primitive.Primitive) primitive.Primitive {
+		count++
+		return primitive.Nil{}
+	}}
+
+	after := 0
+	once := &primitive.Procedure{F: func(e *env.Environment, args []primitive.Primitive) primitive.Primitive {
+		after++
+		return primitive.Nil{}
+	}}
+
+	h := timerEveryFn(ENV, []primitive.Primitive{primitive.Number(20), every})
+	if _, ok := h.(*primitive.Handle); !ok {
+		t.Fatalf("expected timer, got %v", h)
+	}
+	timerAfterFn(ENV, []primitive.Primitive{primitive.Number(10), once})
+
+	// Nothing happens unless we're sleeping
+	time.Sleep(50 * time.Millisecond)
+	if count != 0 || after != 0 {
+		t.Fatalf("timers ran while we weren't sleeping")
+	}
+
+	out := sleepFn(ENV, []primitive.Primitive{primitive.Number(110)})
+	if _, ok := out.(primitive.Nil); !ok {
+		t.Fatalf("expected nil from sleep, got %v", out)
+	}
+	if after != 1 {
+		t.Fatalf("expected one-shot timer to run once, got %d", after)
+	}
+	if count < 3 {
+		t.Fatalf("expected repeating timer to run several times, got %d", count)
+	}
+
+	// Cancel, and confirm it doesn't run again
+	out = timerCancelFn(ENV, []primitive.Primitive{h})
+	if _, ok := out.(primitive.Nil); !ok {
+		t.Fatalf("expected nil from cancel, got %v", out)
+	}
+
+	seen := count
+	sleepFn(ENV, []primitive.Primitive{primitive.Number(60)})
+	if count != seen {
+		t.Fatalf("cancelled timer still running")
+	}
+	if after != 1 {
+		t.Fatalf("one-shot timer ran again")
+	}
+}
+
+// TestTimersPerInterpreter tests that a timer is only run by the
+// interpreter which created it.
+func TestTimersPerInterpreter(t *testing.T) {
+
+	ran := 0
+	proc := &primitive.Procedure{F: func(e *env.Environment, args []primitive.Primitive) primitive.Primitive {
+		ran++
+		return primitive.Nil{}
+	}}
+
+	one := env.New()
+	two := env.New()
+
+	timerAfterFn(one, []primitive.Primitive{primitive.Number(1), proc})
+
+	sleepFn(two, []primitive.Primitive{primitive.Number(50)})
+	if ran != 0 {
+		t.Fatalf("timer was run by another interpreter")
+	}
+
+	sleepFn(one, []primitive.Primitive{primitive.Number(50)})
+	if ran != 1 {
+		t.Fatalf("timer wasn't run by its interpreter, ran %d times", ran)
+	}
+
+	// The timers are shared by every scope of the interpreter.
+	three := env.New()
+	PopulateEnvironment(three)
+
+	timerAfterFn(env.NewEnvironment(three), []primitive.Primitive{primitive.Number(1), proc})
+	sleepFn(env.NewEnvironment(three), []primitive.Primitive{primitive.Number(50)})
+	if ran != 2 {
+		t.Fatalf("timer wasn't run within another scope, ran %d times", ran)
+	}
+}
+
+// TestTimerFinished tests that a repeating timer which has no time to
+// fire again is stopped, rather than firing continuously.
+func TestTimerFinished(t *testing.T) {
+
+	var calls atomic.Int32
+	q := newTimerQueue(env.New())
+	tm := &timer{
+		proc: &primitive.Procedure{F: func(e *env.Environment, args []primitive.Primitive) primitive.Primitive {
+			return primitive.Nil{}
+		}},
+		next: func(now time.Time) time.Time {
+			calls.Add(1)
+			return time.Time{}
+		},
+	}
+	q.schedule(tm, time.Millisecond)
+
+	time.Sleep(100 * time.Millisecond)
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("expected the timer to fire once, it fired %d times", n)
+	}
+	if len(q.take()) != 1 {
+		t.Fatalf("expected the timer to be due")
+	}
+}
+
+// TestTimerFailure tests that an error from a timer is returned by sleep.
+func TestTimerFailure(t *testing.T) {
+
+	fail := &primitive.Procedure{F: func(e *env.Environment, args []primitive.Primitive) primitive.Primitive {
+		return primitive.Error("bang")
+	}}
+
+	start := time.Now()
+	timerAfterFn(ENV, []primitive.Primitive{primitive.Number(10), fail})
+
+	out := sleepFn(ENV, []primitive.Primitive{primitive.Number(5000)})
+	if out != primitive.Error("bang") {
+		t.Fatalf("expected error, got %v", out)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("sleep didn't return promptly")
+	}
+
+	// A lisp function can't be called without an interpreter
+	lisp := &primitive.Procedure{Body: primitive.String("x")}
+	timerAfterFn(ENV, []primitive.Primitive{primitive.Number(1), lisp})
+
+	out = sleepFn(ENV, []primitive.Primitive{primitive.Number(5000)})
+	if !strings.Contains(out.ToString(), "no interpreter available") {
+		t.Fatalf("expected error, got %v", out)
+	}
+}
+
+// TestSleepTimeout tests that sleep respects the interpreter's context.
+func TestSleepTimeout(t *testing.T) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	e := env.New()
+	e.SetEvaluator(&fakeEvaluator{ctx: ctx})
+
+	start := time.Now()
+	out := sleepFn(e, []primitive.Primitive{primitive.Number(5000)})
+	if !strings.Contains(out.ToString(), "deadline exceeded") {
+		t.Fatalf("expected timeout, got %v", out)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("sleep didn't return promptly")
+	}
+}
@@ -9,10 +9,14 @@
 //
 // The I/O abstraction allows a host program to setup different streams
 // prior to initializing the interpreter.
+//
+// The source of random numbers is held here too, so that a host program,
+// or test-case, can make the interpreter's random numbers reproducible.
 package config
 
 import (
 	"io"
+	"math/rand"
 	"os"
 )
 
@@ -30,6 +34,12 @@ type Config struct {
 
 	// STDOUT is the writer which is used for "(print)".
 	STDOUT io.Writer
+
+	// Random is the generator used for "(random)", and friends.
+	//
+	// If this is nil a generator seeded from the current time will
+	// be created when it is first needed.
+	Random *rand.Rand
 }
 
 // New returns a new configuration object
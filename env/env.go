@@ -25,6 +25,11 @@ type Environment struct {
 	// ioconfig holds the interface to the outside world,
 	// which is used for I/O
 	ioconfig *config.Config
+
+	// evaluator holds the interpreter which is executing code
+	// using this environment, which allows golang primitives to
+	// call back into lisp.
+	evaluator any
 }
 
 // Get retrieves a value from the environment.
@@ -114,6 +119,38 @@ func (env *Environment) SetIOConfig(cfg *config.Config) {
 
 // GetIOConfig returns the configuration object which is stored in
 // our environment.
+//
+// If none was set in the current scope then the parent will be consulted,
+// and if there is none at all an empty configuration is created in the
+// outermost environment, so that every scope shares it.
 func (env *Environment) GetIOConfig() *config.Config {
+	if env.ioconfig != nil {
+		return env.ioconfig
+	}
+	if env.parent != nil {
+		return env.parent.GetIOConfig()
+	}
+	env.ioconfig = config.New()
 	return env.ioconfig
 }
+
+// SetEvaluator records the interpreter which is executing code using
+// this environment.
+func (env *Environment) SetEvaluator(ev any) {
+	env.evaluator = ev
+}
+
+// GetEvaluator returns the interpreter which is executing code using
+// this environment.
+//
+// If no interpreter was set in the current scope then the parent will
+// be consulted, and if there is none at all nil is returned.
+func (env *Environment) GetEvaluator() any {
+	if env.evaluator != nil {
+		return env.evaluator
+	}
+	if env.parent == nil {
+		return nil
+	}
+	return env.parent.GetEvaluator()
+}
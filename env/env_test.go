@@ -78,3 +78,54 @@ func TestScopedSet(t *testing.T) {
 	}
 
 }
+
+func TestEvaluator(t *testing.T) {
+
+	// parent
+	p := New()
+
+	// child
+	c := NewEnvironment(p)
+
+	// By default there is no evaluator
+	if c.GetEvaluator() != nil {
+		t.Fatalf("unexpected evaluator")
+	}
+
+	// Set in the parent, and it is visible in the child
+	p.SetEvaluator("parent")
+	if c.GetEvaluator().(string) != "parent" {
+		t.Fatalf("failed to get evaluator in parent scope")
+	}
+
+	// Set in the child, and it is more specific
+	c.SetEvaluator("child")
+	if c.GetEvaluator().(string) != "child" {
+		t.Fatalf("got evaluator; wrong value")
+	}
+	if p.GetEvaluator().(string) != "parent" {
+		t.Fatalf("child evaluator leaked into parent")
+	}
+}
+
+func TestIOConfig(t *testing.T) {
+
+	// parent, with no configuration
+	p := New()
+	p.SetIOConfig(nil)
+
+	// child
+	c := NewEnvironment(p)
+
+	// A configuration is created in the parent, and shared
+	cfg := c.GetIOConfig()
+	if cfg == nil {
+		t.Fatalf("expected a configuration")
+	}
+	if p.GetIOConfig() != cfg {
+		t.Fatalf("configuration wasn't shared with the parent")
+	}
+	if NewEnvironment(p).GetIOConfig() != cfg {
+		t.Fatalf("configuration wasn't shared with another child")
+	}
+}
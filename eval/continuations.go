@@ -0,0 +1,109 @@
+// continuations.go - escape continuations, and (dynamic-wind ..).
+//
+// The continuations created by (call/ec ..) are escape continuations:
+// calling one returns its value(s) from the call which created it,
+// unwinding anything in between, so they can be used for an early return,
+// or to abandon a search.
+//
+// A continuation may only be called while the call which created it is
+// still running; it cannot be used to re-enter a computation which has
+// already finished.
+
+package eval
+
+import (
+	"fmt"
+
+	"github.com/skx/yal/env"
+	"github.com/skx/yal/primitive"
+)
+
+// escape records whether the call which created a continuation is
+// still running.
+type escape struct {
+	active bool
+}
+
+// escapeSignal is used to implement continuations, which panic with it
+// to unwind to the call that created them.
+type escapeSignal struct {
+
+	// k is the continuation which was called.
+	k *escape
+
+	// value is the value, or values, given to the continuation.
+	value primitive.Primitive
+}
+
+// callEC calls the given procedure with an escape continuation, returning
+// either the value of the procedure, or the value given to the
+// continuation if it is called.
+func (ev *Eval) callEC(name string, proc *primitive.Procedure, e *env.Environment) (ret primitive.Primitive) {
+
+	k := &escape{active: true}
+
+	cont := &primitive.Procedure{
+		Help: "An escape continuation, created by (" + name + " ..).",
+		Args: []primitive.Symbol{primitive.Symbol("&values")},
+		F: func(e *env.Environment, args []primitive.Primitive) primitive.Primitive {
+			if !k.active {
+				return primitive.Error(fmt.Sprintf("a continuation from (%s ..) was called after it returned", name))
+			}
+
+			var val primitive.Primitive
+			switch len(args) {
+			case 0:
+				val = primitive.Nil{}
+			case 1:
+				val = args[0]
+			default:
+				val = primitive.Values(args)
+			}
+			panic(escapeSignal{k: k, value: val})
+		},
+	}
+
+	defer func() {
+		k.active = false
+
+		if r := recover(); r != nil {
+			sig, ok := r.(escapeSignal)
+			if !ok || sig.k != k {
+				panic(r)
+			}
+			ret = sig.value
+		}
+	}()
+
+	return ev.call(e, proc, []primitive.Primitive{cont})
+}
+
+// dynamicWind calls the thunk between calls to before and after, with
+// after being called however the thunk is left; by returning, by an
+// escape continuation, or by (break ..).
+func (ev *Eval) dynamicWind(before, thunk, after *primitive.Procedure, e *env.Environment) (ret primitive.Primitive) {
+
+	if er, ok := ev.call(e, before, nil).(primitive.Error); ok {
+		return er
+	}
+
+	done := false
+	defer func() {
+		if done {
+			return
+		}
+
+		// We're unwinding, so any error from after is lost.
+		ev.call(e, after, nil)
+	}()
+
+	ret = ev.call(e, thunk, nil)
+	done = true
+
+	if er, ok := ev.call(e, after, nil).(primitive.Error); ok {
+		if _, failed := ret.(primitive.Error); !failed {
+			return er
+		}
+	}
+	return ret
+}
@@ -0,0 +1,261 @@
+// destructure.go - binding values to destructuring patterns.
+//
+// Anywhere a variable is introduced, a pattern may be used in place of
+// a symbol to pull apart the value being bound:
+//
+//   (a (b c) &rest)             - a list, which may contain nested patterns,
+//                                 with any remaining items bound to "rest".
+//   {:keys (name age)           - a hash, binding the values of :name and :age,
+//    :or {age 0} :as person}      with defaults for missing keys, and binding
+//                                 the whole hash to "person".
+
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/skx/yal/env"
+	"github.com/skx/yal/primitive"
+)
+
+// checkPattern ensures that the given form may be used as a binding
+// pattern, returning an error describing the problem if not.
+func checkPattern(pattern primitive.Primitive) error {
+
+	switch p := pattern.(type) {
+	case primitive.Symbol:
+		if strings.HasPrefix(string(p), "&") {
+			return fmt.Errorf("%s may only be used as the last item of a pattern", p)
+		}
+		return nil
+
+	case primitive.List:
+		for i, x := range p {
+			if sym, ok := x.(primitive.Symbol); ok && strings.HasPrefix(string(sym), "&") {
+				if i != len(p)-1 || len(sym) == 1 {
+					return fmt.Errorf("%s may only be used as the last item of a pattern, got %s", sym, patternString(p))
+				}
+				continue
+			}
+			if err := checkPattern(x); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case primitive.Hash:
+		for key, val := range p.Entries {
+			switch key {
+			case ":keys":
+				names, ok := val.(primitive.List)
+				if !ok {
+					return fmt.Errorf(":keys expects a list of symbols, got %s", patternString(val))
+				}
+				for _, x := range names {
+					if _, ok := x.(primitive.Symbol); !ok {
+						return fmt.Errorf(":keys expects a list of symbols, got %s", patternString(val))
+					}
+				}
+			case ":or":
+				if _, ok := val.(primitive.Hash); !ok {
+					return fmt.Errorf(":or expects a hash of defaults, got %s", patternString(val))
+				}
+			case ":as":
+				if _, ok := val.(primitive.Symbol); !ok {
+					return fmt.Errorf(":as expects a symbol, got %s", patternString(val))
+				}
+			default:
+				return fmt.Errorf("unknown key %s in pattern %s, expected :keys, :or, or :as", key, patternString(p))
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("expected a symbol, list, or hash to bind, got %s", patternString(pattern))
+}
+
+// bindPattern binds the names in the given pattern to the corresponding
+// parts of the value, in the specified environment.
+//
+// Any defaults given in a hash pattern are evaluated in that environment,
+// so they may refer to variables bound earlier.
+func (ev *Eval) bindPattern(pattern primitive.Primitive, value primitive.Primitive, e *env.Environment, expandMacro bool) error {
+
+	switch p := pattern.(type) {
+	case primitive.Symbol:
+		e.Set(string(p), value)
+		return nil
+
+	case primitive.List:
+		var items primitive.List
+		if !primitive.IsNil(value) {
+			lst, ok := value.(primitive.List)
+			if !ok {
+				return fmt.Errorf("pattern %s expects a list, got %s %s", patternString(p), value.Type(), value.ToString())
+			}
+			items = lst
+		}
+
+		for i, x := range p {
+
+			// &rest takes the remaining items, if any
+			if sym, ok := x.(primitive.Symbol); ok && strings.HasPrefix(string(sym), "&") {
+				var rest primitive.Primitive
+				rest = primitive.Nil{}
+				if i < len(items) {
+					rest = items[i:]
+				}
+				e.Set(strings.TrimPrefix(string(sym), "&"), rest)
+				return nil
+			}
+
+			if i >= len(items) {
+				return fmt.Errorf("pattern %s expects %d values, got %d", patternString(p), len(p), len(items))
+			}
+			if err := ev.bindPattern(x, items[i], e, expandMacro); err != nil {
+				return err
+			}
+		}
+
+		if len(items) > len(p) {
+			return fmt.Errorf("pattern %s expects %d values, got %d", patternString(p), len(p), len(items))
+		}
+		return nil
+
+	case primitive.Hash:
+		hsh := primitive.NewHash()
+		if !primitive.IsNil(value) {
+			h, ok := value.(primitive.Hash)
+			if !ok {
+				return fmt.Errorf("pattern %s expects a hash, got %s %s", patternString(p), value.Type(), value.ToString())
+			}
+			hsh = h
+		}
+
+		if err := checkPattern(p); err != nil {
+			return err
+		}
+
+		if as, ok := p.Entries[":as"]; ok {
+			e.Set(as.ToString(), value)
+		}
+
+		defaults, _ := p.Entries[":or"].(primitive.Hash)
+		names, _ := p.Entries[":keys"].(primitive.List)
+		for _, x := range names {
+			name := x.ToString()
+
+			// The key might be ":name", or a plain "name", as it
+			// would be in a struct or a decoded JSON object.
+			val, ok := hsh.Entries[":"+name]
+			if !ok {
+				val, ok = hsh.Entries[name]
+			}
+			if !ok {
+				val = primitive.Nil{}
+				if def, found := defaults.Entries[name]; found {
+					val = ev.eval(def, e, expandMacro)
+					if er, eok := val.(primitive.Error); eok {
+						return errors.New(string(er))
+					}
+				}
+			}
+			e.Set(name, val)
+		}
+		return nil
+	}
+
+	return checkPattern(pattern)
+}
+
+// paramPattern returns the destructuring pattern, and default-value, of
+// a parameter to a procedure, or nil if the parameter is not a pattern.
+//
+// A list which may be a pattern is always one, so (a b) destructures a
+// list of two items.  Otherwise a list of a pattern and a value gives the
+// pattern a default, ((a b) nil), and anything else is left to be read as
+// (name default).
+func paramPattern(param primitive.Primitive) (primitive.Primitive, primitive.Primitive) {
+
+	switch p := param.(type) {
+	case primitive.Hash:
+		return p, nil
+
+	case primitive.List:
+		if checkPattern(p) == nil && !bindsKeyword(p) {
+			return p, nil
+		}
+		if len(p) == 2 {
+			switch p[0].(type) {
+			case primitive.List, primitive.Hash:
+				if checkPattern(p[0]) == nil {
+					return p[0], p[1]
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+// bindsKeyword returns true if a list pattern contains a keyword, which
+// cannot be bound, such as the default of (name :value).
+func bindsKeyword(pattern primitive.List) bool {
+
+	for _, x := range pattern {
+		switch p := x.(type) {
+		case primitive.Symbol:
+			if strings.HasPrefix(string(p), ":") {
+				return true
+			}
+		case primitive.List:
+			if bindsKeyword(p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// patternArg records a destructuring pattern as an argument of the given
+// procedure, returning the name it is known by.
+func patternArg(proc *primitive.Procedure, pattern primitive.Primitive) primitive.Symbol {
+
+	name := primitive.Symbol(patternString(pattern))
+	if proc.Patterns == nil {
+		proc.Patterns = make(map[primitive.Symbol]primitive.Primitive)
+	}
+	proc.Patterns[name] = pattern
+	return name
+}
+
+// patternString returns a pattern as it would be written, with any hashes
+// on a single line.
+func patternString(pattern primitive.Primitive) string {
+
+	switch p := pattern.(type) {
+	case primitive.List:
+		parts := []string{}
+		for _, x := range p {
+			parts = append(parts, patternString(x))
+		}
+		return "(" + strings.Join(parts, " ") + ")"
+
+	case primitive.Hash:
+		keys := []string{}
+		for k := range p.Entries {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		parts := []string{}
+		for _, k := range keys {
+			parts = append(parts, k+" "+patternString(p.Entries[k]))
+		}
+		return "{" + strings.Join(parts, " ") + "}"
+	}
+
+	return pattern.ToString()
+}
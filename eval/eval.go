@@ -10,6 +10,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"regexp"
 	"strconv"
 	"strings"
@@ -34,12 +35,25 @@ type Eval struct {
 	// read from next.
 	offset int
 
+	// forms holds the expressions which have been read from our
+	// tokens, so that they are only read once.
+	forms []primitive.Primitive
+
 	// context for handling timeout
 	context context.Context
 
 	// Recurse keeps track of how many times we've recursed
 	recurse int
 
+	// loop is the scope of the innermost loop which (break) and
+	// (continue) would stop, and running holds the loops which may
+	// be stopped, so that they can be rejected elsewhere.
+	loop    *env.Environment
+	running *loopFrame
+
+	// gen is the generator whose body is running, if any.
+	gen *generator
+
 	// Symbols contains our (interned) symbol atom
 	symbols map[string]primitive.Primitive
 
@@ -65,6 +79,52 @@ type Eval struct {
 	// loadingStdlib controls whether we're loading the standard library
 	// if we are we write definitions to stdlib, otherwise we don't
 	loadingStdlib bool
+
+	// expansions remembers the result of expanding each macro call
+	// which was read from the source, so that a call within a loop,
+	// or a function, is expanded only once rather than every time it
+	// is evaluated.
+	expansions map[expansionKey]expansion
+
+	// expanded holds the keys of the expansions, oldest first from
+	// the position oldest, so that they're forgotten in that order.
+	expanded []expansionKey
+	oldest   int
+
+	// source records the forms which were produced by the reader,
+	// the only forms whose expansions are remembered.
+	source map[expansionKey]bool
+
+	// sched allows lisp to run on more than one goroutine, taking
+	// turns to do so.
+	sched scheduler
+
+	// abandoned holds the generators which can no longer be reached,
+	// and which are waiting to be stopped.
+	abandoned *abandoned
+}
+
+// maxExpansions is the number of macro expansions we'll remember, after
+// which the oldest is forgotten as each new one is made.
+const maxExpansions = 16 * 1024
+
+// expansionKey identifies a form read from the source by the memory
+// which holds its elements, which is the same each time the form is
+// evaluated.
+type expansionKey struct {
+	first  *primitive.Primitive
+	length int
+}
+
+// expansion is the result of expanding a single macro call.
+type expansion struct {
+
+	// macro is the macro which was called.  If its name is later
+	// bound to something else the expansion is no longer used.
+	macro *primitive.Procedure
+
+	// form is what the macro expanded to.
+	form primitive.Primitive
 }
 
 // New constructs a new lisp interpreter.
@@ -89,6 +149,15 @@ func New(src string) *Eval {
 		// accessors contains the names of generated get/set
 		// functions for field access within structs
 		accessors: make(map[string]string),
+
+		// expansions caches the results of macro expansion
+		expansions: make(map[expansionKey]expansion),
+
+		// source holds the forms the reader produced
+		source: make(map[expansionKey]bool),
+
+		// abandoned holds generators waiting to be stopped
+		abandoned: &abandoned{},
 	}
 
 	// Setup the default symbol-table (interned) entries.
@@ -126,6 +195,45 @@ func (ev *Eval) Aliased() map[string]string {
 	return ev.aliases
 }
 
+// Apply invokes the given procedure with the specified arguments.
+//
+// This is used by golang primitives which need to call functions that
+// have been supplied to them, and the arguments are not evaluated again.
+func (ev *Eval) Apply(e *env.Environment, proc *primitive.Procedure, args []primitive.Primitive) primitive.Primitive {
+
+	// The procedure cannot (break) out of a loop which is running
+	// the golang primitive that called us.
+	running := ev.running
+	ev.running = nil
+	defer func() {
+		ev.running = running
+	}()
+
+	ret := ev.call(e, proc, args)
+	if vals, ok := ret.(primitive.Values); ok {
+		return vals.First()
+	}
+	return ret
+}
+
+// call invokes the given procedure with the specified arguments, which
+// will not be evaluated again, returning any multiple values.
+func (ev *Eval) call(e *env.Environment, proc *primitive.Procedure, args []primitive.Primitive) primitive.Primitive {
+
+	// Bind the procedure in a new scope, using a name which cannot
+	// be produced by the reader, so that it cannot be shadowed.
+	scope := env.NewEnvironment(e)
+	scope.Set("apply procedure", proc)
+
+	// Build up a call to the procedure, quoting each argument.
+	call := primitive.List{primitive.Symbol("apply procedure")}
+	for _, arg := range args {
+		call = append(call, primitive.List{primitive.Symbol("quote"), arg})
+	}
+
+	return ev.evalValues(call, scope, false)
+}
+
 // Evaluate executes the source that was passed in the constructor,
 // using the given environment for storing/retrieving state.
 //
@@ -133,20 +241,25 @@ func (ev *Eval) Aliased() map[string]string {
 // was executed.
 func (ev *Eval) Evaluate(e *env.Environment) primitive.Primitive {
 
-	// Reset our position so we can evaluate the same program
-	// multiple times
-	ev.offset = 0
-
 	// Our output/return value
 	var out primitive.Primitive
 
 	// Default to "nil" not "<nil>"
 	out = primitive.Nil{}
 
+	// An interpreter which used the environment before us might
+	// have created generators, which we'll stop if they're abandoned.
+	if prev, ok := e.GetEvaluator().(*Eval); ok && prev != ev {
+		ev.abandoned = prev.abandoned
+	}
+
+	// Allow golang primitives to call back into lisp
+	e.SetEvaluator(ev)
+
 	// loop over all input
-	for {
+	for i := 0; ; i++ {
 		// Get the next expression
-		expr, err := ev.readExpression(e)
+		expr, err := ev.read(e, i)
 
 		if err != nil {
 			// End of list?
@@ -168,6 +281,29 @@ func (ev *Eval) Evaluate(e *env.Environment) primitive.Primitive {
 	return out
 }
 
+// read returns the expression at the given position in our source.
+//
+// Each expression is only read once, so that evaluating the same program
+// multiple times evaluates the same forms, whose macro expansions have
+// been remembered.
+func (ev *Eval) read(e *env.Environment, n int) (primitive.Primitive, error) {
+
+	if n < len(ev.forms) {
+		return ev.forms[n], nil
+	}
+
+	// Read the next expression, retrying from the same place
+	// if that fails
+	start := ev.offset
+	expr, err := ev.readExpression(e)
+	if err != nil {
+		ev.offset = start
+		return nil, err
+	}
+	ev.forms = append(ev.forms, expr)
+	return expr, nil
+}
+
 // Execute will load the new code in the given src, and execute it
 // using the specified environment.
 //
@@ -182,6 +318,12 @@ func (ev *Eval) Execute(e *env.Environment, src string) primitive.Primitive {
 	return (ev.Evaluate(e))
 }
 
+// Context returns the context which was passed to the evaluator, via
+// SetContext.
+func (ev *Eval) Context() context.Context {
+	return ev.context
+}
+
 // SetContext allows a context to be passed to the evaluator.
 //
 // The context allows you to setup a timeout/deadline for the
@@ -260,7 +402,19 @@ func (ev *Eval) atom(token string) primitive.Primitive {
 	return primitive.Symbol(token)
 }
 
-// eval evaluates a single expression appropriately.
+// eval evaluates a single expression, where a single value is expected.
+//
+// If the expression returns multiple values only the first is used.
+func (ev *Eval) eval(exp primitive.Primitive, e *env.Environment, expandMacro bool) primitive.Primitive {
+	ret := ev.evalValues(exp, e, expandMacro)
+	if vals, ok := ret.(primitive.Values); ok {
+		return vals.First()
+	}
+	return ret
+}
+
+// evalValues evaluates a single expression appropriately, which might
+// return multiple values.
 //
 // We have special cases for the simple values, for example numbers, strings,
 // and similar primitive types just return themselves.
@@ -269,14 +423,17 @@ func (ev *Eval) atom(token string) primitive.Primitive {
 //
 // Symbols return the appropriate value from the environment, and
 // lists involve invoking functions (or our special built-in forms).
-func (ev *Eval) eval(exp primitive.Primitive, e *env.Environment, expandMacro bool) primitive.Primitive {
+func (ev *Eval) evalValues(exp primitive.Primitive, e *env.Environment, expandMacro bool) primitive.Primitive {
 
 	// Bump our recursion count
 	ev.recurse++
 
-	// Ensure that when we exit we drop back down again
+	// Ensure that when we exit we drop back down again, and
+	// restore the loop we're inside, if we called a procedure.
+	loop := ev.loop
 	defer func() {
 		ev.recurse--
+		ev.loop = loop
 	}()
 
 	// Arbitrary limit here.
@@ -315,6 +472,13 @@ func (ev *Eval) eval(exp primitive.Primitive, e *env.Environment, expandMacro bo
 			exp = ev.macroExpand(exp, e)
 		}
 
+		//
+		// Hash literals have their values evaluated.
+		//
+		if hsh, ok := exp.(primitive.Hash); ok && hsh.Literal {
+			return ev.evalHash(hsh, e)
+		}
+
 		//
 		// Simple types return themselves literally.
 		//
@@ -328,6 +492,15 @@ func (ev *Eval) eval(exp primitive.Primitive, e *env.Environment, expandMacro bo
 			return exp
 		}
 
+		//
+		// A procedure is placed directly within a form when
+		// a (syntax-rules ..) template refers to one which the
+		// caller has shadowed, and evaluates to itself.
+		//
+		if _, ok := exp.(*primitive.Procedure); ok {
+			return exp
+		}
+
 		//
 		// After simple types we have to deal with symbols, and lists.
 		//
@@ -387,6 +560,16 @@ func (ev *Eval) eval(exp primitive.Primitive, e *env.Environment, expandMacro bo
 			//
 			res, ok := ev.evalSpecialForm(sym.ToString(), listExp[1:], e, expandMacro)
 			if ok {
+
+				// A form in tail position is evaluated
+				// by going round the loop again.
+				//
+				// TCO.
+				if tail, isTail := res.(*tailCall); isTail {
+					exp = tail.exp
+					e = tail.env
+					continue
+				}
 				return res
 			}
 		}
@@ -591,10 +774,12 @@ func (ev *Eval) eval(exp primitive.Primitive, e *env.Environment, expandMacro bo
 		//
 		// Count the minimum number of arguments.
 		//
-		// A variadic argument may be nil of course.
+		// A variadic argument may be nil of course, and optional
+		// arguments, or those with defaults, may be omitted.
 		//
 		for _, arg := range proc.Args {
-			if !strings.HasPrefix(arg.ToString(), "&") {
+			_, def := proc.Defaults[arg]
+			if !strings.HasPrefix(arg.ToString(), "&") && !def && !proc.Optional[arg] {
 				min++
 			}
 		}
@@ -613,7 +798,7 @@ func (ev *Eval) eval(exp primitive.Primitive, e *env.Environment, expandMacro bo
 		//   - OR
 		//   - The argument is typed as not taking a list
 		//
-		if len(proc.Args) == 1 && len(args) > 1 {
+		if len(proc.Args) == 1 && len(proc.Keys) == 0 && len(args) > 1 {
 
 			// Get the argument name
 			// If this is typed it will have ":blah" suffix
@@ -656,7 +841,7 @@ func (ev *Eval) eval(exp primitive.Primitive, e *env.Environment, expandMacro bo
 		// Variadic arguments would add _extra_ arguments, so this check
 		// is still safe for those.
 		//
-		if (len(args) + len(proc.Defaults)) < min {
+		if len(args) < min {
 			return primitive.ArityError()
 		}
 
@@ -664,17 +849,20 @@ func (ev *Eval) eval(exp primitive.Primitive, e *env.Environment, expandMacro bo
 		// parameter values within.
 		e = env.NewEnvironment(proc.Env)
 
-		// For each default argument set it
-		for k, v := range proc.Defaults {
-			e.Set(k.ToString(), v)
-		}
-
 		// For each of the arguments that have been supplied
 		for i, x := range args {
 
 			// If this is not more than the proc accepts
 			if i < len(proc.Args) {
 
+				// Destructure the argument?
+				if pat, ok := proc.Patterns[proc.Args[i]]; ok && variadic == "" {
+					if err := ev.bindPattern(pat, x, e, expandMacro); err != nil {
+						return primitive.Error(err.Error())
+					}
+					continue
+				}
+
 				// Get the parameter name
 				tmp := proc.Args[i].ToString()
 
@@ -726,6 +914,37 @@ func (ev *Eval) eval(exp primitive.Primitive, e *env.Environment, expandMacro bo
 			}
 		}
 
+		// Arguments which were not supplied are bound to their
+		// defaults, which are evaluated now so that they may refer
+		// to the earlier arguments, or to nil if they are optional.
+		for i := len(args); i < len(proc.Args); i++ {
+			arg := proc.Args[i]
+			if strings.HasPrefix(arg.ToString(), "&") {
+				break
+			}
+			if err := ev.bindDefault(proc, arg, e, expandMacro); err != nil {
+				return primitive.Error(err.Error())
+			}
+		}
+
+		// Record which of the optional arguments were supplied
+		for i, arg := range proc.Args {
+			if sup, ok := proc.Supplied[arg]; ok {
+				e.Set(sup.ToString(), primitive.Bool(i < len(args)))
+			}
+		}
+
+		// Keyword arguments follow the positional ones
+		if len(proc.Keys) > 0 {
+			if err := ev.bindKeys(proc, args, variadic != "", e, expandMacro); err != nil {
+				return primitive.Error(fmt.Sprintf("%s for call to (%s ..)", err, thing.ToString()))
+			}
+		}
+
+		// The body may (break) out of the loop it was defined
+		// within, but not out of others running in its caller.
+		ev.loop = proc.Loop
+
 		// Here we go round the evaluation loop again.
 		//
 		// Which will execute the body of the function this time.
@@ -735,63 +954,247 @@ func (ev *Eval) eval(exp primitive.Primitive, e *env.Environment, expandMacro bo
 	}
 }
 
+// bindDefault binds an argument which was not supplied to its default,
+// evaluated in the given environment, or to nil if there is none.
+func (ev *Eval) bindDefault(proc *primitive.Procedure, arg primitive.Symbol, e *env.Environment, expandMacro bool) error {
+
+	var val primitive.Primitive
+	val = primitive.Nil{}
+	if def, ok := proc.Defaults[arg]; ok {
+		val = ev.eval(def, e, expandMacro)
+		if er, eok := val.(primitive.Error); eok {
+			return errors.New(string(er))
+		}
+	}
+
+	if pat, ok := proc.Patterns[arg]; ok {
+		return ev.bindPattern(pat, val, e, expandMacro)
+	}
+
+	// Remove any type-suffix from the name
+	name, _, _ := strings.Cut(arg.ToString(), ":")
+	e.Set(name, val)
+	return nil
+}
+
+// bindKeys binds the keyword arguments of a procedure, which are given as
+// ":name value" pairs after the positional arguments.
+//
+// Unknown keywords are an error, unless there is a variadic argument which
+// will have received them.
+func (ev *Eval) bindKeys(proc *primitive.Procedure, args []primitive.Primitive, variadic bool, e *env.Environment, expandMacro bool) error {
+
+	// Skip the positional arguments
+	positional := 0
+	for _, arg := range proc.Args {
+		if !strings.HasPrefix(arg.ToString(), "&") {
+			positional++
+		}
+	}
+	if positional > len(args) {
+		positional = len(args)
+	}
+	pairs := args[positional:]
+
+	if len(pairs)%2 != 0 {
+		return fmt.Errorf("keyword arguments must be given as pairs of :name value, got %v", primitive.List(pairs))
+	}
+
+	given := make(map[string]primitive.Primitive)
+	for i := 0; i < len(pairs); i += 2 {
+		key := pairs[i].ToString()
+		if _, ok := pairs[i].(primitive.Symbol); !ok || !strings.HasPrefix(key, ":") {
+			return fmt.Errorf("expected a keyword argument, got %v", pairs[i])
+		}
+		known := false
+		for _, k := range proc.Keys {
+			known = known || ":"+k.ToString() == key
+		}
+		if !known && !variadic {
+			return fmt.Errorf("unknown keyword argument %s", key)
+		}
+
+		// The first value given wins
+		if _, ok := given[key]; !ok {
+			given[key] = pairs[i+1]
+		}
+	}
+
+	for _, k := range proc.Keys {
+		val, ok := given[":"+k.ToString()]
+		if ok {
+			e.Set(k.ToString(), val)
+		} else if err := ev.bindDefault(proc, k, e, expandMacro); err != nil {
+			return err
+		}
+		if sup, found := proc.Supplied[k]; found {
+			e.Set(sup.ToString(), primitive.Bool(ok))
+		}
+	}
+	return nil
+}
+
 // isMacro tests if a given thing is a macro
 func (ev *Eval) isMacro(exp primitive.Primitive, e *env.Environment) bool {
+	return ev.macroFor(exp, e) != nil
+}
+
+// macroFor returns the macro which the given form calls, or nil if it is
+// not a macro call.
+func (ev *Eval) macroFor(exp primitive.Primitive, e *env.Environment) *primitive.Procedure {
 
 	// If we're not being called with a list then there's nothing to do
 	l, ok := exp.(primitive.List)
 	if !ok {
-		return false
+		return nil
 	}
 
 	// If the list doesn't have a size it is not a macro.
 	if len(l) < 1 {
-		return false
+		return nil
 	}
 
 	// Find the thing we're gonna call.
-	procExp := ev.eval(l[0], e, false)
+	//
+	// This is almost always a symbol, which we look up directly
+	// rather than evaluating it.
+	var procExp primitive.Primitive
+	if sym, ok := l[0].(primitive.Symbol); ok {
+		if strings.HasPrefix(string(sym), ":") {
+			return nil
+		}
+		v, found := e.Get(string(sym))
+		if !found {
+			return nil
+		}
+		procExp = v.(primitive.Primitive)
+	} else {
+		procExp = ev.eval(l[0], e, false)
+	}
 
-	// Is it really a procedure we can call?
+	// Is it really a macro we can call?
 	proc, ok2 := procExp.(*primitive.Procedure)
-	if !ok2 {
-		return false
+	if !ok2 || !proc.Macro {
+		return nil
 	}
-	return proc.Macro
+	return proc
 }
 
 // macroExpand expands the given macro.
 //
-// This is not done recursively.
+// This is not done recursively, but the result is expanded again if it
+// is itself a macro call.  The expansion of each call which was read from
+// the source is remembered, so a call which is evaluated repeatedly is
+// only expanded the first time.  Forms built as the program runs are new
+// each time, so they're always expanded.
 func (ev *Eval) macroExpand(exp primitive.Primitive, e *env.Environment) primitive.Primitive {
 
 	// is this a macro?
-	for ev.isMacro(exp, e) {
-
-		// Save the before, so we can see if there was a change.
-		before := exp
+	for mac := ev.macroFor(exp, e); mac != nil; mac = ev.macroFor(exp, e) {
 
-		// Rewrite it
-		exp = ev.eval(exp, e, false)
+		// If it was a macro it was a list, so this is safe.
+		lst := exp.(primitive.List)
 
-		// If things changed (why wouldn't they?)
-		if exp.ToString() != before.ToString() {
+		// Have we expanded this call, with this macro, before?
+		key := expansionKey{first: &lst[0], length: len(lst)}
+		if prev, ok := ev.expansions[key]; ok && prev.macro == mac {
+			exp = prev.form
+		} else {
+			// Rewrite it
+			exp = ev.eval(exp, e, false)
 
-			// If it was a macro it was a list, so this is safe.
-			lst := before.(primitive.List)
+			// Errors are not remembered, they are returned as-is.
+			if _, ok := exp.(primitive.Error); ok {
+				return exp
+			}
 
-			// Log the expansion
-			ioHelper := e.GetIOConfig()
-			log := fmt.Sprintf("Expanded macro %s -> %s\n", lst[0].ToString(), exp.ToString())
+			if ev.source[key] {
+				ev.remember(key, expansion{macro: mac, form: exp})
+			}
+		}
 
-			// Write via our configuration object
-			// Linter complains about ignored return values here..
-			_, _ = ioHelper.STDERR.Write([]byte(log))
+		// Log the expansion, unless nobody would see it
+		ioHelper := e.GetIOConfig()
+		if ioHelper.STDERR == io.Discard {
+			continue
 		}
+		log := fmt.Sprintf("Expanded macro %s -> %s\n", lst[0].ToString(), exp.ToString())
+
+		// Write via our configuration object
+		// Linter complains about ignored return values here..
+		_, _ = ioHelper.STDERR.Write([]byte(log))
 	}
 	return exp
 }
 
+// remember records the expansion of a macro call, forgetting the oldest
+// expansion if we have too many.
+func (ev *Eval) remember(key expansionKey, exp expansion) {
+
+	if _, ok := ev.expansions[key]; !ok {
+		if len(ev.expanded) < maxExpansions {
+			ev.expanded = append(ev.expanded, key)
+		} else {
+			delete(ev.expansions, ev.expanded[ev.oldest])
+			ev.expanded[ev.oldest] = key
+			ev.oldest = (ev.oldest + 1) % maxExpansions
+		}
+	}
+	ev.expansions[key] = exp
+}
+
+// macroExpandAll expands the given form, and every form within it, until
+// no macros remain.
+//
+// Quoted forms, the parameters of functions, the names bound by let*, and
+// the definitions of macros are left alone.
+func (ev *Eval) macroExpandAll(exp primitive.Primitive, e *env.Environment) primitive.Primitive {
+
+	exp = ev.macroExpand(exp, e)
+
+	lst, ok := exp.(primitive.List)
+	if !ok || len(lst) == 0 {
+		return exp
+	}
+
+	// The number of leading forms to leave as they are
+	keep := 0
+
+	out := primitive.List{}
+	if head, ok := lst[0].(primitive.Symbol); ok {
+		switch head {
+		case "quote", "quasiquote", "defmacro!", "define-syntax", "syntax-rules":
+			return exp
+
+		case "fn*", "lambda", "dolist", "dotimes", "for":
+			keep = 2
+
+		case "let*":
+			if len(lst) > 1 {
+				if bindings, ok := lst[1].(primitive.List); ok {
+					expanded := primitive.List{}
+					for i, x := range bindings {
+						if i%2 == 1 {
+							x = ev.macroExpandAll(x, e)
+						}
+						expanded = append(expanded, x)
+					}
+					out = append(out, head, expanded)
+				}
+			}
+		}
+	}
+
+	for i, x := range lst[len(out):] {
+		if i < keep {
+			out = append(out, x)
+			continue
+		}
+		out = append(out, ev.macroExpandAll(x, e))
+	}
+	return out
+}
+
 // quote/quote loop
 func (ev *Eval) qqLoop(xs primitive.List) primitive.List {
 	var acc primitive.List
@@ -920,6 +1323,14 @@ func (ev *Eval) readExpression(e *env.Environment) (primitive.Primitive, error)
 		// which means we skip over the closing ")" character.
 		ev.offset++
 
+		// Remember that this form came from the source, so
+		// that the expansion of a macro call may be reused.
+		if len(list) > 0 {
+			if _, ok := list[0].(primitive.Symbol); ok {
+				ev.source[expansionKey{first: &list[0], length: len(list)}] = true
+			}
+		}
+
 		return list, nil
 
 	case "{":
@@ -959,11 +1370,11 @@ func (ev *Eval) readExpression(e *env.Environment) (primitive.Primitive, error)
 				return nil, ErrEOF
 			}
 
-			// Ensure the value is evaluated
-			v := ev.eval(val, e, true)
-
-			hash.Set(key.ToString(), v)
+			// The value is evaluated when the hash is, so
+			// that it can refer to local variables.
+			hash.Set(key.ToString(), val)
 		}
+		hash.Literal = true
 
 		// We bump the current read-position one more here,
 		// which means we skip over the closing "}" character.
@@ -984,6 +1395,20 @@ func (ev *Eval) readExpression(e *env.Environment) (primitive.Primitive, error)
 	}
 }
 
+// evalHash evaluates the values of a hash literal, returning a new hash,
+// or the first error produced by one of them.
+func (ev *Eval) evalHash(lit primitive.Hash, e *env.Environment) primitive.Primitive {
+	hash := primitive.NewHash()
+	for key, val := range lit.Entries {
+		v := ev.eval(val, e, true)
+		if _, ok := v.(primitive.Error); ok {
+			return v
+		}
+		hash.Set(key, v)
+	}
+	return hash
+}
+
 // Does the given list start with a call to the given function?
 func (ev *Eval) startsWith(l primitive.List, val string) bool {
 	// list must have one entry
@@ -1002,6 +1427,7 @@ func (ev *Eval) tokenize(str string) {
 	// Reset our position
 	ev.offset = 0
 	ev.toks = []string{}
+	ev.forms = nil
 
 	re := regexp.MustCompile(`[\s,]*(~@|[\[\]{}()'` + "`" +
 		`~^@]|"(?:\\.|[^\\"])*"|;.*|[^\s\[\]{}('"` + "`" +
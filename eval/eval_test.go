@@ -1,8 +1,11 @@
 package eval
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"net"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
@@ -88,6 +91,231 @@ func TestAliased(t *testing.T) {
 
 }
 
+// TestApply ensures golang primitives can call back into lisp.
+func TestApply(t *testing.T) {
+
+	// With a new environment
+	ev := env.New()
+
+	// Environment will have a config
+	ev.SetIOConfig(config.DefaultIO())
+
+	// Populate the default primitives
+	builtins.PopulateEnvironment(ev)
+
+	// Add a function which calls its first argument, via the
+	// interpreter, with the second.
+	ev.Set("call",
+		&primitive.Procedure{
+			F: func(e *env.Environment, args []primitive.Primitive) primitive.Primitive {
+				i, ok := e.GetEvaluator().(primitive.Evaluator)
+				if !ok {
+					return primitive.Error("no evaluator")
+				}
+				return i.Apply(e, args[0].(*primitive.Procedure), args[1:])
+			}})
+
+	type TC struct {
+		input  string
+		output string
+	}
+
+	tests := []TC{
+		// lisp function
+		{"(call (lambda (x) (* x 2)) 21)", "42"},
+
+		// golang function
+		{"(call + 1 2 3)", "6"},
+
+		// arguments are not evaluated again
+		{"(call (lambda (x) (car x)) '(+ 1 2))", "+"},
+
+		// errors are returned
+		{"(call (lambda (x) (error x)) \"bang\")", "ERROR{bang}"},
+	}
+
+	for _, test := range tests {
+		l := New(test.input)
+		out := l.Evaluate(ev)
+		if out.ToString() != test.output {
+			t.Fatalf("test '%s' should have produced '%s', but got '%s'", test.input, test.output, out.ToString())
+		}
+	}
+
+	// The procedure name we use should not leak.
+	l := New("(call (lambda () (env)) nil)")
+	out := l.Evaluate(ev)
+	if strings.Contains(out.ToString(), "apply procedure") {
+		t.Fatalf("internal name leaked")
+	}
+}
+
+// TestNetServe ensures lisp handlers take turns to serve connections.
+func TestNetServe(t *testing.T) {
+
+	// With a new environment
+	ev := env.New()
+
+	// Environment will have a config
+	ev.SetIOConfig(config.DefaultIO())
+
+	// Populate the default primitives
+	builtins.PopulateEnvironment(ev)
+
+	addr := New(`(set! ln (net:listen "tcp" "127.0.0.1:0"))
+                     (get (net:address ln) :local)`).Evaluate(ev).ToString()
+
+	// The handler replies to each line, within a loop, until it is
+	// told to stop the server.
+	l := New(`
+(net:serve ln (lambda (c)
+  (dotimes (i 4)
+    (let* (line (net:read-line c))
+      (if (string= line "QUIT")
+        (do (net:close ln) (break))
+        (net:write c (sprintf "%s %s\n" line i)))))))
+(break)
+`)
+
+	result := make(chan primitive.Primitive, 1)
+	go func() {
+		result <- l.Evaluate(ev)
+	}()
+
+	dial := func() (net.Conn, *bufio.Reader) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("failed to connect:%s", err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		return conn, bufio.NewReader(conn)
+	}
+
+	// Two clients are served, in turn, while both are connected
+	a, ar := dial()
+	defer a.Close()
+	b, br := dial()
+	defer b.Close()
+
+	for i, msg := range []string{"one", "two", "three"} {
+		for _, c := range []struct {
+			conn net.Conn
+			r    *bufio.Reader
+		}{{b, br}, {a, ar}} {
+			c.conn.Write([]byte(msg + "\n"))
+			reply, err := c.r.ReadString('\n')
+			expected := fmt.Sprintf("%s %d\n", msg, i)
+			if err != nil || reply != expected {
+				t.Fatalf("wrong reply %q:%s", reply, err)
+			}
+		}
+	}
+
+	// Stopping the server closes the other connection, and we
+	// return to the top-level, which is outside any loop.
+	a.Write([]byte("QUIT\n"))
+
+	select {
+	case out := <-result:
+		if !strings.Contains(out.ToString(), "outside of a loop") {
+			t.Fatalf("expected error, got %v", out)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("server didn't stop")
+	}
+
+	if _, err := br.ReadString('\n'); err == nil {
+		t.Fatalf("expected the connection to be closed")
+	}
+}
+
+// TestGeneratorsStopped ensures that generators which are abandoned
+// don't leave their goroutines behind.
+func TestGeneratorsStopped(t *testing.T) {
+
+	// With a new environment
+	ev := env.New()
+
+	// Environment will have a config
+	ev.SetIOConfig(config.DefaultIO())
+
+	// Populate the default primitives
+	builtins.PopulateEnvironment(ev)
+
+	before := runtime.NumGoroutine()
+
+	out := New("(dotimes (i 2000) (car (generator (dotimes (j 10) (yield j)))))").Evaluate(ev)
+	if _, ok := out.(primitive.Error); ok {
+		t.Fatalf("unexpected error %v", out)
+	}
+
+	// The abandoned generators are stopped once they've been
+	// collected, when the next generator is created.
+	after := 0
+	for range 100 {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+		New("(car (generator (yield 1)))").Evaluate(ev)
+
+		after = runtime.NumGoroutine()
+		if after < before+50 {
+			return
+		}
+	}
+	t.Fatalf("goroutines grew from %d to %d", before, after)
+}
+
+// TestMacroExpansions tests that the expansion of every macro call is
+// logged, even when it was remembered.
+func TestMacroExpansions(t *testing.T) {
+
+	// With a new environment, logging to a buffer
+	ev := env.New()
+	var log strings.Builder
+	ev.GetIOConfig().STDERR = &log
+
+	// Populate the default primitives
+	builtins.PopulateEnvironment(ev)
+
+	l := New("(defmacro! m (fn* () 1)) (dotimes (i 3) (m))")
+	for range 2 {
+		out := l.Evaluate(ev)
+		if _, ok := out.(primitive.Error); ok {
+			t.Fatalf("unexpected error %v", out)
+		}
+	}
+
+	count := strings.Count(log.String(), "Expanded macro m -> 1\n")
+	if count != 6 {
+		t.Fatalf("expected six expansions to be logged, got %d: %q", count, log.String())
+	}
+}
+
+// TestMacroExpansionsForgotten tests that the oldest expansions are
+// forgotten first.
+func TestMacroExpansionsForgotten(t *testing.T) {
+
+	ev := New("")
+
+	keys := []expansionKey{}
+	for range maxExpansions + 2 {
+		form := primitive.List{primitive.Symbol("m")}
+		key := expansionKey{first: &form[0], length: len(form)}
+		keys = append(keys, key)
+		ev.remember(key, expansion{form: form})
+	}
+
+	if len(ev.expansions) != maxExpansions {
+		t.Fatalf("expected %d expansions, got %d", maxExpansions, len(ev.expansions))
+	}
+	for i, key := range keys {
+		_, ok := ev.expansions[key]
+		if ok != (i >= 2) {
+			t.Fatalf("expansion %d remembered:%t", i, ok)
+		}
+	}
+}
+
 // This function contains a bunch of table-driven tests which are
 // designed to be simple.
 func TestEvaluate(t *testing.T) {
@@ -135,6 +363,186 @@ func TestEvaluate(t *testing.T) {
 		{"(set! def2 (fn* ( (a 3)   ) a )) (def2 33)", "33"},
 		{"(fn* ( (3 3)   ) a )", "ERROR{expected a symbol for an argument, got 3}"},
 		{"(fn* ( (a 3 c) ) a )", "ERROR{only two list items allowed for a default-value, got 3}"},
+		{"(set! def3 (fn* ( (a 3) (b (+ a 1)) ) (list a b))) (list (def3) (def3 10) (def3 10 20))", "((3 4) (10 11) (10 20))"},
+		{"(set! def4 (fn* ( (a (error \"bogus\")) ) a)) (def4)", "ERROR{bogus}"},
+		{"(set! def5 (fn* ( (a:number 3) ) a)) (def5)", "3"},
+
+		// optional and keyword arguments
+		{"(set! opt (fn* (a &optional (b (* a 2) b?) c) (list a b b? c))) (list (opt 1) (opt 1 5 6))", "((1 2 #f nil) (1 5 #t 6))"},
+		{"(set! opt (fn* (&optional a) a)) (opt)", "nil"},
+		{"(set! opt (fn* (a &optional b) a)) (opt)", primitive.ArityError().ToString()},
+		{"(set! opt (fn* (&optional ((x y) '(1 2))) (+ x y))) (list (opt) (opt '(3 4)))", "(3 7)"},
+		{"(set! key (fn* (url &key (method \"GET\") (timeout (* 10 2) t?) verbose) (list url method timeout t? verbose))) (key \"x\")", "(x GET 20 #f nil)"},
+		{"(set! key (fn* (url &key (method \"GET\") (timeout (* 10 2) t?) verbose) (list url method timeout t? verbose))) (key \"x\" :verbose true :timeout 5)", "(x GET 5 #t #t)"},
+		{"(set! key (fn* (&key a) a)) (key :a 1 :a 2)", "1"},
+		{"(set! key (fn* (a &rest &key b) (list a rest b))) (key 1 :b 2 :c 3)", "(1 (:b 2 :c 3) 2)"},
+		{"(set! key (fn* (&key a) a)) (key :b 1)", "ERROR{unknown keyword argument :b for call to (key ..)}"},
+		{"(set! key (fn* (&key a) a)) (key :a)", "ERROR{keyword arguments must be given as pairs of :name value, got [:a] for call to (key ..)}"},
+		{"(set! key (fn* (&key a) a)) (key 1 2)", "ERROR{expected a keyword argument, got 1 for call to (key ..)}"},
+		{"(set! key (fn* (&key (a (error \"bogus\"))) a)) (key)", "ERROR{bogus for call to (key ..)}"},
+		{"(fn* (&key a &optional b) 1)", "ERROR{&optional may not follow &key}"},
+		{"(fn* (&key a &key b) 1)", "ERROR{&key may not follow &key}"},
+		{"(fn* (&rest &optional b) 1)", "ERROR{&optional must come before any &rest argument}"},
+		{"(fn* (&rest b) 1)", "ERROR{only &key arguments may follow the &rest argument, got b}"},
+		{"(fn* (&key (a 1 2)) 1)", "ERROR{&key expects a symbol to record whether a was supplied, got 2}"},
+		{"(fn* (&key (a 1 b c)) 1)", "ERROR{&key expects a name, or (name default supplied-p), got [a 1 b c]}"},
+		{"(fn* (&key :a) 1)", "ERROR{&key expects a name, or (name default supplied-p), got :a}"},
+		{"(fn* (&key (a b)) 1)", "(lambda (&key (a b)) 1)"},
+		{"(set! f (fn* (a &optional (b 2 b?) &key (c \"x\")) \"Help.\" a)) (help f)", "Arguments a &optional (b 2 b?) &key (c \"x\")\nHelp."},
+
+		// destructuring
+		{"(let* ((a (b c) &rest) (list 1 (list 2 3) 4 5)) (list a b c rest))", "(1 2 3 (4 5))"},
+		{"(let* ((a &rest) (list 1)) (nil? rest))", "#t"},
+		{"(let* ((a b) nil) a)", "ERROR{pattern (a b) expects 2 values, got 0}"},
+		{"(let* ((a b) (list 1 2 3)) a)", "ERROR{pattern (a b) expects 2 values, got 3}"},
+		{"(let* ((a (b c)) (list 1 2)) a)", "ERROR{pattern (b c) expects a list, got number 2}"},
+		{"(let* ({:keys (name age)} {:name \"Steve\" :age 42}) (list name age))", "(Steve 42)"},
+		{"(let* (n 3 {:keys (a b) :or {b (* n 2)} :as all} {:a 1}) (list a b (get all :a)))", "(1 6 1)"},
+		{"(let* ({:keys (a)} nil) a)", "nil"},
+		{"(struct person name) (let* ({:keys (name)} (person \"Steve\")) name)", "Steve"},
+		{"(let* ({:keys (a)} (list 1)) a)", "ERROR{pattern {:keys (a)} expects a hash, got list (1)}"},
+		{"(let* ({:key (a)} {}) a)", "ERROR{unknown key :key in pattern {:key (a)}, expected :keys, :or, or :as}"},
+		{"(let* ({:keys a} {}) a)", "ERROR{:keys expects a list of symbols, got a}"},
+		{"(let* ({:keys (a) :or 3} {}) a)", "ERROR{:or expects a hash of defaults, got 3}"},
+		{"(let* ((a &b c) nil) a)", "ERROR{&b may only be used as the last item of a pattern, got (a &b c)}"},
+		{"(let* ((a 3) nil) a)", "ERROR{expected a symbol, list, or hash to bind, got 3}"},
+		{"(set! f (fn* ((a (b c) &r) {:keys (d)}) (list a b c r d))) (f '(1 (2 3)) {:d 4})", "(1 2 3 nil 4)"},
+		{"(set! f (fn* (((a b) nil)) (list a b))) (f '(1 2))", "(1 2)"},
+		{"(set! f (fn* (((a b) '(1 2))) (+ a b))) (list (f) (f '(3 4)))", "(3 7)"},
+		{"(set! f (fn* ((a b c)) a)) (f '(1 2))", "ERROR{pattern (a b c) expects 3 values, got 2}"},
+		{"(set! f (fn* ((a b)) (list b a))) (f '(1 2))", "(2 1)"},
+		{"(set! f (fn* (x (a b)) (list x a b))) (f 0 '(1 2))", "(0 1 2)"},
+		{"(set! f (fn* ((a b)) a)) (f '(1))", "ERROR{pattern (a b) expects 2 values, got 1}"},
+		{"(set! f (fn* ((a b)) a)) (f)", primitive.ArityError().ToString()},
+		{"(set! f (fn* ((a :x)) a)) (list (f) (f 1))", "(:x 1)"},
+		{"(set! f (fn* (a &optional (b a)) (list a b))) (list (f 1) (f 1 2))", "((1 1) (1 2))"},
+		{"(fn* ({:keys (3)}) 3)", "ERROR{:keys expects a list of symbols, got (3)}"},
+		{"(set! f (fn* ((a b c)) a)) (help f)", "Arguments (a b c)\n"},
+		{"(let fib ((a b) (list 0 1) n 10) (if (= n 0) a (fib (list b (+ a b)) (- n 1))))", "55"},
+		{"(set! a ()) (dolist ((x y) '((1 2) (3 4))) (set! a (cons (+ x y) a))) a", "(7 3)"},
+		{"(set! a ()) (for ({:keys (x)} (list {:x 1} {:x 2})) (set! a (cons x a))) a", "(2 1)"},
+		{"(set! a ()) (loop (k v) '((:a 1) (:b 2)) (set! a (cons v a))) a", "(2 1)"},
+
+		// hash literals are evaluated when used, not when read
+		{"(set! f (fn* (x) {:x x})) (get (f 3) :x)", "3"},
+		{"(get '{:x (+ 1 2)} :x)", "(+ 1 2)"},
+		{"(set! x 1) (set! f (fn* () {:x x})) (set! x 2) (get (f) :x)", "2"},
+		{"(set! h {:a (+ 1 2) :b (list 1 2)}) (list (get h :a) (get h :b))", "(3 (1 2))"},
+		{"(get (car '({:x y})) :x)", "y"},
+		{"(set! h {:a 1 :b (error \"bogus\")}) h", "ERROR{bogus}"},
+		{"(set! f (fn* () {:a (car 3)})) (f)", "ERROR{argument not a list}"},
+
+		// multiple values
+		{"(receive (q r) (values 7 2) (list q r))", "(7 2)"},
+		{"(set! divmod (fn* (a b) (values (/ a b) (% a b)))) (receive (q r) (divmod 9 2) (list q r))", "(4.500000 1)"},
+		{"(set! divmod (fn* (a b) (values (/ a b) (% a b)))) (+ 1 (divmod 9 2))", "5.500000"},
+		{"(list (values 1 2) (values))", "(1 nil)"},
+		{"(set! x (values 1 2)) x", "1"},
+		{"(receive (a b c) (values 1) (list a b c))", "(1 nil nil)"},
+		{"(receive (a &rest) (values 1 2 3) (list a rest))", "(1 (2 3))"},
+		{"(receive all (values 1 2) all)", "(1 2)"},
+		{"(receive all (values) all)", "nil"},
+		{"(receive (a) 3 a)", "3"},
+		{"(multiple-value-bind ((x y) z) (values '(1 2) 3) (list x y z))", "(1 2 3)"},
+		{"(receive (a b) (if true (values 1 2) 3) (list a b))", "(1 2)"},
+		{"(receive (a b) (do 1 (values 1 2)) (list a b))", "(1 2)"},
+		{"(receive (a b) (values 1 2))", "nil"},
+		{"(receive (a))", primitive.ArityError().ToString()},
+		{"(receive (a) (error \"bogus\") a)", "ERROR{bogus}"},
+		{"(receive 3 (values 1) 1)", "ERROR{(receive ..) expects a list of variables, got 3}"},
+		{"(receive (a 3) (values 1) 1)", "ERROR{(receive ..) expected a symbol, list, or hash to bind, got 3}"},
+
+		// continuations
+		{"(call/ec (fn* (k) (+ 1 (k 42))))", "42"},
+		{"(call/ec (fn* (k) 7))", "7"},
+		{"(call/ec (fn* (k) (do (k 1) 2)))", "1"},
+		{"(call/ec (fn* (k) (k)))", "nil"},
+		{"(receive (a b) (call/ec (fn* (k) (k 1 2))) (list a b))", "(1 2)"},
+		{"(call/ec (fn* (outer) (do (call/ec (fn* (inner) (outer :outer))) :inner)))", ":outer"},
+		{"(call/ec (fn* (k) (dotimes (i 10) (if (= i 3) (k i)))))", "3"},
+		{"(dotimes (i 10) (call/ec (fn* (k) (if (= i 3) (break i)))))", "3"},
+		{"(set! f (fn* (lst) (call/ec (fn* (return) (do (dolist (x lst) (if (> x 2) (return x))) nil))))) (f '(1 2 3 4))", "3"},
+		{"(set! saved nil) (call/ec (fn* (k) (set! saved k))) (saved 3)", "ERROR{a continuation from (call/ec ..) was called after it returned}"},
+		{"(call/ec 3)", "ERROR{(call/ec ..) expects a procedure, got 3}"},
+		{"(call/ec (error \"bogus\"))", "ERROR{bogus}"},
+		{"(call/ec)", primitive.ArityError().ToString()},
+
+		// delayed evaluation
+		{"(set! c 0) (set! p (delay (do (set! c (+ c 1)) c))) (list c (force p) (force p) c)", "(0 1 1 1)"},
+		{"(force (delay (+ 1 2)))", "3"},
+		{"(type (delay 1))", "promise"},
+		{"(force 3)", "3"},
+		{"(delay)", primitive.ArityError().ToString()},
+
+		// lazy sequences
+		{"(lazy-seq '(1 2 3))", "(1 2 3)"},
+		{"(type (lazy-seq nil))", "lazy-seq"},
+		{"(nil? (lazy-seq nil))", "#t"},
+		{"(set! c 0) (set! s (lazy-seq (do (set! c (+ c 1)) '(1 2)))) (list c (car s) (car s) c)", "(0 1 1 1)"},
+		{"(set! f (fn* (n) (lazy-seq (cons n (f (+ n 1)))))) (car (cdr (cdr (f 0))))", "2"},
+		{"(set! f (fn* (n) (lazy-seq (cons n (f (+ n 1)))))) (nth (f 0) 10)", "10"},
+		{"(cons 0 (lazy-seq '(1 2)))", "(0 1 2)"},
+		{"(lazy-seq 3)", "(ERROR{a lazy sequence must produce a list, or a lazy sequence, got number 3})"},
+		{"(car (lazy-seq 3))", "ERROR{a lazy sequence must produce a list, or a lazy sequence, got number 3}"},
+		{"(car (lazy-seq (error \"bogus\")))", "ERROR{bogus}"},
+		{"(set! s (lazy-seq s)) (car s)", "ERROR{lazy sequence depends upon itself}"},
+		{"(dotimes (i 3) (car (lazy-seq (break i))))", "ERROR{(break) used outside of a loop}"},
+		{"(set! s (lazy-seq '(1))) (call/ec (fn* (k) (car (lazy-seq (k 3)))))", "3"},
+
+		// generators
+		{"(generator (yield 1) (yield 2))", "(1 2)"},
+		{"(generator (dotimes (i 3) (yield i)))", "(0 1 2)"},
+		{"(set! c 0) (set! g (generator (forever (do (set! c (+ c 1)) (yield c))))) (list (car (cdr g)) c)", "(2 2)"},
+		{"(set! g (generator (yield 1) (error \"bogus\"))) (car g)", "1"},
+		{"(set! g (generator (yield 1) (error \"bogus\"))) (car (cdr g))", "ERROR{bogus}"},
+		{"(car (generator (yield)))", primitive.ArityError().ToString()},
+		{"(set! y nil) (car (generator (set! y yield) (yield 1))) (y 2)", "ERROR{(yield ..) was called outside of the body of its generator}"},
+		{"(set! g (generator (yield (car (generator (yield 1) (yield 2)))) (yield 3))) (list (car g) (car (cdr g)))", "(1 3)"},
+		{"(set! outer nil) (car (generator (do (set! outer yield) (car (generator (outer 1))))))", "ERROR{(yield ..) was called outside of the body of its generator}"},
+		{"(dotimes (i 3) (car (generator (break i))))", "ERROR{(break) used outside of a loop}"},
+		{"(dotimes (i 5) (do (car (generator (dotimes (j 3) (yield j)))) (if (= i 2) (break i))))", "2"},
+		{"(call/ec (fn* (k) (car (generator (k :escaped)))))", ":escaped"},
+
+		// dynamic-wind
+		{"(set! l '()) (dynamic-wind (fn* () (set! l (cons :in l))) (fn* () (set! l (cons :body l))) (fn* () (set! l (cons :out l)))) l", "(:out :body :in)"},
+		{"(dynamic-wind (fn* () 1) (fn* () 2) (fn* () 3))", "2"},
+		{"(set! l '()) (call/ec (fn* (k) (dynamic-wind (fn* () nil) (fn* () (do (k :escaped) :body)) (fn* () (set! l (cons :out l)))))) l", "(:out)"},
+		{"(set! l '()) (call/ec (fn* (k) (dynamic-wind (fn* () nil) (fn* () (do (k :escaped) :body)) (fn* () (set! l (cons :out l))))))", ":escaped"},
+		{"(set! c 0) (dotimes (i 10) (dynamic-wind (fn* () nil) (fn* () (if (= i 3) (break i))) (fn* () (set! c (+ c 1))))) c", "4"},
+		{"(set! c 0) (try (dynamic-wind (fn* () (error \"before\")) (fn* () (set! c 1)) (fn* () (set! c 2))) (catch e c))", "0"},
+		{"(dynamic-wind (fn* () nil) (fn* () 1) (fn* () (error \"after\")))", "ERROR{after}"},
+		{"(dynamic-wind (fn* () nil) (fn* () (error \"body\")) (fn* () (error \"after\")))", "ERROR{body}"},
+		{"(dynamic-wind (fn* () nil) 3 (fn* () nil))", "ERROR{(dynamic-wind ..) expects a procedure, got 3}"},
+		{"(dynamic-wind (fn* () nil) (fn* () nil))", primitive.ArityError().ToString()},
+
+		// pattern-matching
+		{"(match-case 3 (3 :three) (else :other))", ":three"},
+		{"(match-case 4 (3 :three) (else :other))", ":other"},
+		{"(match-case \"x\" (\"x\" 1) (_ 2))", "1"},
+		{"(match-case :quit (:start 1) (:quit 2))", "2"},
+		{"(match-case 'foo ('bar 1) ('foo 2))", "2"},
+		{"(match-case nil (() :empty))", ":empty"},
+		{"(match-case 5 (s:string s) (n:number (* n 2)))", "10"},
+		{"(match-case 5 (n:string:number (* n 2)))", "10"},
+		{"(match-case -5 (n:number :when (> n 0) :pos) (n:number :neg))", ":neg"},
+		{"(match-case '(1 (2 3) 4 5) ((a (b c) &rest) (list a b c rest)))", "(1 2 3 (4 5))"},
+		{"(match-case '(1 2) ((a) 1) ((a b c) 3) ((a b) 2))", "2"},
+		{"(match-case '(:add 1 2) ((:sub a b) (- a b)) ((:add a b) (+ a b)))", "3"},
+		{"(match-case {:type \"user\" :name \"Steve\"} ({:type \"admin\"} 1) ({:type \"user\" :name n} n))", "Steve"},
+		{"(struct person name age) (match-case (person \"Steve\" 42) ((person n a) :when (> a 50) 1) ((person n _) n))", "Steve"},
+		{"(struct person name age) (struct pet name age) (match-case (pet \"Rex\" 3) ((person n _) 1) (p:pet (pet.name p)))", "Rex"},
+		{"(match-case 3 (x :when x))", "nil"},
+		{"(match-case 3 (x))", "nil"},
+		{"(set! x 1) (match-case 3 (x x)) x", "1"},
+		{"(match-case)", primitive.ArityError().ToString()},
+		{"(match-case (error \"bogus\") (_ 1))", "ERROR{bogus}"},
+		{"(match-case 3 (4 1))", "ERROR{(match-case ..) no clause matched number 3, and there is no else clause}"},
+		{"(match-case {:a 1} (4 1))", "ERROR{(match-case ..) no clause matched hash {:a 1}, and there is no else clause}"},
+		{"(match-case 3 (else 1) (_ 2))", "ERROR{(match-case ..) expects the else clause to be the last}"},
+		{"(match-case 3 4)", "ERROR{(match-case ..) expects (pattern body..) for each clause, got 4}"},
+		{"(match-case 3 (_ :when))", "ERROR{(match-case ..) expects an expression after :when, got [_ :when]}"},
+		{"(match-case '(1 2) ((a &b c) 1))", "ERROR{(match-case ..) &b may only be used as the last item of a pattern, got (a &b c)}"},
+		{"(struct person name age) (match-case 3 ((person n) 1))", "ERROR{(match-case ..) pattern (person n) expects 2 fields for the struct person, got 1}"},
 
 		// literals
 		{":foo", ":foo"},
@@ -174,6 +582,73 @@ func TestEvaluate(t *testing.T) {
                   (macroexpand (steve))`,
 			"steve"},
 
+		// a macro call is expanded once, unless the macro is redefined
+		{`(set! n 0) (defmacro! m (fn* () (do (set! n (+ n 1) true) 1))) (dotimes (i 5) (m)) n`, "1"},
+		{`(defmacro! m (fn* () 1)) (set! f (fn* () (m))) (f) (defmacro! m (fn* () 2)) (f)`, "2"},
+		{`(defmacro! m (fn* () 1)) (set! f (fn* (m) (m))) (list (f (fn* () 3)) (m))`, "(3 1)"},
+		{`(set! n 0) (defmacro! m (fn* () (do (set! n (+ n 1) true) (error "bogus")))) (dotimes (i 3) (try (m) (catch e nil))) n`, "3"},
+		// only the calls which were read from the source are remembered
+		{`(set! n 0) (defmacro! inner (fn* () (do (set! n (+ n 1) true) 1))) (defmacro! outer (fn* () (list 'inner))) (dotimes (i 3) (outer)) n`, "3"},
+
+		// macroexpand-1 expands only once, macroexpand-all everywhere
+		{`(defmacro! one (fn* (x) (list 'two x))) (defmacro! two (fn* (x) x)) (macroexpand-1 (one 3))`, "(two 3)"},
+		{`(defmacro! one (fn* (x) (list 'two x))) (defmacro! two (fn* (x) x)) (macroexpand (one 3))`, "3"},
+		{`(macroexpand-1 (+ 1 2))`, "(+ 1 2)"},
+		{`(defmacro! two (fn* (x) x)) (macroexpand-all (list (two 1) '(two 2) (fn* (two) (two 3))))`, "(list 1 (quote (two 2)) (fn* (two) 3))"},
+		{`(defmacro! two (fn* (x) x)) (macroexpand-all (let* (two (two 1)) two))`, "(let* (two 1) two)"},
+		{`(macroexpand-1)`, primitive.ArityError().ToString()},
+		{`(macroexpand-all 1 2)`, primitive.ArityError().ToString()},
+
+		// syntax-rules
+		{`(define-syntax my-if (syntax-rules () ((_ c a b) (cond c a true b)))) (my-if false 1 2)`, "2"},
+		{`(define-syntax my-list (syntax-rules () ((_ x ...) (list x ...)))) (my-list 1 2 3)`, "(1 2 3)"},
+		{`(define-syntax my-list (syntax-rules () ((_ x ...) (list x ...)))) (my-list)`, "()"},
+		{`(define-syntax my-list (syntax-rules ::: () ((_ x :::) (list x :::)))) (my-list 1 2)`, "(1 2)"},
+		{`(define-syntax my-let (syntax-rules () ((_ ((n v) ...) body ...) ((lambda (n ...) (do body ...)) v ...)))) (my-let ((a 1) (b 2)) (+ a b))`, "3"},
+		{`(define-syntax pairs (syntax-rules () ((_ (a b ...) ...) (list (list a (list b ...)) ...)))) (pairs (1 2 3) (4) (5 6))`, "((1 (2 3)) (4 ()) (5 (6)))"},
+		{`(define-syntax first-last (syntax-rules () ((_ a b ... c) (list a c)))) (first-last 1 2 3 4)`, "(1 4)"},
+		{`(define-syntax arrow (syntax-rules (=>) ((_ a => b) (list b a)) ((_ a b) (list a b)))) (list (arrow 1 => 2) (arrow 1 2))`, "((2 1) (1 2))"},
+		{`(define-syntax ignore (syntax-rules () ((_ _ x) x))) (ignore 1 2)`, "2"},
+		{`(define-syntax my-or (syntax-rules () ((_) false) ((_ e) e) ((_ e r ...) (let* (t e) (if t t (my-or r ...)))))) (my-or false nil 3)`, "3"},
+		{`(set! m (syntax-rules () ((_ x) (* x x)))) (m 4)`, "16"},
+
+		// syntax-rules renames the variables which the template binds
+		{`(define-syntax my-swap! (syntax-rules () ((_ a b) (let* (tmp a) (set! a b true) (set! b tmp true)))))
+                  (set! tmp 1) (set! other 2) (my-swap! tmp other) (list tmp other)`, "(2 1)"},
+		{`(define-syntax twice (syntax-rules () ((_ body) (let* (n 2) (dotimes (i n) body))))) (set! n 0) (twice (set! n (+ n 1) true)) n`, "2"},
+		{`(define-syntax my-swap! (syntax-rules () ((_ a b) (let* (tmp a) (set! a b true) (set! b tmp true)))))
+                  (eq (car (nth (macroexpand (my-swap! x y)) 1)) 'tmp)`, "#f"},
+		// syntax-rules templates refer to the names visible where the macro was defined
+		{`(define-syntax sign (syntax-rules () ((_ n) (cond (< n 0) :neg (> n 0) :pos true :zero))))
+                  (let* (cond 1) (list (sign -2) (sign 0) (sign 3)))`, "(:neg :zero :pos)"},
+		{`(define-syntax pair (syntax-rules () ((_ a b) (list a b)))) (let* (list (fn* (&x) :mine)) (pair 1 2))`, "(1 2)"},
+		{`(define-syntax pair (syntax-rules () ((_ a b) (list a b)))) (let* (list 7) (pair list 2))`, "(7 2)"},
+		{`(define-syntax listed (syntax-rules () ((_) (map '(1 2) (lambda (x) (list x)))))) (let* (list 3) (listed))`, "((1) (2))"},
+		{`(define-syntax named (syntax-rules () ((_) 'list))) (let* (list 3) (named))`, "list"},
+		{`(set! n 0) (while (< n 5) (set! n (+ n 1) true)) n`, "5"},
+		{`(set! again 0) (while (< again 3) (set! again (+ again 1) true)) again`, "3"},
+
+		// define-syntax
+		{`(define-syntax)`, primitive.ArityError().ToString()},
+		{`(define-syntax m "doc" (syntax-rules () ((_) 1))) (help m)`, "doc"},
+		{`(define-syntax m (syntax-rules () ((_ x) x))) (help m)`, "A macro defined by syntax-rules, used as:\n\n(m x)"},
+		{`(define-syntax 3 (syntax-rules () ((_) 1)))`, "ERROR{Expected a symbol, got 3}"},
+		{`(define-syntax m 3 (syntax-rules () ((_) 1)))`, "ERROR{(define-syntax ..) expects a docstring, got 3}"},
+		{`(define-syntax m (fn* () 1))`, "ERROR{(define-syntax ..) expects a macro, such as (syntax-rules ..), got (lambda () 1)}"},
+		{`(defmacro! two (fn* (x) x)) (define-syntax m two) (m 3)`, "3"},
+
+		// syntax-rules errors
+		{`(define-syntax m (syntax-rules () ((_ x) x))) (m)`, "ERROR{(m ..) matched no syntax-rules pattern, got (m)}"},
+		{`(syntax-rules 3)`, "ERROR{(syntax-rules ..) expects a list of literals, got 3}"},
+		{`(syntax-rules () 3)`, "ERROR{(syntax-rules ..) expects (pattern template) for each rule, got 3}"},
+		{`(syntax-rules () (3 3))`, "ERROR{(syntax-rules ..) expects each pattern to be a list, got 3}"},
+		{`(syntax-rules () ((_ ...) 1))`, "ERROR{... must follow a pattern}"},
+		{`(syntax-rules () ((_ x x) 1))`, "ERROR{pattern variable x is used more than once}"},
+		{`(syntax-rules () ((_ x ... y ...) 1))`, "ERROR{... may only be used once in the list (x ... y ...)}"},
+		{`(define-syntax m (syntax-rules () ((_ x ...) x))) (m 1)`, "ERROR{pattern variable x must be followed by ... in the template}"},
+		{`(define-syntax m (syntax-rules () ((_ (x ...) (y ...)) (list (list x y) ...)))) (m (1 2) (3))`, "ERROR{pattern variables in (list x y) matched different numbers of forms}"},
+		{`(define-syntax m (syntax-rules () ((_ x ...) (list 1 ...)))) (m 1)`, "ERROR{... follows 1, which contains no pattern variable that matched repeated forms}"},
+
 		// lambda
 		{`(define sq (lambda (x) (* x x)))
                  ; comment
@@ -181,8 +656,10 @@ func TestEvaluate(t *testing.T) {
 		{`(define sqrt (lambda (x) (# x 0.5))) (sqrt 9)`, "3"},
 		{`(define sqrt (lambda (x) (# x 0.5))) (sqrt 100)`, "10"},
 
-		// gensym - just test that there's an 11 character return
-		{"(length (split (str (gensym)) \"\"))", "11"},
+		// gensym - just test that there's a unique, unreadable, symbol
+		{"(eq (gensym) (gensym))", "#f"},
+		{"(type (gensym \"tmp\"))", "symbol"},
+		{"(length (split (str (gensym)) \" \"))", "2"},
 
 		// let*
 		{"(let* (z 9) z)", "9"},
@@ -234,6 +711,75 @@ a
 		// try no error to catch
 		{"(try (/ 1 1) (catch e 3))", "1"},
 
+		// with-env sets variables, and restores them afterwards
+		{`(with-env {:YAL_WITH_ENV "cake"} (getenv "YAL_WITH_ENV"))`, "cake"},
+		{`(with-env {"YAL_WITH_ENV" 3} (car (shell (list "sh" "-c" "echo $YAL_WITH_ENV"))))`, "3\n"},
+		{`(do (with-env {:YAL_WITH_ENV "cake"} 3) (getenv "YAL_WITH_ENV"))`, ""},
+		{`(do (with-env {:YAL_WITH_ENV "cake"} (error "fail")) (getenv "YAL_WITH_ENV"))`, ""},
+		{`(do (setenv "YAL_WITH_ENV" "pie") (with-env {:YAL_WITH_ENV nil} (set! a (getenv "YAL_WITH_ENV"))) (set! b (join (list a (getenv "YAL_WITH_ENV")))) (unsetenv "YAL_WITH_ENV") b)`, "pie"},
+		{`(with-env {})`, "nil"},
+		{`(set! n 0) (try (with-env {} (error "first") (set! n 1 true)) (catch e nil)) n`, "0"},
+		{`(with-env {} (error "first") 3)`, "ERROR{first}"},
+		{`(with-env {:YAL_WITH_ENV "cake"} (car 3) (getenv "YAL_WITH_ENV"))`, "ERROR{argument not a list}"},
+
+		// loops
+		{"(set! a 0) (dotimes (i 5) (set! a (+ a i))) a", "10"},
+		{"(dotimes (i 5 i))", "4"},
+		{"(dotimes (i 0 i))", "nil"},
+		{"(set! a ()) (dolist (x '(1 2 3) a) (set! a (cons x a)))", "(3 2 1)"},
+		{"(dolist (x nil :empty))", ":empty"},
+		{"(set! a ()) (for (i 1 10 3) (set! a (cons i a))) a", "(10 7 4 1)"},
+		{"(set! a ()) (for (i 3 1 -1) (set! a (cons i a))) a", "(1 2 3)"},
+		{"(set! a ()) (for (i 0 1 0.5) (set! a (cons i a))) a", "(1 0.500000 0)"},
+		{"(set! a ()) (for (c \"abc\") (set! a (cons c a))) a", "(c b a)"},
+		{"(set! a ()) (for (k {:b 2 :a 1}) (set! a (cons k a))) a", "(:b :a)"},
+		{"(set! a ()) (for ((k v) {:b 2 :a 1}) (set! a (cons v a))) a", "(2 1)"},
+		{"(dotimes (i 10) (if (= i 4) (break (* i 10))))", "40"},
+		{"(dolist (x '(1 2 3)) (break))", "nil"},
+		{"(set! a ()) (dotimes (i 5) (if (odd? i) (continue)) (set! a (cons i a))) a", "(4 2 0)"},
+		{"(dolist (x '(1 2)) (dolist (y '(a b)) (break)) (if (= x 2) (break :outer)))", ":outer"},
+		{"(set! f (fn* () (break 99))) (dotimes (i 3) (f))", "ERROR{(break) used outside of a loop}"},
+		{"(set! f (fn* () (continue))) (dolist (x '(1 2)) (f))", "ERROR{(continue) used outside of a loop}"},
+		{"(dotimes (i 5) ((fn* () (if (= i 2) (break (* i 3))))))", "6"},
+		{"(dotimes (i 5) (let loop (n 0) (if (= i 3) (break :named) (if (< n 2) (loop (+ n 1))))))", ":named"},
+		{"(set! f (fn* () (break 1))) (dotimes (i 2) (dotimes (j 2) ((fn* () (f)))))", "ERROR{(break) used outside of a loop}"},
+		{"(set! f nil) (dotimes (i 1) (set! f (fn* () (break :from-f)))) (dotimes (j 3) (f))", "ERROR{(break) used outside of a loop}"},
+		{"(set! f nil) (dotimes (i 3) (set! f (fn* () (continue)))) (dolist (x '(1 2)) (f))", "ERROR{(continue) used outside of a loop}"},
+		{"(dotimes (i 3) (set! g (fn* () (break (list :outer i)))) (dotimes (j 3) (g)))", "(:outer 0)"},
+		{"(set! a ()) (dotimes (i 3) (set! g (fn* () (if (= i 1) (continue)))) (dotimes (j 2) (g)) (set! a (cons i a))) a", "(2 0)"},
+		{"(dotimes (i 5) (/ 1 i))", "ERROR{attempted division by zero}"},
+		{"(break)", "ERROR{(break) used outside of a loop}"},
+		{"(continue)", "ERROR{(continue) used outside of a loop}"},
+		{"(break 1 2)", primitive.ArityError().ToString()},
+		{"(dotimes (i 2) (continue 1))", primitive.ArityError().ToString()},
+		{`(dotimes (i 2) (template:render "{{call .f}}" {:f (lambda () (break))}))`, "ERROR{failed to render template:template: template:1:2: executing \"template\" at <call .f>: error calling call: (break) used outside of a loop}"},
+		{"(dotimes)", primitive.ArityError().ToString()},
+		{"(dotimes i 3)", "ERROR{(dotimes ..) expects a list for the loop variable, got i}"},
+		{"(dotimes (3 3))", "ERROR{(dotimes ..) expects a symbol or pattern for the loop variable, got 3}"},
+		{"(dotimes ((a &b c) 3))", "ERROR{(dotimes ..) &b may only be used as the last item of a pattern, got (a &b c)}"},
+		{"(dotimes (i))", "ERROR{(dotimes ..) expects (var count [result]), got [i]}"},
+		{"(dotimes (i \"3\"))", "ERROR{(dotimes ..) expects a number for the count, got 3}"},
+		{"(dolist (x 3))", "ERROR{(dolist ..) expects a list, got 3}"},
+		{"(dolist ((k v) 3))", "ERROR{(dolist ..) expects a list, got 3}"},
+		{"(for (x 3))", "ERROR{(for ..) cannot iterate over number 3}"},
+		{"(for ((a b) '(1 2)))", "ERROR{pattern (a b) expects a list, got number 1}"},
+		{"(for ((a b) 1 3))", "ERROR{(for ..) expects a single variable for a range, got [[a b] 1 3]}"},
+		{"(for (i 1 \"3\"))", "ERROR{(for ..) expects numbers for a range, got 3}"},
+		{"(for (i 1 3 0))", "ERROR{(for ..) expects a non-zero step}"},
+		{"(for (i 1 2 3 4))", "ERROR{(for ..) expects (var collection) or (var start end [step]), got [i 1 2 3 4]}"},
+
+		// named let
+		{"(let loop (i 0 acc ()) (if (< i 3) (loop (+ i 1) (cons i acc)) acc))", "(2 1 0)"},
+		{"(let loop (i 0) (if (< i 3) (recur (+ i 1)) i))", "3"},
+		{"(let loop (i 0) (set! a i) (if (< i 3) (recur (+ i 1)) (* a 2)))", "6"},
+		{"(let loop ())", "nil"},
+		{"(let outer (i 0) (if (< i 2) (let inner (j 0) (if (< j 2) (recur (+ j 1)) (outer (+ i 1)))) i))", "2"},
+		{"(let (a 1) a)", "ERROR{(let ..) expects a name for the loop, use (let* ..) for local variables, got [a 1]}"},
+		{"(let loop a)", "ERROR{argument is not a list, got a}"},
+		{"(let loop (a))", "ERROR{list for (let ..) must have even length, got [a]}"},
+		{"(let loop (1 2))", "ERROR{binding name is not a symbol, got 1}"},
+		{"(let loop (a (/ 1 0)))", "ERROR{attempted division by zero}"},
+
 		// quoting options
 		// quasiquote
 		{"`1", "1"},
@@ -408,6 +954,13 @@ a
 		{"(alias foo print)", "nil"},
 		{"(alias foo bar print)", "ERROR{(alias ..) must have an even length of arguments, got [foo bar print]}"},
 
+		{"(with-env)", primitive.ArityError().ToString()},
+		{"(with-env 3)", "ERROR{(with-env ..) expects a hash of variables, got 3}"},
+		{`(with-env (error "no variables") 3)`, "ERROR{no variables}"},
+		{`(with-env {:A (error "no value")} 3)`, "ERROR{no value}"},
+		{`(with-env {"" "empty"} 3)`, "ERROR{environment variable name must not be empty}"},
+		{`(with-env {: "empty"} 3)`, "ERROR{environment variable name must not be empty}"},
+
 		// try / catch
 		{"(try 3)", primitive.ArityError().ToString()},
 		{"(try 3 3)", "ERROR{expected a list for argument, got 3}"},
@@ -423,7 +976,7 @@ a
 		{input: "(define blah (lambda (a:any) (print a))) (blah '(3))", output: "(3)"},
 
 		// fuzz errors
-		{input: "(defmacro! unless(fn*()`(~!)))(unless )", output: "ERROR{argument '(lambda (x) (if x #f #t))' not a function}"},
+		{input: "(defmacro! unless(fn*()`(~!)))(unless )", output: primitive.ArityError().ToString()},
 		{input: "(ord 0)", output: "ERROR{argument not a character/string, got number}"},
 	}
 
@@ -582,6 +1135,80 @@ func TestStandardLibrary(t *testing.T) {
 	}
 }
 
+// TestTailCalls ensures that recursion in tail position runs in constant
+// space, so it isn't stopped by our recursion limit.
+func TestTailCalls(t *testing.T) {
+
+	type TC struct {
+		input  string
+		output string
+	}
+
+	tests := []TC{
+
+		// if - true, and false, branches
+		{input: "(set! f (fn* (n) (if (> n 0) (f (- n 1)) :done))) (f 1000000)", output: ":done"},
+		{input: "(set! c 0) (set! f (fn* (n) (if (zero? n) c (set! c (+ c 1)) (f (- n 1))))) (f 1000000)", output: "1000000"},
+
+		// do
+		{input: "(set! f (fn* (n) (do (set! c n) (if (zero? n) :done (do (f (- n 1))))))) (f 1000000)", output: ":done"},
+
+		// let*
+		{input: "(set! f (fn* (n acc) (let* (m (- n 1)) (if (< m 0) acc (f m (+ acc 1)))))) (f 1000000 0)", output: "1000000"},
+
+		// try - the catch-clause
+		{input: `(set! f (fn* (n) (if (zero? n) :done (try (error "x") (catch e (f (- n 1))))))) (f 1000000)`, output: ":done"},
+
+		// cond, which expands to if, is slower so we use fewer iterations
+		// which still exceed our recursion limit.
+		{input: "(set! f (fn* (n) (cond (zero? n) :done true (f (- n 1))))) (f 10000)", output: ":done"},
+
+		// loops
+		{input: "(set! c 0) (dotimes (i 1000000) (set! c (+ c i))) c", output: "499999500000"},
+		{input: "(let loop (i 0) (if (< i 1000000) (recur (+ i 1)) i))", output: "1000000"},
+		{input: "(set! f (fn* (n) (match-case n (0 :done) (_ (f (- n 1)))))) (f 1000000)", output: ":done"},
+		{input: "(set! f (fn* (n) (if (zero? n) (values :done n) (f (- n 1))))) (receive (a b) (f 1000000) (list a b))", output: "(:done 0)"},
+
+		// the standard library
+		{input: "(set! c 0) (while (< c 1000000) (set! c (+ c 1))) c", output: "1000000"},
+		{input: "(car (lazy-filter (iterate inc 0) (fn* (x) (> x 100000))))", output: "100001"},
+		{input: "(nth (generator (let loop (i 0) (do (yield i) (loop (+ i 1))))) 100000)", output: "100000"},
+		{input: "(set! c 0) (repeat 1000000 (lambda (n) (set! c (+ c n)))) c", output: "500000500000"},
+		{input: "(set! c 0) (loop x (seq 10000) (set! c (+ c x))) c", output: "50005000"},
+		{input: "(car (reverse (range 1 10000 1)))", output: "10000"},
+		{input: "(last (nat 10000))", output: "10000"},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.input, func(t *testing.T) {
+
+			// Load our standard library
+			st := stdlib.Contents()
+			std := string(st)
+
+			// Create a new interpreter
+			l := New(std + "\n" + test.input)
+
+			// With a new environment
+			env := env.New()
+
+			// Populate the default primitives
+			builtins.PopulateEnvironment(env)
+
+			// Environment will have a config
+			env.SetIOConfig(config.DefaultIO())
+
+			// Run it
+			out := l.Evaluate(env)
+
+			if out.ToString() != test.output {
+				t.Fatalf("test '%s' should have produced '%s', but got '%s'", test.input, test.output, out.ToString())
+			}
+		})
+	}
+}
+
 func TestStartsWith(t *testing.T) {
 	l := primitive.List{}
 
@@ -666,7 +1293,10 @@ func TestTimeout(t *testing.T) {
 	// Environment will have a config
 	ev.SetIOConfig(config.DefaultIO())
 
-	// Add a new function
+	// Populate the default primitives
+	builtins.PopulateEnvironment(ev)
+
+	// Replace the builtin sleep with one which ignores the context
 	ev.Set("sleep",
 		&primitive.Procedure{
 			Help: "sleep delays for two seconds",
@@ -676,9 +1306,6 @@ func TestTimeout(t *testing.T) {
 				return primitive.Nil{}
 			}})
 
-	// Populate the default primitives
-	builtins.PopulateEnvironment(ev)
-
 	// Run it
 	out := l.Evaluate(ev)
 
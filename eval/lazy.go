@@ -0,0 +1,188 @@
+// lazy.go - delayed evaluation, lazy sequences, and generators.
+//
+// (delay ..) and (lazy-seq ..) capture their body, to be evaluated when
+// the value is first needed.
+//
+// (generator ..) runs its body as a coroutine, which produces the items
+// of a lazy sequence by calling (yield ..), and is suspended until the
+// next item is needed.  A generator which is never run to completion is
+// stopped once its sequence can no longer be reached, the next time a
+// generator is created, so that its goroutine exits.
+
+package eval
+
+import (
+	"iter"
+	"runtime"
+	"sync"
+
+	"github.com/skx/yal/env"
+	"github.com/skx/yal/primitive"
+)
+
+// generator records the state of a (generator ..), whose body runs as
+// a coroutine.
+type generator struct {
+
+	// loop, running, and recurse hold the state of the evaluator
+	// for the body of the generator, while it is suspended.
+	loop    *env.Environment
+	running *loopFrame
+	recurse int
+}
+
+// generatorRef is referenced by the part of a generator's sequence which
+// has not yet been computed, so that it is only collected once that part
+// can no longer be reached.
+type generatorRef struct {
+	next func() (primitive.Primitive, bool)
+	stop func()
+}
+
+// abandoned holds the functions which stop the bodies of generators
+// which can no longer be reached, until the interpreter calls them.
+type abandoned struct {
+	mu    sync.Mutex
+	stops []func()
+}
+
+// add records that the generator with the given stop function can no
+// longer be reached, it is called on the goroutine which runs finalizers.
+func (a *abandoned) add(stop func()) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.stops = append(a.stops, stop)
+}
+
+// take removes, and returns, the functions which have been recorded.
+func (a *abandoned) take() []func() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	stops := a.stops
+	a.stops = nil
+	return stops
+}
+
+// stopAbandoned stops the bodies of any generators which can no longer be
+// reached.  A body runs lisp as it is stopped, so this must be called by
+// the interpreter rather than when the generator is collected.
+func (ev *Eval) stopAbandoned() {
+
+	stops := ev.abandoned.take()
+	if len(stops) == 0 {
+		return
+	}
+
+	loop, loops, recurse, running := ev.loop, ev.running, ev.recurse, ev.gen
+	defer func() {
+		ev.loop, ev.running, ev.recurse, ev.gen = loop, loops, recurse, running
+	}()
+
+	for _, stop := range stops {
+		stop()
+	}
+}
+
+// thunk returns a function which evaluates the body in the specified
+// environment, returning the value of the last form, or the first error.
+func (ev *Eval) thunk(body []primitive.Primitive, e *env.Environment, expandMacro bool) func() primitive.Primitive {
+
+	return func() primitive.Primitive {
+
+		// The body cannot (break) out of a loop which happens
+		// to be running when the value is needed.
+		loop, running := ev.loop, ev.running
+		ev.loop, ev.running = nil, nil
+		defer func() {
+			ev.loop, ev.running = loop, running
+		}()
+
+		var ret primitive.Primitive
+		ret = primitive.Nil{}
+		for _, x := range body {
+			ret = ev.eval(x, e, expandMacro)
+			if _, ok := ret.(primitive.Error); ok {
+				return ret
+			}
+		}
+		return ret
+	}
+}
+
+// generate returns a lazy sequence of the values which the body passes
+// to (yield ..), evaluating it only as far as is needed.
+func (ev *Eval) generate(body []primitive.Primitive, e *env.Environment, expandMacro bool) *primitive.LazySeq {
+
+	ev.stopAbandoned()
+
+	gen := &generator{}
+	scope := env.NewEnvironment(e)
+
+	// failed holds any error returned by the body.
+	var failed primitive.Primitive
+
+	push := func(yield func(primitive.Primitive) bool) {
+
+		scope.Set("yield", &primitive.Procedure{
+			Help: "Produce the next item of the generator, suspending it until the item after that is needed.",
+			Args: []primitive.Symbol{primitive.Symbol("value")},
+			F: func(_ *env.Environment, args []primitive.Primitive) primitive.Primitive {
+				if len(args) != 1 {
+					return primitive.ArityError()
+				}
+				if ev.gen != gen {
+					return primitive.Error("(yield ..) was called outside of the body of its generator")
+				}
+
+				// Remember our state while we're suspended.
+				gen.loop, gen.running, gen.recurse = ev.loop, ev.running, ev.recurse
+				if !yield(args[0]) {
+					return primitive.Error("the generator was stopped")
+				}
+				ev.loop, ev.running, ev.recurse, ev.gen = gen.loop, gen.running, gen.recurse, gen
+				return primitive.Nil{}
+			},
+		})
+
+		ev.gen = gen
+		if ret, ok := ev.thunk(body, scope, expandMacro)().(primitive.Error); ok {
+			failed = ret
+		}
+	}
+
+	next, stop := iter.Pull(iter.Seq[primitive.Primitive](push))
+
+	// The body is stopped once the sequence has been read to its
+	// end, or once the rest of it can no longer be reached.
+	ref := &generatorRef{next: next, stop: stop}
+	runtime.SetFinalizer(ref, func(r *generatorRef) {
+		ev.abandoned.add(r.stop)
+	})
+
+	var step func() primitive.Primitive
+	step = func() primitive.Primitive {
+
+		// Restore our state when the generator is suspended, or
+		// unwinds because of a continuation.
+		loop, loops, recurse, running := ev.loop, ev.running, ev.recurse, ev.gen
+		defer func() {
+			ev.loop, ev.running, ev.recurse, ev.gen = loop, loops, recurse, running
+		}()
+
+		val, ok := ref.next()
+		if !ok {
+			runtime.SetFinalizer(ref, nil)
+			ref.stop()
+
+			if failed != nil {
+				return failed
+			}
+			return primitive.Nil{}
+		}
+		return primitive.LazyCons(val, primitive.NewLazySeq(step))
+	}
+
+	return primitive.NewLazySeq(step)
+}
@@ -0,0 +1,156 @@
+// match.go - structural pattern-matching, for (match-case ..).
+//
+// The patterns which may be used are:
+//
+//   _                  - matches anything.
+//   name               - matches anything, binding it to "name".
+//   name:number        - matches a value of the given type(s), binding it.
+//   3, "str", :kw, nil - matches an identical literal value.
+//   'anything          - matches the quoted value literally.
+//   (a b &rest)        - matches a list, with nested patterns.
+//   {:key pattern}     - matches a hash which has the given keys.
+//   (person n a)       - matches an instance of the struct "person".
+
+package eval
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/skx/yal/env"
+	"github.com/skx/yal/primitive"
+)
+
+// matchPattern tests whether the value matches the given pattern, setting
+// any variables the pattern binds in the specified environment.
+//
+// An error is returned only for a pattern which is invalid.
+func (ev *Eval) matchPattern(pattern primitive.Primitive, value primitive.Primitive, e *env.Environment) (bool, error) {
+
+	switch p := pattern.(type) {
+	case primitive.Symbol:
+		name := string(p)
+
+		// keywords are literals
+		if strings.HasPrefix(name, ":") {
+			return matchLiteral(p, value), nil
+		}
+		if strings.HasPrefix(name, "&") {
+			return false, fmt.Errorf("%s may only be used as the last item of a pattern", name)
+		}
+
+		// name:type only matches values of that type
+		if varName, types, found := strings.Cut(name, ":"); found {
+			if ev.typeCheck(types, value.Type()) != nil {
+				return false, nil
+			}
+			name = varName
+		}
+		if name != "_" {
+			e.Set(name, value)
+		}
+		return true, nil
+
+	case primitive.List:
+		// 'x matches x literally
+		if len(p) == 2 && ev.startsWith(p, "quote") {
+			return matchLiteral(p[1], value), nil
+		}
+
+		// (name field..) matches an instance of a struct
+		if len(p) > 0 {
+			if fields, ok := ev.structs[p[0].ToString()]; ok {
+				return ev.matchStruct(p, fields, value, e)
+			}
+		}
+		return ev.matchList(p, value, e)
+
+	case primitive.Hash:
+		hsh, ok := value.(primitive.Hash)
+		if !ok {
+			return false, nil
+		}
+		for key, pat := range p.Entries {
+			val, found := hsh.Entries[key]
+			if !found {
+				return false, nil
+			}
+			ok, err := ev.matchPattern(pat, val, e)
+			if !ok || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+
+	// Anything else is a literal: a number, string, character, etc.
+	return matchLiteral(pattern, value), nil
+}
+
+// matchList matches a list against a list pattern, which may end with
+// "&name" to match any remaining items.
+func (ev *Eval) matchList(pattern primitive.List, value primitive.Primitive, e *env.Environment) (bool, error) {
+
+	var items primitive.List
+	if !primitive.IsNil(value) {
+		lst, ok := value.(primitive.List)
+		if !ok {
+			return false, nil
+		}
+		items = lst
+	}
+
+	for i, x := range pattern {
+
+		// &rest takes the remaining items, if any
+		if sym, ok := x.(primitive.Symbol); ok && strings.HasPrefix(string(sym), "&") {
+			if i != len(pattern)-1 || len(sym) == 1 {
+				return false, fmt.Errorf("%s may only be used as the last item of a pattern, got %s", sym, patternString(pattern))
+			}
+			var rest primitive.Primitive
+			rest = primitive.Nil{}
+			if i < len(items) {
+				rest = items[i:]
+			}
+			e.Set(strings.TrimPrefix(string(sym), "&"), rest)
+			return true, nil
+		}
+
+		if i >= len(items) {
+			return false, nil
+		}
+		ok, err := ev.matchPattern(x, items[i], e)
+		if !ok || err != nil {
+			return false, err
+		}
+	}
+	return len(items) == len(pattern), nil
+}
+
+// matchStruct matches an instance of a struct against a pattern for each
+// of its fields, in the order they were defined.
+func (ev *Eval) matchStruct(pattern primitive.List, fields []string, value primitive.Primitive, e *env.Environment) (bool, error) {
+
+	name := pattern[0].ToString()
+	if len(pattern)-1 != len(fields) {
+		return false, fmt.Errorf("pattern %s expects %d fields for the struct %s, got %d", patternString(pattern), len(fields), name, len(pattern)-1)
+	}
+
+	hsh, ok := value.(primitive.Hash)
+	if !ok || hsh.GetStruct() != name {
+		return false, nil
+	}
+	for i, field := range fields {
+		ok, err := ev.matchPattern(pattern[i+1], hsh.Get(field), e)
+		if !ok || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// matchLiteral returns true if the value is identical to the literal,
+// as with (eq ..).
+func matchLiteral(literal primitive.Primitive, value primitive.Primitive) bool {
+	return literal.Type() == value.Type() && literal.ToString() == value.ToString()
+}
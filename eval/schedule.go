@@ -0,0 +1,82 @@
+// schedule.go - running lisp on more than one goroutine.
+//
+// The evaluator is not safe to use concurrently, so goroutines take turns
+// to run lisp: the goroutine which holds the turn runs until it blocks,
+// in a primitive which yields, or returns.
+//
+// Until (Go) is first called there is only one goroutine running lisp,
+// so there is nothing to lock.
+
+package eval
+
+import (
+	"sync"
+
+	"github.com/skx/yal/env"
+)
+
+// turn holds the state of the evaluator which belongs to the goroutine
+// running lisp, while it waits for its next turn.
+type turn struct {
+	loop    *env.Environment
+	running *loopFrame
+	recurse int
+	gen     *generator
+}
+
+// scheduler records which goroutine may run lisp.
+type scheduler struct {
+
+	// running is held by the goroutine which is running lisp.
+	running sync.Mutex
+
+	// shared is set once lisp may run on more than one goroutine.
+	shared bool
+}
+
+// Go calls the given function on a new goroutine, once the caller, or
+// another goroutine, yields to it.
+func (ev *Eval) Go(fn func()) {
+
+	// The caller is running lisp, so it holds the turn.
+	if !ev.sched.shared {
+		ev.sched.shared = true
+		ev.sched.running.Lock()
+	}
+
+	go func() {
+		ev.sched.running.Lock()
+		defer ev.sched.running.Unlock()
+
+		ev.loop, ev.running, ev.recurse, ev.gen = nil, nil, 0, nil
+
+		// A continuation cannot unwind to a call on another
+		// goroutine, so the function simply stops.
+		defer func() {
+			if r := recover(); r != nil {
+				if _, ok := r.(escapeSignal); !ok {
+					panic(r)
+				}
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// Yield allows another goroutine to run lisp, returning the function
+// which waits for our next turn.
+func (ev *Eval) Yield() func() {
+
+	if !ev.sched.shared {
+		return func() {}
+	}
+
+	state := turn{loop: ev.loop, running: ev.running, recurse: ev.recurse, gen: ev.gen}
+	ev.sched.running.Unlock()
+
+	return func() {
+		ev.sched.running.Lock()
+		ev.loop, ev.running, ev.recurse, ev.gen = state.loop, state.running, state.recurse, state.gen
+	}
+}
@@ -5,6 +5,7 @@ package eval
 import (
 	"bufio"
 	"fmt"
+	"iter"
 	"os"
 	"os/exec"
 	"sort"
@@ -14,13 +15,40 @@ import (
 	"github.com/skx/yal/primitive"
 )
 
+// tailCall is returned by the special forms which finish by evaluating
+// an expression, such as the chosen branch of (if ..) or the last form
+// of (do ..).
+//
+// Rather than evaluating that expression recursively eval continues its
+// main loop with it, so that recursive loops run in constant space.
+type tailCall struct {
+	exp primitive.Primitive
+	env *env.Environment
+}
+
+// IsSimpleType is part of the primitive.Primitive interface.
+func (t *tailCall) IsSimpleType() bool {
+	return false
+}
+
+// ToString is part of the primitive.Primitive interface.
+func (t *tailCall) ToString() string {
+	return t.exp.ToString()
+}
+
+// Type is part of the primitive.Primitive interface.
+func (t *tailCall) Type() string {
+	return "tail-call"
+}
+
 // evalSpecialForm is invoked to execute one of our special forms.
 //
 // This is done to centralize the code, and also ensure that eval doesn't
 // get too dense.
 //
 // The return value from this function is "XX, BOOL".  If the boolean result
-// is true this function handled the call, otherwise it did not.
+// is true this function handled the call, otherwise it did not.  The result
+// may be a *tailCall, which the caller must evaluate.
 //
 // This is required because special forms take precedence over other calls.
 func (ev *Eval) evalSpecialForm(name string, args []primitive.Primitive, e *env.Environment, expandMacro bool) (primitive.Primitive, bool) {
@@ -113,6 +141,42 @@ func (ev *Eval) evalSpecialForm(name string, args []primitive.Primitive, e *env.
 		}
 		return primitive.Nil{}, true
 
+	case "break":
+		// We accept an optional value for the loop to return
+		if len(args) > 1 {
+			return primitive.ArityError(), true
+		}
+		if !ev.inLoop() {
+			return primitive.Error("(break) used outside of a loop"), true
+		}
+
+		var val primitive.Primitive
+		val = primitive.Nil{}
+
+		if len(args) == 1 {
+			val = ev.eval(args[0], e, expandMacro)
+
+			// Was that an error?
+			er, eok := val.(primitive.Error)
+			if eok {
+				return er, true
+			}
+		}
+
+		// Unwind to the loop
+		panic(loopSignal{loop: ev.loop, brk: true, value: val})
+
+	case "continue":
+		if len(args) != 0 {
+			return primitive.ArityError(), true
+		}
+		if !ev.inLoop() {
+			return primitive.Error("(continue) used outside of a loop"), true
+		}
+
+		// Unwind to the loop
+		panic(loopSignal{loop: ev.loop, brk: false, value: primitive.Nil{}})
+
 	case "define", "def!":
 		if len(args) < 2 {
 			return primitive.ArityError(), true
@@ -132,6 +196,55 @@ func (ev *Eval) evalSpecialForm(name string, args []primitive.Primitive, e *env.
 		}
 		return primitive.Error(fmt.Sprintf("Expected a symbol, got %v", args[0])), true
 
+	case "define-syntax":
+		// (define-syntax name [docstring] (syntax-rules ..))
+		if len(args) < 2 || len(args) > 3 {
+			return primitive.ArityError(), true
+		}
+
+		symb, ok := args[0].(primitive.Symbol)
+		if !ok {
+			return primitive.Error(fmt.Sprintf("Expected a symbol, got %v", args[0])), true
+		}
+
+		help := ""
+		if len(args) == 3 {
+			doc, ok := args[1].(primitive.String)
+			if !ok {
+				return primitive.Error(fmt.Sprintf("(define-syntax ..) expects a docstring, got %v", args[1])), true
+			}
+			help = string(doc)
+		}
+
+		// (syntax-rules ..) is given the name of the macro
+		var val primitive.Primitive
+		body := args[len(args)-1]
+		if lst, ok := body.(primitive.List); ok && len(lst) > 0 && lst[0] == primitive.Symbol("syntax-rules") {
+			val = ev.syntaxRules(string(symb), lst[1:], e)
+		} else {
+			val = ev.eval(body, e, expandMacro)
+		}
+		if er, eok := val.(primitive.Error); eok {
+			return er, true
+		}
+
+		mac, ok := val.(*primitive.Procedure)
+		if !ok || !mac.Macro {
+			return primitive.Error(fmt.Sprintf("(define-syntax ..) expects a macro, such as (syntax-rules ..), got %s", val.ToString())), true
+		}
+		if help != "" {
+			mac.Help = help
+		}
+
+		// If we're loading our standard library save the macro
+		if ev.loadingStdlib {
+			ev.stdlib = append(ev.stdlib, symb.ToString())
+			sort.Strings(ev.stdlib)
+		}
+
+		e.Set(string(symb), mac)
+		return primitive.Nil{}, true
+
 	case "defmacro!":
 		if len(args) < 2 {
 			return primitive.ArityError(), true
@@ -165,15 +278,69 @@ func (ev *Eval) evalSpecialForm(name string, args []primitive.Primitive, e *env.
 		return primitive.Nil{}, true
 
 	case "do":
-		var ret primitive.Primitive
-
 		// default return value is nil
-		ret = primitive.Nil{}
+		if len(args) == 0 {
+			return primitive.Nil{}, true
+		}
 
-		for _, x := range args {
-			ret = ev.eval(x, e, expandMacro)
+		for _, x := range args[:len(args)-1] {
+			_ = ev.eval(x, e, expandMacro)
+		}
+
+		// The last form is in tail position
+		return &tailCall{exp: args[len(args)-1], env: e}, true
+
+	case "dolist":
+		// (dolist (var list [result]) body..)
+		if len(args) < 1 {
+			return primitive.ArityError(), true
+		}
+
+		pattern, spec, err := loopVars(name, args[0])
+		if err != nil {
+			return primitive.Error(err.Error()), true
+		}
+		if len(spec) != 1 && len(spec) != 2 {
+			return primitive.Error(fmt.Sprintf("(dolist ..) expects (var list [result]), got %v", args[0])), true
+		}
+
+		lst := ev.eval(spec[0], e, expandMacro)
+		if er, eok := lst.(primitive.Error); eok {
+			return er, true
+		}
+		if _, ok := lst.(primitive.List); !ok && !primitive.IsNil(lst) {
+			return primitive.Error(fmt.Sprintf("(dolist ..) expects a list, got %v", lst)), true
+		}
+
+		values, err := loopValues(name, lst, false)
+		if err != nil {
+			return primitive.Error(err.Error()), true
+		}
+		return ev.runLoop(values, pattern, spec[1:], args[1:], e, expandMacro), true
+
+	case "dotimes":
+		// (dotimes (var count [result]) body..)
+		if len(args) < 1 {
+			return primitive.ArityError(), true
 		}
-		return ret, true
+
+		pattern, spec, err := loopVars(name, args[0])
+		if err != nil {
+			return primitive.Error(err.Error()), true
+		}
+		if len(spec) != 1 && len(spec) != 2 {
+			return primitive.Error(fmt.Sprintf("(dotimes ..) expects (var count [result]), got %v", args[0])), true
+		}
+
+		count := ev.eval(spec[0], e, expandMacro)
+		n, ok := count.(primitive.Number)
+		if !ok {
+			if er, eok := count.(primitive.Error); eok {
+				return er, true
+			}
+			return primitive.Error(fmt.Sprintf("(dotimes ..) expects a number for the count, got %v", count)), true
+		}
+		return ev.runLoop(loopRange(0, n-1, 1), pattern, spec[1:], args[1:], e, expandMacro), true
 
 	case "eval":
 		if len(args) != 1 {
@@ -190,6 +357,7 @@ func (ev *Eval) evalSpecialForm(name string, args []primitive.Primitive, e *env.
 			// Create a new evaluator with
 			// the result as a string
 			tmp := New(res.ToString())
+			tmp.context = ev.context
 
 			// Ensure that we have a suitable
 			// child-environment.
@@ -203,6 +371,7 @@ func (ev *Eval) evalSpecialForm(name string, args []primitive.Primitive, e *env.
 			str, ok := e.Get(val.ToString())
 			if ok {
 				tmp := New(str.(primitive.Primitive).ToString())
+				tmp.context = ev.context
 				nEnv := env.NewEnvironment(e)
 				return tmp.Evaluate(nEnv), true
 			}
@@ -211,6 +380,7 @@ func (ev *Eval) evalSpecialForm(name string, args []primitive.Primitive, e *env.
 		// string eval
 		case primitive.String:
 			tmp := New(string(val))
+			tmp.context = ev.context
 			nEnv := env.NewEnvironment(e)
 			return tmp.Evaluate(nEnv), true
 
@@ -234,6 +404,62 @@ func (ev *Eval) evalSpecialForm(name string, args []primitive.Primitive, e *env.
 		// not reached
 		return nil, true
 
+	case "for":
+		// (for (var start end [step]) body..)
+		// (for (var collection) body..)
+		// (for ((key val) hash) body..)
+		if len(args) < 1 {
+			return primitive.ArityError(), true
+		}
+
+		pattern, spec, err := loopVars(name, args[0])
+		if err != nil {
+			return primitive.Error(err.Error()), true
+		}
+		if len(spec) < 1 || len(spec) > 3 {
+			return primitive.Error(fmt.Sprintf("(for ..) expects (var collection) or (var start end [step]), got %v", args[0])), true
+		}
+
+		// Evaluate the collection, or the bounds
+		vals := []primitive.Primitive{}
+		for _, x := range spec {
+			val := ev.eval(x, e, expandMacro)
+			if er, eok := val.(primitive.Error); eok {
+				return er, true
+			}
+			vals = append(vals, val)
+		}
+
+		// Iterating over a collection
+		if len(vals) == 1 {
+			// A hash gives its keys, unless they are to be
+			// destructured with their values: ((k v) hash)
+			_, keys := pattern.(primitive.Symbol)
+			values, err := loopValues(name, vals[0], !keys)
+			if err != nil {
+				return primitive.Error(err.Error()), true
+			}
+			return ev.runLoop(values, pattern, nil, args[1:], e, expandMacro), true
+		}
+
+		// Otherwise over numbers, inclusive of the end, as with (range ..)
+		if _, ok := pattern.(primitive.Symbol); !ok {
+			return primitive.Error(fmt.Sprintf("(for ..) expects a single variable for a range, got %v", args[0])), true
+		}
+
+		nums := []primitive.Number{0, 0, 1}
+		for i, x := range vals {
+			n, ok := x.(primitive.Number)
+			if !ok {
+				return primitive.Error(fmt.Sprintf("(for ..) expects numbers for a range, got %v", x)), true
+			}
+			nums[i] = n
+		}
+		if nums[2] == 0 {
+			return primitive.Error("(for ..) expects a non-zero step"), true
+		}
+		return ev.runLoop(loopRange(nums[0], nums[1], nums[2]), pattern, nil, args[1:], e, expandMacro), true
+
 	case "forever":
 
 		// We run the body forever.
@@ -269,20 +495,14 @@ func (ev *Eval) evalSpecialForm(name string, args []primitive.Primitive, e *env.
 		//
 		if b, ok := test.(primitive.Bool); (ok && !bool(b)) || primitive.IsNil(test) {
 
-			// default return value
-			var ret primitive.Primitive
-
-			// default return value is nil
-			ret = primitive.Nil{}
-
 			// No else clause(s) ?  Return the nil
 			if len(args) < 3 {
-				return ret, true
+				return primitive.Nil{}, true
 			}
 
 			// Otherwise execute all the false statements.
-			for _, x := range args[2:] {
-				ret = ev.eval(x, e, expandMacro)
+			for _, x := range args[2 : len(args)-1] {
+				ret := ev.eval(x, e, expandMacro)
 
 				// error?
 				er, eok := ret.(primitive.Error)
@@ -291,12 +511,12 @@ func (ev *Eval) evalSpecialForm(name string, args []primitive.Primitive, e *env.
 				}
 			}
 
-			// all done
-			return ret, true
+			// The last of which is in tail position
+			return &tailCall{exp: args[len(args)-1], env: e}, true
 		}
 
 		// otherwise we handle the true-section.
-		return ev.eval(args[1], e, expandMacro), true
+		return &tailCall{exp: args[1], env: e}, true
 
 	case "lambda", "fn*":
 		// ensure we have arguments
@@ -312,17 +532,73 @@ func (ev *Eval) evalSpecialForm(name string, args []primitive.Primitive, e *env.
 
 		proc := &primitive.Procedure{
 			Defaults: make(map[primitive.Symbol]primitive.Primitive),
+			Optional: make(map[primitive.Symbol]bool),
+			Supplied: make(map[primitive.Symbol]primitive.Symbol),
+			Loop:     ev.loop,
 		}
 
 		// Collect arguments
+		//
+		// Those given after &optional, or &key, may have a default and
+		// a variable recording whether they were supplied.
 		arguments := []primitive.Symbol{}
+		section := ""
+		rest := false
 		for _, x := range argMarkers {
 
+			// The start of the optional, or keyword, arguments?
+			if sym, ok := x.(primitive.Symbol); ok && (sym == "&optional" || sym == "&key") {
+				if section == "&key" {
+					return primitive.Error(fmt.Sprintf("%s may not follow &key", sym)), true
+				}
+				if sym == "&optional" && (section != "" || rest) {
+					return primitive.Error("&optional must come before any &rest argument"), true
+				}
+				section = string(sym)
+				continue
+			}
+
+			if section != "" {
+				xs, def, sup, err := optionalParam(proc, section, x)
+				if err != nil {
+					return primitive.Error(err.Error()), true
+				}
+				if section == "&key" {
+					proc.Keys = append(proc.Keys, xs)
+				} else {
+					arguments = append(arguments, xs)
+					proc.Optional[xs] = true
+				}
+				if def != nil {
+					proc.Defaults[xs] = def
+				}
+				if sup != "" {
+					proc.Supplied[xs] = sup
+				}
+				continue
+			}
+
+			if rest {
+				return primitive.Error(fmt.Sprintf("only &key arguments may follow the &rest argument, got %v", x)), true
+			}
+
+			// Destructuring patterns, with optional defaults
+			if pat, def := paramPattern(x); pat != nil {
+				if err := checkPattern(pat); err != nil {
+					return primitive.Error(err.Error()), true
+				}
+				xs := patternArg(proc, pat)
+				if def != nil {
+					proc.Defaults[xs] = def
+				}
+				arguments = append(arguments, xs)
+				continue
+			}
+
 			lst, ok1 := x.(primitive.List)
 			if ok1 {
 				// First term is the name
 				// Second term is the default
-				// TODO: More flexible
 				if len(lst) != 2 {
 					return primitive.Error(fmt.Sprintf("only two list items allowed for a default-value, got %d", len(lst))), true
 				}
@@ -342,6 +618,7 @@ func (ev *Eval) evalSpecialForm(name string, args []primitive.Primitive, e *env.
 					return primitive.Error(fmt.Sprintf("expected a symbol for an argument, got %v", x)), true
 				}
 				arguments = append(arguments, xs)
+				rest = strings.HasPrefix(string(xs), "&")
 			}
 		}
 
@@ -367,6 +644,92 @@ func (ev *Eval) evalSpecialForm(name string, args []primitive.Primitive, e *env.
 
 		return proc, true
 
+	case "let":
+		// (let name (var val ..) body..)
+		if len(args) < 2 {
+			return primitive.ArityError(), true
+		}
+
+		// The name is required, as this is a loop
+		loopName, ok := args[0].(primitive.Symbol)
+		if !ok {
+			return primitive.Error(fmt.Sprintf("(let ..) expects a name for the loop, use (let* ..) for local variables, got %v", args[0])), true
+		}
+
+		bindingsList, ok := args[1].(primitive.List)
+		if !ok {
+			return primitive.Error(fmt.Sprintf("argument is not a list, got %v", args[1])), true
+		}
+		if len(bindingsList)%2 != 0 {
+			return primitive.Error(fmt.Sprintf("list for (let ..) must have even length, got %v", bindingsList)), true
+		}
+
+		// The names of the variables, and their initial values
+		// which are evaluated in the current scope.
+		loopEnv := env.NewEnvironment(e)
+		proc := &primitive.Procedure{
+			Defaults: make(map[primitive.Symbol]primitive.Primitive),
+			Env:      loopEnv,
+			Loop:     ev.loop,
+		}
+
+		names := []primitive.Symbol{}
+		vals := []primitive.Primitive{}
+		for i := 0; i < len(bindingsList); i += 2 {
+
+			// The variable might be a pattern to destructure with
+			key, ok := bindingsList[i].(primitive.Symbol)
+			if !ok {
+				switch bindingsList[i].(type) {
+				case primitive.List, primitive.Hash:
+					if err := checkPattern(bindingsList[i]); err != nil {
+						return primitive.Error(err.Error()), true
+					}
+					key = patternArg(proc, bindingsList[i])
+				default:
+					return primitive.Error(fmt.Sprintf("binding name is not a symbol, got %v", bindingsList[i])), true
+				}
+			}
+
+			val := ev.eval(bindingsList[i+1], e, expandMacro)
+			if er, eok := val.(primitive.Error); eok {
+				return er, true
+			}
+
+			names = append(names, key)
+			vals = append(vals, val)
+		}
+
+		// The body is a function, which may be called by name, or
+		// via (recur ..), to go round the loop again.
+		//
+		// Doing so in tail position runs in constant space.
+		var body primitive.Primitive
+		body = primitive.Nil{}
+		if len(args) == 3 {
+			body = args[2]
+		} else if len(args) > 3 {
+			body = append(primitive.List{primitive.Symbol("do")}, args[2:]...)
+		}
+
+		proc.Args = names
+		proc.Body = body
+		loopEnv.Set(string(loopName), proc)
+		loopEnv.Set("recur", proc)
+
+		// Now run the first iteration
+		callEnv := env.NewEnvironment(loopEnv)
+		for i, x := range names {
+			pat, ok := proc.Patterns[x]
+			if !ok {
+				pat = x
+			}
+			if err := ev.bindPattern(pat, vals[i], callEnv, expandMacro); err != nil {
+				return primitive.Error(err.Error()), true
+			}
+		}
+		return &tailCall{exp: body, env: callEnv}, true
+
 	case "let*":
 		// We need to have at least one argument.
 		//
@@ -401,29 +764,40 @@ func (ev *Eval) evalSpecialForm(name string, args []primitive.Primitive, e *env.
 				return er, true
 			}
 
-			// The thing to set
-			eKey, ok := key.(primitive.Symbol)
-			if !ok {
+			// The thing to set, which might be a pattern to
+			// destructure the value with.
+			switch key.(type) {
+			case primitive.Symbol, primitive.List, primitive.Hash:
+				if err := checkPattern(key); err != nil {
+					return primitive.Error(err.Error()), true
+				}
+			default:
 				return primitive.Error(fmt.Sprintf("binding name is not a symbol, got %v", key)), true
 			}
 
 			// Finally set the parameter
-			newEnv.Set(string(eKey), eVal)
+			if err := ev.bindPattern(key, eVal, newEnv, expandMacro); err != nil {
+				return primitive.Error(err.Error()), true
+			}
 		}
 
 		// Now we've populated the new
 		// environment with the pairs we received
 		// in the setup phase we can execute
 		// the body.
-		var ret primitive.Primitive
+		body := args[1:]
 
 		// default return value is nil
-		ret = primitive.Nil{}
+		if len(body) == 0 {
+			return primitive.Nil{}, true
+		}
 
-		for _, x := range args[1:] {
-			ret = ev.eval(x, newEnv, expandMacro)
+		for _, x := range body[:len(body)-1] {
+			_ = ev.eval(x, newEnv, expandMacro)
 		}
-		return ret, true
+
+		// The last form is in tail position
+		return &tailCall{exp: body[len(body)-1], env: newEnv}, true
 
 	case "macroexpand":
 		if len(args) != 1 {
@@ -431,6 +805,86 @@ func (ev *Eval) evalSpecialForm(name string, args []primitive.Primitive, e *env.
 		}
 		return ev.macroExpand(args[0], e), true
 
+	case "macroexpand-1":
+		if len(args) != 1 {
+			return primitive.ArityError(), true
+		}
+		if !ev.isMacro(args[0], e) {
+			return args[0], true
+		}
+		return ev.eval(args[0], e, false), true
+
+	case "macroexpand-all":
+		if len(args) != 1 {
+			return primitive.ArityError(), true
+		}
+		return ev.macroExpandAll(args[0], e), true
+
+	case "match-case":
+		// (match-case value (pattern [:when guard] body..) .. (else body..))
+		if len(args) < 1 {
+			return primitive.ArityError(), true
+		}
+
+		val := ev.eval(args[0], e, expandMacro)
+		if er, eok := val.(primitive.Error); eok {
+			return er, true
+		}
+
+		for i, x := range args[1:] {
+			clause, ok := x.(primitive.List)
+			if !ok || len(clause) < 1 {
+				return primitive.Error(fmt.Sprintf("(match-case ..) expects (pattern body..) for each clause, got %v", x)), true
+			}
+
+			// Each clause binds in its own scope
+			clauseEnv := env.NewEnvironment(e)
+			body := clause[1:]
+
+			if ev.startsWith(clause, "else") {
+				if i != len(args)-2 {
+					return primitive.Error("(match-case ..) expects the else clause to be the last"), true
+				}
+			} else {
+				match, err := ev.matchPattern(clause[0], val, clauseEnv)
+				if err != nil {
+					return primitive.Error(fmt.Sprintf("(match-case ..) %s", err)), true
+				}
+				if !match {
+					continue
+				}
+
+				// An optional guard must also be true
+				if len(body) > 0 && body[0] == primitive.Symbol(":when") {
+					if len(body) < 2 {
+						return primitive.Error(fmt.Sprintf("(match-case ..) expects an expression after :when, got %v", clause)), true
+					}
+					guard := ev.eval(body[1], clauseEnv, expandMacro)
+					if er, eok := guard.(primitive.Error); eok {
+						return er, true
+					}
+					if b, ok := guard.(primitive.Bool); (ok && !bool(b)) || primitive.IsNil(guard) {
+						continue
+					}
+					body = body[2:]
+				}
+			}
+
+			if len(body) == 0 {
+				return primitive.Nil{}, true
+			}
+			for _, x := range body[:len(body)-1] {
+				ret := ev.eval(x, clauseEnv, expandMacro)
+				if er, eok := ret.(primitive.Error); eok {
+					return er, true
+				}
+			}
+
+			// The last form is in tail position
+			return &tailCall{exp: body[len(body)-1], env: clauseEnv}, true
+		}
+
+		return primitive.Error(fmt.Sprintf("(match-case ..) no clause matched %s %s, and there is no else clause", val.Type(), patternString(val))), true
 	case "stdlib-end":
 		ev.loadingStdlib = false
 		return primitive.Nil{}, true
@@ -443,7 +897,7 @@ func (ev *Eval) evalSpecialForm(name string, args []primitive.Primitive, e *env.
 		if len(args) != 1 {
 			return primitive.ArityError(), true
 		}
-		return ev.eval(ev.quasiquote(args[0]), e, expandMacro), true
+		return &tailCall{exp: ev.quasiquote(args[0]), env: e}, true
 
 	case "quote":
 		if len(args) != 1 {
@@ -491,6 +945,93 @@ func (ev *Eval) evalSpecialForm(name string, args []primitive.Primitive, e *env.
 		// Return it.
 		return out, true
 
+	case "call/ec":
+		// (call/ec (fn* (k) ..))
+		if len(args) != 1 {
+			return primitive.ArityError(), true
+		}
+		val := ev.eval(args[0], e, expandMacro)
+		if er, eok := val.(primitive.Error); eok {
+			return er, true
+		}
+		proc, ok := val.(*primitive.Procedure)
+		if !ok {
+			return primitive.Error(fmt.Sprintf("(%s ..) expects a procedure, got %v", name, val)), true
+		}
+		return ev.callEC(name, proc, e), true
+
+	case "delay":
+		// (delay expr)
+		if len(args) != 1 {
+			return primitive.ArityError(), true
+		}
+		return primitive.NewPromise(ev.thunk(args, e, expandMacro)), true
+
+	case "lazy-seq":
+		// (lazy-seq body..)
+		return primitive.NewLazySeq(ev.thunk(args, e, expandMacro)), true
+
+	case "generator":
+		// (generator body..)
+		return ev.generate(args, e, expandMacro), true
+
+	case "dynamic-wind":
+		// (dynamic-wind before thunk after)
+		if len(args) != 3 {
+			return primitive.ArityError(), true
+		}
+		procs := []*primitive.Procedure{}
+		for _, x := range args {
+			val := ev.eval(x, e, expandMacro)
+			if er, eok := val.(primitive.Error); eok {
+				return er, true
+			}
+			proc, ok := val.(*primitive.Procedure)
+			if !ok {
+				return primitive.Error(fmt.Sprintf("(dynamic-wind ..) expects a procedure, got %v", val)), true
+			}
+			procs = append(procs, proc)
+		}
+		return ev.dynamicWind(procs[0], procs[1], procs[2], e), true
+
+	case "receive", "multiple-value-bind":
+		// (receive (a b &rest) expr body..)
+		if len(args) < 2 {
+			return primitive.ArityError(), true
+		}
+
+		vals := ev.evalValues(args[1], e, expandMacro)
+		if er, eok := vals.(primitive.Error); eok {
+			return er, true
+		}
+		values, ok := vals.(primitive.Values)
+		if !ok {
+			values = primitive.Values{vals}
+		}
+
+		newEnv := env.NewEnvironment(e)
+		if err := ev.bindValues(name, args[0], values, newEnv, expandMacro); err != nil {
+			return primitive.Error(err.Error()), true
+		}
+
+		body := args[2:]
+		if len(body) == 0 {
+			return primitive.Nil{}, true
+		}
+		for _, x := range body[:len(body)-1] {
+			ret := ev.eval(x, newEnv, expandMacro)
+			if er, eok := ret.(primitive.Error); eok {
+				return er, true
+			}
+		}
+
+		// The last form is in tail position
+		return &tailCall{exp: body[len(body)-1], env: newEnv}, true
+
+	case "syntax-rules":
+		// (syntax-rules [ellipsis] (literals..) (pattern template)..)
+		return ev.syntaxRules("", args, e), true
+
 	case "set!":
 		if len(args) < 2 {
 			return primitive.ArityError(), true
@@ -621,9 +1162,362 @@ func (ev *Eval) evalSpecialForm(name string, args []primitive.Primitive, e *env.
 		// The form to execute with that is blkLst[2]
 		tmpEnv := env.NewEnvironment(e)
 		tmpEnv.Set(blkLst[1].ToString(), primitive.String(out.ToString()))
-		return ev.eval(blkLst[2], tmpEnv, expandMacro), true
+		return &tailCall{exp: blkLst[2], env: tmpEnv}, true
+
+	case "with-env":
+		if len(args) < 1 {
+			return primitive.ArityError(), true
+		}
+
+		// first expression is the hash of variables to set
+		vars := ev.eval(args[0], e, expandMacro)
+		if er, eok := vars.(primitive.Error); eok {
+			return er, true
+		}
+		hsh, ok := vars.(primitive.Hash)
+		if !ok {
+			return primitive.Error(fmt.Sprintf("(with-env ..) expects a hash of variables, got %v", vars)), true
+		}
+
+		// The previous values of the variables we change, nil
+		// for those which were not set.
+		//
+		// These are restored when we're done, however we finish.
+		restore := make(map[string]*string)
+		defer func() {
+			for name, val := range restore {
+				if val == nil {
+					os.Unsetenv(name)
+				} else {
+					os.Setenv(name, *val)
+				}
+			}
+		}()
+
+		for key, val := range hsh.Entries {
+
+			// Variables may be named as ":NAME" or "NAME".
+			name := strings.TrimPrefix(key, ":")
+			if name == "" {
+				return primitive.Error("environment variable name must not be empty"), true
+			}
+
+			if _, seen := restore[name]; !seen {
+				restore[name] = nil
+				if old, found := os.LookupEnv(name); found {
+					restore[name] = &old
+				}
+			}
+
+			// A nil value unsets the variable
+			var err error
+			if primitive.IsNil(val) {
+				err = os.Unsetenv(name)
+			} else {
+				err = os.Setenv(name, val.ToString())
+			}
+			if err != nil {
+				return primitive.Error(fmt.Sprintf("failed to set environment variable %s: %s", name, err)), true
+			}
+		}
+
+		// Now evaluate the body, as with (do ..), stopping at
+		// the first error
+		var ret primitive.Primitive
+		ret = primitive.Nil{}
+		for _, x := range args[1:] {
+			ret = ev.eval(x, e, expandMacro)
+			if _, eok := ret.(primitive.Error); eok {
+				break
+			}
+		}
+		return ret, true
 	}
 
 	// The input was not handled as a special form.
 	return primitive.Nil{}, false
 }
+
+// loopSignal is used to implement (break ..) and (continue), which
+// panic with it to unwind to the loop which is running.
+//
+// A procedure body may only do so if the procedure was defined within
+// the loop, so loops cannot be stopped by the functions they call.
+type loopSignal struct {
+
+	// loop is the scope of the loop to stop.
+	loop *env.Environment
+
+	// brk is true for (break ..), and false for (continue).
+	brk bool
+
+	// value is the value given to (break ..).
+	value primitive.Primitive
+}
+
+// loopFrame records a running loop, which may be stopped, and the loops
+// running outside it.
+type loopFrame struct {
+	loop  *env.Environment
+	outer *loopFrame
+}
+
+// inLoop returns true if (break) and (continue) may stop the loop which
+// they're within.
+func (ev *Eval) inLoop() bool {
+	for f := ev.running; f != nil; f = f.outer {
+		if f.loop == ev.loop {
+			return true
+		}
+	}
+	return false
+}
+
+// loopVars parses the specification of a loop, such as "(x lst)",
+// returning the variable, or the pattern to destructure each value
+// with, and the remaining terms.
+func loopVars(name string, spec primitive.Primitive) (primitive.Primitive, primitive.List, error) {
+
+	lst, ok := spec.(primitive.List)
+	if !ok || len(lst) < 1 {
+		return nil, nil, fmt.Errorf("(%s ..) expects a list for the loop variable, got %v", name, spec)
+	}
+
+	switch lst[0].(type) {
+	case primitive.Symbol, primitive.List, primitive.Hash:
+		if err := checkPattern(lst[0]); err != nil {
+			return nil, nil, fmt.Errorf("(%s ..) %s", name, err)
+		}
+		return lst[0], lst[1:], nil
+	}
+	return nil, nil, fmt.Errorf("(%s ..) expects a symbol or pattern for the loop variable, got %v", name, lst[0])
+}
+
+// loopValues returns the values of the given collection to iterate over.
+//
+// For a hash this is the keys, in sorted order, or if pairs is true a
+// list of each key and its value.
+func loopValues(name string, val primitive.Primitive, pairs bool) (iter.Seq[primitive.Primitive], error) {
+
+	switch v := val.(type) {
+	case primitive.Nil:
+		return func(yield func(primitive.Primitive) bool) {}, nil
+
+	case primitive.Hash:
+		keys := []string{}
+		for k := range v.Entries {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		return func(yield func(primitive.Primitive) bool) {
+			for _, k := range keys {
+				var x primitive.Primitive
+				x = primitive.String(k)
+				if pairs {
+					x = primitive.List{x, v.Entries[k]}
+				}
+				if !yield(x) {
+					return
+				}
+			}
+		}, nil
+
+	case primitive.List, primitive.String:
+
+		// Strings are iterated over by character
+		items, ok := v.(primitive.List)
+		if !ok {
+			for _, c := range v.ToString() {
+				items = append(items, primitive.Character(string(c)))
+			}
+		}
+
+		return func(yield func(primitive.Primitive) bool) {
+			for _, x := range items {
+				if !yield(x) {
+					return
+				}
+			}
+		}, nil
+	}
+
+	return nil, fmt.Errorf("(%s ..) cannot iterate over %s %v", name, val.Type(), val)
+}
+
+// loopRange returns the numbers from start to end, inclusive, with the
+// given step.
+func loopRange(start, end, step primitive.Number) iter.Seq[primitive.Primitive] {
+
+	return func(yield func(primitive.Primitive) bool) {
+		for i := start; (step > 0 && i <= end) || (step < 0 && i >= end); i += step {
+			if !yield(i) {
+				return
+			}
+		}
+	}
+}
+
+// runLoop evaluates the body of a loop for each of the given values,
+// which are bound to the loop variable, or destructured with its pattern,
+// in a new scope.
+//
+// The result is that given to (break ..), an error from the body, or
+// that of the optional result form which is evaluated afterwards.
+func (ev *Eval) runLoop(values iter.Seq[primitive.Primitive], pattern primitive.Primitive, result []primitive.Primitive, body []primitive.Primitive, e *env.Environment, expandMacro bool) primitive.Primitive {
+
+	loopEnv := env.NewEnvironment(e)
+
+	for val := range values {
+		if err := ev.bindPattern(pattern, val, loopEnv, expandMacro); err != nil {
+			return primitive.Error(err.Error())
+		}
+
+		ret, stop := ev.loopBody(body, loopEnv, expandMacro)
+		if stop {
+			return ret
+		}
+	}
+
+	if len(result) == 1 {
+		return &tailCall{exp: result[0], env: loopEnv}
+	}
+	return primitive.Nil{}
+}
+
+// loopBody evaluates the body of a loop once.
+//
+// The result is that of the last expression, and stop is true if the loop
+// should stop, because of an error or (break ..).
+func (ev *Eval) loopBody(body []primitive.Primitive, e *env.Environment, expandMacro bool) (ret primitive.Primitive, stop bool) {
+
+	loop, running := ev.loop, ev.running
+	ev.loop = e
+	ev.running = &loopFrame{loop: e, outer: running}
+
+	defer func() {
+		ev.loop, ev.running = loop, running
+
+		r := recover()
+		if r == nil {
+			return
+		}
+		sig, ok := r.(loopSignal)
+		if !ok || sig.loop != e {
+			panic(r)
+		}
+		ret = sig.value
+		stop = sig.brk
+	}()
+
+	// A loop with an empty body must still be time-limited
+	select {
+	case <-ev.context.Done():
+		return primitive.Error(ErrTimeout.Error()), true
+	default:
+		// nop
+	}
+
+	ret = primitive.Nil{}
+	for _, x := range body {
+		ret = ev.eval(x, e, expandMacro)
+
+		// An error stops the loop
+		if _, ok := ret.(primitive.Error); ok {
+			return ret, true
+		}
+	}
+	return ret, false
+}
+
+// optionalParam parses a parameter given after &optional, or &key, which
+// is a name, or a list of the name, its default, and the name of the
+// variable recording whether it was supplied: (name default supplied-p)
+//
+// The name of an optional argument may be a destructuring pattern.
+func optionalParam(proc *primitive.Procedure, section string, param primitive.Primitive) (primitive.Symbol, primitive.Primitive, primitive.Symbol, error) {
+
+	name := param
+	var def primitive.Primitive
+	var sup primitive.Symbol
+
+	if lst, ok := param.(primitive.List); ok {
+		if len(lst) < 1 || len(lst) > 3 {
+			return "", nil, "", fmt.Errorf("%s expects a name, or (name default supplied-p), got %v", section, param)
+		}
+		name = lst[0]
+		if len(lst) > 1 {
+			def = lst[1]
+		}
+		if len(lst) > 2 {
+			s, ok := lst[2].(primitive.Symbol)
+			if !ok {
+				return "", nil, "", fmt.Errorf("%s expects a symbol to record whether %v was supplied, got %v", section, name, lst[2])
+			}
+			sup = s
+		}
+	}
+
+	switch n := name.(type) {
+	case primitive.Symbol:
+		if !strings.HasPrefix(string(n), "&") && !strings.HasPrefix(string(n), ":") {
+			return n, def, sup, nil
+		}
+	case primitive.List, primitive.Hash:
+		if section == "&optional" {
+			if err := checkPattern(n); err != nil {
+				return "", nil, "", err
+			}
+			return patternArg(proc, n), def, sup, nil
+		}
+	}
+	return "", nil, "", fmt.Errorf("%s expects a name, or (name default supplied-p), got %v", section, param)
+}
+
+// bindValues binds multiple values to the given variables, for (receive ..).
+//
+// A single symbol receives a list of all the values, otherwise each of a
+// list of variables, or patterns, receives one value.  Missing values are
+// nil, and any extra values are ignored unless the last variable is &rest.
+func (ev *Eval) bindValues(name string, vars primitive.Primitive, values primitive.Values, e *env.Environment, expandMacro bool) error {
+
+	if sym, ok := vars.(primitive.Symbol); ok {
+		var all primitive.Primitive
+		all = primitive.Nil{}
+		if len(values) > 0 {
+			all = primitive.List(values)
+		}
+		e.Set(string(sym), all)
+		return nil
+	}
+
+	lst, ok := vars.(primitive.List)
+	if !ok {
+		return fmt.Errorf("(%s ..) expects a list of variables, got %v", name, vars)
+	}
+	if err := checkPattern(lst); err != nil {
+		return fmt.Errorf("(%s ..) %s", name, err)
+	}
+
+	for i, x := range lst {
+		if sym, ok := x.(primitive.Symbol); ok && strings.HasPrefix(string(sym), "&") {
+			var rest primitive.Primitive
+			rest = primitive.Nil{}
+			if i < len(values) {
+				rest = primitive.List(values[i:])
+			}
+			e.Set(strings.TrimPrefix(string(sym), "&"), rest)
+			return nil
+		}
+
+		var val primitive.Primitive
+		val = primitive.Nil{}
+		if i < len(values) {
+			val = values[i]
+		}
+		if err := ev.bindPattern(x, val, e, expandMacro); err != nil {
+			return err
+		}
+	}
+	return nil
+}
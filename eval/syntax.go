@@ -0,0 +1,615 @@
+// syntax.go - pattern-based hygienic macros, via (syntax-rules ..).
+//
+//   (define-syntax swap!
+//     (syntax-rules ()
+//       ((_ a b) (let* (tmp a)
+//                  (set! a b true)
+//                  (set! b tmp true)))))
+//
+// Each rule is a pattern, which is matched against a use of the macro,
+// and a template which is expanded with each pattern variable replaced
+// by the form it matched.  In a pattern "x ..." matches zero or more
+// forms, and in a template it repeats "x" for each of them.
+//
+// Any symbol which the template binds, with let*, fn*, or one of the
+// other binding forms, is renamed each time the macro is expanded, so
+// that it cannot capture a variable of the same name used by the caller.
+// Other symbols in the template refer to the functions, and macros, which
+// were visible where the macro was defined, even if the caller has bound
+// the same names locally.
+
+package eval
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/skx/yal/env"
+	"github.com/skx/yal/primitive"
+)
+
+// syntaxRules holds the rules of a macro defined by (syntax-rules ..).
+type syntaxRules struct {
+
+	// name is the name of the macro, used in error messages.
+	name string
+
+	// ellipsis is the symbol which marks repetition, "..." by default.
+	ellipsis string
+
+	// literals are the symbols which match only themselves.
+	literals map[string]bool
+
+	// rules are tried in order, until one matches.
+	rules []syntaxRule
+}
+
+// syntaxRule is a single pattern, and the template it expands to.
+type syntaxRule struct {
+
+	// pattern is matched against the arguments of the macro, the
+	// keyword at the start of the pattern is ignored.
+	pattern primitive.List
+
+	// template is what the macro expands to.
+	template primitive.Primitive
+
+	// binders are the symbols the template binds, which are renamed
+	// on each expansion.
+	binders []string
+}
+
+// syntaxScope holds the environments a template is expanded between.
+type syntaxScope struct {
+
+	// def is the environment the macro was defined within.
+	def *env.Environment
+
+	// use is the environment the macro is being used within.
+	use *env.Environment
+}
+
+// resolve returns the procedure a free symbol of the template referred
+// to where the macro was defined, if the caller has bound the same name
+// to something else, otherwise the symbol itself.
+func (s *syntaxScope) resolve(sym primitive.Symbol) primitive.Primitive {
+
+	if s == nil || strings.HasPrefix(string(sym), ":") {
+		return sym
+	}
+	v, ok := s.def.Get(string(sym))
+	if !ok {
+		return sym
+	}
+	proc, ok := v.(*primitive.Procedure)
+	if !ok {
+		return sym
+	}
+	if cur, found := s.use.Get(string(sym)); found {
+		if p, ok := cur.(*primitive.Procedure); ok && p == proc {
+			return sym
+		}
+	}
+	return proc
+}
+
+// syntaxBinding is the form matched by a pattern variable, or for a
+// variable followed by an ellipsis the bindings for each repetition.
+type syntaxBinding struct {
+	value primitive.Primitive
+	items []*syntaxBinding
+}
+
+// newSyntaxRules parses the arguments of (syntax-rules [ellipsis] (literals..) rules..).
+func newSyntaxRules(name string, args []primitive.Primitive) (*syntaxRules, error) {
+
+	sr := &syntaxRules{name: name, ellipsis: "...", literals: make(map[string]bool)}
+
+	// A custom ellipsis may be given first
+	if len(args) > 0 {
+		if sym, ok := args[0].(primitive.Symbol); ok {
+			sr.ellipsis = string(sym)
+			args = args[1:]
+		}
+	}
+	if len(args) < 1 {
+		return nil, fmt.Errorf("(syntax-rules ..) expects a list of literals")
+	}
+
+	if !primitive.IsNil(args[0]) {
+		lits, ok := args[0].(primitive.List)
+		if !ok {
+			return nil, fmt.Errorf("(syntax-rules ..) expects a list of literals, got %v", args[0])
+		}
+		for _, x := range lits {
+			sym, ok := x.(primitive.Symbol)
+			if !ok {
+				return nil, fmt.Errorf("(syntax-rules ..) expects a list of literals, got %v", args[0])
+			}
+			sr.literals[string(sym)] = true
+		}
+	}
+
+	for _, x := range args[1:] {
+		rule, ok := x.(primitive.List)
+		if !ok || len(rule) != 2 {
+			return nil, fmt.Errorf("(syntax-rules ..) expects (pattern template) for each rule, got %v", x)
+		}
+		pattern, ok := rule[0].(primitive.List)
+		if !ok || len(pattern) < 1 {
+			return nil, fmt.Errorf("(syntax-rules ..) expects each pattern to be a list, got %v", rule[0])
+		}
+
+		vars := make(map[string]int)
+		if err := sr.patternVars(pattern[1:], 0, vars); err != nil {
+			return nil, err
+		}
+
+		// Without a name use the keyword of the pattern
+		if sr.name == "" && pattern[0] != primitive.Symbol("_") {
+			sr.name = pattern[0].ToString()
+		}
+
+		binders := make(map[string]bool)
+		sr.templateBinders(rule[1], binders)
+
+		r := syntaxRule{pattern: pattern[1:], template: rule[1]}
+		for name := range binders {
+			if _, found := vars[name]; !found {
+				r.binders = append(r.binders, name)
+			}
+		}
+		sr.rules = append(sr.rules, r)
+	}
+
+	return sr, nil
+}
+
+// syntaxRules returns a macro which expands according to the given rules,
+// the arguments of (syntax-rules ..), evaluated within the given environment.
+func (ev *Eval) syntaxRules(name string, args []primitive.Primitive, e *env.Environment) primitive.Primitive {
+
+	sr, err := newSyntaxRules(name, args)
+	if err != nil {
+		return primitive.Error(err.Error())
+	}
+
+	// The help shows how the macro may be used
+	usage := []string{}
+	for _, rule := range sr.rules {
+		usage = append(usage, patternString(append(primitive.List{primitive.Symbol(sr.name)}, rule.pattern...)))
+	}
+
+	return &primitive.Procedure{
+		Macro: true,
+		Help:  "A macro defined by syntax-rules, used as:\n\n" + strings.Join(usage, "\n"),
+		F: func(use *env.Environment, args []primitive.Primitive) primitive.Primitive {
+			out, err := sr.expand(args, &syntaxScope{def: e, use: use})
+			if err != nil {
+				return primitive.Error(err.Error())
+			}
+			return out
+		},
+	}
+}
+
+// patternVars records the variables of a pattern, and the number of
+// ellipses each is nested within, returning an error if the pattern is
+// invalid.
+func (sr *syntaxRules) patternVars(pattern primitive.Primitive, depth int, vars map[string]int) error {
+
+	switch p := pattern.(type) {
+	case primitive.Symbol:
+		name := string(p)
+		if name == "_" || sr.literals[name] || strings.HasPrefix(name, ":") {
+			return nil
+		}
+		if name == sr.ellipsis {
+			return fmt.Errorf("%s must follow a pattern", sr.ellipsis)
+		}
+		if _, found := vars[name]; found {
+			return fmt.Errorf("pattern variable %s is used more than once", name)
+		}
+		vars[name] = depth
+		return nil
+
+	case primitive.List:
+		seen := false
+		for i, x := range p {
+			if sym, ok := x.(primitive.Symbol); ok && string(sym) == sr.ellipsis {
+				if seen {
+					return fmt.Errorf("%s may only be used once in the list %s", sr.ellipsis, patternString(p))
+				}
+				if i == 0 {
+					return fmt.Errorf("%s must follow a pattern", sr.ellipsis)
+				}
+				seen = true
+				continue
+			}
+
+			d := depth
+			if i+1 < len(p) && sr.isEllipsis(p[i+1]) {
+				d++
+			}
+			if err := sr.patternVars(x, d, vars); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// templateVars records the symbols within a template, or pattern, which
+// might be pattern variables.
+func (sr *syntaxRules) templateVars(template primitive.Primitive, vars map[string]bool) {
+
+	switch t := template.(type) {
+	case primitive.Symbol:
+		name := string(t)
+		if name != "_" && name != sr.ellipsis && !sr.literals[name] && !strings.HasPrefix(name, ":") {
+			vars[name] = true
+		}
+	case primitive.List:
+		for _, x := range t {
+			sr.templateVars(x, vars)
+		}
+	case primitive.Hash:
+		for _, x := range t.Entries {
+			sr.templateVars(x, vars)
+		}
+	}
+}
+
+// isEllipsis returns true if the given form is the ellipsis.
+func (sr *syntaxRules) isEllipsis(x primitive.Primitive) bool {
+	sym, ok := x.(primitive.Symbol)
+	return ok && string(sym) == sr.ellipsis
+}
+
+// templateBinders records the symbols which are bound by the binding
+// forms within a template.
+func (sr *syntaxRules) templateBinders(template primitive.Primitive, binders map[string]bool) {
+
+	lst, ok := template.(primitive.List)
+	if !ok || len(lst) == 0 {
+		return
+	}
+
+	if head, ok := lst[0].(primitive.Symbol); ok && len(lst) > 1 {
+		switch head {
+		case "quote":
+			return
+
+		case "let*":
+			if bindings, ok := lst[1].(primitive.List); ok {
+				for i := 0; i < len(bindings); i += 2 {
+					sr.patternBinders(bindings[i], binders)
+				}
+			}
+
+		case "let":
+			sr.patternBinders(lst[1], binders)
+			if len(lst) > 2 {
+				if bindings, ok := lst[2].(primitive.List); ok {
+					for i := 0; i < len(bindings); i += 2 {
+						sr.patternBinders(bindings[i], binders)
+					}
+				}
+			}
+
+		case "fn*", "lambda":
+			if params, ok := lst[1].(primitive.List); ok {
+				for _, x := range params {
+					// (name default supplied-p)
+					if p, ok := x.(primitive.List); ok && len(p) > 0 {
+						if _, ok := p[0].(primitive.Symbol); ok {
+							sr.patternBinders(p[0], binders)
+							if len(p) == 3 {
+								sr.patternBinders(p[2], binders)
+							}
+							continue
+						}
+					}
+					sr.patternBinders(x, binders)
+				}
+			}
+
+		case "dolist", "dotimes", "for":
+			if spec, ok := lst[1].(primitive.List); ok && len(spec) > 0 {
+				sr.patternBinders(spec[0], binders)
+			}
+
+		case "receive", "multiple-value-bind", "catch":
+			sr.patternBinders(lst[1], binders)
+		}
+	}
+
+	for _, x := range lst {
+		sr.templateBinders(x, binders)
+	}
+}
+
+// patternBinders records the symbols bound by a destructuring pattern.
+func (sr *syntaxRules) patternBinders(pattern primitive.Primitive, binders map[string]bool) {
+
+	switch p := pattern.(type) {
+	case primitive.Symbol:
+		name := strings.TrimPrefix(string(p), "&")
+		name, _, _ = strings.Cut(name, ":")
+		if name == "" || name == "_" || name == "optional" || name == "key" || name == sr.ellipsis {
+			return
+		}
+		binders[name] = true
+
+	case primitive.List:
+		for _, x := range p {
+			sr.patternBinders(x, binders)
+		}
+
+	case primitive.Hash:
+		if names, ok := p.Entries[":keys"].(primitive.List); ok {
+			sr.patternBinders(names, binders)
+		}
+		if as, ok := p.Entries[":as"]; ok {
+			sr.patternBinders(as, binders)
+		}
+	}
+}
+
+// expand expands a use of the macro with the given arguments, via the
+// first rule whose pattern they match.
+func (sr *syntaxRules) expand(args []primitive.Primitive, scope *syntaxScope) (primitive.Primitive, error) {
+
+	for _, rule := range sr.rules {
+		b := make(map[string]*syntaxBinding)
+		if !sr.match(rule.pattern, primitive.List(args), b) {
+			continue
+		}
+
+		renames := make(map[string]primitive.Symbol)
+		for _, name := range rule.binders {
+			renames[name] = primitive.Gensym(name)
+		}
+		return sr.substitute(rule.template, b, renames, scope)
+	}
+
+	form := append(primitive.List{primitive.Symbol(sr.name)}, args...)
+	return nil, fmt.Errorf("(%s ..) matched no syntax-rules pattern, got %s", sr.name, patternString(form))
+}
+
+// match tests whether the form matches the pattern, recording the forms
+// matched by each pattern variable.
+func (sr *syntaxRules) match(pattern primitive.Primitive, form primitive.Primitive, b map[string]*syntaxBinding) bool {
+
+	switch p := pattern.(type) {
+	case primitive.Symbol:
+		name := string(p)
+		if name == "_" {
+			return true
+		}
+		if sr.literals[name] || strings.HasPrefix(name, ":") {
+			sym, ok := form.(primitive.Symbol)
+			return ok && sym == p
+		}
+		b[name] = &syntaxBinding{value: form}
+		return true
+
+	case primitive.List:
+		var items primitive.List
+		if !primitive.IsNil(form) {
+			lst, ok := form.(primitive.List)
+			if !ok {
+				return false
+			}
+			items = lst
+		}
+
+		// Find the ellipsis, if any
+		ell := -1
+		for i, x := range p {
+			if sr.isEllipsis(x) {
+				ell = i
+			}
+		}
+
+		if ell < 0 {
+			if len(items) != len(p) {
+				return false
+			}
+			for i, x := range p {
+				if !sr.match(x, items[i], b) {
+					return false
+				}
+			}
+			return true
+		}
+
+		// The items before "x ...", and after it
+		before := p[:ell-1]
+		after := p[ell+1:]
+		if len(items) < len(before)+len(after) {
+			return false
+		}
+		for i, x := range before {
+			if !sr.match(x, items[i], b) {
+				return false
+			}
+		}
+		for i, x := range after {
+			if !sr.match(x, items[len(items)-len(after)+i], b) {
+				return false
+			}
+		}
+
+		// Each of the repeated items is matched separately
+		vars := make(map[string]bool)
+		sr.templateVars(p[ell-1], vars)
+
+		repeated := make(map[string]*syntaxBinding)
+		for name := range vars {
+			repeated[name] = &syntaxBinding{items: []*syntaxBinding{}}
+			b[name] = repeated[name]
+		}
+		for _, item := range items[len(before) : len(items)-len(after)] {
+			sub := make(map[string]*syntaxBinding)
+			if !sr.match(p[ell-1], item, sub) {
+				return false
+			}
+			for name := range vars {
+				repeated[name].items = append(repeated[name].items, sub[name])
+			}
+		}
+		return true
+	}
+
+	return matchLiteral(pattern, form)
+}
+
+// substitute expands the template, replacing pattern variables by the
+// forms they matched, renaming the symbols the template binds, and
+// resolving the other symbols where the macro was defined.
+func (sr *syntaxRules) substitute(template primitive.Primitive, b map[string]*syntaxBinding, renames map[string]primitive.Symbol, scope *syntaxScope) (primitive.Primitive, error) {
+
+	switch t := template.(type) {
+	case primitive.Symbol:
+		if bind, ok := b[string(t)]; ok {
+			if bind.items != nil {
+				return nil, fmt.Errorf("pattern variable %s must be followed by %s in the template", t, sr.ellipsis)
+			}
+			return bind.value, nil
+		}
+		renamed := renameSymbol(t, renames)
+		if renamed != t {
+			return renamed, nil
+		}
+		return scope.resolve(t), nil
+
+	case primitive.List:
+		// Quoted symbols are not renamed, or resolved
+		if len(t) == 2 && t[0] == primitive.Symbol("quote") {
+			renames = nil
+			scope = nil
+		}
+
+		out := primitive.List{}
+		for i := 0; i < len(t); i++ {
+			x := t[i]
+
+			// Count the ellipses which follow this item
+			depth := 0
+			for i+1 < len(t) && sr.isEllipsis(t[i+1]) {
+				depth++
+				i++
+			}
+
+			if depth == 0 {
+				val, err := sr.substitute(x, b, renames, scope)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, val)
+				continue
+			}
+
+			vals, err := sr.repeat(x, depth, b, renames, scope)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, vals...)
+		}
+		return out, nil
+
+	case primitive.Hash:
+		if !t.Literal {
+			return t, nil
+		}
+		hsh := primitive.NewHash()
+		hsh.Literal = true
+		for k, v := range t.Entries {
+			val, err := sr.substitute(v, b, renames, scope)
+			if err != nil {
+				return nil, err
+			}
+			hsh.Entries[k] = val
+		}
+		return hsh, nil
+	}
+
+	return template, nil
+}
+
+// repeat expands a template which is followed by the given number of
+// ellipses, once for each form matched by the variables within it.
+func (sr *syntaxRules) repeat(template primitive.Primitive, depth int, b map[string]*syntaxBinding, renames map[string]primitive.Symbol, scope *syntaxScope) ([]primitive.Primitive, error) {
+
+	// Find the variables which repeat
+	vars := make(map[string]bool)
+	sr.templateVars(template, vars)
+
+	count := -1
+	repeated := []string{}
+	for name := range vars {
+		bind, ok := b[name]
+		if !ok || bind.items == nil {
+			continue
+		}
+		if count >= 0 && len(bind.items) != count {
+			return nil, fmt.Errorf("pattern variables in %s matched different numbers of forms", patternString(template))
+		}
+		count = len(bind.items)
+		repeated = append(repeated, name)
+	}
+	if len(repeated) == 0 {
+		return nil, fmt.Errorf("%s follows %s, which contains no pattern variable that matched repeated forms", sr.ellipsis, patternString(template))
+	}
+
+	out := []primitive.Primitive{}
+	for i := 0; i < count; i++ {
+		sub := make(map[string]*syntaxBinding, len(b))
+		for k, v := range b {
+			sub[k] = v
+		}
+		for _, name := range repeated {
+			sub[name] = b[name].items[i]
+		}
+
+		if depth > 1 {
+			vals, err := sr.repeat(template, depth-1, sub, renames, scope)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, vals...)
+			continue
+		}
+
+		val, err := sr.substitute(template, sub, renames, scope)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, val)
+	}
+	return out, nil
+}
+
+// renameSymbol returns the new name of a symbol the template binds,
+// keeping any "&" prefix, or type suffix.
+func renameSymbol(sym primitive.Symbol, renames map[string]primitive.Symbol) primitive.Symbol {
+
+	name := string(sym)
+	prefix := ""
+	if strings.HasPrefix(name, "&") {
+		prefix = "&"
+		name = name[1:]
+	}
+	base, types, typed := strings.Cut(name, ":")
+
+	renamed, ok := renames[base]
+	if !ok {
+		return sym
+	}
+	out := prefix + string(renamed)
+	if typed {
+		out += ":" + types
+	}
+	return primitive.Symbol(out)
+}
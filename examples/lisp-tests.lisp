@@ -18,7 +18,7 @@
 ;; When a test fails it will be shown:
 ;;
 ;;   $ yal tests.lisp | tapview
-;;   not ok add:mult failed %!s(int=40) != %!s(int=10)
+;;   not ok add:mult failed 40 != 10
 ;;   4 tests, 1 failures.
 ;;
 ;; tapview can be found here:
@@ -457,6 +457,19 @@ If the name of the test is not unique then that will cause an error to be printe
 (deftest defaults:3 (list (addy 1 2)    3))
 (deftest defaults:4 (list (addy 1 2 3)  3))
 
+;; defaults are evaluated, and may refer to earlier arguments
+(set! addz (fn* ( a (b (* a 2)) ) (+ a b) ))
+(deftest defaults:5 (list (addz 1)     3))
+(deftest defaults:6 (list (addz 1 1)   2))
+
+;; optional and keyword arguments
+(set! opty (fn* (a &optional (b 10 b?) &key (scale 1) verbose) (list (* (+ a b) scale) b? verbose)))
+(deftest optional:1 (list (opty 1)                     (list 11 false nil)))
+(deftest optional:2 (list (opty 1 2)                   (list 3 true nil)))
+(deftest optional:3 (list (opty 1 2 :scale 2)          (list 6 true nil)))
+(deftest optional:4 (list (opty 1 2 :verbose :yes)     (list 3 true :yes)))
+(deftest optional:5 (list (try (opty 1 2 :bogus 3) (catch e "caught")) "caught"))
+
 
 ;; Define two helpers for sorting, by one/other field.
 (set! people-surname-sort (fn* (a b) (string< (person.surname a) (person.surname b))))
@@ -495,6 +508,184 @@ If the name of the test is not unique then that will cause an error to be printe
 
 
 
+;; path handling
+(deftest path:base:1 (list (path:base (path:join "a" "b" "c.txt")) "c.txt"))
+(deftest path:ext:1  (list (path:ext  (path:join "a" "b" "c.txt")) ".txt"))
+(deftest path:dir:1  (list (path:dir  (path:join "a" "b"))         "a"))
+(deftest path:match:1 (list (path:match "*.lisp" "tests.lisp")     true))
+(deftest path:match:2 (list (path:match "*.lisp" "tests.go")       false))
+
+;; time
+(deftest time:parse:1  (list (time.year (time:parse "2023-07-04T13:05:09Z")) 2023))
+(deftest time:parse:2  (list (time:format (time:parse "04/07/2023" "%d/%m/%Y") "2006-01-02") "2023-07-04"))
+(deftest time:add:1    (list (time.hour (time:add (time:parse "2023-07-04T13:05:09Z") "2h")) 15))
+(deftest time:diff:1   (list (time:diff (time:from-unix 100) (time:from-unix 40)) 60))
+(deftest time:tz:1     (list (time:format (time:tz (time:from-unix 0) "Asia/Tokyo") "%H:%M") "09:00"))
+(deftest time:cmp:1    (list (> (time:now) (time:from-unix 0)) true))
+(deftest time:cmp:2    (list (= (time:from-unix 0) (time:tz (time:from-unix 0) "Asia/Tokyo")) true))
+(deftest time?:1       (list (time? (time:now)) true))
+
+;; environment
+(deftest setenv:1   (list (do (setenv "YAL_TEST_1" "ok") (getenv "YAL_TEST_1")) "ok"))
+(deftest environ:1  (list (do (setenv "YAL_TEST_2" "ok") (get (environ) "YAL_TEST_2")) "ok"))
+(deftest unsetenv:1 (list (do (setenv "YAL_TEST_3" "ok") (unsetenv "YAL_TEST_3") (getenv "YAL_TEST_3")) ""))
+(deftest with-env:1 (list (with-env {:YAL_TEST_4 "temp"} (getenv "YAL_TEST_4")) "temp"))
+(deftest with-env:2 (list (do (with-env {:YAL_TEST_4 "temp"} 1) (getenv "YAL_TEST_4")) ""))
+;; encoding
+(deftest base64:1 (list (encode:base64 "hello") "aGVsbG8="))
+(deftest base64:2 (list (decode:base64 (encode:base64 "a?b>" true) true) "a?b>"))
+(deftest encode:hex:1 (list (decode:hex (encode:hex "steve")) "steve"))
+(deftest url:1    (list (url:encode "a b&c") "a+b%26c"))
+(deftest url:2    (list (url:decode "a+b%26c") "a b&c"))
+(deftest url:3    (list (get (get (url:parse "http://example.com/?q=yal") :query) "q") "yal"))
+(deftest url:4    (list (url:build {:scheme "https" :host "example.com" :path "/" :query {:q "a b"}}) "https://example.com/?q=a+b"))
+
+;; digests
+(deftest crc32:1        (list (crc32 "steve") "96AC18A5"))
+(deftest hmac:1         (list (hmac "sha1" "key" "") "F42BB0EEB018EBBD4597AE7213711EC60760843F"))
+(deftest random:bytes:1 (list (strlen (encode:hex (random:bytes 8))) 16))
+(deftest uuid:v4:1      (list (strlen (uuid:v4)) 36))
+
+;; seedable random numbers
+(deftest random:seed:1 (list (do (random:seed 5)
+                                 (set! rseed-1 (list (random 100) (random:item (seq 10))))
+                                 (random:seed 5)
+                                 (str (list (random 100) (random:item (seq 10)))))
+                             (str rseed-1)))
+(deftest random:new:1  (list (str (random:shuffle (seq 10) (random:new 3)))
+                             (str (random:shuffle (seq 10) (random:new 3)))))
+(deftest random:range:1 (list (random:range 4 5) 4))
+(deftest random:weighted:1 (list (random:weighted (list "a" "b") (list 0 1)) "b"))
+
+;; compression
+(deftest gzip:1 (list (gzip:decompress (gzip:compress "Hello, World!")) "Hello, World!"))
+(deftest zlib:1 (list (zlib:decompress (zlib:compress "Hello, World!")) "Hello, World!"))
+(deftest json:1 (list (get (json:decode "{\"name\": \"steve\", \"age\": 42}") :age) 42))
+(deftest json:2 (list (json:encode (list 1 "two" nil true)) "[1,\"two\",null,true]"))
+(deftest json:3 (list (json:encode { :name "steve" }) "{\"name\":\"steve\"}"))
+
+(deftest net:1 (list (let* (ln   (net:listen "tcp" "127.0.0.1:0")
+                             c    (net:dial "tcp" (get (net:address ln) :local))
+                             s    (net:accept ln)
+                             _    (net:write c (sprintf "%s\r\n" "PING"))
+                             line (net:read-line s))
+                        (net:close c)
+                        (net:close s)
+                        (net:close ln)
+                        line)
+                      "PING"))
+
+(deftest template:1 (list (template:render "{{range .hosts}}server {{.}};{{end}}" {:hosts (list "a" "b")})
+                          "server a;server b;"))
+(deftest template:2 (list (template:render "{{call .f 3}} {{lisp \"upper\" .x}}" {:f (lambda (n) (* n n)) :x "hi"})
+                          "9 HI"))
+(deftest template:3 (list (template:render "touch {{.name}}" {:name "my file"} :shell)
+                          "touch 'my file'"))
+
+;; formatting
+(deftest format:1 (list (sprintf "~a ~s ~a" "x" "x" #\y) "x \"x\" y"))
+(deftest format:2 (list (sprintf "%'d|%5.1f|%-4s|" 1234567 3.14159 "ab") "1,234,567|  3.1|ab  |"))
+(deftest format:3 (list (sprintf "~{~a~^, ~}" (list 1 2 3)) "1, 2, 3"))
+(deftest format:4 (list (sprintf "~:d ~5,'0d ~x" 1234567 42 255) "1,234,567 00042 ff"))
+(deftest format:5 (list (sprintf "~:{~a=~a ~}" (list (list :a 1) (list :b 2))) ":a=1 :b=2 "))
+(deftest format:6 (list (try (sprintf "%d" 1.5) (catch e "caught")) "caught"))
+(deftest format:7 (list (try (sprintf "~a ~a" 1) (catch e "caught")) "caught"))
+(deftest format:8 (list (sprintf "path ~/x %s" "a") "path ~/x a"))
+
+;; loops
+(deftest dotimes:1 (list (let* (a ()) (dotimes (i 3 a) (set! a (cons i a)))) (list 2 1 0)))
+(deftest dolist:1  (list (dolist (x (list 1 2 3 4)) (if (> x 2) (break (* x 10)))) 30))
+(deftest dolist:2  (list (let* (f (fn* () (break 1))) (try (dolist (x (list 1 2)) (f)) (catch e "caught"))) "caught"))
+(deftest for:1     (list (let* (a 0) (for (i 1 10) (if (odd? i) (continue)) (set! a (+ a i))) a) 30))
+(deftest for:2     (list (let* (a ()) (for ((k v) {:a 1 :b 2}) (set! a (cons v a))) a) (list 2 1)))
+(deftest let:1     (list (let fact (n 10 acc 1) (if (<= n 1) acc (fact (- n 1) (* acc n)))) 3628800))
+
+;; destructuring
+(deftest destructure:1 (list (let* ((a (b c) &rest) (list 1 (list 2 3) 4)) (list a b c rest)) (list 1 2 3 (list 4))))
+(deftest destructure:2 (list (let* ({:keys (name age) :or {age 0}} {:name "Steve"}) (list name age)) (list "Steve" 0)))
+(deftest destructure:3 (list ((fn* (((x y) nil)) (* x y)) (list 3 4)) 12))
+(deftest destructure:4 (list (try (let* ((a b) (list 1 2 3)) a) (catch e "caught")) "caught"))
+
+;; pattern-matching
+(set! match-test (fn* (x)
+                      (match-case x
+                        (0 :zero)
+                        (n:number :when (< n 0) :negative)
+                        ((:add a b) (+ a b))
+                        ({:name n} n)
+                        (else :other))))
+(deftest match-case:1 (list (match-test 0) :zero))
+(deftest match-case:2 (list (match-test -1) :negative))
+(deftest match-case:3 (list (match-test (list :add 1 2)) 3))
+(deftest match-case:4 (list (match-test {:name "Steve"}) "Steve"))
+(deftest match-case:5 (list (match-test 7) :other))
+(deftest match-case:6 (list (try (match-case 7 (0 :zero)) (catch e "caught")) "caught"))
+
+;; multiple values
+(set! divmod (fn* (a b) (values (/ a b) (% a b))))
+(deftest values:1 (list (receive (q r) (divmod 8 3) (list q r)) (list (/ 8 3) 2)))
+(deftest values:2 (list (+ 1 (values 2 3)) 3))
+(deftest values:3 (list (multiple-value-bind (a &rest) (values 1 2 3) rest) (list 2 3)))
+
+;; continuations
+(set! find-first (fn* (pred lst)
+                      (call/ec (lambda (return)
+                                 (do
+                                   (dolist (x lst) (if (pred x) (return x)))
+                                   nil)))))
+(deftest call/ec:1 (list (find-first (lambda (x) (> x 2)) '(1 2 3 4)) 3))
+(deftest call/ec:2 (list (find-first (lambda (x) (> x 20)) '(1 2 3 4)) nil))
+(deftest call/ec:3 (list (call/ec (lambda (k) (map '(1 2 3) (lambda (x) (if (= x 2) (k "escaped") x))))) "escaped"))
+(set! wind-log '())
+(call/ec (lambda (k)
+           (dynamic-wind
+               (lambda () (set! wind-log (cons "in" wind-log)))
+               (lambda () (k nil))
+               (lambda () (set! wind-log (cons "out" wind-log))))))
+(deftest dynamic-wind:1 (list wind-log (list "out" "in")))
+
+;; lazy sequences
+(set! naturals (fn* (n) (lazy-seq (cons n (naturals (+ n 1))))))
+(deftest lazy-seq:1 (list (take 5 (naturals 0)) (list 0 1 2 3 4)))
+(deftest lazy-seq:2 (list (take 3 (filter (lazy-range 0 1000000 1) (lambda (x) (= 0 (% x 7))))) (list 0 7 14)))
+(deftest lazy-seq:3 (list (realize (lazy-map (lazy-take 3 (iterate inc 1)) (lambda (x) (* x x)))) (list 1 4 9)))
+(deftest lazy-seq:4 (list (take 5 (cycle '(a b))) '(a b a b a)))
+(deftest lazy-seq:5 (list (realize (lazy-drop 2 (lazy-range 1 5))) (list 3 4 5)))
+(deftest lazy-seq:6 (list (realize (lazy-range 10 1 -4)) (list 10 6 2)))
+(deftest lazy-seq:7 (list (lazy-seq? (map (naturals 0) inc)) true))
+(deftest generator:1 (list (realize (generator (dolist (x '(1 2 3)) (yield (* x 10))))) (list 10 20 30)))
+(deftest generator:2 (list (nth (generator (let loop (a 0 b 1) (do (yield a) (loop b (+ a b))))) 10) 55))
+(set! promised 0)
+(set! promise (delay (do (set! promised (inc promised)) promised)))
+(deftest delay:1 (list (list (force promise) (force promise) promised) (list 1 1 1)))
+
+;; hygienic macros
+(define-syntax test-swap! (syntax-rules () ((_ a b) (let* (tmp a) (set! a b true) (set! b tmp true)))))
+(set! tmp 1)
+(set! other 2)
+(test-swap! tmp other)
+(deftest syntax-rules:1 (list (list tmp other) (list 2 1)))
+(define-syntax test-let (syntax-rules () ((_ ((n v) ...) body ...) ((lambda (n ...) (do body ...)) v ...))))
+(deftest syntax-rules:2 (list (test-let ((a 1) (b 2)) (+ a b)) 3))
+(define-syntax test-arrow (syntax-rules (=>) ((_ a => b) (list b a)) ((_ a b) (list a b))))
+(deftest syntax-rules:3 (list (list (test-arrow 1 => 2) (test-arrow 1 2)) (list (list 2 1) (list 1 2))))
+(deftest macroexpand-1:1 (list (macroexpand-1 (test-arrow 1 => 2)) (list 'list 2 1)))
+(deftest macroexpand-all:1 (list (macroexpand-all (list (test-arrow 1 2) '(test-arrow 3 4))) '(list (list 1 2) (quote (test-arrow 3 4)))))
+
+;; timers
+(deftest cron:next:1 (list (str (cron:next "30 9 * * mon-fri" (time:tz (time:from-unix 0) "UTC"))) "1970-01-01T09:30:00Z"))
+(deftest cron:next:2 (list (cron:next "0 0 30 2 *") nil))
+(deftest timer:1     (list (do (set! timer-1 0)
+                               (timer:after 1 (lambda () (set! timer-1 1 true)))
+                               (sleep 20)
+                               timer-1) 1))
+(deftest timer:2     (list (do (set! timer-2 0)
+                               (after 1 (lambda () (set! timer-2 2 true)))
+                               (sleep 20)
+                               timer-2) 2))
+
+
+
 ;;
 ;; Define a function to run all the tests, by iterating over the
 ;; contents of the global hash, to which the tests were stored via
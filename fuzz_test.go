@@ -141,22 +141,56 @@ func FuzzYAL(f *testing.F) {
 	// report those known-bad things.
 	//
 	known := []string{
+		"a lazy sequence must produce",    // lazy-seq
+		"arguments for the format-string", // print/sprintf
 		"arityerror",
+		"cannot iterate over",                  // for
+		"(syntax-rules ..) expects",            // syntax-rules
 		"catch list should begin with 'catch'", // try/catch
 		"deadline exceeded",                    // context timeout
+		"depends upon itself",                  // lazy-seq, delay
 		"division by zero",
 		"error expanding argument",
 		"expected a function body",
 		"expected a list",
 		"expected a hash",
 		"expected a symbol",
+		"expects (pattern",            // match-case
+		"expects (var",                // dolist/dotimes/for
+		"expects a list",              // dolist
+		"expects a name for the loop", // let
+		"expects a non-zero step",     // for
+		"expects a macro",             // define-syntax
+		"expects a docstring",         // define-syntax
+		"expects a procedure",         // call/ec, dynamic-wind
+		"expects a number",            // dotimes
+		"expects a single variable",   // for
+		"expects a hash",              // destructuring
+		"expects a name, or (name",    // &optional/&key
+		"expects a symbol",
+		"expects an expression after :when", // match-case
+		"expects the else clause",           // match-case
+		"expects numbers for a range",       // for
 		"failed to compile regexp",
-		"failed to open", // file:lines
+		"fields for the struct",       // match-case
+		"failed to open",              // file:lines
+		"incomplete format directive", // print/sprintf
 		"invalid character literal",
+		"keyword argument", // &key
 		"is not a symbol",
-		"list should have three elements", // try
-		"must be greater than zero",       // random
+		"is used more than once",             // syntax-rules
+		"list should have three elements",    // try
+		"must be greater than zero",          // random
+		"matched different numbers of forms", // syntax-rules
+		"matched no syntax-rules pattern",    // syntax-rules
+		"may not follow &key",
+		"may only be used once in the list", // syntax-rules
+		"must be followed by",               // syntax-rules
+		"must follow a pattern",             // syntax-rules
+		"must come before any &rest",
 		"must have even length",
+		"no clause matched",
+		"no pattern variable that matched", // syntax-rules // match-case
 		"not a character",
 		"not a function",
 		"not a hash",
@@ -164,12 +198,21 @@ func FuzzYAL(f *testing.F) {
 		"not a number",
 		"not a procedure",
 		"not a string",
+		"only &key arguments may follow",
+		"only be used as the last item of a pattern", // &rest
+		"outside of the body of its generator",
 		"out of bounds", // nth
+		"outside of a loop",
 		"recursion limit",
 		"syntax error in pattern", // glob
+		"in format-string",        // print/sprintf
 		"tried to set a non-symbol",
+		"was called after it returned", // call/ec
 		"typeerror - ",
 		"unexpected type",
+		"unknown format directive", // print/sprintf
+		"unknown key",              // destructuring
+		"values, got",              // destructuring
 	}
 
 	// Read the standard library only once.
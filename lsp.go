@@ -10,7 +10,6 @@ import (
 	"fmt"
 	"os"
 	"sort"
-	"strings"
 
 	"github.com/skx/yal/primitive"
 	"github.com/tliron/glsp"
@@ -190,14 +189,8 @@ func textDocumentHover(context *glsp.Context, params *protocol.HoverParams) (*pr
 	}
 
 	// Build up the arguments to the procedure.
-	args := ""
-
-	if len(prc.Args) > 0 {
-
-		for _, arg := range prc.Args {
-			args += " " + arg.ToString()
-		}
-		args = strings.TrimSpace(args)
+	args := prc.Params()
+	if args != "" {
 		args = " (" + args + ")"
 	}
 
@@ -157,22 +157,8 @@ func help(show []string) {
 		}
 
 		// Build up the arguments to the procedure.
-		args := ""
-
-		if len(prc.Args) > 0 {
-
-			for _, arg := range prc.Args {
-				args += " " + arg.ToString()
-
-				// Default value for this argument?
-				def, ok := prc.Defaults[arg]
-				if ok {
-					args += "[default:"
-					args += def.ToString()
-					args += "]"
-				}
-			}
-			args = strings.TrimSpace(args)
+		args := prc.Params()
+		if args != "" {
 			args = " (" + args + ")"
 		}
 
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/skx/yal/builtins"
+	"github.com/skx/yal/config"
 	"github.com/skx/yal/env"
 	"github.com/skx/yal/eval"
 	"github.com/skx/yal/primitive"
@@ -17,6 +18,10 @@ var interpreter *eval.Eval
 // The environment contains the primitives the interpreter uses.
 var environment *env.Environment
 
+// The interpreter, and environment, for the macro benchmark.
+var macroInterpreter *eval.Eval
+var macroEnvironment *env.Environment
+
 // Create the interpreter, and parse the source of our benchmark script.
 //
 // Only do this once, at startup.
@@ -45,6 +50,27 @@ func init() {
 
 	// Create a new interpreter with that source
 	interpreter = eval.New(src)
+
+	// The macro benchmark runs a loop which uses while, when, and
+	// cond, so that each is expanded many times.
+	macroEnvironment = env.New()
+	macroEnvironment.SetIOConfig(config.DefaultIO())
+	builtins.PopulateEnvironment(macroEnvironment)
+
+	content = `
+(define count-odd (lambda (n)
+  (let* (i 0 odd 0)
+    (while (< i n)
+      (when (= 1 (% i 2))
+        (set! odd (+ odd 1) true))
+      (cond
+        (= i 0) (set! i 1 true)
+        true    (set! i (+ i 1) true)))
+    odd)))
+
+(count-odd 1000)
+`
+	macroInterpreter = eval.New(string(pre) + "\n" + string(content))
 }
 
 // BenchmarkGoFactorial allows running the golang benchmark.
@@ -71,6 +97,23 @@ func BenchmarkYALFactorial(b *testing.B) {
 
 }
 
+// BenchmarkYALMacros allows running the lisp benchmark of macro-heavy code.
+func BenchmarkYALMacros(b *testing.B) {
+	var out primitive.Primitive
+
+	for i := 0; i < b.N; i++ {
+		out = macroInterpreter.Evaluate(macroEnvironment)
+	}
+
+	// Did we get an error?  Then show it.
+	if _, ok := out.(primitive.Error); ok {
+		fmt.Printf("Error running: %v\n", out)
+	}
+	if out.ToString() != "500" {
+		b.Fatalf("unexpected result %s", out.ToString())
+	}
+}
+
 // fact is a benchmark implementation in pure-go for comparison purposes.
 func fact(n int64) int64 {
 	if n == 0 {
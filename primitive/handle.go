@@ -0,0 +1,42 @@
+package primitive
+
+import "fmt"
+
+// Handle holds a reference to a golang object which has no lisp
+// representation of its own, for example a running process.
+//
+// Lisp code may pass handles around, and hand them to the primitives
+// which understand them, but cannot look inside them.
+type Handle struct {
+
+	// Kind describes what this handle refers to, and is returned
+	// as the type of the object.
+	Kind string
+
+	// Value contains the golang object we're wrapping.
+	Value any
+}
+
+// NewHandle creates a new handle, wrapping the given object.
+func NewHandle(kind string, value any) *Handle {
+	return &Handle{Kind: kind, Value: value}
+}
+
+// IsSimpleType is used to denote whether this object
+// is self-evaluating.
+func (h *Handle) IsSimpleType() bool {
+	return true
+}
+
+// ToString converts this object to a string.
+//
+// We include the address of the handle, so that two distinct handles
+// will not compare as equal via "eq".
+func (h *Handle) ToString() string {
+	return fmt.Sprintf("#<%s %p>", h.Kind, h)
+}
+
+// Type returns the type of this primitive object.
+func (h *Handle) Type() string {
+	return h.Kind
+}
@@ -11,6 +11,11 @@ type Hash struct {
 	// StructType contains the name of this struct, if it is being
 	// being used to implement a Struct, rather than a Hash
 	StructType string
+
+	// Literal is true for hashes created by the reader, whose values
+	// are unevaluated forms; evaluating such a hash produces a new
+	// hash holding the evaluated values.
+	Literal bool
 }
 
 // Get returns the value of a given index
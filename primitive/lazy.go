@@ -0,0 +1,260 @@
+package primitive
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// LazyPrintLimit is the number of items of a lazy sequence which will be
+// shown when it is converted to a string, as it might be infinite.
+const LazyPrintLimit = 100
+
+// LazySeq is a sequence whose items are only computed when they are
+// needed, and then remembered, which allows it to be infinite.
+//
+// The items are produced by a thunk, which returns nil, a list, another
+// lazy sequence, or an error.
+type LazySeq struct {
+
+	// thunk computes the sequence, it is cleared when it is called.
+	thunk func() Primitive
+
+	// realized is true once the thunk has been called.
+	realized bool
+
+	// empty is true if the sequence has no items.
+	empty bool
+
+	// first is the first item of the sequence.
+	first Primitive
+
+	// rest is the remainder of the sequence, which is nil, a list,
+	// or another lazy sequence.
+	rest Primitive
+
+	// err holds any error raised by the thunk.
+	err error
+}
+
+// NewLazySeq creates a lazy sequence, which will be computed by calling
+// the given thunk when it is first needed.
+func NewLazySeq(thunk func() Primitive) *LazySeq {
+	return &LazySeq{thunk: thunk}
+}
+
+// LazyCons creates a lazy sequence of the given item, followed by the
+// items of rest, which is nil, a list, or a lazy sequence.
+func LazyCons(first Primitive, rest Primitive) *LazySeq {
+	return &LazySeq{realized: true, first: first, rest: rest}
+}
+
+// Next returns the first item of the sequence and the rest of it, which
+// is nil, a list, or a lazy sequence, or false if the sequence is empty.
+func (s *LazySeq) Next() (Primitive, Primitive, bool, error) {
+	if !s.realized && s.thunk == nil {
+		return nil, nil, false, errors.New("lazy sequence depends upon itself")
+	}
+	s.realize()
+	if s.err != nil {
+		return nil, nil, false, s.err
+	}
+	if s.empty {
+		return Nil{}, Nil{}, false, nil
+	}
+	return s.first, s.rest, true, nil
+}
+
+// realize calls the thunk of the sequence, if that has not been done.
+//
+// A thunk which returns another unrealized sequence is followed here,
+// rather than recursively, so that a long chain of them cannot exhaust
+// the stack; each sequence along the way shares the result.
+func (s *LazySeq) realize() {
+	if s.realized {
+		return
+	}
+
+	pending := []*LazySeq{}
+	thunks := []func() Primitive{}
+
+	// If a thunk is interrupted, by a continuation or (break ..),
+	// then the sequences may be computed again later.
+	defer func() {
+		for i, x := range pending {
+			if !x.realized {
+				x.thunk = thunks[i]
+			}
+		}
+	}()
+
+	cur := s
+	var val Primitive
+	for {
+		if cur.thunk == nil {
+			val = Error("lazy sequence depends upon itself")
+			break
+		}
+		pending = append(pending, cur)
+		thunks = append(thunks, cur.thunk)
+		cur.thunk = nil
+		val = thunks[len(thunks)-1]()
+
+		next, ok := val.(*LazySeq)
+		if !ok || next.realized {
+			break
+		}
+		cur = next
+	}
+
+	res := LazySeq{realized: true}
+	switch v := val.(type) {
+	case *LazySeq:
+		res = *v
+	case Nil:
+		res.empty = true
+	case List:
+		res.empty = len(v) == 0
+		if !res.empty {
+			res.first = v[0]
+			res.rest = Nil{}
+			if len(v) > 1 {
+				res.rest = v[1:]
+			}
+		}
+	case Error:
+		res.err = errors.New(string(v))
+	default:
+		res.err = fmt.Errorf("a lazy sequence must produce a list, or a lazy sequence, got %s %s", val.Type(), val.ToString())
+	}
+
+	for _, x := range pending {
+		*x = res
+	}
+}
+
+// SeqNext returns the first item of a list or lazy sequence, and the rest
+// of it, or false if it is empty.
+//
+// An error is returned for anything else, or if the sequence could not
+// be computed.
+func SeqNext(seq Primitive) (Primitive, Primitive, bool, error) {
+
+	switch s := seq.(type) {
+	case Nil:
+		return Nil{}, Nil{}, false, nil
+	case List:
+		if len(s) == 0 {
+			return Nil{}, Nil{}, false, nil
+		}
+		if len(s) == 1 {
+			return s[0], Nil{}, true, nil
+		}
+		return s[0], s[1:], true, nil
+	case *LazySeq:
+		return s.Next()
+	}
+	return nil, nil, false, fmt.Errorf("expected a list or lazy sequence, got %s %s", seq.Type(), seq.ToString())
+}
+
+// IsSimpleType is used to denote whether this object
+// is self-evaluating.
+func (s *LazySeq) IsSimpleType() bool {
+	return true
+}
+
+// ToString converts this object to a string.
+//
+// This computes the items which are shown, up to LazyPrintLimit of them.
+func (s *LazySeq) ToString() string {
+
+	parts := []string{}
+
+	var cur Primitive = s
+	for {
+		first, rest, ok, err := SeqNext(cur)
+		if err != nil {
+			parts = append(parts, Error(err.Error()).ToString())
+			break
+		}
+		if !ok {
+			break
+		}
+		if len(parts) == LazyPrintLimit {
+			parts = append(parts, "...")
+			break
+		}
+		parts = append(parts, first.ToString())
+		cur = rest
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+// Type returns the type of this primitive object.
+func (s *LazySeq) Type() string {
+	return "lazy-seq"
+}
+
+// Promise holds an expression which is evaluated when it is first forced,
+// with the result being remembered.
+type Promise struct {
+
+	// thunk computes the value, it is cleared once that succeeds.
+	thunk func() Primitive
+
+	// forcing is true while the thunk is running.
+	forcing bool
+
+	// value is the result of the thunk.
+	value Primitive
+}
+
+// NewPromise creates a promise, whose value is computed by calling the
+// given thunk when it is first forced.
+func NewPromise(thunk func() Primitive) *Promise {
+	return &Promise{thunk: thunk}
+}
+
+// Force returns the value of the promise, computing it if necessary.
+//
+// An error is not remembered, so forcing the promise again will retry.
+func (p *Promise) Force() Primitive {
+	if p.thunk == nil {
+		return p.value
+	}
+	if p.forcing {
+		return Error("promise depends upon itself")
+	}
+
+	p.forcing = true
+	defer func() {
+		p.forcing = false
+	}()
+	val := p.thunk()
+
+	if _, ok := val.(Error); ok {
+		return val
+	}
+	p.thunk = nil
+	p.value = val
+	return val
+}
+
+// IsSimpleType is used to denote whether this object
+// is self-evaluating.
+func (p *Promise) IsSimpleType() bool {
+	return true
+}
+
+// ToString converts this object to a string.
+//
+// We include the address of the promise, so that two distinct promises
+// will not compare as equal via "eq".
+func (p *Promise) ToString() string {
+	return fmt.Sprintf("#<promise %p>", p)
+}
+
+// Type returns the type of this primitive object.
+func (p *Promise) Type() string {
+	return "promise"
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestBool(t *testing.T) {
@@ -257,3 +258,225 @@ func TestSymbol(t *testing.T) {
 	}
 
 }
+
+func TestHandle(t *testing.T) {
+
+	h := NewHandle("process", 3)
+	o := NewHandle("process", 3)
+
+	if !h.IsSimpleType() {
+		t.Fatalf("expected handle to be a simple type")
+	}
+	if h.Type() != "process" {
+		t.Fatalf("wrong type")
+	}
+	if !strings.HasPrefix(h.ToString(), "#<process ") {
+		t.Fatalf("handle->String had wrong result:%s", h.ToString())
+	}
+	if h.ToString() == o.ToString() {
+		t.Fatalf("distinct handles should have distinct strings")
+	}
+	if h.Value.(int) != 3 {
+		t.Fatalf("handle lost its value")
+	}
+}
+
+func TestTime(t *testing.T) {
+
+	tm := Time(time.Date(2023, time.March, 4, 5, 6, 7, 0, time.UTC))
+
+	if !tm.IsSimpleType() {
+		t.Fatalf("expected time to be a simple type")
+	}
+	if tm.Type() != "time" {
+		t.Fatalf("wrong type")
+	}
+	if tm.ToString() != "2023-03-04T05:06:07Z" {
+		t.Fatalf("time->String had wrong result:%s", tm.ToString())
+	}
+
+	// fractional seconds are shown, if present
+	tm = Time(time.Date(2023, time.March, 4, 5, 6, 7, 500000000, time.FixedZone("", 3600)))
+	if tm.ToString() != "2023-03-04T05:06:07.5+01:00" {
+		t.Fatalf("time->String had wrong result:%s", tm.ToString())
+	}
+
+	n, ok := tm.ToInterface().(time.Time)
+	if !ok {
+		t.Fatalf("failed to convert to native")
+	}
+	if n.Year() != 2023 {
+		t.Fatalf("native time had wrong value")
+	}
+}
+
+func TestValues(t *testing.T) {
+
+	v := Values{Number(1), String("two")}
+
+	if !v.IsSimpleType() {
+		t.Fatalf("expected values to be a simple type")
+	}
+	if v.Type() != "values" {
+		t.Fatalf("wrong type")
+	}
+	if v.ToString() != "1 two" {
+		t.Fatalf("values->String had wrong result:%s", v.ToString())
+	}
+	if v.First().ToString() != "1" {
+		t.Fatalf("wrong first value")
+	}
+	if !IsNil(Values{}.First()) {
+		t.Fatalf("expected no values to give nil")
+	}
+}
+
+func TestLazySeq(t *testing.T) {
+
+	// count the number of items computed
+	computed := 0
+
+	var from func(n int) func() Primitive
+	from = func(n int) func() Primitive {
+		return func() Primitive {
+			computed++
+			return LazyCons(Number(n), NewLazySeq(from(n+1)))
+		}
+	}
+
+	s := NewLazySeq(from(0))
+	if !s.IsSimpleType() {
+		t.Fatalf("expected a lazy sequence to be a simple type")
+	}
+	if s.Type() != "lazy-seq" {
+		t.Fatalf("wrong type")
+	}
+	if computed != 0 {
+		t.Fatalf("nothing should be computed yet")
+	}
+
+	first, rest, ok, err := s.Next()
+	if err != nil || !ok || first.ToString() != "0" {
+		t.Fatalf("wrong first item %v %v %v", first, ok, err)
+	}
+	if _, ok := rest.(*LazySeq); !ok {
+		t.Fatalf("expected the rest to be lazy, got %v", rest)
+	}
+
+	// Again is remembered
+	s.Next()
+	if computed != 1 {
+		t.Fatalf("expected one item to be computed, got %d", computed)
+	}
+
+	// Printing is limited
+	str := s.ToString()
+	if !strings.HasPrefix(str, "(0 1 2 ") || !strings.HasSuffix(str, " 99 ...)") {
+		t.Fatalf("lazy-seq->String had wrong result:%s", str)
+	}
+
+	// Lists, nil, errors, and chains of sequences
+	tests := []struct {
+		thunk  Primitive
+		output string
+	}{
+		{Nil{}, "()"},
+		{List{}, "()"},
+		{List{Number(1), Number(2)}, "(1 2)"},
+		{NewLazySeq(func() Primitive { return List{Number(3)} }), "(3)"},
+		{LazyCons(Number(1), List{Number(2)}), "(1 2)"},
+		{Error("bogus"), "(ERROR{bogus})"},
+		{Number(3), "(ERROR{a lazy sequence must produce a list, or a lazy sequence, got number 3})"},
+	}
+	for _, test := range tests {
+		s := NewLazySeq(func() Primitive { return test.thunk })
+		if s.ToString() != test.output {
+			t.Fatalf("expected %s, got %s", test.output, s.ToString())
+		}
+	}
+
+	// A long chain of sequences, which produce other sequences
+	var skip func(n int) func() Primitive
+	skip = func(n int) func() Primitive {
+		return func() Primitive {
+			if n == 0 {
+				return List{String("done")}
+			}
+			return NewLazySeq(skip(n - 1))
+		}
+	}
+	s = NewLazySeq(skip(1000000))
+	if s.ToString() != "(done)" {
+		t.Fatalf("wrong result for a chain of sequences:%s", s.ToString())
+	}
+
+	// A sequence which depends on itself
+	s = NewLazySeq(nil)
+	s.thunk = func() Primitive {
+		_, _, _, err := s.Next()
+		return Error(err.Error())
+	}
+	_, _, _, err = s.Next()
+	if err == nil || err.Error() != "lazy sequence depends upon itself" {
+		t.Fatalf("expected an error, got %v", err)
+	}
+
+	// SeqNext rejects anything else
+	_, _, _, err = SeqNext(Number(3))
+	if err == nil {
+		t.Fatalf("expected an error for a number")
+	}
+	first, rest, ok, err = SeqNext(List{Number(1)})
+	if err != nil || !ok || first.ToString() != "1" || !IsNil(rest) {
+		t.Fatalf("wrong result for a list %v %v %v %v", first, rest, ok, err)
+	}
+}
+
+func TestPromise(t *testing.T) {
+
+	calls := 0
+	p := NewPromise(func() Primitive {
+		calls++
+		return Number(calls)
+	})
+
+	if !p.IsSimpleType() {
+		t.Fatalf("expected a promise to be a simple type")
+	}
+	if p.Type() != "promise" {
+		t.Fatalf("wrong type")
+	}
+	if !strings.HasPrefix(p.ToString(), "#<promise ") {
+		t.Fatalf("promise->String had wrong result:%s", p.ToString())
+	}
+
+	// The value is computed once
+	if p.Force().ToString() != "1" || p.Force().ToString() != "1" {
+		t.Fatalf("expected the value to be remembered")
+	}
+
+	// Errors are not remembered
+	fail := true
+	p = NewPromise(func() Primitive {
+		if fail {
+			return Error("bogus")
+		}
+		return String("ok")
+	})
+	if p.Force().ToString() != "ERROR{bogus}" {
+		t.Fatalf("expected an error")
+	}
+	fail = false
+	if p.Force().ToString() != "ok" {
+		t.Fatalf("expected the promise to be retried")
+	}
+
+	// A promise which forces itself
+	p = NewPromise(nil)
+	p.thunk = func() Primitive {
+		return p.Force()
+	}
+	if p.Force().ToString() != "ERROR{promise depends upon itself}" {
+		t.Fatalf("expected an error")
+	}
+}
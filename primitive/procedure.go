@@ -1,11 +1,45 @@
 package primitive
 
-import "github.com/skx/yal/env"
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/skx/yal/env"
+)
 
 // GolangPrimitiveFn is the type which represents a function signature for
 // a lisp-usable function implemented in golang.
 type GolangPrimitiveFn func(e *env.Environment, args []Primitive) Primitive
 
+// Evaluator is the interface implemented by our interpreter, which allows
+// golang primitives to invoke procedures passed to them as arguments.
+type Evaluator interface {
+
+	// Apply calls the given procedure with the specified arguments,
+	// which will not be evaluated again.
+	Apply(e *env.Environment, proc *Procedure, args []Primitive) Primitive
+
+	// Context returns the context which limits the execution of
+	// the interpreter, so that long-running primitives may be
+	// interrupted.
+	Context() context.Context
+}
+
+// Scheduler may be implemented by an evaluator which allows lisp to run
+// on more than one goroutine, with only one of them running it at a time.
+type Scheduler interface {
+
+	// Go calls the given function on a new goroutine, once it is
+	// allowed to run lisp.
+	Go(fn func())
+
+	// Yield allows other goroutines to run lisp while the caller
+	// blocks.  The returned function must be called before the
+	// caller runs lisp, or touches the environment, again.
+	Yield() func()
+}
+
 // Procedure holds a user-defined function.
 //
 // This structure is used to hold both the built-in functions, implemented in
@@ -18,12 +52,32 @@ type Procedure struct {
 	// Defaults supplied when the procedure was defined
 	Defaults map[Symbol]Primitive
 
+	// Patterns holds the destructuring patterns of any arguments which
+	// are not plain symbols, indexed by the name used in Args.
+	Patterns map[Symbol]Primitive
+
+	// Optional records the arguments which were given after &optional,
+	// which may be omitted even if they have no default.
+	Optional map[Symbol]bool
+
+	// Keys holds the names of the keyword arguments, given after &key,
+	// which are supplied as ":name value" after the other arguments.
+	Keys []Symbol
+
+	// Supplied holds the name of the variable which is set to true, or
+	// false, to record whether an optional or keyword argument was given.
+	Supplied map[Symbol]Symbol
+
 	// Body is the body to execute, in the case where F is nil.
 	Body Primitive
 
 	// Env contains the environment within which this procedure is executed.
 	Env *env.Environment
 
+	// Loop is the scope of the innermost loop the procedure was defined
+	// within, which its body may (break) out of while it's running.
+	Loop *env.Environment
+
 	// F contains a pointer to the golang implementation of this procedure,
 	// if it is a native one.
 	F GolangPrimitiveFn
@@ -48,18 +102,55 @@ func (p *Procedure) ToString() string {
 	if p.F != nil {
 		return "#built-in-function"
 	}
-	args := List{}
-	for _, x := range p.Args {
-		args = append(args, x)
-	}
-
 	// might be a macro
 	first := "lambda"
 	if p.Macro {
 		first = "macro"
 	}
 
-	return "(" + first + " " + args.ToString() + " " + p.Body.ToString() + ")"
+	return "(" + first + " (" + p.Params() + ") " + p.Body.ToString() + ")"
+}
+
+// Params returns the parameters of this procedure as they would be written,
+// without the surrounding parenthesis, for use in help-output.
+func (p *Procedure) Params() string {
+
+	param := func(arg Symbol) string {
+		def, ok := p.Defaults[arg]
+		sup, ok2 := p.Supplied[arg]
+		if !ok && !ok2 {
+			return arg.ToString()
+		}
+		if !ok {
+			def = Nil{}
+		}
+		val := def.ToString()
+		if str, ok := def.(String); ok {
+			val = strconv.Quote(string(str))
+		}
+		out := "(" + arg.ToString() + " " + val
+		if ok2 {
+			out += " " + sup.ToString()
+		}
+		return out + ")"
+	}
+
+	params := []string{}
+	optional := false
+	for _, arg := range p.Args {
+		if p.Optional[arg] && !optional {
+			params = append(params, "&optional")
+			optional = true
+		}
+		params = append(params, param(arg))
+	}
+	if len(p.Keys) > 0 {
+		params = append(params, "&key")
+		for _, arg := range p.Keys {
+			params = append(params, param(arg))
+		}
+	}
+	return strings.Join(params, " ")
 }
 
 // Type returns the type of this primitive object.
@@ -73,3 +73,44 @@ func TestProcedure(t *testing.T) {
 		t.Fatalf("did not expect macro to be a simple type")
 	}
 }
+
+func TestProcedureParams(t *testing.T) {
+
+	p := Procedure{
+		Args: []Symbol{
+			Symbol("a"),
+			Symbol("b"),
+			Symbol("c"),
+			Symbol("&rest"),
+		},
+		Defaults: map[Symbol]Primitive{
+			Symbol("b"):       Number(3),
+			Symbol("method"):  String("GET"),
+			Symbol("timeout"): List{Symbol("*"), Symbol("b"), Number(2)},
+		},
+		Optional: map[Symbol]bool{
+			Symbol("b"): true,
+			Symbol("c"): true,
+		},
+		Keys: []Symbol{
+			Symbol("method"),
+			Symbol("timeout"),
+			Symbol("verbose"),
+		},
+		Supplied: map[Symbol]Symbol{
+			Symbol("c"):       Symbol("c?"),
+			Symbol("timeout"): Symbol("t?"),
+		},
+	}
+
+	out := p.Params()
+	if out != `a &optional (b 3) (c nil c?) &rest &key (method "GET") (timeout (* b 2) t?) verbose` {
+		t.Fatalf("wrong parameters, got %s", out)
+	}
+
+	// no parameters
+	n := Procedure{}
+	if n.Params() != "" {
+		t.Fatalf("expected no parameters, got %s", n.Params())
+	}
+}
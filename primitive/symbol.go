@@ -1,8 +1,25 @@
 package primitive
 
+import (
+	"fmt"
+	"sync/atomic"
+)
+
 // Symbol is the type for our symbols.
 type Symbol string
 
+// gensyms is the count of symbols created by Gensym.
+var gensyms atomic.Int64
+
+// Gensym returns a new symbol, based upon the given name, which is
+// unique.
+//
+// The symbol contains a space, so it can never be produced by the
+// reader, and cannot clash with any symbol in a program.
+func Gensym(name string) Symbol {
+	return Symbol(fmt.Sprintf("#<%s %d>", name, gensyms.Add(1)))
+}
+
 // IsSimpleType is used to denote whether this object
 // is self-evaluating.
 func (s Symbol) IsSimpleType() bool {
@@ -0,0 +1,29 @@
+package primitive
+
+import "time"
+
+// Time holds a point in time, along with its time zone.
+type Time time.Time
+
+// IsSimpleType is used to denote whether this object
+// is self-evaluating.
+func (t Time) IsSimpleType() bool {
+	return true
+}
+
+// ToInterface converts this object to a golang value
+func (t Time) ToInterface() any {
+	return time.Time(t)
+}
+
+// ToString converts this object to a string.
+//
+// We use RFC3339 format, with fractional seconds only if they're present.
+func (t Time) ToString() string {
+	return time.Time(t).Format(time.RFC3339Nano)
+}
+
+// Type returns the type of this primitive object.
+func (t Time) Type() string {
+	return "time"
+}
@@ -0,0 +1,37 @@
+package primitive
+
+import "strings"
+
+// Values holds multiple values, returned from a procedure by (values ..),
+// or from a golang primitive which returns more than one result.
+//
+// Anywhere a single value is expected only the first is used.
+type Values []Primitive
+
+// First returns the first of the values, or nil if there are none.
+func (v Values) First() Primitive {
+	if len(v) == 0 {
+		return Nil{}
+	}
+	return v[0]
+}
+
+// IsSimpleType is used to denote whether this object
+// is self-evaluating.
+func (v Values) IsSimpleType() bool {
+	return true
+}
+
+// ToString converts this object to a string.
+func (v Values) ToString() string {
+	elemStrings := []string{}
+	for _, e := range v {
+		elemStrings = append(elemStrings, e.ToString())
+	}
+	return strings.Join(elemStrings, " ")
+}
+
+// Type returns the type of this primitive object.
+func (v Values) Type() string {
+	return "values"
+}
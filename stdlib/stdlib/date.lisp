@@ -1,26 +1,26 @@
 ;;; date.lisp - Date-related functions.
 
-;; We have a built in function "date" to return the current date
-;; as a list (XXXX DD MM YYYY).
+;; We have a built in function "time:now" to return the current time,
+;; and accessors such as "time.day" to retrieve the fields of a time.
 ;;
 ;; Here we create some helper functions for retrieving the various
-;; parts of the date, as well as some aliases for ease of typing.
+;; parts of the current date, as well as some aliases for ease of typing.
 (set! date:day (fn* ()
                "Return the day of the current month, as an integer."
-               (nth (date) 1)))
+               (time.day (time:now))))
 
 (set! date:month (fn* ()
                  "Return the number of the current month, as an integer."
-                 (nth (date) 2)))
+                 (time.month (time:now))))
 
 
 (set! date:weekday (fn* ()
                    "Return a string containing the current day of the week."
-                   (nth (date) 0)))
+                   (time.weekday (time:now))))
 
 (set! date:year (fn* ()
                 "Return the current year, as an integer."
-                (nth (date) 3)))
+                (time.year (time:now))))
 
 
 ;;
@@ -36,16 +36,11 @@
 
 If the binary does not exist in a directory located upon the PATH nil will be returned.
 
-NOTE: This is a non-portable function!
-
-      1.  It assumes that the environmental variable PATH exists.
-      2.  It assumes $PATH can be split by ':'
-      3.  It assumes '/' works as a directory separator.
-"
-                 (let* (path (split (getenv "PATH") ":")
-                             res (filter path (lambda (dir) (exists? (join (list dir "/" binary))))))
+See also: path:join path:split-list"
+                 (let* (path (path:split-list (getenv "PATH"))
+                             res (filter path (lambda (dir) (exists? (path:join dir binary)))))
                    (if res
-                       (join (list (car res) "/" binary))))))
+                       (path:join (car res) binary)))))
 
 
 ;; Define a legacy alias
@@ -0,0 +1,82 @@
+;;; lazy.lisp - Functions for working with lazy sequences.
+
+;; A lazy sequence is created by (lazy-seq ..), or (generator ..), and its
+;; items are only computed when they are needed, so it may be infinite.
+;;
+;; car, cdr, cons, and nil? work upon lazy sequences, so most functions which
+;; expect a list will accept a (finite) lazy sequence too.  The functions
+;; here accept either, and return lazy sequences.
+
+(set! lazy-map (fn* (xs f:function)
+                    "Return a lazy sequence of the results of calling the given function on each item of the specified list, or lazy sequence.
+
+See-also: lazy-filter, map"
+                    (lazy-seq
+                     (if (nil? xs)
+                         nil
+                       (cons (f (car xs)) (lazy-map (cdr xs) f))))))
+
+(set! lazy-filter (fn* (xs f:function)
+                       "Return a lazy sequence of the items of the specified list, or lazy sequence, for which the given function returns true.
+
+See-also: filter, lazy-map"
+                       (lazy-seq
+                        (if (nil? xs)
+                            nil
+                          (if (f (car xs))
+                              (cons (car xs) (lazy-filter (cdr xs) f))
+                            (lazy-filter (cdr xs) f))))))
+
+(set! lazy-take (fn* (n:number xs)
+                     "Return a lazy sequence of the first N items of the specified list, or lazy sequence.
+
+See-also: lazy-drop, take"
+                     (lazy-seq
+                      (if (if (<= n 0) true (nil? xs))
+                          nil
+                        (cons (car xs) (lazy-take (- n 1) (cdr xs)))))))
+
+(set! lazy-drop (fn* (n:number xs)
+                     "Return a lazy sequence of the items of the specified list, or lazy sequence, after the first N.
+
+See-also: drop, lazy-take"
+                     (lazy-seq
+                      (if (if (<= n 0) true (nil? xs))
+                          xs
+                        (lazy-drop (- n 1) (cdr xs))))))
+
+(set! lazy-concat (fn* (xs ys)
+                       "Return a lazy sequence of the items of xs followed by those of ys, either of which may be a list, or lazy sequence."
+                       (lazy-seq
+                        (if (nil? xs)
+                            ys
+                          (cons (car xs) (lazy-concat (cdr xs) ys))))))
+
+(set! lazy-range (fn* (start:number &optional end (step 1))
+                      "Return a lazy sequence of the numbers from start to end, inclusive, incrementing by the given step each time.
+
+Without an end the sequence is infinite.
+
+See-also: range"
+                      (if (zero? step)
+                          (error "step must be non-zero")
+                        (lazy-seq
+                         (if (if (nil? end) false (if (> step 0) (> start end) (< start end)))
+                             nil
+                           (cons start (lazy-range (+ start step) end step)))))))
+
+(set! iterate (fn* (f:function x)
+                   "Return an infinite lazy sequence of x, (f x), (f (f x)), and so on."
+                   (lazy-seq
+                    (cons x (iterate f (f x))))))
+
+(set! cycle (fn* (xs)
+                 "Return an infinite lazy sequence which repeats the items of the specified list, or lazy sequence."
+                 (lazy-seq
+                  (if (nil? xs)
+                      nil
+                    (lazy-concat xs (cycle xs))))))
+
+(set! realize (fn* (xs)
+                   "Return a list of all the items of the specified lazy sequence, which must be finite."
+                   (reverse (reduce xs (lambda (acc x) (cons x acc)) nil))))
@@ -40,32 +40,40 @@ It is similar to an if-statement, however there is no provision for an 'else' cl
 ;;       (print "I got %d" n)
 ;;       (foo n)))
 ;;
+;; The variable may also be a destructuring pattern:
+;;
+;;   (loop (k v) '((:a 1) (:b 2))
+;;     (print "%s is %d" k v))
+;;
 (defmacro! loop (fn* (vr xs bdy)
                      "loop allows executing a block of code with a single variable bound to an item from the supplied list."
-                    (let* (inner-sym (gensym))
-                    `(list
-                       (let* (~inner-sym (fn* (~vr) (~@bdy)))
-                         (if (> (length ~xs) 0)
-                           (do
-                             (~inner-sym (car ~xs))
-                             (loop ~vr (cdr ~xs) ~bdy )
-                             )))))))
+                    (let* (inner-sym (gensym)
+                           lst-sym   (gensym)
+                           arg-sym   (gensym))
+                    `(let* (~inner-sym (fn* (~arg-sym) (let* (~vr ~arg-sym) (~@bdy)))
+                            ~lst-sym   ~xs)
+                       (while (! (nil? ~lst-sym))
+                         (~inner-sym (car ~lst-sym))
+                         (set! ~lst-sym (cdr ~lst-sym)))))))
 
 
 ;;
 ;; If the specified predicate is true, then run the body.
 ;;
-;; NOTE: This recurses, so it will eventually explode the stack.
+;; This recurses, but the recursive call is in tail position so it
+;; runs in constant space.  The name "again" is renamed by syntax-rules,
+;; so it cannot clash with any variable used in the body.
 ;;
-(defmacro! while (fn* (condition &body)
-                      "while is a macro which repeatedly runs the specified body, while the condition returns a true-result."
-                      (let* (inner-sym (gensym))
-                        `(let* (~inner-sym (fn* ()
-                                                (if ~condition
-                                                    (do
-                                                        ~@body
-                                                        (~inner-sym)))))
-                           (~inner-sym)))))
+(define-syntax while
+  "while is a macro which repeatedly runs the specified body, while the condition returns a true-result."
+  (syntax-rules ()
+    ((_ condition body ...)
+     (let* (again (fn* ()
+                       (if condition
+                           (do
+                               body ...
+                               (again)))))
+       (again)))))
 
 
 ;;
@@ -73,12 +81,14 @@ It is similar to an if-statement, however there is no provision for an 'else' cl
 ;;
 (defmacro! cond (fn* (&xs)
                      "cond is a macro which accepts a list of conditions and results, and returns the value of the first matching condition.  It is similar in functionality to a C case-statement."
-                     (if (> (length xs) 0)
-                         (list 'if (first xs)
-                               (if (> (length xs) 1)
-                                   (nth xs 1)
-                                 (error "An odd number of forms to (cond..)"))
-                               (cons 'cond (rest (rest xs)))))))
+                     (let* (clauses (fn* (xs)
+                                         (if (> (length xs) 0)
+                                             (list 'if (first xs)
+                                                   (if (> (length xs) 1)
+                                                       (nth xs 1)
+                                                     (error "An odd number of forms to (cond..)"))
+                                                   (clauses (rest (rest xs)))))))
+                       (clauses xs))))
 
 ;; A useful helper to apply a given function to each element of a list.
 (set! apply (fn* (lst:list fun:function)
@@ -123,13 +133,17 @@ Example: (apply-pairs (list 1 2 3 4) (lambda (a b) (print \"Called with %s %s\"
 (alias count length)
 
 
-(set! map (fn* (lst:list fun:function)
+(set! map (fn* (lst:list:lazy-seq fun:function)
                "Return a list with the contents of evaluating the given function on every item of the supplied list.
 
-See-also: map-pairs"
-               (if (nil? lst)
-                   ()
-                 (cons (fun (car lst)) (map (cdr lst) fun)))))
+Given a lazy sequence this returns a lazy sequence, as lazy-map does.
+
+See-also: lazy-map, map-pairs"
+               (if (lazy-seq? lst)
+                   (lazy-map lst fun)
+                 (if (nil? lst)
+                     ()
+                   (cons (fun (car lst)) (map (cdr lst) fun))))))
 
 (set! map-pairs (fn* (lst:list fun:function)
                "Return a list with the contents of evaluating the given function on every pair of items in the supplied list.
@@ -59,13 +59,20 @@ See-also: apply, apply-pairs"
 
 
 ;; Create ranges of numbers in a list
+;;
+;; The list is built in reverse, with a loop, so that large ranges
+;; don't exhaust the stack.
 (set! range (fn* (start:number end:number step:number)
                  "Create a list of numbers between the start and end bounds, inclusive, incrementing by the given offset each time."
                  (if (zero? step)
                      (error "step must be non-zero")
-                   (if (<= start end)
-                       (cons start (range (+ start step) end step))
-                     ()))))
+                   (let* (acc ())
+                     (while (<= start end)
+                       (set! acc (cons start acc))
+                       (set! start (+ start step)))
+                     (if (nil? acc)
+                         ()
+                       (reverse acc))))))
 
 ;; Create sequences from 0/1 to N
 (set! seq (fn* (n:number)
@@ -77,13 +84,17 @@ See-also: apply, apply-pairs"
 
 
 ;; Remove items from a list where the predicate function is not T
-(set! filter (fn* (xs:list f:function)
-                  "Remove any items from the specified list, if the result of calling the provided function on that item is not true."
-                  (if (nil? xs)
-                      ()
-                      (if (f (car xs))
-                          (cons (car xs)(filter (cdr xs) f))
-                          (filter (cdr xs) f)))))
+(set! filter (fn* (xs:list:lazy-seq f:function)
+                  "Remove any items from the specified list, if the result of calling the provided function on that item is not true.
+
+Given a lazy sequence this returns a lazy sequence, as lazy-filter does."
+                  (if (lazy-seq? xs)
+                      (lazy-filter xs f)
+                    (if (nil? xs)
+                        ()
+                        (if (f (car xs))
+                            (cons (car xs)(filter (cdr xs) f))
+                            (filter (cdr xs) f))))))
 
 
 
@@ -104,9 +115,7 @@ See-also: apply, apply-pairs"
 
 (set! reverse (fn* (l)
                    "Reverse the contents of the specified list."
-                   (if (nil? l)
-                       nil
-                     (append (reverse (cdr l)) (list (car l))))))
+                   (reduce l (lambda (acc x) (cons x acc)) nil)))
 
 
 ;; Get the first N items from a list.
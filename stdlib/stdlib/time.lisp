@@ -1,23 +1,23 @@
 ;;; time.lisp - Time related functions
 
 
-;; We have a built in function "time" to return the current time
-;; as a list (HH MM SS).
+;; We have a built in function "time:now" to return the current time,
+;; and accessors such as "time.hour" to retrieve the fields of a time.
 ;;
 ;; Here we create some helper functions for retrieving the various
-;; parts of the time, as well as some aliases for ease of typing.
+;; parts of the current time, as well as some aliases for ease of typing.
 
 (set! time:hour (fn* ()
                      "Return the current hour, as an integer."
-                     (nth (time) 0)))
+                     (time.hour (time:now))))
 
 (set! time:minute (fn* ()
                        "Return the current minute, as an integer."
-                       (nth (time) 1)))
+                       (time.minute (time:now))))
 
 (set! time:second (fn* ()
                        "Return the current seconds, as an integer."
-                       (nth (time) 2)))
+                       (time.second (time:now))))
 
 ;; define legacy aliases
 (alias hour time:hour
@@ -27,8 +27,10 @@
 
 (set! time:hms (fn* ()
                "Return the current time as a string, formatted as 'HH:MM:SS'."
-               (sprintf "%02d:%02d:%02d"
-                        (hour)
-                        (minute)
-                        (second))))
+               (time:format (time:now) "%H:%M:%S")))
 (alias hms time:hms)
+
+
+;; "after" is a shorter name for timer:after.  There is no such name for
+;; timer:every, as "every" tests each item of a list.
+(alias after timer:after)
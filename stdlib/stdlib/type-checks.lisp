@@ -25,6 +25,10 @@
                      "Returns true if the argument specified is a macro."
                      (eq (type x) "macro")))
 
+(set! lazy-seq? (fn* (x)
+                     "Returns true if the argument specified is a lazy sequence."
+                     (eq (type x) "lazy-seq")))
+
 (set! list?     (fn* (x)
                      "Returns true if the argument specified is a list."
                      (eq (type x) "list")))
@@ -33,6 +37,10 @@
                      "Returns true if the argument specified is a number."
                      (eq (type x) "number")))
 
+(set! promise?  (fn* (x)
+                     "Returns true if the argument specified is a promise, created by delay."
+                     (eq (type x) "promise")))
+
 (set! string?   (fn* (x)
                      "Returns true if the argument specified is a string."
                      (eq (type x) "string")))
@@ -41,6 +49,10 @@
                      "Returns true if the argument specified is a character."
                      (eq (type x) "character")))
 
+(set! time?     (fn* (x)
+                     "Returns true if the argument specified is a time."
+                     (eq (type x) "time")))
+
 (set! symbol?   (fn* (x)
                      "Returns true if the argument specified is a symbol."
                      (eq (type x) "symbol")))